@@ -1,17 +1,23 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/mihaisavezi/claude-code-open/internal/process"
+	"github.com/mihaisavezi/claude-code-open/internal/handlers"
 )
 
+// customHeadersEnv holds extra "Name: value" headers, one per line, that Claude Code
+// sends with every request
+const customHeadersEnv = "ANTHROPIC_CUSTOM_HEADERS"
+
 var codeCmd = &cobra.Command{
 	Use:   "code [args...]",
 	Short: "Execute Claude Code via the router service",
@@ -20,8 +26,28 @@ var codeCmd = &cobra.Command{
 	RunE:  runCode,
 }
 
+func init() {
+	codeCmd.Flags().String("provider", "", "Provider to use for this session, bypassing the router (requires --model)")
+	codeCmd.Flags().StringP("model", "m", "", "Model to use for this session, as \"model\" with --provider or \"provider,model\"")
+}
+
 func runCode(cmd *cobra.Command, args []string) error {
-	procMgr := process.NewManager(baseDir)
+	provider, err := cmd.Flags().GetString("provider")
+	if err != nil {
+		return err
+	}
+
+	model, err := cmd.Flags().GetString("model")
+	if err != nil {
+		return err
+	}
+
+	modelOverride, err := buildModelOverride(provider, model)
+	if err != nil {
+		return err
+	}
+
+	procMgr := newProcessManager()
 	cfg := cfgMgr.Get()
 
 	// Ensure service is running and track if we started it
@@ -47,6 +73,13 @@ func runCode(cmd *cobra.Command, args []string) error {
 	env = append(env, "ANTHROPIC_BASE_URL=http://"+cfg.Host+":"+strconv.Itoa(cfg.Port))
 	env = append(env, "API_TIMEOUT_MS=600000")
 
+	// Pin every request of this session to the chosen model via the proxy's override header
+	if modelOverride != "" {
+		env = setCustomHeader(env, handlers.ModelOverrideHeader, modelOverride)
+
+		color.Green("Using %s for this session", modelOverride)
+	}
+
 	// Track reference count
 	procMgr.IncrementRef()
 
@@ -72,6 +105,49 @@ func runCode(cmd *cobra.Command, args []string) error {
 	return claudeCmd.Run()
 }
 
+// buildModelOverride combines the --provider and --model flags into a "provider,model" override
+func buildModelOverride(provider, model string) (string, error) {
+	provider = strings.TrimSpace(provider)
+	model = strings.TrimSpace(model)
+
+	switch {
+	case provider == "" && model == "":
+		return "", nil
+	case model == "":
+		return "", errors.New("--provider requires --model")
+	case provider != "":
+		return provider + "," + model, nil
+	case strings.Contains(model, ","):
+		return model, nil
+	default:
+		return "", fmt.Errorf("--model %q needs a provider: use --provider or \"provider,model\"", model)
+	}
+}
+
+// setCustomHeader adds a header to ANTHROPIC_CUSTOM_HEADERS, replacing any earlier value
+// for the same header and keeping the others
+func setCustomHeader(env []string, name, value string) []string {
+	var lines []string
+
+	prefix := customHeadersEnv + "="
+	for _, e := range env {
+		if !startsWith(e, prefix) {
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimPrefix(e, prefix), "\n") {
+			key, _, _ := strings.Cut(line, ":")
+			if strings.TrimSpace(line) != "" && !strings.EqualFold(strings.TrimSpace(key), name) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	lines = append(lines, name+": "+value)
+
+	return append(filterEnv(env, customHeadersEnv), prefix+strings.Join(lines, "\n"))
+}
+
 func filterEnv(env []string, key string) []string {
 	var filtered []string
 
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/handlers"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestBuildModelOverride(t *testing.T) {
+	testCases := []struct {
+		provider string
+		model    string
+		expected string
+		wantErr  bool
+	}{
+		{"", "", "", false},
+		{"openrouter", "qwen/qwen3-coder", "openrouter,qwen/qwen3-coder", false},
+		{"", "openai,gpt-4o", "openai,gpt-4o", false},
+		{"openai", "", "", true},
+		{"", "gpt-4o", "", true},
+	}
+
+	for _, tc := range testCases {
+		override, err := buildModelOverride(tc.provider, tc.model)
+		if tc.wantErr {
+			assert.Error(t, err, "provider=%q model=%q", tc.provider, tc.model)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, override)
+	}
+}
+
+func TestSetCustomHeader_KeepsOtherHeaders(t *testing.T) {
+	env := []string{
+		"HOME=/home/user",
+		customHeadersEnv + "=X-Team: platform\nx-cco-model: old,model",
+	}
+
+	env = setCustomHeader(env, handlers.ModelOverrideHeader, "openai,gpt-4o")
+
+	var headers []string
+
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, customHeadersEnv+"="); ok {
+			headers = append(headers, value)
+		}
+	}
+
+	require.Len(t, headers, 1, "the variable should be set exactly once")
+	assert.Equal(t, "X-Team: platform\nX-CCO-Model: openai,gpt-4o", headers[0])
+	assert.Contains(t, env, "HOME=/home/user")
+}
+
+func TestCodeModelOverride_ReachesRouting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamModel string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &request)
+		upstreamModel, _ = request["model"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+		Router: config.RouterConfig{Default: "openrouter,anthropic/claude-sonnet-4"},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	proxy := handlers.NewProxyHandler(cfgMgr, registry, logger)
+
+	override, err := buildModelOverride("openai", "gpt-4o")
+	require.NoError(t, err)
+
+	// Send the headers Claude Code would derive from the session environment
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+
+	for _, e := range setCustomHeader(nil, handlers.ModelOverrideHeader, override) {
+		value := strings.TrimPrefix(e, customHeadersEnv+"=")
+		for _, line := range strings.Split(value, "\n") {
+			name, headerValue, _ := strings.Cut(line, ":")
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "gpt-4o", upstreamModel, "the override should win over the router default")
+}
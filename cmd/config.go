@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"strings"
 
@@ -22,8 +24,9 @@ var configCmd = &cobra.Command{
 var configInitCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize configuration interactively",
-	Long:  `Initialize configuration by prompting for provider details.`,
-	RunE:  runConfigInit,
+	Long: `Initialize configuration by prompting for provider details, or with --template write a
+commented starter configuration covering every provider, with ${ENV} placeholders for keys.`,
+	RunE: runConfigInit,
 }
 
 var configShowCmd = &cobra.Command{
@@ -53,64 +56,122 @@ func init() {
 	configCmd.AddCommand(configValidateCmd)
 	configCmd.AddCommand(configGenerateCmd)
 
+	configInitCmd.Flags().Bool("template", false, "Write a commented starter configuration instead of prompting")
+	configInitCmd.Flags().BoolP("force", "f", false, "Overwrite an existing configuration file (with --template)")
+
 	// Add flags for generate command
 	configGenerateCmd.Flags().BoolP("force", "f", false, "Overwrite existing configuration file")
 }
 
 func runConfigInit(cmd *cobra.Command, _ []string) error {
+	template, err := cmd.Flags().GetBool("template")
+	if err != nil {
+		return err
+	}
+
+	if template {
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		return writeStarterTemplate(force)
+	}
+
 	color.Blue("Claude Code Router Configuration Setup")
 	color.Yellow("Follow the prompts to configure your LLM providers.")
 
 	reader := bufio.NewReader(os.Stdin)
 
-	// Get provider details
-	fmt.Print("\nProvider Name (e.g., openrouter, openai): ")
-
-	providerName, err := reader.ReadString('\n')
+	cfg, err := promptInitConfig(reader, os.Stdout)
 	if err != nil {
-		return fmt.Errorf("error reading provider name: %w", err)
+		return err
 	}
 
-	providerName = strings.TrimSpace(providerName)
+	provider := cfg.Providers[0]
 
-	fmt.Print("API Key: ")
+	fmt.Println()
+	fmt.Printf("  %-15s: %s\n", "Provider", provider.Name)
+	fmt.Printf("  %-15s: %s\n", "URL", provider.APIBase)
+	fmt.Printf("  %-15s: %s\n", "API Key", maskString(provider.APIKey))
+	fmt.Printf("  %-15s: %s\n", "Default Model", cfg.Router.Default)
 
-	apiKey, err := reader.ReadString('\n')
+	save, err := promptConfirm(reader, os.Stdout, fmt.Sprintf("Save configuration to %s? [Y/n]: ", cfgMgr.GetPath()))
 	if err != nil {
-		return fmt.Errorf("error reading API key: %w", err)
+		return fmt.Errorf("error reading confirmation: %w", err)
+	}
+
+	if !save {
+		color.Yellow("Configuration not saved.")
+		return nil
+	}
+
+	// Save configuration
+	if err := cfgMgr.Save(cfg); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
 	}
 
-	apiKey = strings.TrimSpace(apiKey)
+	color.Green("Configuration saved successfully to: %s", cfgMgr.GetPath())
+	color.Cyan("You can now start the router with: cco start")
 
-	fmt.Print("API Base URL: ")
+	return nil
+}
 
-	baseURL, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("error reading base URL: %w", err)
+// writeStarterTemplate writes the commented starter configuration, refusing to replace an
+// existing configuration unless forced
+func writeStarterTemplate(force bool) error {
+	if cfgMgr.Exists() && !force {
+		color.Yellow("Configuration file already exists: %s", cfgMgr.GetPath())
+		color.Cyan("Use --force to overwrite, or 'cco config show' to view current config")
+
+		return nil
+	}
+
+	if err := cfgMgr.WriteStarterTemplate(); err != nil {
+		return fmt.Errorf("failed to write starter configuration: %w", err)
 	}
 
-	baseURL = strings.TrimSpace(baseURL)
+	color.Green("Starter configuration created: %s", cfgMgr.GetYAMLPath())
+	color.Cyan("\nNext steps:")
+	fmt.Println("1. Export the API keys of the providers you use (e.g. OPENROUTER_API_KEY)")
+	fmt.Println("2. Remove the providers you don't use and adjust the router")
+	fmt.Println("3. Run 'cco config validate' to check your configuration")
+	fmt.Println("4. Start the router with 'cco start'")
+
+	return nil
+}
+
+// promptInitConfig asks for the provider details, repeating each prompt until the answer is valid
+func promptInitConfig(reader *bufio.Reader, out io.Writer) (*config.Config, error) {
+	fmt.Fprint(out, "\n")
 
-	fmt.Print("Default Model: ")
+	providerName, err := promptValue(reader, out, "Provider Name (e.g., openrouter, openai): ", validateProviderName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provider name: %w", err)
+	}
 
-	model, err := reader.ReadString('\n')
+	apiKey, err := promptValue(reader, out, "API Key: ", nil)
 	if err != nil {
-		return fmt.Errorf("error reading model: %w", err)
+		return nil, fmt.Errorf("error reading API key: %w", err)
 	}
 
-	model = strings.TrimSpace(model)
+	baseURL, err := promptValue(reader, out, "API Base URL: ", validateBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error reading base URL: %w", err)
+	}
 
-	// Optional router API key
-	fmt.Print("Router API Key (optional, for authentication): ")
+	model, err := promptValue(reader, out, "Default Model: ", validateModelName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading model: %w", err)
+	}
 
-	routerAPIKey, err := reader.ReadString('\n')
+	// Optional router API key
+	routerAPIKey, err := promptValue(reader, out, "Router API Key (optional, for authentication): ", nil)
 	if err != nil {
-		return fmt.Errorf("error reading router API key: %w", err)
+		return nil, fmt.Errorf("error reading router API key: %w", err)
 	}
-	routerAPIKey = strings.TrimSpace(routerAPIKey)
 
-	// Create configuration
-	cfg := &config.Config{
+	return &config.Config{
 		Host:   config.DefaultHost,
 		Port:   config.DefaultPort,
 		APIKey: routerAPIKey,
@@ -125,15 +186,95 @@ func runConfigInit(cmd *cobra.Command, _ []string) error {
 		Router: config.RouterConfig{
 			Default: fmt.Sprintf("%s,%s", providerName, model),
 		},
+	}, nil
+}
+
+// promptValue prints the prompt and reads a trimmed line, asking again while validate
+// rejects it. A nil validate accepts anything, including an empty answer.
+func promptValue(reader *bufio.Reader, out io.Writer, prompt string, validate func(string) error) (string, error) {
+	for {
+		fmt.Fprint(out, prompt)
+
+		line, err := reader.ReadString('\n')
+		value := strings.TrimSpace(line)
+
+		// A last line without a newline still counts as an answer
+		if err != nil && (!errors.Is(err, io.EOF) || value == "") {
+			return "", err
+		}
+
+		if validate == nil {
+			return value, nil
+		}
+
+		validationErr := validate(value)
+		if validationErr == nil {
+			return value, nil
+		}
+
+		// There is no more input to retry with
+		if err != nil {
+			return "", validationErr
+		}
+
+		color.New(color.FgRed).Fprintf(out, "Invalid value: %v\n", validationErr)
 	}
+}
 
-	// Save configuration
-	if err := cfgMgr.Save(cfg); err != nil {
-		return fmt.Errorf("failed to save configuration: %w", err)
+// promptConfirm asks a yes/no question; an empty answer means yes
+func promptConfirm(reader *bufio.Reader, out io.Writer, prompt string) (bool, error) {
+	var confirmed bool
+
+	_, err := promptValue(reader, out, prompt, func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "", "y", "yes":
+			confirmed = true
+		case "n", "no":
+			confirmed = false
+		default:
+			return errors.New("please answer y or n")
+		}
+
+		return nil
+	})
+
+	return confirmed, err
+}
+
+func validateProviderName(name string) error {
+	if name == "" {
+		return errors.New("provider name is required")
 	}
 
-	color.Green("Configuration saved successfully to: %s", cfgMgr.GetPath())
-	color.Cyan("You can now start the router with: cco start")
+	// The name is the prefix of "provider,model" references
+	if strings.ContainsAny(name, ", \t") {
+		return fmt.Errorf("provider name %q must not contain commas or spaces", name)
+	}
+
+	return nil
+}
+
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return errors.New("API base URL is required")
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL, e.g. https://api.openai.com/v1/chat/completions", baseURL)
+	}
+
+	return nil
+}
+
+func validateModelName(model string) error {
+	if model == "" {
+		return errors.New("model is required")
+	}
 
 	return nil
 }
@@ -217,30 +358,7 @@ func runConfigValidate(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Validation logic
-	var validationErrors []string
-
-	if len(cfg.Providers) == 0 {
-		validationErrors = append(validationErrors, "no providers configured")
-	}
-
-	for i, provider := range cfg.Providers {
-		if provider.Name == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: name is required", i))
-		}
-
-		if provider.APIBase == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: API base URL is required", i))
-		}
-
-		if provider.APIKey == "" {
-			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: API key is required", i))
-		}
-	}
-
-	if cfg.Router.Default == "" {
-		validationErrors = append(validationErrors, "default router model is required")
-	}
+	validationErrors := cfg.Validate()
 
 	if len(validationErrors) > 0 {
 		color.Red("Configuration validation failed:")
@@ -288,12 +406,15 @@ func runConfigGenerate(cmd *cobra.Command, _ []string) error {
 	fmt.Println("3. Run 'cco config validate' to check your configuration")
 	fmt.Println("4. Start the router with 'cco start'")
 
-	color.Yellow("\nNote: The configuration includes all 5 supported providers:")
+	color.Yellow("\nNote: The configuration includes all 8 supported providers:")
 	fmt.Println("- OpenRouter (access to multiple models)")
 	fmt.Println("- OpenAI (GPT models)")
 	fmt.Println("- Anthropic (Claude models)")
 	fmt.Println("- Nvidia (Nemotron models)")
 	fmt.Println("- Google Gemini (Gemini models)")
+	fmt.Println("- Fireworks AI (open-weight models)")
+	fmt.Println("- Together AI (open-weight models)")
+	fmt.Println("- LM Studio (local models, no API key)")
 
 	return nil
 }
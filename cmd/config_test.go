@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestPromptInitConfig_RepromptsInvalidInput(t *testing.T) {
+	input := strings.Join([]string{
+		"   ",               // empty provider name
+		"open router",       // contains a space
+		"openrouter",        // valid
+		"sk-or-key",         // API key
+		"",                  // empty URL
+		"openrouter.ai/api", // no scheme
+		"https://openrouter.ai/api/v1/chat/completions",
+		"",                 // empty model
+		"qwen/qwen3-coder", // valid
+		"",                 // no router key
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+
+	cfg, err := promptInitConfig(bufio.NewReader(strings.NewReader(input)), &out)
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Providers, 1)
+	assert.Equal(t, "openrouter", cfg.Providers[0].Name)
+	assert.Equal(t, "sk-or-key", cfg.Providers[0].APIKey)
+	assert.Equal(t, "https://openrouter.ai/api/v1/chat/completions", cfg.Providers[0].APIBase)
+	assert.Equal(t, []string{"qwen/qwen3-coder"}, cfg.Providers[0].Models)
+	assert.Equal(t, "openrouter,qwen/qwen3-coder", cfg.Router.Default)
+	assert.Empty(t, cfg.APIKey)
+
+	assert.Equal(t, 3, strings.Count(out.String(), "Provider Name"))
+	assert.Equal(t, 3, strings.Count(out.String(), "API Base URL"))
+	assert.Equal(t, 2, strings.Count(out.String(), "Default Model"))
+	assert.Contains(t, out.String(), "provider name is required")
+	assert.Contains(t, out.String(), "is not an http(s) URL")
+	assert.Contains(t, out.String(), "model is required")
+}
+
+func TestPromptInitConfig_InputEndsBeforeValidAnswer(t *testing.T) {
+	var out bytes.Buffer
+
+	_, err := promptInitConfig(bufio.NewReader(strings.NewReader("openai\nkey\nnot a url")), &out)
+	require.Error(t, err, "running out of input must not loop or produce a broken config")
+	assert.Contains(t, err.Error(), "base URL")
+}
+
+func TestPromptConfirm(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected bool
+		prompts  int
+	}{
+		{"\n", true, 1},
+		{"y\n", true, 1},
+		{"No\n", false, 1},
+		{"maybe\nn\n", false, 2},
+	}
+
+	for _, tc := range testCases {
+		var out bytes.Buffer
+
+		confirmed, err := promptConfirm(bufio.NewReader(strings.NewReader(tc.input)), &out, "Save? [Y/n]: ")
+		require.NoError(t, err, "input %q", tc.input)
+		assert.Equal(t, tc.expected, confirmed, "input %q", tc.input)
+		assert.Equal(t, tc.prompts, strings.Count(out.String(), "Save?"), "input %q", tc.input)
+	}
+
+	_, err := promptConfirm(bufio.NewReader(strings.NewReader("")), &bytes.Buffer{}, "Save? [Y/n]: ")
+	assert.Error(t, err, "no answer at all is not a confirmation")
+}
+
+func TestStarterTemplate_LoadsAndValidates(t *testing.T) {
+	keys := []string{
+		"OPENROUTER_API_KEY", "OPENAI_API_KEY", "ANTHROPIC_API_KEY", "NVIDIA_API_KEY",
+		"GEMINI_API_KEY", "FIREWORKS_API_KEY", "TOGETHER_API_KEY",
+	}
+
+	t.Setenv("CCO_API_KEY", "")
+
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+
+	mgr := config.NewManager(t.TempDir())
+	require.NoError(t, mgr.WriteStarterTemplate())
+
+	cfg, err := mgr.Load()
+	require.NoError(t, err, "the starter template must parse")
+
+	// Only the unset key placeholders are reported
+	problems := cfg.Validate()
+	assert.Len(t, problems, len(keys))
+
+	for _, problem := range problems {
+		assert.Contains(t, problem, "API key is required")
+	}
+
+	for _, key := range keys {
+		t.Setenv(key, "key-"+strings.ToLower(key))
+	}
+
+	cfg, err = mgr.Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Validate())
+
+	byName := make(map[string]config.Provider)
+	for _, provider := range cfg.Providers {
+		byName[provider.Name] = provider
+	}
+
+	assert.Equal(t, "key-openrouter_api_key", byName["openrouter"].APIKey)
+	assert.Equal(t, config.DefaultProviderURLs["gemini"], byName["gemini"].APIBase)
+
+	// Every router bucket names a provider of the template
+	for _, route := range []string{cfg.Router.Default, cfg.Router.Think, cfg.Router.Background, cfg.Router.LongContext, cfg.Router.WebSearch} {
+		providerName, _, found := strings.Cut(route, ",")
+		require.True(t, found, "route %q should use the provider,model format", route)
+		assert.Contains(t, byName, providerName, "route %q", route)
+	}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "Inspect provider implementations",
+	Long:  `Inspect the built-in provider implementations and how configured providers map to them.`,
+}
+
+var providersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List built-in providers",
+	Long:  `List the built-in provider implementations with their default endpoint and streaming support, and the configured providers that map to each.`,
+	RunE:  runProvidersList,
+}
+
+var providersTestStreamCmd = &cobra.Command{
+	Use:   "test-stream <provider> <file>",
+	Short: "Convert a recorded provider stream to Anthropic events",
+	Long: `Read a provider's SSE stream recorded to a file (or - for stdin), run it through the
+provider's stream conversion like the proxy does, and print the resulting Anthropic events.
+Useful for debugging streaming conversion without live calls.`,
+	Example: `  curl -sN https://api.openai.com/v1/chat/completions ... > stream.sse
+  cco providers test-stream openai stream.sse`,
+	Args: cobra.ExactArgs(2),
+	RunE: runProvidersTestStream,
+}
+
+// ProviderInfo describes a built-in provider implementation
+type ProviderInfo struct {
+	Name       string
+	Endpoint   string
+	Streaming  bool
+	Configured []string // configured providers whose URL resolves to this implementation
+}
+
+func init() {
+	providersCmd.AddCommand(providersListCmd)
+	providersCmd.AddCommand(providersTestStreamCmd)
+}
+
+func runProvidersList(cmd *cobra.Command, _ []string) error {
+	var cfg *config.Config
+
+	if cfgMgr.Exists() {
+		loaded, err := cfgMgr.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		cfg = loaded
+	}
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	builtIn, unmapped := buildProviderList(registry, cfg)
+	printProviderList(os.Stdout, builtIn, unmapped)
+
+	return nil
+}
+
+// buildProviderList describes every registered provider, sorted by name, along with
+// the configured providers that resolve to it the way the proxy resolves them (by URL).
+// Configured providers with no matching implementation are returned separately.
+func buildProviderList(registry *providers.Registry, cfg *config.Config) ([]ProviderInfo, []string) {
+	var unmapped []string
+
+	configured := make(map[string][]string)
+
+	if cfg != nil {
+		registry.SetDomainMappings(cfg.DomainMappings)
+
+		for _, provider := range cfg.Providers {
+			implementation, err := registry.GetByDomain(provider.APIBase)
+			if err != nil {
+				unmapped = append(unmapped, provider.Name)
+				continue
+			}
+
+			configured[implementation.Name()] = append(configured[implementation.Name()], provider.Name)
+		}
+	}
+
+	names := registry.List()
+	slices.Sort(names)
+
+	infos := make([]ProviderInfo, 0, len(names))
+
+	for _, name := range names {
+		provider, _ := registry.Get(name)
+
+		endpoint := provider.GetEndpoint()
+		if endpoint == "" {
+			endpoint = config.DefaultProviderURLs[name]
+		}
+
+		infos = append(infos, ProviderInfo{
+			Name:       name,
+			Endpoint:   endpoint,
+			Streaming:  provider.SupportsStreaming(),
+			Configured: configured[name],
+		})
+	}
+
+	return infos, unmapped
+}
+
+func printProviderList(out io.Writer, infos []ProviderInfo, unmapped []string) {
+	color.New(color.FgBlue).Fprintln(out, "Built-in providers:")
+
+	for _, info := range infos {
+		streaming := "no"
+		if info.Streaming {
+			streaming = "yes"
+		}
+
+		configured := "-"
+		if len(info.Configured) > 0 {
+			configured = strings.Join(info.Configured, ", ")
+		}
+
+		fmt.Fprintf(out, "  - Name: %s\n", info.Name)
+		fmt.Fprintf(out, "    Endpoint: %s\n", info.Endpoint)
+		fmt.Fprintf(out, "    Streaming: %s\n", streaming)
+		fmt.Fprintf(out, "    Configured: %s\n", configured)
+	}
+
+	if len(unmapped) > 0 {
+		color.New(color.FgYellow).Fprintf(out, "\nConfigured providers without a matching implementation: %s\n", strings.Join(unmapped, ", "))
+		fmt.Fprintln(out, "Use a known provider URL or add a domain_mappings entry for them.")
+	}
+}
+
+func runProvidersTestStream(cmd *cobra.Command, args []string) error {
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	provider, ok := registry.Get(args[0])
+	if !ok {
+		names := registry.List()
+		slices.Sort(names)
+
+		return fmt.Errorf("unknown provider '%s' (available: %s)", args[0], strings.Join(names, ", "))
+	}
+
+	in := cmd.InOrStdin()
+
+	if args[1] != "-" {
+		file, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open stream recording: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		in = file
+	}
+
+	return replayStream(cmd.OutOrStdout(), provider, in)
+}
+
+// replayStream feeds a recorded SSE stream to the provider's TransformStream with
+// providers.ProcessSSEStream, the way the proxy does, and prints only the converted Anthropic
+// events. It stops at the first event that fails to convert.
+func replayStream(out io.Writer, provider providers.Provider, in io.Reader) error {
+	events, err := providers.ProcessSSEStream(in, provider)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+		}
+
+		if _, err := fmt.Fprintf(out, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestBuildProviderList_IncludesBuiltInProviders(t *testing.T) {
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	cfg := &config.Config{
+		Providers: []config.Provider{
+			{Name: "openrouter", APIBase: "https://openrouter.ai/api/v1/chat/completions"},
+			{Name: "work-gateway", APIBase: "https://gateway.example.com/v1/chat/completions"},
+			{Name: "mystery", APIBase: "https://llm.example.org/v1/chat/completions"},
+		},
+		DomainMappings: map[string]string{"gateway.example.com": "openai"},
+	}
+
+	infos, unmapped := buildProviderList(registry, cfg)
+
+	byName := make(map[string]ProviderInfo)
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+
+	for _, name := range []string{"anthropic", "fireworks", "gemini", "lmstudio", "nvidia", "openai", "openrouter", "together"} {
+		info, ok := byName[name]
+		require.True(t, ok, "built-in provider %s should be listed", name)
+		assert.NotEmpty(t, info.Endpoint, "provider %s should have a default endpoint", name)
+		assert.True(t, info.Streaming, "provider %s supports streaming", name)
+	}
+
+	assert.Equal(t, []string{"openrouter"}, byName["openrouter"].Configured)
+	assert.Equal(t, []string{"work-gateway"}, byName["openai"].Configured)
+	assert.Equal(t, []string{"mystery"}, unmapped)
+
+	var out bytes.Buffer
+	printProviderList(&out, infos, unmapped)
+	assert.Contains(t, out.String(), "Name: together")
+	assert.Contains(t, out.String(), "Configured: work-gateway")
+	assert.Contains(t, out.String(), "without a matching implementation: mystery")
+}
+
+func TestReplayStream_OpenAIRecording(t *testing.T) {
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	provider, ok := registry.Get("openai")
+	require.True(t, ok)
+
+	recording, err := os.Open("testdata/openai_stream.sse")
+	require.NoError(t, err)
+	defer recording.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, replayStream(&out, provider, recording))
+
+	var events []string
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if event, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, event)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	}, events)
+
+	assert.Contains(t, out.String(), `"text":"Hello"`)
+	assert.Contains(t, out.String(), `"stop_reason":"end_turn"`)
+	assert.Contains(t, out.String(), `"output_tokens":2`)
+	assert.NotContains(t, out.String(), "[DONE]")
+}
+
+func TestReplayStream_ReportsFailingEvent(t *testing.T) {
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	provider, _ := registry.Get("openai")
+
+	err := replayStream(&bytes.Buffer{}, provider, strings.NewReader("data: {not json\n\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "event 1 failed to convert")
+	assert.Contains(t, err.Error(), "{not json")
+}
+
+func TestReplayStream_PrintsOnlyConvertedEvents(t *testing.T) {
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	provider, _ := registry.Get("openai")
+
+	recording := "event: chunk\nid: 1\n" +
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"stop"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	require.NoError(t, replayStream(&out, provider, strings.NewReader(recording)))
+
+	assert.NotContains(t, out.String(), "event: chunk")
+	assert.NotContains(t, out.String(), "id: 1")
+	assert.Contains(t, out.String(), "event: message_stop")
+}
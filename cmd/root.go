@@ -11,19 +11,30 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/process"
 )
 
 const (
 	AppName    = "claude-code-open"
 	OldAppName = "claude-code-router" // For backward compatibility
-	Version    = "0.3.0"
+)
+
+// Build metadata, set at build time with -ldflags "-X .../cmd.Version=..."
+var (
+	Version   = "0.3.0"
+	Commit    = "unknown"
+	BuildDate = "unknown"
 )
 
 var (
 	logger  *slog.Logger
 	homeDir string
 	baseDir string
+	profile string
 	cfgMgr  *config.Manager
+
+	// configFile is the config given with --config, if any
+	configFile string
 )
 
 func init() {
@@ -47,10 +58,83 @@ func init() {
 }
 
 var rootCmd = &cobra.Command{
-	Use:     "cco",
-	Short:   "Claude Code Open - LLM Proxy Server",
-	Long:    `A production-ready LLM proxy server that converts requests from various providers to Anthropic's Claude API format.`,
-	Version: Version,
+	Use:               "cco",
+	Short:             "Claude Code Open - LLM Proxy Server",
+	Long:              `A production-ready LLM proxy server that converts requests from various providers to Anthropic's Claude API format.`,
+	Version:           Version,
+	PersistentPreRunE: setupProfile,
+}
+
+// setupProfile switches the config manager to the selected config file or profile. A file
+// comes from --config or the CCO_CONFIG (or legacy CCR_CONFIG) environment variable, a
+// profile from --profile or CCO_PROFILE (or CCR_PROFILE).
+func setupProfile(cmd *cobra.Command, _ []string) error {
+	name, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = os.Getenv("CCO_PROFILE")
+	}
+
+	if name == "" {
+		name = os.Getenv("CCR_PROFILE")
+	}
+
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		path = os.Getenv("CCO_CONFIG")
+	}
+
+	if path == "" {
+		path = os.Getenv("CCR_CONFIG")
+	}
+
+	if path != "" {
+		if name != "" {
+			return errors.New("--config and --profile cannot be used together")
+		}
+
+		return useConfigFile(path)
+	}
+
+	mgr, err := config.NewProfileManager(baseDir, name)
+	if err != nil {
+		return err
+	}
+
+	profile = name
+	cfgMgr = mgr
+
+	return nil
+}
+
+// useConfigFile reads the configuration from path; its directory becomes the base directory
+func useConfigFile(path string) error {
+	mgr, err := config.NewFileManager(path)
+	if err != nil {
+		return err
+	}
+
+	baseDir = mgr.BaseDir()
+	configFile = mgr.GetPath()
+	cfgMgr = mgr
+
+	return nil
+}
+
+// newProcessManager returns the process manager for the active config file or profile
+func newProcessManager() *process.Manager {
+	if configFile != "" {
+		return process.NewFileManager(configFile)
+	}
+
+	return process.NewProfileManager(baseDir, profile)
 }
 
 func Execute() {
@@ -111,6 +195,8 @@ func directoryHasConfig(dir string) bool {
 func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "enable verbose logging")
 	rootCmd.PersistentFlags().BoolP("log-file", "l", false, "enable file logging")
+	rootCmd.PersistentFlags().StringP("profile", "p", "", "named configuration profile (config.<profile>.yaml)")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "path to the configuration file (.yaml or .json)")
 
 	// Add subcommands
 	rootCmd.AddCommand(startCmd)
@@ -118,6 +204,8 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(codeCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(providersCmd)
+	rootCmd.AddCommand(versionCmd)
 }
 
 func setupLogging(verbose, logFile bool) {
@@ -155,6 +243,7 @@ func ensureConfigExists() error {
 
 func promptForConfig() error {
 	// This will be implemented in the config command
-	fmt.Println("Please run 'cco config init' to set up your configuration")
+	fmt.Println("Please run 'cco config init' to set up your configuration,")
+	fmt.Println("or 'cco config init --template' for a starter configuration covering every provider")
 	return errors.New("configuration required")
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupProfile_ConfigFile(t *testing.T) {
+	savedMgr, savedBaseDir, savedConfigFile := cfgMgr, baseDir, configFile
+	t.Cleanup(func() { cfgMgr, baseDir, configFile = savedMgr, savedBaseDir, savedConfigFile })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ci.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("port: 7171\n"), 0600))
+
+	newCommand := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("profile", "", "")
+		cmd.Flags().String("config", "", "")
+		require.NoError(t, cmd.Flags().Parse(args))
+
+		return cmd
+	}
+
+	t.Setenv("CCO_PROFILE", "")
+	t.Setenv("CCR_PROFILE", "")
+	t.Setenv("CCR_CONFIG", "")
+	t.Setenv("CCO_CONFIG", path)
+
+	require.NoError(t, setupProfile(newCommand(), nil))
+
+	cfg, err := cfgMgr.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 7171, cfg.Port, "CCO_CONFIG should select the config file")
+	assert.Equal(t, dir, baseDir)
+	assert.Equal(t, path, configFile)
+
+	// The flag wins over the environment, and can't be combined with a profile
+	other := filepath.Join(dir, "other.yaml")
+	require.NoError(t, setupProfile(newCommand("--config", other), nil))
+	assert.Equal(t, other, configFile)
+
+	assert.Error(t, setupProfile(newCommand("--config", other, "--profile", "work"), nil))
+}
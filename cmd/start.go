@@ -4,7 +4,6 @@ import (
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/mihaisavezi/claude-code-open/internal/process"
 	"github.com/mihaisavezi/claude-code-open/internal/server"
 )
 
@@ -15,6 +14,11 @@ var startCmd = &cobra.Command{
 	RunE:  runStart,
 }
 
+func init() {
+	startCmd.Flags().Bool("mock", false, "register the mock provider, which answers with canned responses")
+	startCmd.Flags().Bool("validate-stream", false, "check streams sent to clients against Anthropic's event order and log violations (debugging)")
+}
+
 func runStart(cmd *cobra.Command, _ []string) error {
 	// Setup logging
 	verbose, err := cmd.Flags().GetBool("verbose")
@@ -27,6 +31,16 @@ func runStart(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	mock, err := cmd.Flags().GetBool("mock")
+	if err != nil {
+		return err
+	}
+
+	validateStream, err := cmd.Flags().GetBool("validate-stream")
+	if err != nil {
+		return err
+	}
+
 	setupLogging(verbose, logFile)
 
 	// Ensure configuration exists
@@ -47,8 +61,12 @@ func runStart(cmd *cobra.Command, _ []string) error {
 		"providers", len(cfg.Providers),
 	)
 
-	// Setup process management
-	procMgr := process.NewManager(baseDir)
+	// Setup process management, dropping files left behind by a crashed instance
+	procMgr := newProcessManager()
+	if procMgr.PruneStale() {
+		logger.Info("Removed stale PID and reference files of a previous instance")
+	}
+
 	if err := procMgr.WritePID(); err != nil {
 		return err
 	}
@@ -56,6 +74,13 @@ func runStart(cmd *cobra.Command, _ []string) error {
 
 	// Create and start server
 	srv := server.New(cfgMgr, logger)
+	if mock {
+		srv.EnableMockProvider()
+	}
+
+	if validateStream {
+		srv.EnableStreamValidation()
+	}
 
 	return srv.Start()
 }
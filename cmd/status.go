@@ -1,41 +1,135 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/mihaisavezi/claude-code-open/internal/process"
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/handlers"
 )
 
+// readinessTimeout bounds the request to the running server's readiness endpoint
+const readinessTimeout = 2 * time.Second
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show router service status",
 	Long:  `Display the current status of the LLM proxy router service.`,
-	Run:   runStatus,
+	RunE:  runStatus,
+}
+
+// StatusInfo is the machine-readable status emitted by `status --json`
+type StatusInfo struct {
+	Running    bool                 `json:"running"`
+	PID        int                  `json:"pid"`
+	Host       string               `json:"host"`
+	Port       int                  `json:"port"`
+	Endpoint   string               `json:"endpoint"`
+	Providers  int                  `json:"providers"`
+	Router     *config.RouterConfig `json:"router"`
+	ConfigPath string               `json:"config_path"`
+	References int                  `json:"references"`
+	Version    string               `json:"version"`
+
+	ProviderHealth []handlers.ProbeResult `json:"provider_health,omitempty"`
 }
 
-func runStatus(cmd *cobra.Command, _ []string) {
-	procMgr := process.NewManager(baseDir)
+func init() {
+	statusCmd.Flags().Bool("json", false, "Output status as JSON")
+}
+
+func runStatus(cmd *cobra.Command, _ []string) error {
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	procMgr := newProcessManager()
 	cfg := cfgMgr.Get()
 
-	running := procMgr.IsRunning()
-	pid := procMgr.ReadPID()
-	refs := procMgr.ReadRef()
+	status := buildStatus(procMgr.IsRunning(), procMgr.ReadPID(), procMgr.ReadRef(), cfg, cfgMgr.GetPath())
+
+	if status.Running && cfg != nil {
+		status.ProviderHealth = fetchProviderHealth(status.Endpoint)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(status)
+	}
 
 	color.Blue("Status for %s:", AppName)
-	fmt.Printf("  %-15s: %v\n", "Running", running)
-	fmt.Printf("  %-15s: %d\n", "PID", pid)
+	fmt.Printf("  %-15s: %v\n", "Running", status.Running)
+	fmt.Printf("  %-15s: %d\n", "PID", status.PID)
+
+	if cfg != nil {
+		fmt.Printf("  %-15s: %s\n", "Host", status.Host)
+		fmt.Printf("  %-15s: %d\n", "Port", status.Port)
+		fmt.Printf("  %-15s: %s\n", "Endpoint", status.Endpoint)
+		fmt.Printf("  %-15s: %d\n", "Providers", status.Providers)
+	}
+
+	fmt.Printf("  %-15s: %s\n", "Config Path", status.ConfigPath)
+	fmt.Printf("  %-15s: %d\n", "References", status.References)
+	fmt.Printf("  %-15s: v%s\n", "Version", status.Version)
+
+	if len(status.ProviderHealth) > 0 {
+		color.Blue("Provider health:")
+
+		for _, result := range status.ProviderHealth {
+			if result.Reachable {
+				fmt.Printf("  %-15s: reachable (%dms)\n", result.Provider, result.LatencyMS)
+			} else {
+				fmt.Printf("  %-15s: unreachable (%s)\n", result.Provider, result.Error)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchProviderHealth reads the cached provider probes from the running server.
+// Errors are ignored; status is still useful without them.
+func fetchProviderHealth(endpoint string) []handlers.ProbeResult {
+	client := &http.Client{Timeout: readinessTimeout}
+
+	resp, err := client.Get(endpoint + "/health/ready")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var report handlers.ReadinessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil
+	}
+
+	return report.Providers
+}
+
+func buildStatus(running bool, pid, refs int, cfg *config.Config, configPath string) StatusInfo {
+	status := StatusInfo{
+		Running:    running,
+		PID:        pid,
+		ConfigPath: configPath,
+		References: refs,
+		Version:    Version,
+	}
 
 	if cfg != nil {
-		fmt.Printf("  %-15s: %s\n", "Host", cfg.Host)
-		fmt.Printf("  %-15s: %d\n", "Port", cfg.Port)
-		fmt.Printf("  %-15s: %s\n", "Endpoint", fmt.Sprintf("http://%s:%d", cfg.Host, cfg.Port))
-		fmt.Printf("  %-15s: %d\n", "Providers", len(cfg.Providers))
+		status.Host = cfg.Host
+		status.Port = cfg.Port
+		status.Endpoint = fmt.Sprintf("http://%s:%d", cfg.Host, cfg.Port)
+		status.Providers = len(cfg.Providers)
+		status.Router = &cfg.Router
 	}
 
-	fmt.Printf("  %-15s: %s\n", "Config Path", cfgMgr.GetPath())
-	fmt.Printf("  %-15s: %d\n", "References", refs)
-	fmt.Printf("  %-15s: v%s\n", "Version", Version)
+	return status
 }
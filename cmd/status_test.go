@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestBuildStatus_JSON(t *testing.T) {
+	cfg := &config.Config{
+		Host: "127.0.0.1",
+		Port: 6970,
+		Providers: []config.Provider{
+			{Name: "openrouter"},
+			{Name: "openai"},
+		},
+		Router: config.RouterConfig{
+			Default: "openrouter,anthropic/claude-sonnet-4",
+			Think:   "openai,o1",
+		},
+	}
+
+	status := buildStatus(true, 4242, 2, cfg, "/tmp/config.yaml")
+
+	data, err := json.Marshal(status)
+	require.NoError(t, err)
+
+	var result map[string]any
+	require.NoError(t, json.Unmarshal(data, &result), "status should be valid JSON")
+
+	assert.Equal(t, true, result["running"])
+	assert.Equal(t, float64(4242), result["pid"])
+	assert.Equal(t, "127.0.0.1", result["host"])
+	assert.Equal(t, float64(6970), result["port"])
+	assert.Equal(t, "http://127.0.0.1:6970", result["endpoint"])
+	assert.Equal(t, float64(2), result["providers"])
+	assert.Equal(t, float64(2), result["references"])
+	assert.Equal(t, "/tmp/config.yaml", result["config_path"])
+	assert.Equal(t, Version, result["version"])
+
+	router, ok := result["router"].(map[string]any)
+	require.True(t, ok, "router should be an object")
+	assert.Equal(t, "openrouter,anthropic/claude-sonnet-4", router["default"])
+	assert.Equal(t, "openai,o1", router["think"])
+	assert.NotContains(t, router, "background", "unset model slots should be omitted")
+}
+
+func TestRunStatus_JSONWritesToCommandOutput(t *testing.T) {
+	savedMgr, savedBaseDir, savedConfigFile, savedProfile := cfgMgr, baseDir, configFile, profile
+	t.Cleanup(func() { cfgMgr, baseDir, configFile, profile = savedMgr, savedBaseDir, savedConfigFile, savedProfile })
+
+	baseDir, configFile, profile = t.TempDir(), "", ""
+	cfgMgr = config.NewManager(baseDir)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("json", false, "")
+	require.NoError(t, cmd.Flags().Parse([]string{"--json"}))
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+
+	require.NoError(t, runStatus(cmd, nil))
+
+	var result map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result), "status should be written to the command's output")
+	assert.Equal(t, false, result["running"])
+	assert.Equal(t, cfgMgr.GetPath(), result["config_path"])
+}
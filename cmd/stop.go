@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
@@ -10,14 +15,30 @@ import (
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop the router service",
-	Long:  `Stop the running LLM proxy router service.`,
-	RunE:  runStop,
+	Long: `Stop the running LLM proxy router service.
+
+With --all, the instances of every profile are stopped.`,
+	RunE: runStop,
+}
+
+func init() {
+	stopCmd.Flags().Bool("all", false, "Stop the instances of all profiles")
 }
 
 func runStop(cmd *cobra.Command, _ []string) error {
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+
+	if all {
+		color.Yellow("Stopping all %s instances...", AppName)
+		return stopAllInstances(baseDir, os.Stdout)
+	}
+
 	color.Yellow("Stopping %s...", AppName)
 
-	procMgr := process.NewManager(baseDir)
+	procMgr := newProcessManager()
 
 	if !procMgr.IsRunning() {
 		color.Yellow("Service is not running")
@@ -35,3 +56,47 @@ func runStop(cmd *cobra.Command, _ []string) error {
 
 	return nil
 }
+
+// stopAllInstances stops the service of every profile with a PID file in baseDir and
+// removes the PID and reference files, including those left behind by dead instances
+func stopAllInstances(baseDir string, out io.Writer) error {
+	managers, err := process.ProfileManagers(baseDir)
+	if err != nil {
+		return err
+	}
+
+	stopped := 0
+
+	var errs []error
+
+	for _, procMgr := range managers {
+		name := procMgr.Profile()
+		if name == "" {
+			name = "default"
+		}
+
+		if !procMgr.IsRunning() {
+			procMgr.CleanupRef()
+			continue
+		}
+
+		pid := procMgr.ReadPID()
+
+		if err := procMgr.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+			continue
+		}
+
+		procMgr.CleanupRef()
+
+		stopped++
+
+		fmt.Fprintf(out, "Stopped profile %s (PID %d)\n", name, pid)
+	}
+
+	if stopped == 0 && len(errs) == 0 {
+		fmt.Fprintln(out, "No service is running")
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/process"
+)
+
+func TestStopAllInstances(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process signals are not supported on Windows")
+	}
+
+	baseDir := t.TempDir()
+
+	// Keep the reference files of the test out of the real temporary directory
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// Stand-ins for the default and a "work" profile instance
+	exited := make(map[string]chan struct{})
+
+	for _, profile := range []string{"", "work"} {
+		instance := exec.Command("sleep", "30")
+		require.NoError(t, instance.Start())
+
+		done := make(chan struct{})
+		exited[profile] = done
+
+		// Reap the child so that it disappears once signalled
+		go func() {
+			_ = instance.Wait()
+			close(done)
+		}()
+
+		t.Cleanup(func() { _ = instance.Process.Kill() })
+
+		procMgr := process.NewProfileManager(baseDir, profile)
+		require.NoError(t, os.WriteFile(pidPath(baseDir, profile), []byte(strconv.Itoa(instance.Process.Pid)), 0o600))
+		require.True(t, procMgr.IsRunning())
+	}
+
+	// A PID file left behind by an instance that is gone is cleaned up too
+	require.NoError(t, os.WriteFile(pidPath(baseDir, "stale"), []byte("999999999"), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, stopAllInstances(baseDir, &out))
+
+	for profile, done := range exited {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Errorf("instance of profile %q is still running", profile)
+		}
+
+		assert.NoFileExists(t, pidPath(baseDir, profile))
+	}
+
+	assert.NoFileExists(t, pidPath(baseDir, "stale"))
+	assert.Contains(t, out.String(), "Stopped profile default")
+	assert.Contains(t, out.String(), "Stopped profile work")
+
+	managers, err := process.ProfileManagers(baseDir)
+	require.NoError(t, err)
+	assert.Empty(t, managers)
+}
+
+func pidPath(baseDir, profile string) string {
+	name := ".claude-code-open"
+	if profile != "" {
+		name += "." + profile
+	}
+
+	return filepath.Join(baseDir, name+".pid")
+}
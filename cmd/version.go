@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version information",
+	Long:  `Display the version, Git commit and build date of this binary.`,
+	RunE:  runVersion,
+}
+
+func init() {
+	versionCmd.Flags().Bool("short", false, "print only the version number")
+}
+
+func runVersion(cmd *cobra.Command, _ []string) error {
+	short, err := cmd.Flags().GetBool("short")
+	if err != nil {
+		return err
+	}
+
+	printVersion(cmd.OutOrStdout(), short)
+
+	return nil
+}
+
+// printVersion writes the build metadata, or only the version number when short is set
+func printVersion(w io.Writer, short bool) {
+	if short {
+		fmt.Fprintln(w, Version)
+		return
+	}
+
+	fmt.Fprintf(w, "%s v%s\n", AppName, Version)
+	fmt.Fprintf(w, "  %-11s: %s\n", "Commit", Commit)
+	fmt.Fprintf(w, "  %-11s: %s\n", "Built", BuildDate)
+	fmt.Fprintf(w, "  %-11s: %s %s/%s\n", "Go", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
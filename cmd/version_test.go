@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintVersion(t *testing.T) {
+	var out bytes.Buffer
+	printVersion(&out, true)
+	assert.Equal(t, Version+"\n", out.String(), "--short should print only the version")
+
+	out.Reset()
+	printVersion(&out, false)
+	assert.Contains(t, out.String(), AppName+" v"+Version)
+	assert.Contains(t, out.String(), "Commit")
+	assert.Contains(t, out.String(), Commit)
+	assert.Contains(t, out.String(), BuildDate)
+}
@@ -5,6 +5,9 @@ go 1.24.4
 require (
 	github.com/andybalholm/brotli v1.2.0
 	github.com/fatih/color v1.18.0
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
 	github.com/pkoukk/tiktoken-go v0.1.7
 	github.com/spf13/cobra v1.9.1
 	github.com/stretchr/testify v1.9.0
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// apiKeyField is the name of a provider's API key in both configuration formats
+const apiKeyField = "api_key"
+
+// plainProvider has Provider's fields without its (un)marshalers
+type plainProvider Provider
+
+// Keys returns the provider's API keys in rotation order
+func (p *Provider) Keys() []string {
+	if len(p.APIKeys) > 0 {
+		return p.APIKeys
+	}
+
+	if p.APIKey != "" {
+		return []string{p.APIKey}
+	}
+
+	return nil
+}
+
+// keylessProviders run on this machine and take requests without an API key
+var keylessProviders = map[string]bool{
+	"lmstudio": true,
+	"mock":     true,
+}
+
+// hasUsableKey reports whether requests to the provider can be sent: it has a key of its
+// own, CCO_API_KEY stands in for one, it signs in with OAuth, or it is a local server that
+// needs none
+func (p *Provider) hasUsableKey() bool {
+	if len(p.Keys()) > 0 || p.Auth == AuthOAuth || os.Getenv("CCO_API_KEY") != "" {
+		return true
+	}
+
+	return keylessProviders[p.Name] || isLocalURL(p.APIBase)
+}
+
+// isLocalURL reports whether a provider URL points at this machine (loopback, unix socket
+// or the in-process mock)
+func isLocalURL(rawURL string) bool {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(target.Scheme, "unix") || target.Scheme == "mock" {
+		return true
+	}
+
+	host := target.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// setKeys records a list of keys given for api_key
+func (p *Provider) setKeys(keys []string) {
+	p.APIKeys = keys
+	p.APIKey = ""
+
+	if len(keys) > 0 {
+		p.APIKey = keys[0]
+	}
+}
+
+// UnmarshalYAML accepts api_key as a single key or a list of keys
+func (p *Provider) UnmarshalYAML(node *yaml.Node) error {
+	var keys []string
+
+	hasKeyList := false
+
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != apiKeyField || node.Content[i+1].Kind != yaml.SequenceNode {
+				continue
+			}
+
+			if err := node.Content[i+1].Decode(&keys); err != nil {
+				return fmt.Errorf("invalid api_key list: %w", err)
+			}
+
+			// Decode the rest without the list, which doesn't fit the string field
+			content := make([]*yaml.Node, 0, len(node.Content)-2)
+			content = append(content, node.Content[:i]...)
+			content = append(content, node.Content[i+2:]...)
+
+			withoutKeys := *node
+			withoutKeys.Content = content
+			node = &withoutKeys
+			hasKeyList = true
+
+			break
+		}
+	}
+
+	if err := node.Decode((*plainProvider)(p)); err != nil {
+		return err
+	}
+
+	if hasKeyList {
+		p.setKeys(keys)
+	}
+
+	return nil
+}
+
+// MarshalYAML writes api_key as a list when the provider has several keys
+func (p Provider) MarshalYAML() (any, error) {
+	if len(p.APIKeys) <= 1 {
+		return plainProvider(p), nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(plainProvider(p)); err != nil {
+		return nil, err
+	}
+
+	var keys yaml.Node
+	if err := keys.Encode(p.APIKeys); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == apiKeyField {
+			node.Content[i+1] = &keys
+			break
+		}
+	}
+
+	return &node, nil
+}
+
+// UnmarshalJSON accepts api_key as a single key or a list of keys
+func (p *Provider) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var keys []string
+
+	raw, hasKey := fields[apiKeyField]
+	hasKeyList := hasKey && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("["))
+
+	if hasKeyList {
+		if err := json.Unmarshal(raw, &keys); err != nil {
+			return fmt.Errorf("invalid api_key list: %w", err)
+		}
+
+		delete(fields, apiKeyField)
+
+		withoutKeys, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		data = withoutKeys
+	}
+
+	if err := json.Unmarshal(data, (*plainProvider)(p)); err != nil {
+		return err
+	}
+
+	if hasKeyList {
+		p.setKeys(keys)
+	}
+
+	return nil
+}
+
+// MarshalJSON writes api_key as a list when the provider has several keys
+func (p Provider) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(plainProvider(p))
+	if err != nil || len(p.APIKeys) <= 1 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	keys, err := json.Marshal(p.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	fields[apiKeyField] = keys
+
+	return json.Marshal(fields)
+}
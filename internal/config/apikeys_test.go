@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProvider_APIKeyList(t *testing.T) {
+	t.Setenv("SECOND_KEY", "key-2")
+
+	tempDir := t.TempDir()
+	mgr := NewManager(tempDir)
+
+	yamlConfig := `
+providers:
+  - name: openai
+    api_key:
+      - key-1
+      - ${SECOND_KEY}
+    models: [gpt-4o]
+  - name: anthropic
+    api_key: single-key
+`
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultYAMLFilename), []byte(yamlConfig), 0644))
+
+	cfg, err := mgr.Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.Providers, 2)
+
+	assert.Equal(t, []string{"key-1", "key-2"}, cfg.Providers[0].Keys())
+	assert.Equal(t, "key-1", cfg.Providers[0].APIKey, "the first key stands in where a single key is expected")
+	assert.Equal(t, []string{"gpt-4o"}, cfg.Providers[0].Models)
+
+	assert.Equal(t, []string{"single-key"}, cfg.Providers[1].Keys())
+	assert.Empty(t, cfg.Providers[1].APIKeys)
+}
+
+func TestProvider_APIKeyListRoundTrip(t *testing.T) {
+	provider := Provider{Name: "openai", APIKey: "key-1", APIKeys: []string{"key-1", "key-2"}}
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(provider)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"api_key":["key-1","key-2"]`)
+
+		var decoded Provider
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, provider.Keys(), decoded.Keys())
+		assert.Equal(t, "openai", decoded.Name)
+
+		single, err := json.Marshal(Provider{Name: "openai", APIKey: "key-1"})
+		require.NoError(t, err)
+		assert.Contains(t, string(single), `"api_key":"key-1"`)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		data, err := yaml.Marshal(provider)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "api_key:\n    - key-1\n    - key-2\n")
+
+		var decoded Provider
+		require.NoError(t, yaml.Unmarshal(data, &decoded))
+		assert.Equal(t, provider.Keys(), decoded.Keys())
+		assert.Equal(t, "openai", decoded.Name)
+	})
+}
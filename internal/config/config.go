@@ -2,11 +2,13 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +18,34 @@ const (
 	DefaultConfigFilename = "config.json"
 	DefaultYAMLFilename   = "config.yaml"
 	DefaultHost           = "127.0.0.1"
+
+	DefaultIdempotencyCacheSize  = 128
+	DefaultIdempotencyTTLSeconds = 60
+
+	DefaultPreRequestHookTimeoutSeconds = 5
+
+	DefaultStreamPingIntervalSeconds = 15
+
+	DefaultStreamDrainTimeoutSeconds = 120
+
+	DefaultHealthProbeIntervalSeconds = 30
+	DefaultHealthProbeTimeoutSeconds  = 5
+
+	DefaultCORSMaxAgeSeconds = 600
+
+	DefaultDebugCaptureSize = 10
+
+	DefaultConcurrencyQueueTimeoutSeconds = 30
+
+	// AuthOAuth is the provider auth mode of a Claude.ai subscription login
+	AuthOAuth = "oauth"
+
+	// SystemRoleDeveloper sends the system prompt to OpenAI-compatible providers as a
+	// "developer" message, the role newer OpenAI models expect
+	SystemRoleDeveloper = "developer"
+
+	// OutputFormatOpenAI sends responses and streams to OpenAI clients as OpenAI chat completions
+	OutputFormatOpenAI = "openai"
 )
 
 var (
@@ -26,8 +56,15 @@ var (
 		"anthropic":  "https://api.anthropic.com/v1/messages",
 		"nvidia":     "https://integrate.api.nvidia.com/v1/chat/completions",
 		"gemini":     "https://generativelanguage.googleapis.com/v1beta/models",
+		"fireworks":  "https://api.fireworks.ai/inference/v1/chat/completions",
+		"together":   "https://api.together.xyz/v1/chat/completions",
+		"lmstudio":   "http://localhost:1234/v1/chat/completions",
+		"mock":       "mock://mock",
 	}
 
+	// DefaultBackgroundModels are the model-id prefixes of Claude Code's haiku background calls
+	DefaultBackgroundModels = []string{"claude-3-5-haiku", "claude-haiku"}
+
 	// Default models for each provider
 	DefaultProviderModels = map[string][]string{
 		"openrouter": {
@@ -56,6 +93,20 @@ var (
 			"gemini-1.5-pro",
 			"gemini-1.5-flash",
 		},
+		"fireworks": {
+			"accounts/fireworks/models/llama-v3p1-405b-instruct",
+			"accounts/fireworks/models/qwen2p5-coder-32b-instruct",
+			"accounts/fireworks/models/deepseek-v3",
+		},
+		"together": {
+			"meta-llama/Llama-3.3-70B-Instruct-Turbo",
+			"Qwen/Qwen2.5-Coder-32B-Instruct",
+			"deepseek-ai/DeepSeek-V3",
+		},
+		"lmstudio": {
+			"qwen2.5-coder-14b-instruct",
+			"meta-llama-3.1-8b-instruct",
+		},
 	}
 )
 
@@ -66,6 +117,72 @@ type Provider struct {
 	Models         []string `json:"models" yaml:"models,omitempty"`
 	ModelWhitelist []string `json:"model_whitelist,omitempty" yaml:"model_whitelist,omitempty"`
 	DefaultModels  []string `json:"default_models,omitempty" yaml:"default_models,omitempty"`
+
+	// APIKeys holds every key when api_key is given as a list; APIKey is then the first.
+	// Requests rotate through them (see Keys).
+	APIKeys []string `json:"-" yaml:"-"`
+
+	// ModelMap rewrites requested model names to the ids this provider uses
+	ModelMap map[string]string `json:"model_map,omitempty" yaml:"model_map,omitempty"`
+
+	// BaseIsFullURL tells whether APIBase is the complete endpoint URL (the default) or a base
+	// the provider appends its endpoint path to, such as https://gateway.example.com/v1
+	BaseIsFullURL *bool `json:"base_is_full_url,omitempty" yaml:"base_is_full_url,omitempty"`
+
+	// URLTemplate builds the endpoint URL of each request, for endpoints that need the model
+	// or other values in it, e.g. "{base}/ml/v1/text/chat?version={version}". {base} is the
+	// url, {model} the model id and other placeholders come from URLParams. Streaming requests
+	// use StreamURLTemplate when it is set.
+	URLTemplate       string            `json:"url_template,omitempty" yaml:"url_template,omitempty"`
+	StreamURLTemplate string            `json:"stream_url_template,omitempty" yaml:"stream_url_template,omitempty"`
+	URLParams         map[string]string `json:"url_params,omitempty" yaml:"url_params,omitempty"`
+
+	// PreserveUnknownFields keeps response fields the conversion drops as <name>_<field>
+	PreserveUnknownFields bool `json:"preserve_unknown_fields,omitempty" yaml:"preserve_unknown_fields,omitempty"`
+
+	// DefaultParams fill request parameters the client left out, such as temperature or top_p,
+	// before the request is converted for the provider
+	DefaultParams map[string]any `json:"default_params,omitempty" yaml:"default_params,omitempty"`
+
+	// SystemRole is the role of the system prompt message sent to OpenAI-compatible providers:
+	// "system" (the default) or SystemRoleDeveloper
+	SystemRole string `json:"system_role,omitempty" yaml:"system_role,omitempty"`
+
+	// MaxOutputTokens caps the max_tokens of requests to this provider; zero means no cap
+	MaxOutputTokens int `json:"max_output_tokens,omitempty" yaml:"max_output_tokens,omitempty"`
+
+	// ModelInfo describes models by name, for clients that look up a model's limits and
+	// pricing through /v1/models
+	ModelInfo map[string]ModelInfo `json:"model_info,omitempty" yaml:"model_info,omitempty"`
+
+	// DisableTransform forwards request and response bytes unchanged, for providers that
+	// already speak the Anthropic format. Routing, auth and token logging still apply.
+	DisableTransform bool `json:"disable_transform,omitempty" yaml:"disable_transform,omitempty"`
+
+	// Auth selects how requests are authenticated; AuthOAuth uses a Claude.ai subscription's
+	// OAuth token instead of an API key (Anthropic only)
+	Auth string `json:"auth,omitempty" yaml:"auth,omitempty"`
+
+	// TimeoutMS bounds a whole non-streaming request; IdleTimeoutMS bounds the gap between
+	// streamed chunks. Zero means no limit.
+	TimeoutMS     int `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`
+	IdleTimeoutMS int `json:"idle_timeout_ms,omitempty" yaml:"idle_timeout_ms,omitempty"`
+
+	// MaxConcurrentRequests caps in-flight upstream requests to this provider; zero means no cap
+	MaxConcurrentRequests int `json:"max_concurrent_requests,omitempty" yaml:"max_concurrent_requests,omitempty"`
+}
+
+// ModelInfo is the metadata served for a model. Zero values are left out.
+type ModelInfo struct {
+	ContextWindow   int           `json:"context_window,omitempty" yaml:"context_window,omitempty"`
+	MaxOutputTokens int           `json:"max_output_tokens,omitempty" yaml:"max_output_tokens,omitempty"`
+	Pricing         *ModelPricing `json:"pricing,omitempty" yaml:"pricing,omitempty"`
+}
+
+// ModelPricing is a model's price in US dollars per million tokens
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"input_per_million" yaml:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million" yaml:"output_per_million"`
 }
 
 type RouterConfig struct {
@@ -74,15 +191,166 @@ type RouterConfig struct {
 	Background  string `json:"background,omitempty" yaml:"background,omitempty"`
 	LongContext string `json:"longContext,omitempty" yaml:"long_context,omitempty"`
 	WebSearch   string `json:"webSearch,omitempty" yaml:"web_search,omitempty"`
+	// BackgroundModels are the model-id prefixes routed to the background bucket;
+	// DefaultBackgroundModels applies when empty
+	BackgroundModels []string `json:"backgroundModels,omitempty" yaml:"background_models,omitempty"`
+}
+
+// IsBackgroundModel reports whether a requested model is one of the background models. The
+// provider prefix ("openrouter,") and any vendor path ("anthropic/") are stripped first, and
+// prefixes match without regard to case.
+func (r *RouterConfig) IsBackgroundModel(model string) bool {
+	if _, id, found := strings.Cut(model, ","); found {
+		model = id
+	}
+
+	model = strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+
+	prefixes := r.BackgroundModels
+	if len(prefixes) == 0 {
+		prefixes = DefaultBackgroundModels
+	}
+
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(model, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Route returns the model of the named router bucket, using the YAML names of the fields
+func (r *RouterConfig) Route(bucket string) (string, bool) {
+	switch bucket {
+	case "default":
+		return r.Default, true
+	case "think":
+		return r.Think, true
+	case "background":
+		return r.Background, true
+	case "long_context":
+		return r.LongContext, true
+	case "web_search":
+		return r.WebSearch, true
+	}
+
+	return "", false
+}
+
+// IdempotencyConfig controls replay of responses for requests carrying an Idempotency-Key header
+type IdempotencyConfig struct {
+	CacheSize  int `json:"cache_size,omitempty" yaml:"cache_size,omitempty"`
+	TTLSeconds int `json:"ttl_seconds,omitempty" yaml:"ttl_seconds,omitempty"`
+}
+
+// CORSConfig controls which browser origins may call the proxy. No origins disables CORS headers.
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins,omitempty" yaml:"allowed_origins,omitempty"`
+	MaxAgeSeconds  int      `json:"max_age_seconds,omitempty" yaml:"max_age_seconds,omitempty"`
+}
+
+// AllowsOrigin reports whether a browser origin is one of the allowed origins, or "*" is
+func (c *CORSConfig) AllowsOrigin(origin string) bool {
+	origin = strings.TrimSuffix(origin, "/")
+
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MockConfig sets what the mock provider answers: text, tool calls, or both
+type MockConfig struct {
+	Text      string         `json:"text,omitempty" yaml:"text,omitempty"`
+	ToolCalls []MockToolCall `json:"tool_calls,omitempty" yaml:"tool_calls,omitempty"`
+}
+
+// MockToolCall is a tool call the mock provider simulates
+type MockToolCall struct {
+	Name  string         `json:"name" yaml:"name"`
+	Input map[string]any `json:"input,omitempty" yaml:"input,omitempty"`
 }
 
 type Config struct {
-	Host      string       `json:"HOST,omitempty" yaml:"host,omitempty"`
-	Port      int          `json:"PORT,omitempty" yaml:"port,omitempty"`
-	APIKey    string       `json:"APIKEY,omitempty" yaml:"api_key,omitempty"`
-	Providers []Provider   `json:"Providers" yaml:"providers"`
-	Router    RouterConfig `json:"Router" yaml:"router,omitempty"`
-	DomainMappings map[string]string      `json:"domain_mappings,omitempty" yaml:"domain_mappings,omitempty"`
+	Host           string            `json:"HOST,omitempty" yaml:"host,omitempty"`
+	Port           int               `json:"PORT,omitempty" yaml:"port,omitempty"`
+	APIKey         string            `json:"APIKEY,omitempty" yaml:"api_key,omitempty"`
+	Providers      []Provider        `json:"Providers" yaml:"providers"`
+	Router         RouterConfig      `json:"Router" yaml:"router,omitempty"`
+	DomainMappings map[string]string `json:"domain_mappings,omitempty" yaml:"domain_mappings,omitempty"`
+	Idempotency    IdempotencyConfig `json:"idempotency,omitempty" yaml:"idempotency,omitempty"`
+	CORS           CORSConfig        `json:"cors,omitempty" yaml:"cors,omitempty"`
+
+	// InboundHMACSecret, when set, requires every authenticated request to carry an
+	// x-ccr-timestamp header within 5 minutes of the proxy's clock and an x-ccr-signature
+	// header with the hex HMAC-SHA256, under this secret, of the timestamp, method, request
+	// URI and body. Bodies over 32 MiB are refused.
+	InboundHMACSecret string `json:"inbound_hmac_secret,omitempty" yaml:"inbound_hmac_secret,omitempty"`
+
+	// PreRequestHook is an executable that receives the request JSON on stdin and writes the modified request to stdout
+	PreRequestHook        string `json:"pre_request_hook,omitempty" yaml:"pre_request_hook,omitempty"`
+	PreRequestHookTimeout int    `json:"pre_request_hook_timeout,omitempty" yaml:"pre_request_hook_timeout,omitempty"`
+
+	// StreamPingInterval is the number of seconds of upstream silence before a ping event is sent; negative disables pings
+	StreamPingInterval int `json:"stream_ping_interval,omitempty" yaml:"stream_ping_interval,omitempty"`
+
+	// StreamKeepAliveComments forwards the upstream's generic keep-alive comments (": keep-alive")
+	// to streaming clients; other comments, such as ": OPENROUTER PROCESSING", are always dropped
+	StreamKeepAliveComments bool `json:"stream_keepalive_comments,omitempty" yaml:"stream_keepalive_comments,omitempty"`
+
+	// GzipMinBytes gzips non-streaming responses of at least this many bytes for clients that
+	// accept gzip; zero leaves responses uncompressed
+	GzipMinBytes int `json:"gzip_min_bytes,omitempty" yaml:"gzip_min_bytes,omitempty"`
+
+	// OutputFormat is the format responses are sent to OpenAI clients in on the proxy's
+	// listener: "anthropic" (the default) or OutputFormatOpenAI
+	OutputFormat string `json:"output_format,omitempty" yaml:"output_format,omitempty"`
+
+	// StreamDrainTimeout is the number of seconds in-flight streaming responses get to finish on shutdown
+	StreamDrainTimeout int `json:"stream_drain_timeout,omitempty" yaml:"stream_drain_timeout,omitempty"`
+
+	// DefaultMaxTokens is sent as max_tokens when the client omits it; zero leaves the request unchanged
+	DefaultMaxTokens int `json:"default_max_tokens,omitempty" yaml:"default_max_tokens,omitempty"`
+
+	// HealthProbeInterval is the number of seconds between provider reachability probes; negative disables probing
+	HealthProbeInterval int `json:"health_probe_interval,omitempty" yaml:"health_probe_interval,omitempty"`
+	HealthProbeTimeout  int `json:"health_probe_timeout,omitempty" yaml:"health_probe_timeout,omitempty"`
+
+	// PreserveLogprobs copies OpenAI-style logprobs into non-streaming responses as openai_logprobs
+	PreserveLogprobs bool `json:"preserve_logprobs,omitempty" yaml:"preserve_logprobs,omitempty"`
+
+	// Debug keeps the last DebugCaptureSize request/response pairs and serves them on /debug/last
+	Debug            bool `json:"debug,omitempty" yaml:"debug,omitempty"`
+	DebugCaptureSize int  `json:"debug_capture_size,omitempty" yaml:"debug_capture_size,omitempty"`
+
+	// HTTPProxy is the proxy for upstream requests; when empty HTTPS_PROXY/HTTP_PROXY/NO_PROXY apply
+	HTTPProxy string `json:"http_proxy,omitempty" yaml:"http_proxy,omitempty"`
+	// CACertFile is a PEM bundle trusted for upstream TLS in addition to the system roots
+	CACertFile string `json:"ca_cert_file,omitempty" yaml:"ca_cert_file,omitempty"`
+
+	// Mock is the canned reply of the "mock" provider
+	Mock MockConfig `json:"mock,omitempty" yaml:"mock,omitempty"`
+
+	// MaxConcurrentRequests caps in-flight upstream requests across all providers; zero means no cap.
+	// Requests over a cap wait up to ConcurrencyQueueTimeout seconds for a slot (negative rejects at once).
+	MaxConcurrentRequests   int `json:"max_concurrent_requests,omitempty" yaml:"max_concurrent_requests,omitempty"`
+	ConcurrencyQueueTimeout int `json:"concurrency_queue_timeout,omitempty" yaml:"concurrency_queue_timeout,omitempty"`
+
+	// SystemPrefix and SystemSuffix are added before and after the system prompt of every request
+	SystemPrefix string `json:"system_prefix,omitempty" yaml:"system_prefix,omitempty"`
+	SystemSuffix string `json:"system_suffix,omitempty" yaml:"system_suffix,omitempty"`
+
+	// StripClientTelemetry drops the SDK's x-stainless-* headers from upstream requests and
+	// replaces the client's User-Agent with the proxy's
+	StripClientTelemetry bool `json:"strip_client_telemetry,omitempty" yaml:"strip_client_telemetry,omitempty"`
+
+	// Aliases expand short model names sent by clients into a "provider,model" or the
+	// name of a router bucket (default, think, background, long_context, web_search)
+	Aliases map[string]string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
 }
 
 type Manager struct {
@@ -100,6 +368,62 @@ func NewManager(baseDir string) *Manager {
 	}
 }
 
+// NewProfileManager returns a manager for the named profile, which reads
+// config.<profile>.yaml or config.<profile>.json instead of the default files
+func NewProfileManager(baseDir, profile string) (*Manager, error) {
+	if profile == "" {
+		return NewManager(baseDir), nil
+	}
+
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		baseDir:  baseDir,
+		jsonPath: filepath.Join(baseDir, "config."+profile+".json"),
+		yamlPath: filepath.Join(baseDir, "config."+profile+".yaml"),
+	}, nil
+}
+
+// NewFileManager returns a manager for the configuration file at path, wherever it is. A
+// .json extension selects the JSON format, anything else YAML, and the file's directory
+// serves as the base directory.
+func NewFileManager(path string) (*Manager, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolve config path %s: %w", path, err)
+	}
+
+	m := &Manager{baseDir: filepath.Dir(absPath)}
+
+	if strings.EqualFold(filepath.Ext(absPath), ".json") {
+		m.jsonPath = absPath
+	} else {
+		m.yamlPath = absPath
+	}
+
+	return m, nil
+}
+
+// ValidateProfileName ensures a profile name is safe to embed in file names
+func ValidateProfileName(profile string) error {
+	if profile == "" {
+		return errors.New("profile name cannot be empty")
+	}
+
+	for _, r := range profile {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+
+		if !isLetter && !isDigit && r != '-' && r != '_' {
+			return fmt.Errorf("invalid profile name %q: only letters, digits, '-' and '_' are allowed", profile)
+		}
+	}
+
+	return nil
+}
+
 // createMinimalConfig creates a minimal configuration with all providers using CCO_API_KEY
 func (m *Manager) createMinimalConfig() Config {
 	return Config{
@@ -111,6 +435,8 @@ func (m *Manager) createMinimalConfig() Config {
 			{Name: "anthropic"},
 			{Name: "nvidia"},
 			{Name: "gemini"},
+			{Name: "fireworks"},
+			{Name: "together"},
 		},
 		Router: RouterConfig{
 			Default:     "openrouter,anthropic/claude-3.5-sonnet",
@@ -123,6 +449,19 @@ func (m *Manager) createMinimalConfig() Config {
 }
 
 func (m *Manager) Load() (*Config, error) {
+	cfg, err := m.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	m.configValue.Store(cfg)
+
+	return cfg, nil
+}
+
+// Read loads the configuration like Load but leaves the one in use in place, so that it
+// can be checked before Use switches to it
+func (m *Manager) Read() (*Config, error) {
 	var (
 		cfg Config
 		err error
@@ -146,17 +485,21 @@ func (m *Manager) Load() (*Config, error) {
 		// No config file found, but CCO_API_KEY is set - create minimal config
 		cfg = m.createMinimalConfig()
 	} else {
-		return nil, fmt.Errorf("no configuration file found (looked for %s or %s) and CCO_API_KEY environment variable not set", m.yamlPath, m.jsonPath)
+		return nil, fmt.Errorf("no configuration file found (looked for %s) and CCO_API_KEY environment variable not set", m.lookedFor())
 	}
 
-	// Apply defaults and validation
+	// Resolve ${VAR} placeholders, then apply defaults and validation
+	expandEnvPlaceholders(&cfg)
 	m.applyDefaults(&cfg)
 
-	m.configValue.Store(&cfg)
-
 	return &cfg, nil
 }
 
+// Use makes cfg the configuration in use without writing it to disk
+func (m *Manager) Use(cfg *Config) {
+	m.configValue.Store(cfg)
+}
+
 func (m *Manager) loadYAML() (Config, error) {
 	var cfg Config
 
@@ -197,6 +540,46 @@ func (m *Manager) applyDefaults(cfg *Config) {
 		cfg.Host = DefaultHost
 	}
 
+	if cfg.Idempotency.CacheSize <= 0 {
+		cfg.Idempotency.CacheSize = DefaultIdempotencyCacheSize
+	}
+
+	if cfg.Idempotency.TTLSeconds <= 0 {
+		cfg.Idempotency.TTLSeconds = DefaultIdempotencyTTLSeconds
+	}
+
+	if cfg.PreRequestHookTimeout <= 0 {
+		cfg.PreRequestHookTimeout = DefaultPreRequestHookTimeoutSeconds
+	}
+
+	if cfg.StreamPingInterval == 0 {
+		cfg.StreamPingInterval = DefaultStreamPingIntervalSeconds
+	}
+
+	if cfg.StreamDrainTimeout <= 0 {
+		cfg.StreamDrainTimeout = DefaultStreamDrainTimeoutSeconds
+	}
+
+	if cfg.HealthProbeInterval == 0 {
+		cfg.HealthProbeInterval = DefaultHealthProbeIntervalSeconds
+	}
+
+	if cfg.HealthProbeTimeout <= 0 {
+		cfg.HealthProbeTimeout = DefaultHealthProbeTimeoutSeconds
+	}
+
+	if cfg.CORS.MaxAgeSeconds <= 0 {
+		cfg.CORS.MaxAgeSeconds = DefaultCORSMaxAgeSeconds
+	}
+
+	if cfg.DebugCaptureSize <= 0 {
+		cfg.DebugCaptureSize = DefaultDebugCaptureSize
+	}
+
+	if cfg.ConcurrencyQueueTimeout == 0 {
+		cfg.ConcurrencyQueueTimeout = DefaultConcurrencyQueueTimeoutSeconds
+	}
+
 	// Apply provider defaults
 	for i := range cfg.Providers {
 		provider := &cfg.Providers[i]
@@ -235,6 +618,47 @@ func (m *Manager) applyDefaults(cfg *Config) {
 	}
 }
 
+// Validate lists the problems of a loaded configuration
+func (c *Config) Validate() []string {
+	var validationErrors []string
+
+	if len(c.Providers) == 0 {
+		validationErrors = append(validationErrors, "no providers configured")
+	}
+
+	for i, provider := range c.Providers {
+		if provider.Name == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: name is required", i))
+		}
+
+		if provider.APIBase == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: API base URL is required", i))
+		}
+
+		if !provider.hasUsableKey() {
+			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: API key is required", i))
+		}
+
+		if missing := provider.MissingURLParams(); len(missing) > 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: url_params has no value for URL template placeholders %s", i, strings.Join(missing, ", ")))
+		}
+
+		if role := provider.SystemRole; role != "" && role != "system" && role != SystemRoleDeveloper {
+			validationErrors = append(validationErrors, fmt.Sprintf("provider %d: system_role must be \"system\" or \"%s\"", i, SystemRoleDeveloper))
+		}
+	}
+
+	if format := c.OutputFormat; format != "" && format != "anthropic" && format != OutputFormatOpenAI {
+		validationErrors = append(validationErrors, fmt.Sprintf("output_format must be \"anthropic\" or \"%s\"", OutputFormatOpenAI))
+	}
+
+	if c.Router.Default == "" {
+		validationErrors = append(validationErrors, "default router model is required")
+	}
+
+	return validationErrors
+}
+
 func (m *Manager) Get() *Config {
 	if v := m.configValue.Load(); v != nil {
 		if cfg, ok := v.(*Config); ok {
@@ -254,7 +678,25 @@ func (m *Manager) Get() *Config {
 	return cfg
 }
 
+// lookedFor lists the config files the manager reads
+func (m *Manager) lookedFor() string {
+	var paths []string
+
+	for _, path := range []string{m.yamlPath, m.jsonPath} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return strings.Join(paths, " or ")
+}
+
 func (m *Manager) Save(cfg *Config) error {
+	// A manager for a single JSON file keeps saving JSON
+	if m.yamlPath == "" {
+		return m.SaveAsJSON(cfg)
+	}
+
 	if err := os.MkdirAll(m.baseDir, 0750); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
@@ -275,6 +717,10 @@ func (m *Manager) Save(cfg *Config) error {
 }
 
 func (m *Manager) SaveAsYAML(cfg *Config) error {
+	if m.yamlPath == "" {
+		return fmt.Errorf("configuration file %s is not YAML", m.jsonPath)
+	}
+
 	if err := os.MkdirAll(m.baseDir, 0750); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
@@ -294,6 +740,10 @@ func (m *Manager) SaveAsYAML(cfg *Config) error {
 }
 
 func (m *Manager) SaveAsJSON(cfg *Config) error {
+	if m.jsonPath == "" {
+		return fmt.Errorf("configuration file %s is not JSON", m.yamlPath)
+	}
+
 	if err := os.MkdirAll(m.baseDir, 0750); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
@@ -312,9 +762,14 @@ func (m *Manager) SaveAsJSON(cfg *Config) error {
 	return nil
 }
 
+// BaseDir returns the directory holding the configuration and provider credentials
+func (m *Manager) BaseDir() string {
+	return m.baseDir
+}
+
 func (m *Manager) GetPath() string {
 	// Return YAML path if it exists, otherwise JSON path
-	if _, err := os.Stat(m.yamlPath); err == nil {
+	if _, err := os.Stat(m.yamlPath); err == nil || m.jsonPath == "" {
 		return m.yamlPath
 	}
 
@@ -376,6 +831,18 @@ func (m *Manager) CreateExampleYAML() error {
 				Name:   "gemini",
 				APIKey: "your-gemini-api-key",
 			},
+			{
+				Name:   "fireworks",
+				APIKey: "your-fireworks-api-key",
+			},
+			{
+				Name:   "together",
+				APIKey: "your-together-api-key",
+			},
+			{
+				Name: "lmstudio",
+				// Local server, no API key needed
+			},
 		},
 		Router: RouterConfig{
 			Default:     "openrouter/anthropic/claude-3.5-sonnet",
@@ -392,6 +859,30 @@ func (m *Manager) CreateExampleYAML() error {
 	return m.SaveAsYAML(cfg)
 }
 
+// Timeout returns the limit for a whole non-streaming request, or zero for none
+func (p *Provider) Timeout() time.Duration {
+	return time.Duration(max(p.TimeoutMS, 0)) * time.Millisecond
+}
+
+// IdleTimeout returns the longest a stream may go without a chunk, or zero for no limit
+func (p *Provider) IdleTimeout() time.Duration {
+	return time.Duration(max(p.IdleTimeoutMS, 0)) * time.Millisecond
+}
+
+// UsesFullURL reports whether APIBase is used as the endpoint URL as configured
+func (p *Provider) UsesFullURL() bool {
+	return p.BaseIsFullURL == nil || *p.BaseIsFullURL
+}
+
+// ConcurrencyQueueWait returns how long a request over a concurrency cap waits for a slot
+func (c *Config) ConcurrencyQueueWait() time.Duration {
+	if c.ConcurrencyQueueTimeout == 0 {
+		return DefaultConcurrencyQueueTimeoutSeconds * time.Second
+	}
+
+	return time.Duration(max(c.ConcurrencyQueueTimeout, 0)) * time.Second
+}
+
 // IsModelAllowed checks if a model is allowed based on the provider's whitelist
 func (p *Provider) IsModelAllowed(model string) bool {
 	// If no whitelist is defined, all models are allowed
@@ -409,6 +900,22 @@ func (p *Provider) IsModelAllowed(model string) bool {
 	return false
 }
 
+// MapModel returns the provider's id for model, or model itself when it isn't mapped. A web
+// search suffix such as ":online" is kept on the mapped id.
+func (p *Provider) MapModel(model string) string {
+	if mapped, ok := p.ModelMap[model]; ok {
+		return mapped
+	}
+
+	if base, suffix, found := strings.Cut(model, ":"); found {
+		if mapped, ok := p.ModelMap[base]; ok {
+			return mapped + ":" + suffix
+		}
+	}
+
+	return model
+}
+
 // GetAllowedModels returns all models that are allowed based on the whitelist
 func (p *Provider) GetAllowedModels() []string {
 	if len(p.ModelWhitelist) == 0 {
@@ -124,3 +124,156 @@ func TestConfig_GetWithoutLoad(t *testing.T) {
 	assert.Equal(t, DefaultPort, cfg.Port, "should return default port")
 	assert.Equal(t, DefaultHost, cfg.Host, "should return default host")
 }
+
+func TestConfig_ProfileLoading(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Default and work profiles live side by side in the same directory
+	defaultCfg := `{"HOST":"127.0.0.1","PORT":6970,"Providers":[{"name":"openrouter","api_key":"personal-key"}]}`
+	workCfg := `{"HOST":"127.0.0.1","PORT":7070,"Providers":[{"name":"openai","api_key":"work-key"}]}`
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.json"), []byte(defaultCfg), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.work.json"), []byte(workCfg), 0600))
+
+	workManager, err := NewProfileManager(tmpDir, "work")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "config.work.json"), workManager.GetPath())
+
+	cfg, err := workManager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 7070, cfg.Port, "profile config should be loaded")
+	require.Len(t, cfg.Providers, 1)
+	assert.Equal(t, "work-key", cfg.Providers[0].APIKey)
+
+	// An empty profile falls back to the default config files
+	defaultManager, err := NewProfileManager(tmpDir, "")
+	require.NoError(t, err)
+
+	cfg, err = defaultManager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 6970, cfg.Port)
+
+	// A profile without its own config file does not fall back to the default one
+	missingManager, err := NewProfileManager(tmpDir, "personal")
+	require.NoError(t, err)
+	assert.False(t, missingManager.Exists())
+}
+
+func TestConfig_FileManagerLoadsCustomPath(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A default config in the same directory is ignored
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte("port: 6970\n"), 0600))
+
+	yamlPath := filepath.Join(tmpDir, "ci.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("port: 7171\nproviders:\n  - name: openai\n    api_key: ci-key\n"), 0600))
+
+	yamlManager, err := NewFileManager(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, yamlPath, yamlManager.GetPath())
+	assert.Equal(t, tmpDir, yamlManager.BaseDir())
+
+	cfg, err := yamlManager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 7171, cfg.Port)
+	require.Len(t, cfg.Providers, 1)
+	assert.Equal(t, "ci-key", cfg.Providers[0].APIKey)
+
+	// A JSON file is read, and saved, as JSON
+	jsonPath := filepath.Join(tmpDir, "nested", "setup.json")
+	jsonManager, err := NewFileManager(jsonPath)
+	require.NoError(t, err)
+	assert.False(t, jsonManager.Exists())
+
+	require.NoError(t, jsonManager.Save(&Config{Port: 7272}))
+	assert.True(t, jsonManager.HasJSON())
+	assert.False(t, jsonManager.HasYAML())
+
+	cfg, err = jsonManager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 7272, cfg.Port)
+}
+
+func TestConfig_InvalidProfileName(t *testing.T) {
+	for _, name := range []string{"../work", "work/dev", "work.dev", "work dev"} {
+		_, err := NewProfileManager(t.TempDir(), name)
+		assert.Error(t, err, "profile %q should be rejected", name)
+	}
+
+	assert.NoError(t, ValidateProfileName("work-2_dev"))
+}
+
+func TestConfig_ExpandsEnvPlaceholders(t *testing.T) {
+	t.Setenv("CCO_TEST_KEY", "sk-from-env")
+	t.Setenv("CCO_TEST_HOST", "gateway.example.com")
+
+	mgr := NewManager(t.TempDir())
+	require.NoError(t, os.WriteFile(mgr.GetYAMLPath(), []byte(`
+api_key: ${CCO_TEST_UNSET}
+providers:
+  - name: openai
+    api_key: ${CCO_TEST_KEY}
+    url: https://${CCO_TEST_HOST}/v1/chat/completions
+  - name: anthropic
+    api_key: pa$$word
+router:
+  default: openai,gpt-4o
+`), 0600))
+
+	cfg, err := mgr.Load()
+	require.NoError(t, err)
+
+	assert.Empty(t, cfg.APIKey, "unset variables expand to nothing")
+	assert.Equal(t, "sk-from-env", cfg.Providers[0].APIKey)
+	assert.Equal(t, "https://gateway.example.com/v1/chat/completions", cfg.Providers[0].APIBase)
+	assert.Equal(t, "pa$$word", cfg.Providers[1].APIKey, "only ${VAR} placeholders are expanded")
+}
+
+func TestRouterConfig_IsBackgroundModel(t *testing.T) {
+	router := &RouterConfig{}
+
+	for model, expected := range map[string]bool{
+		"claude-3-5-haiku":                      true,
+		"claude-3-5-haiku-20241022":             true,
+		"claude-3-5-haiku-latest":               true,
+		"anthropic,claude-3-5-haiku-latest":     true,
+		"openrouter,anthropic/claude-3-5-haiku": true,
+		"claude-haiku-4-5":                      true,
+		"Claude-3-5-Haiku-Latest":               true,
+		"claude-sonnet-4":                       false,
+		"openrouter,anthropic/claude-sonnet-4":  false,
+		"claude-3-haiku-20240307":               false,
+		"":                                      false,
+	} {
+		assert.Equal(t, expected, router.IsBackgroundModel(model), model)
+	}
+
+	// Configured prefixes replace the defaults
+	router.BackgroundModels = []string{"claude-3-haiku", "gpt-4o-mini"}
+
+	assert.True(t, router.IsBackgroundModel("anthropic,claude-3-haiku-20240307"))
+	assert.True(t, router.IsBackgroundModel("openai,gpt-4o-mini"))
+	assert.False(t, router.IsBackgroundModel("claude-3-5-haiku-latest"))
+}
+
+func TestConfig_ValidateKeylessProviders(t *testing.T) {
+	t.Setenv("CCO_API_KEY", "")
+
+	newConfig := func(providers ...Provider) *Config {
+		return &Config{Providers: providers, Router: RouterConfig{Default: "lmstudio,qwen3"}}
+	}
+
+	// Local servers need no key
+	assert.Empty(t, newConfig(
+		Provider{Name: "lmstudio", APIBase: DefaultProviderURLs["lmstudio"]},
+		Provider{Name: "mock", APIBase: DefaultProviderURLs["mock"]},
+		Provider{Name: "ollama", APIBase: "http://127.0.0.1:11434/v1/chat/completions"},
+	).Validate())
+
+	remote := newConfig(Provider{Name: "openai", APIBase: DefaultProviderURLs["openai"]})
+	assert.Equal(t, []string{"provider 0: API key is required"}, remote.Validate())
+
+	// CCO_API_KEY stands in for a missing key, as it does when requests are sent
+	t.Setenv("CCO_API_KEY", "shared-key")
+	assert.Empty(t, remote.Validate())
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// StarterTemplate is the commented YAML written by `cco config init --template`. Keys are
+// ${ENV} placeholders expanded when the configuration is loaded.
+const StarterTemplate = `# Claude Code Open configuration
+# Generated by: cco config init --template
+#
+# API keys are read from the environment through ${VAR} placeholders, so this
+# file can be shared or committed. Remove the providers you don't use; URLs and
+# model lists are filled in automatically for every provider named here.
+
+host: 127.0.0.1
+port: 6970
+# api_key: ${CCO_PROXY_KEY}   # Optional: clients must send this key to use the proxy
+
+providers:
+  # OpenRouter - models from many vendors behind one key
+  - name: openrouter
+    api_key: ${OPENROUTER_API_KEY}
+    # model_whitelist: [claude, gpt-4]   # Optional: only list matching models
+
+  # OpenAI - GPT and o-series models
+  - name: openai
+    api_key: ${OPENAI_API_KEY}
+
+  # Anthropic - Claude models, passed through without conversion
+  - name: anthropic
+    api_key: ${ANTHROPIC_API_KEY}
+
+  # Nvidia - Nemotron models
+  - name: nvidia
+    api_key: ${NVIDIA_API_KEY}
+
+  # Google Gemini
+  - name: gemini
+    api_key: ${GEMINI_API_KEY}
+
+  # Fireworks AI - open-weight models
+  - name: fireworks
+    api_key: ${FIREWORKS_API_KEY}
+
+  # Together AI - open-weight models
+  - name: together
+    api_key: ${TOGETHER_API_KEY}
+
+  # LM Studio - local models, no API key needed
+  # - name: lmstudio
+
+# Which provider,model serves each kind of request. Only default is required;
+# requests fall back to it when a bucket is unset.
+router:
+  default: openrouter,anthropic/claude-3.5-sonnet   # Everything else
+  think: openai,o1-preview                          # Plan mode and reasoning
+  background: anthropic,claude-3-haiku-20240307     # Claude Code's haiku background calls
+  long_context: gemini,gemini-1.5-pro               # Requests over 60k tokens
+  web_search: openrouter,perplexity/llama-3.1-sonar-huge-128k-online
+
+# See config.example.yaml in the repository for the remaining options
+# (timeouts, concurrency limits, aliases, hooks, proxies, debug capture).
+`
+
+// envPlaceholder matches a ${VAR} placeholder
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} placeholders with the environment variable; unset variables
+// expand to nothing. Other dollar signs are kept as they are.
+func expandEnv(value string) string {
+	return envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return os.Getenv(envPlaceholder.FindStringSubmatch(placeholder)[1])
+	})
+}
+
+// expandEnvPlaceholders expands ${VAR} placeholders in API keys, secrets, URLs and URL params
+func expandEnvPlaceholders(cfg *Config) {
+	cfg.APIKey = expandEnv(cfg.APIKey)
+	cfg.InboundHMACSecret = expandEnv(cfg.InboundHMACSecret)
+
+	for i := range cfg.Providers {
+		cfg.Providers[i].APIKey = expandEnv(cfg.Providers[i].APIKey)
+
+		for j, key := range cfg.Providers[i].APIKeys {
+			cfg.Providers[i].APIKeys[j] = expandEnv(key)
+		}
+
+		cfg.Providers[i].APIBase = expandEnv(cfg.Providers[i].APIBase)
+
+		for name, value := range cfg.Providers[i].URLParams {
+			cfg.Providers[i].URLParams[name] = expandEnv(value)
+		}
+	}
+}
+
+// WriteStarterTemplate writes StarterTemplate as the YAML configuration
+func (m *Manager) WriteStarterTemplate() error {
+	if m.yamlPath == "" {
+		return fmt.Errorf("configuration file %s is not YAML", m.jsonPath)
+	}
+
+	if err := os.MkdirAll(m.baseDir, 0750); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+
+	if err := os.WriteFile(m.yamlPath, []byte(StarterTemplate), 0600); err != nil {
+		return fmt.Errorf("write YAML config file: %w", err)
+	}
+
+	return nil
+}
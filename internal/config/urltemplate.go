@@ -0,0 +1,87 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// urlTemplateVariable matches a {name} placeholder of a URL template
+var urlTemplateVariable = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// EndpointTemplate returns the URL template for a request, preferring StreamURLTemplate for
+// streams, or "" when the provider has none
+func (p *Provider) EndpointTemplate(stream bool) string {
+	if stream && p.StreamURLTemplate != "" {
+		return p.StreamURLTemplate
+	}
+
+	return p.URLTemplate
+}
+
+// ExpandURLTemplate fills a URL template: {base} is the provider's url without a trailing
+// slash, {model} the model id, and any other placeholder takes its value from url_params.
+// Values in the query are query escaped and {model} in the path is path escaped. Placeholders
+// without a value are left as they are; MissingURLParams reports them.
+func (p *Provider) ExpandURLTemplate(template, model string) string {
+	query := strings.Index(template, "?")
+
+	var expanded strings.Builder
+
+	last := 0
+
+	for _, match := range urlTemplateVariable.FindAllStringSubmatchIndex(template, -1) {
+		expanded.WriteString(template[last:match[0]])
+		last = match[1]
+
+		name := template[match[2]:match[3]]
+
+		value, ok := p.urlTemplateValue(name, model)
+
+		switch {
+		case !ok:
+			value = template[match[0]:match[1]]
+		case query >= 0 && match[0] > query:
+			value = url.QueryEscape(value)
+		case name == "base":
+			value = strings.TrimSuffix(value, "/")
+		case name == "model":
+			value = url.PathEscape(value)
+		}
+
+		expanded.WriteString(value)
+	}
+
+	expanded.WriteString(template[last:])
+
+	return expanded.String()
+}
+
+// MissingURLParams lists the placeholders of the provider's URL templates that have no value
+func (p *Provider) MissingURLParams() []string {
+	var missing []string
+
+	for _, template := range []string{p.URLTemplate, p.StreamURLTemplate} {
+		for _, match := range urlTemplateVariable.FindAllStringSubmatch(template, -1) {
+			if _, ok := p.urlTemplateValue(match[1], ""); !ok && !slices.Contains(missing, match[1]) {
+				missing = append(missing, match[1])
+			}
+		}
+	}
+
+	return missing
+}
+
+func (p *Provider) urlTemplateValue(name, model string) (string, bool) {
+	switch name {
+	case "base":
+		return p.APIBase, true
+	case "model":
+		return model, true
+	}
+
+	value, ok := p.URLParams[name]
+
+	return value, ok
+}
@@ -163,8 +163,8 @@ func TestManager_CreateExampleYAML(t *testing.T) {
 	assert.Equal(t, DefaultPort, cfg.Port)
 	assert.Equal(t, "your-proxy-api-key-here", cfg.APIKey)
 
-	// Should have all 5 providers
-	assert.Len(t, cfg.Providers, 5)
+	// Should have all 8 providers
+	assert.Len(t, cfg.Providers, 8)
 
 	providerNames := make([]string, len(cfg.Providers))
 	for i, p := range cfg.Providers {
@@ -179,6 +179,9 @@ func TestManager_CreateExampleYAML(t *testing.T) {
 	assert.Contains(t, providerNames, "anthropic")
 	assert.Contains(t, providerNames, "nvidia")
 	assert.Contains(t, providerNames, "gemini")
+	assert.Contains(t, providerNames, "fireworks")
+	assert.Contains(t, providerNames, "together")
+	assert.Contains(t, providerNames, "lmstudio")
 
 	// Router should be configured
 	assert.NotEmpty(t, cfg.Router.Default)
@@ -235,6 +238,41 @@ func TestProvider_NoWhitelist(t *testing.T) {
 	assert.Equal(t, provider.DefaultModels, allowed)
 }
 
+func TestProvider_MapModel(t *testing.T) {
+	provider := Provider{
+		Name:     "openrouter",
+		ModelMap: map[string]string{"claude-3-5-sonnet-20241022": "anthropic/claude-3.5-sonnet"},
+	}
+
+	assert.Equal(t, "anthropic/claude-3.5-sonnet", provider.MapModel("claude-3-5-sonnet-20241022"))
+	assert.Equal(t, "anthropic/claude-3.5-sonnet:online", provider.MapModel("claude-3-5-sonnet-20241022:online"))
+	assert.Equal(t, "openai/gpt-4o", provider.MapModel("openai/gpt-4o"), "unmapped models should pass through")
+}
+
+func TestProvider_UsesFullURL(t *testing.T) {
+	tempDir := t.TempDir()
+	mgr := NewManager(tempDir)
+
+	yamlConfig := `
+providers:
+  - name: gateway
+    url: https://gateway.example.com/v1
+    api_key: test-key
+    base_is_full_url: false
+  - name: openai
+    api_key: test-key
+`
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultYAMLFilename), []byte(yamlConfig), 0644))
+
+	cfg, err := mgr.Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.Providers, 2)
+
+	assert.False(t, cfg.Providers[0].UsesFullURL())
+	assert.True(t, cfg.Providers[1].UsesFullURL(), "URLs are full endpoint URLs unless configured otherwise")
+}
+
 func TestManager_DefaultsApplication(t *testing.T) {
 	tempDir := t.TempDir()
 	mgr := NewManager(tempDir)
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// ReloadSummary is the JSON document served by the reload endpoint
+type ReloadSummary struct {
+	Reloaded  bool                 `json:"reloaded"`
+	Error     string               `json:"error,omitempty"`
+	Providers []ProviderSummary    `json:"providers,omitempty"`
+	Router    *config.RouterConfig `json:"router,omitempty"`
+}
+
+// ProviderSummary lists a configured provider and its models
+type ProviderSummary struct {
+	Name          string   `json:"name"`
+	Models        []string `json:"models,omitempty"`
+	DefaultModels []string `json:"default_models,omitempty"`
+}
+
+// ReloadHandler reloads the configuration on POST, for environments where sending the
+// server a SIGHUP is awkward
+type ReloadHandler struct {
+	reload func() (*config.Config, error)
+	config *config.Manager
+	logger *slog.Logger
+}
+
+// NewReloadHandler returns a handler that calls reload, which must keep the current
+// configuration when the new one fails to load
+func NewReloadHandler(reload func() (*config.Config, error), config *config.Manager, logger *slog.Logger) *ReloadHandler {
+	return &ReloadHandler{
+		reload: reload,
+		config: config,
+		logger: logger,
+	}
+}
+
+func (h *ReloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	// Without an API key or request signatures the endpoint would be open to anyone who
+	// can reach the proxy
+	if cfg := h.config.Get(); cfg.APIKey == "" && cfg.InboundHMACSecret == "" {
+		h.logger.Warn("Refusing configuration reload, no api_key or inbound_hmac_secret is configured", "remote_addr", r.RemoteAddr)
+		http.Error(w, "reloading over HTTP requires api_key or inbound_hmac_secret to be configured", http.StatusForbidden)
+
+		return
+	}
+
+	status := http.StatusOK
+
+	var summary ReloadSummary
+
+	cfg, err := h.reload()
+	if err != nil {
+		h.logger.Error("Configuration reload failed, keeping the current configuration", "error", err)
+
+		status = http.StatusInternalServerError
+		summary.Error = err.Error()
+	} else {
+		summary.Reloaded = true
+		summary.Router = &cfg.Router
+
+		for _, provider := range cfg.Providers {
+			summary.Providers = append(summary.Providers, ProviderSummary{
+				Name:          provider.Name,
+				Models:        provider.Models,
+				DefaultModels: provider.DefaultModels,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		h.logger.Error("Failed to write reload response", "error", err)
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// globalLimitKey is the limiter key of the cap shared by all providers
+const globalLimitKey = ""
+
+// requestPriority orders requests waiting for a concurrency slot; lower values are served first
+type requestPriority int
+
+const (
+	priorityInteractive requestPriority = iota
+	priorityBackground
+
+	priorityLevels
+)
+
+// routePriority gives requests for the background bucket's model the lower priority, so that
+// cheap asynchronous work queues behind the requests a user is waiting for
+func routePriority(modelName string, router *config.RouterConfig) requestPriority {
+	if router.Background != "" && modelName == router.Background {
+		return priorityBackground
+	}
+
+	return priorityInteractive
+}
+
+// concurrencyLimiter caps the upstream requests in flight, across all providers and per
+// provider. Caps follow configuration reloads: a changed cap starts a new semaphore and
+// requests holding a slot of the old one release it when they finish.
+type concurrencyLimiter struct {
+	mu    sync.Mutex
+	slots map[string]*prioritySemaphore
+}
+
+func newConcurrencyLimiter() *concurrencyLimiter {
+	return &concurrencyLimiter{slots: make(map[string]*prioritySemaphore)}
+}
+
+// acquire takes a slot of the provider and then a global slot, waiting up to the configured
+// queue timeout for each. Requests queued behind a busy provider hold no global slot, so
+// they don't hold up other providers. The returned function releases both and must be
+// called once done.
+func (l *concurrencyLimiter) acquire(ctx context.Context, cfg *config.Config, provider *config.Provider, priority requestPriority) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	wait := cfg.ConcurrencyQueueWait()
+
+	releaseProvider, err := l.acquireSlot(ctx, provider.Name, provider.MaxConcurrentRequests, priority, wait)
+	if err != nil {
+		return nil, fmt.Errorf("all %d concurrent request slots of provider '%s' are in use: %w",
+			provider.MaxConcurrentRequests, provider.Name, err)
+	}
+
+	releaseGlobal, err := l.acquireSlot(ctx, globalLimitKey, cfg.MaxConcurrentRequests, priority, wait)
+	if err != nil {
+		releaseProvider()
+		return nil, fmt.Errorf("all %d concurrent request slots are in use: %w", cfg.MaxConcurrentRequests, err)
+	}
+
+	return func() {
+		releaseGlobal()
+		releaseProvider()
+	}, nil
+}
+
+// acquireSlot takes a slot of the semaphore for key, sized limit; a limit of zero or less
+// means no cap
+func (l *concurrencyLimiter) acquireSlot(ctx context.Context, key string, limit int, priority requestPriority, wait time.Duration) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	return l.semaphore(key, limit).acquire(ctx, priority, wait)
+}
+
+// semaphore returns the semaphore for key, replacing it when the limit has changed
+func (l *concurrencyLimiter) semaphore(key string, limit int) *prioritySemaphore {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots, ok := l.slots[key]
+	if !ok || slots.limit != limit {
+		slots = &prioritySemaphore{limit: limit}
+		l.slots[key] = slots
+	}
+
+	return slots
+}
+
+// prioritySemaphore hands out limit slots. A freed slot goes to the longest waiting request
+// of the highest priority, so interactive requests overtake queued background ones.
+type prioritySemaphore struct {
+	limit int
+
+	mu      sync.Mutex
+	inUse   int
+	waiters [priorityLevels][]chan struct{}
+}
+
+func (s *prioritySemaphore) acquire(ctx context.Context, priority requestPriority, wait time.Duration) (func(), error) {
+	s.mu.Lock()
+
+	if s.inUse < s.limit && !s.hasWaiters() {
+		s.inUse++
+		s.mu.Unlock()
+
+		return s.release, nil
+	}
+
+	if wait <= 0 {
+		s.mu.Unlock()
+		return nil, errors.New("queueing is disabled")
+	}
+
+	granted := make(chan struct{})
+	s.waiters[priority] = append(s.waiters[priority], granted)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var err error
+
+	select {
+	case <-granted:
+		return s.release, nil
+	case <-timer.C:
+		err = fmt.Errorf("no slot freed up within %s", wait)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.removeWaiter(priority, granted) {
+		// The slot was handed over while giving up, so pass it on
+		s.releaseLocked()
+	}
+
+	return nil, err
+}
+
+func (s *prioritySemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked()
+}
+
+// releaseLocked gives the slot to the next waiter, or frees it when nobody waits
+func (s *prioritySemaphore) releaseLocked() {
+	for priority := range s.waiters {
+		if queue := s.waiters[priority]; len(queue) > 0 {
+			s.waiters[priority] = queue[1:]
+			close(queue[0])
+
+			return
+		}
+	}
+
+	s.inUse--
+}
+
+func (s *prioritySemaphore) hasWaiters() bool {
+	for _, queue := range s.waiters {
+		if len(queue) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeWaiter drops granted from the queue, reporting false when it had already been served
+func (s *prioritySemaphore) removeWaiter(priority requestPriority, granted chan struct{}) bool {
+	queue := s.waiters[priority]
+
+	for i, waiter := range queue {
+		if waiter == granted {
+			s.waiters[priority] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
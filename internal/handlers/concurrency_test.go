@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// newConcurrencyTestHandler returns a handler for an OpenAI upstream that answers after a
+// short delay, and the highest number of requests the upstream saw at once
+func newConcurrencyTestHandler(t *testing.T, cfg *config.Config, providerLimit int) (*ProxyHandler, *atomic.Int32) {
+	t.Helper()
+
+	var inFlight, peak atomic.Int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			seen := peak.Load()
+			if current <= seen || peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg.Providers = []config.Provider{{
+		Name:                  "openai",
+		APIBase:               upstream.URL + "/v1/chat/completions",
+		APIKey:                "test-key",
+		MaxConcurrentRequests: providerLimit,
+	}}
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(cfg))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	return NewProxyHandler(cfgMgr, registry, logger), &peak
+}
+
+// sendConcurrently sends n requests at once and returns their status codes and bodies
+func sendConcurrently(handler http.Handler, n int) ([]int, []string) {
+	codes := make([]int, n)
+	bodies := make([]string, n)
+
+	var wg sync.WaitGroup
+
+	for i := range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			codes[i] = rr.Code
+			bodies[i] = rr.Body.String()
+		}()
+	}
+
+	wg.Wait()
+
+	return codes, bodies
+}
+
+func TestServeHTTP_ConcurrencyLimitQueues(t *testing.T) {
+	handler, peak := newConcurrencyTestHandler(t, &config.Config{
+		MaxConcurrentRequests: 2,
+	}, 0)
+
+	codes, bodies := sendConcurrently(handler, 6)
+
+	for i, code := range codes {
+		assert.Equal(t, http.StatusOK, code, bodies[i])
+	}
+
+	assert.Equal(t, int32(2), peak.Load(), "no more than the cap may reach the upstream at once")
+}
+
+func TestServeHTTP_ProviderConcurrencyLimitRejects(t *testing.T) {
+	handler, peak := newConcurrencyTestHandler(t, &config.Config{
+		ConcurrencyQueueTimeout: -1,
+	}, 1)
+
+	codes, bodies := sendConcurrently(handler, 4)
+
+	accepted := 0
+
+	for i, code := range codes {
+		if code == http.StatusOK {
+			accepted++
+			continue
+		}
+
+		require.Equal(t, http.StatusServiceUnavailable, code, bodies[i])
+
+		var errorResp map[string]any
+		require.NoError(t, json.Unmarshal([]byte(bodies[i]), &errorResp))
+
+		errorDetails, ok := errorResp["error"].(map[string]any)
+		require.True(t, ok, "error details should be an object")
+		assert.Equal(t, "overloaded_error", errorDetails["type"])
+		assert.Contains(t, errorDetails["message"], "provider 'openai'")
+	}
+
+	assert.GreaterOrEqual(t, accepted, 1)
+	assert.Less(t, accepted, 4, "requests over the cap are rejected without queueing")
+	assert.Equal(t, int32(1), peak.Load())
+}
+
+func TestConcurrencyLimiter_LimitChange(t *testing.T) {
+	limiter := newConcurrencyLimiter()
+	ctx := t.Context()
+
+	release, err := limiter.acquireSlot(ctx, "openai", 1, priorityInteractive, 0)
+	require.NoError(t, err)
+
+	_, err = limiter.acquireSlot(ctx, "openai", 1, priorityInteractive, 0)
+	require.Error(t, err, "the only slot is taken")
+
+	// A raised cap applies right away; the old slot is still released without blocking
+	second, err := limiter.acquireSlot(ctx, "openai", 2, priorityInteractive, 0)
+	require.NoError(t, err)
+
+	release()
+	second()
+}
+
+func TestConcurrencyLimiter_BusyProviderDoesNotBlockOthers(t *testing.T) {
+	limiter := newConcurrencyLimiter()
+	ctx := t.Context()
+
+	cfg := &config.Config{MaxConcurrentRequests: 2, ConcurrencyQueueTimeout: 60}
+	busy := &config.Provider{Name: "openai", MaxConcurrentRequests: 1}
+
+	release, err := limiter.acquire(ctx, cfg, busy, priorityInteractive)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for range 2 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			release, err := limiter.acquire(ctx, cfg, busy, priorityInteractive)
+			if assert.NoError(t, err) {
+				release()
+			}
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		slots := limiter.semaphore(busy.Name, 1)
+
+		slots.mu.Lock()
+		defer slots.mu.Unlock()
+
+		return len(slots.waiters[priorityInteractive]) == 2
+	}, time.Second, time.Millisecond)
+
+	// Only one request is upstream, so another provider still gets the second global slot
+	other, err := limiter.acquire(ctx, &config.Config{MaxConcurrentRequests: 2, ConcurrencyQueueTimeout: -1}, &config.Provider{Name: "gemini"}, priorityInteractive)
+	require.NoError(t, err, "requests queued for a busy provider should not hold global slots")
+
+	other()
+	release()
+	wg.Wait()
+}
+
+func TestConcurrencyLimiter_InteractiveBeforeBackground(t *testing.T) {
+	limiter := newConcurrencyLimiter()
+	ctx := t.Context()
+
+	release, err := limiter.acquireSlot(ctx, "openai", 1, priorityInteractive, 0)
+	require.NoError(t, err)
+
+	var (
+		mu     sync.Mutex
+		served []string
+		wg     sync.WaitGroup
+	)
+
+	queued := 0
+
+	queue := func(name string, priority requestPriority) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			release, err := limiter.acquireSlot(ctx, "openai", 1, priority, time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			mu.Lock()
+			served = append(served, name)
+			mu.Unlock()
+
+			release()
+		}()
+
+		// Wait until the request is queued, so the queueing order is fixed
+		queued++
+
+		require.Eventually(t, func() bool {
+			slots := limiter.semaphore("openai", 1)
+
+			slots.mu.Lock()
+			defer slots.mu.Unlock()
+
+			return len(slots.waiters[priorityInteractive])+len(slots.waiters[priorityBackground]) == queued
+		}, time.Second, time.Millisecond)
+	}
+
+	queue("background-1", priorityBackground)
+	queue("background-2", priorityBackground)
+	queue("interactive", priorityInteractive)
+
+	release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"interactive", "background-1", "background-2"}, served)
+}
+
+func TestRoutePriority(t *testing.T) {
+	router := &config.RouterConfig{
+		Default:    "openai,gpt-4o",
+		Background: "openai,gpt-4o-mini",
+	}
+
+	assert.Equal(t, priorityBackground, routePriority("openai,gpt-4o-mini", router))
+	assert.Equal(t, priorityInteractive, routePriority("openai,gpt-4o", router))
+	assert.Equal(t, priorityInteractive, routePriority("", &config.RouterConfig{}))
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// debugBodyLimit caps how much of each body an exchange keeps
+const debugBodyLimit = 256 << 10
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveHeaders are replaced in captured upstream headers (lower case)
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"x-goog-api-key":      true,
+	"api-key":             true,
+	"cookie":              true,
+}
+
+// DebugExchange is one proxied request with its bodies on both sides of the transformation
+type DebugExchange struct {
+	Time             time.Time         `json:"time"`
+	Provider         string            `json:"provider"`
+	Model            string            `json:"model"`
+	URL              string            `json:"url"`
+	StatusCode       int               `json:"status_code"`
+	UpstreamHeaders  map[string]string `json:"upstream_headers,omitempty"`
+	ClientRequest    string            `json:"client_request"`
+	UpstreamRequest  string            `json:"upstream_request"`
+	UpstreamResponse string            `json:"upstream_response"`
+	ClientResponse   string            `json:"client_response"`
+	Truncated        bool              `json:"truncated,omitempty"`
+}
+
+// DebugCapture keeps the most recent exchanges in a ring buffer
+type DebugCapture struct {
+	mu      sync.Mutex
+	entries []DebugExchange
+	next    int
+	count   int
+}
+
+func NewDebugCapture() *DebugCapture {
+	return &DebugCapture{}
+}
+
+// add stores an exchange, overwriting the oldest once size exchanges are kept.
+// A nil receiver is a no-op.
+func (c *DebugCapture) add(exchange DebugExchange, size int) {
+	if c == nil {
+		return
+	}
+
+	if size <= 0 {
+		size = config.DefaultDebugCaptureSize
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) != size {
+		// The configured size changed; keep the newest exchanges that still fit
+		recent := c.last()
+		if len(recent) > size {
+			recent = recent[:size]
+		}
+
+		c.entries = make([]DebugExchange, size)
+		c.next, c.count = 0, 0
+
+		for i := len(recent) - 1; i >= 0; i-- {
+			c.push(recent[i])
+		}
+	}
+
+	c.push(exchange)
+}
+
+func (c *DebugCapture) push(exchange DebugExchange) {
+	c.entries[c.next] = exchange
+	c.next = (c.next + 1) % len(c.entries)
+
+	if c.count < len(c.entries) {
+		c.count++
+	}
+}
+
+// Last returns the kept exchanges, newest first
+func (c *DebugCapture) Last() []DebugExchange {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last()
+}
+
+func (c *DebugCapture) last() []DebugExchange {
+	exchanges := make([]DebugExchange, 0, c.count)
+
+	for i := 1; i <= c.count; i++ {
+		exchanges = append(exchanges, c.entries[(c.next-i+len(c.entries))%len(c.entries)])
+	}
+
+	return exchanges
+}
+
+// debugRecorder collects a single exchange while the proxy handles it. All methods
+// accept a nil receiver, which is what requests get when debug capture is off.
+type debugRecorder struct {
+	exchange DebugExchange
+	apiKey   string
+	upstream limitedBuffer
+	client   limitedBuffer
+}
+
+// startDebugCapture begins recording the exchange when debug capture is enabled
+func (h *ProxyHandler) startDebugCapture(cfg *config.Config, clientRequest []byte) *debugRecorder {
+	if !cfg.Debug {
+		return nil
+	}
+
+	recorder := &debugRecorder{
+		exchange: DebugExchange{Time: time.Now()},
+	}
+
+	var request limitedBuffer
+	request.Write(clientRequest)
+	recorder.exchange.ClientRequest = request.String()
+	recorder.exchange.Truncated = request.truncated
+
+	return recorder
+}
+
+// setUpstreamRequest records the transformed request sent to the provider
+func (r *debugRecorder) setUpstreamRequest(req *http.Request, body []byte, provider, model, apiKey string) {
+	if r == nil {
+		return
+	}
+
+	r.apiKey = apiKey
+	r.exchange.Provider = provider
+	r.exchange.Model = model
+	r.exchange.URL = redactURL(req.URL)
+	r.exchange.UpstreamHeaders = make(map[string]string, len(req.Header))
+
+	for key, values := range req.Header {
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[strings.ToLower(key)] {
+			value = redactedValue
+		}
+
+		r.exchange.UpstreamHeaders[key] = value
+	}
+
+	var upstreamRequest limitedBuffer
+	upstreamRequest.Write(body)
+	r.exchange.UpstreamRequest = upstreamRequest.String()
+	r.exchange.Truncated = r.exchange.Truncated || upstreamRequest.truncated
+}
+
+// wrap tees the upstream response body and the response written to the client
+func (r *debugRecorder) wrap(w http.ResponseWriter, resp *http.Response) http.ResponseWriter {
+	if r == nil {
+		return w
+	}
+
+	r.exchange.StatusCode = resp.StatusCode
+	resp.Body = &debugReadCloser{ReadCloser: resp.Body, body: &r.upstream}
+
+	return &debugResponseWriter{ResponseWriter: w, body: &r.client}
+}
+
+// finishDebugCapture stores the completed exchange
+func (h *ProxyHandler) finishDebugCapture(r *debugRecorder, resp *http.Response, size int) {
+	if r == nil {
+		return
+	}
+
+	// The raw upstream body may be compressed; keep whatever decodes, even if it was truncated
+	upstream := r.upstream.Bytes()
+	if resp.Header.Get("Content-Encoding") != "" {
+		reader, err := h.decompressReader(&http.Response{
+			Header: resp.Header,
+			Body:   io.NopCloser(bytes.NewReader(upstream)),
+		})
+		if err == nil {
+			upstream, _ = io.ReadAll(reader)
+		}
+	}
+
+	r.exchange.UpstreamResponse = string(upstream)
+	r.exchange.ClientResponse = r.client.String()
+	r.exchange.Truncated = r.exchange.Truncated || r.upstream.truncated || r.client.truncated
+
+	// A key echoed back anywhere (an error message, a URL) must not leak either
+	if r.apiKey != "" {
+		for _, field := range []*string{
+			&r.exchange.ClientRequest,
+			&r.exchange.UpstreamRequest,
+			&r.exchange.UpstreamResponse,
+			&r.exchange.ClientResponse,
+			&r.exchange.URL,
+		} {
+			*field = strings.ReplaceAll(*field, r.apiKey, redactedValue)
+		}
+	}
+
+	h.debug.add(r.exchange, size)
+}
+
+// redactURL hides API keys passed as query parameters
+func redactURL(u *url.URL) string {
+	redacted := *u
+
+	query := redacted.Query()
+	for key := range query {
+		if lower := strings.ToLower(key); lower == "key" || strings.Contains(lower, "api_key") || strings.Contains(lower, "apikey") {
+			query.Set(key, redactedValue)
+		}
+	}
+
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
+// limitedBuffer keeps the first debugBodyLimit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := debugBodyLimit - b.Len(); len(data) > room {
+		b.truncated = true
+		b.Buffer.Write(data[:max(room, 0)])
+
+		return len(data), nil
+	}
+
+	return b.Buffer.Write(data)
+}
+
+type debugReadCloser struct {
+	io.ReadCloser
+	body *limitedBuffer
+}
+
+func (rc *debugReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	rc.body.Write(p[:n])
+
+	return n, err
+}
+
+type debugResponseWriter struct {
+	http.ResponseWriter
+	body *limitedBuffer
+}
+
+func (w *debugResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *debugResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// streamCheckWriter keeps the stream written to the client so that its events can be
+// validated once it ends
+type streamCheckWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *streamCheckWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *streamCheckWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *streamCheckWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// checkStream wraps w to record the stream when stream validation is enabled
+func (h *ProxyHandler) checkStream(w http.ResponseWriter) (http.ResponseWriter, *streamCheckWriter) {
+	if !h.validateStreams {
+		return w, nil
+	}
+
+	checker := &streamCheckWriter{ResponseWriter: w, status: http.StatusOK}
+
+	return checker, checker
+}
+
+// validateStream logs how a successful event stream sent to the client breaks Anthropic's
+// event ordering rules. Other responses, such as JSON errors, are not checked.
+func (h *ProxyHandler) validateStream(checker *streamCheckWriter, provider, model string) {
+	if checker == nil || checker.status != http.StatusOK ||
+		!strings.HasPrefix(checker.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+
+	if err := providers.ValidateAnthropicSSE(checker.body.Bytes()); err != nil {
+		h.logger.Warn("Stream sent to the client is not a valid Anthropic event stream",
+			"provider", provider, "model", model, "violations", err.Error())
+	}
+}
+
+// DebugHandler serves the captured exchanges; it answers 404 unless debug is enabled
+type DebugHandler struct {
+	capture *DebugCapture
+	config  *config.Manager
+	logger  *slog.Logger
+}
+
+func NewDebugHandler(capture *DebugCapture, config *config.Manager, logger *slog.Logger) *DebugHandler {
+	return &DebugHandler{
+		capture: capture,
+		config:  config,
+		logger:  logger,
+	}
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if cfg := h.config.Get(); cfg == nil || !cfg.Debug {
+		http.NotFound(w, r)
+		return
+	}
+
+	exchanges := h.capture.Last()
+	if exchanges == nil {
+		exchanges = []DebugExchange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(exchanges); err != nil {
+		h.logger.Error("Failed to write debug response", "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestDebugCapture_RecordsTransformedBodies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi there"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "sk-secret-key"},
+		},
+		Debug: true,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	proxy := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"system":"Be brief","messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	debugHandler := NewDebugHandler(proxy.DebugCapture(), cfgMgr, logger)
+	rr = httptest.NewRecorder()
+	debugHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/last", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var exchanges []DebugExchange
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &exchanges))
+	require.Len(t, exchanges, 1)
+
+	exchange := exchanges[0]
+	assert.Equal(t, "openai", exchange.Provider)
+	assert.Equal(t, http.StatusOK, exchange.StatusCode)
+
+	// Request: Anthropic in, OpenAI out (the system prompt becomes a message)
+	assert.Contains(t, exchange.ClientRequest, `"system":"Be brief"`)
+	assert.Contains(t, exchange.UpstreamRequest, `"role":"system"`)
+	assert.NotContains(t, exchange.UpstreamRequest, `"system":"Be brief"`)
+
+	// Response: OpenAI in, Anthropic out
+	assert.Contains(t, exchange.UpstreamResponse, `"choices"`)
+	assert.Contains(t, exchange.ClientResponse, `"type":"message"`)
+	assert.Contains(t, exchange.ClientResponse, "Hi there")
+
+	assert.Equal(t, redactedValue, exchange.UpstreamHeaders["Authorization"])
+	assert.NotContains(t, rr.Body.String(), "sk-secret-key")
+}
+
+func TestDebugCapture_KeepsLastN(t *testing.T) {
+	capture := NewDebugCapture()
+
+	for i := 1; i <= 5; i++ {
+		capture.add(DebugExchange{Model: fmt.Sprintf("model-%d", i)}, 3)
+	}
+
+	models := func() []string {
+		var names []string
+		for _, exchange := range capture.Last() {
+			names = append(names, exchange.Model)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"model-5", "model-4", "model-3"}, models())
+
+	// Shrinking the buffer keeps the newest exchanges
+	capture.add(DebugExchange{Model: "model-6"}, 2)
+	assert.Equal(t, []string{"model-6", "model-5"}, models())
+}
+
+func TestDebugHandler_DisabledByDefault(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{}))
+
+	capture := NewDebugCapture()
+	capture.add(DebugExchange{Model: "gpt-4o"}, 1)
+
+	rr := httptest.NewRecorder()
+	NewDebugHandler(capture, cfgMgr, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/last", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "gpt-4o")
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// estimatedUsageField marks usage whose output_tokens the proxy estimated because the
+// provider reported none
+const estimatedUsageField = "output_tokens_estimated"
+
+// outputEstimator collects the text a stream generates so that a message_delta without
+// output tokens can carry an estimate instead
+type outputEstimator struct {
+	count func(string) int
+	text  strings.Builder
+}
+
+func newOutputEstimator(count func(string) int) *outputEstimator {
+	return &outputEstimator{count: count}
+}
+
+// process records the generated text of the events and fills in missing output tokens of
+// their message_delta. Events without data lines, such as passthrough payloads with usage,
+// come back unchanged.
+func (e *outputEstimator) process(events []byte) []byte {
+	if !bytes.Contains(events, []byte("content_block_delta")) && !bytes.Contains(events, []byte("message_delta")) {
+		return events
+	}
+
+	lines := bytes.Split(events, []byte("\n"))
+	changed := false
+
+	for i, line := range lines {
+		// Passthrough providers return the bare JSON payload without the data: prefix
+		prefix := []byte{}
+		data := line
+
+		if rest, ok := bytes.CutPrefix(line, []byte("data: ")); ok {
+			prefix = []byte("data: ")
+			data = rest
+		}
+
+		if !bytes.HasPrefix(data, []byte("{")) {
+			continue
+		}
+
+		var event map[string]any
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+
+		switch event["type"] {
+		case "content_block_delta":
+			delta, _ := event["delta"].(map[string]any)
+			for _, field := range []string{"text", "partial_json", "thinking"} {
+				if text, ok := delta[field].(string); ok {
+					e.text.WriteString(text)
+				}
+			}
+		case "message_delta":
+			usage, _ := event["usage"].(map[string]any)
+			if output, ok := usage["output_tokens"].(float64); ok && output > 0 {
+				continue
+			}
+
+			estimated := e.count(e.text.String())
+			if estimated == 0 {
+				continue
+			}
+
+			if usage == nil {
+				usage = make(map[string]any)
+			}
+
+			usage["output_tokens"] = estimated
+			usage[estimatedUsageField] = true
+			event["usage"] = usage
+
+			updated, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+
+			lines[i] = append(prefix, updated...)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return events
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// estimateResponseUsage fills in output tokens of a converted response that has none
+func (h *ProxyHandler) estimateResponseUsage(body []byte) []byte {
+	updatedBody, estimated := estimateOutputTokens(body, h.countTokens)
+	if estimated > 0 {
+		h.logger.Debug("Provider reported no output tokens, using an estimate", "output_tokens", estimated)
+	}
+
+	return updatedBody
+}
+
+// estimateOutputTokens counts the text, thinking and tool inputs of a response without
+// output tokens and adds the count to its usage. It returns the estimate, or zero when the
+// body was left unchanged.
+func estimateOutputTokens(body []byte, count func(string) int) ([]byte, int) {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body, 0
+	}
+
+	usage, _ := response["usage"].(map[string]any)
+	if output, ok := usage["output_tokens"].(float64); ok && output > 0 {
+		return body, 0
+	}
+
+	var text strings.Builder
+
+	content, _ := response["content"].([]any)
+	for _, block := range content {
+		blockMap, _ := block.(map[string]any)
+
+		for _, field := range []string{"text", "thinking"} {
+			if value, ok := blockMap[field].(string); ok {
+				text.WriteString(value)
+			}
+		}
+
+		if input, ok := blockMap["input"]; ok {
+			if inputJSON, err := json.Marshal(input); err == nil {
+				text.Write(inputJSON)
+			}
+		}
+	}
+
+	estimated := count(text.String())
+	if estimated == 0 {
+		return body, 0
+	}
+
+	if usage == nil {
+		usage = make(map[string]any)
+	}
+
+	usage["output_tokens"] = estimated
+	usage[estimatedUsageField] = true
+	response["usage"] = usage
+
+	updatedBody, err := json.Marshal(response)
+	if err != nil {
+		return body, 0
+	}
+
+	return updatedBody, estimated
+}
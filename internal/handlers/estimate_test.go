@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// countWords stands in for the tokenizer, which is downloaded on first use
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestEstimateOutputTokens_ResponseWithoutUsage(t *testing.T) {
+	provider := providers.NewOpenAIProvider()
+
+	// A gateway response without any usage
+	converted, err := provider.TransformResponse([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,` +
+		`"message":{"role":"assistant","content":"Four words of output"},"finish_reason":"stop"}]}`))
+	require.NoError(t, err)
+
+	body, estimated := estimateOutputTokens(converted, countWords)
+	assert.Equal(t, 4, estimated)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(body, &response))
+
+	usage := response["usage"].(map[string]any)
+	assert.Equal(t, float64(4), usage["output_tokens"])
+	assert.Equal(t, true, usage[estimatedUsageField])
+
+	// Reported usage is left alone
+	reported := []byte(`{"type":"message","content":[{"type":"text","text":"Hi there"}],"usage":{"input_tokens":3,"output_tokens":9}}`)
+	body, estimated = estimateOutputTokens(reported, countWords)
+	assert.Zero(t, estimated)
+	assert.Equal(t, reported, body)
+}
+
+func TestOutputEstimator_StreamWithoutUsage(t *testing.T) {
+	stream := `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Streaming three"}}]}
+
+data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":" words"}}]}
+
+data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+`
+
+	events, err := providers.ProcessSSEStream(strings.NewReader(stream), providers.NewOpenAIProvider())
+	require.NoError(t, err)
+
+	estimator := newOutputEstimator(countWords)
+
+	var usage map[string]any
+
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		require.NoError(t, err)
+
+		processed := estimator.process(providers.FormatSSEEvent(event.Type, json.RawMessage(data)))
+
+		parsed, err := providers.ParseSSEEvents(processed)
+		require.NoError(t, err)
+		require.Len(t, parsed, 1)
+
+		if parsed[0].Type == "message_delta" {
+			usage, _ = parsed[0].Data["usage"].(map[string]any)
+		}
+	}
+
+	require.NotNil(t, usage, "message_delta should carry usage")
+	assert.Equal(t, float64(3), usage["output_tokens"])
+	assert.Equal(t, true, usage[estimatedUsageField])
+}
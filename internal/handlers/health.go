@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"log/slog"
 	"net/http"
 )
@@ -23,3 +24,47 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("Failed to write health check response", "error", err)
 	}
 }
+
+// ReadinessReport is the JSON document served by the readiness endpoint
+type ReadinessReport struct {
+	Ready     bool          `json:"ready"`
+	Providers []ProbeResult `json:"providers"`
+}
+
+// ReadyHandler reports ready only when every probed provider is reachable
+type ReadyHandler struct {
+	prober *ProviderProber
+	logger *slog.Logger
+}
+
+func NewReadyHandler(prober *ProviderProber, logger *slog.Logger) *ReadyHandler {
+	return &ReadyHandler{
+		prober: prober,
+		logger: logger,
+	}
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := ReadinessReport{
+		Ready:     true,
+		Providers: h.prober.Results(),
+	}
+
+	for _, result := range report.Providers {
+		if !result.Reachable {
+			report.Ready = false
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.logger.Error("Failed to write readiness response", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// applyPreRequestHook pipes the request through the configured hook command,
+// falling back to the original body if the hook fails or returns invalid JSON
+func (h *ProxyHandler) applyPreRequestHook(ctx context.Context, cfg *config.Config, body []byte) []byte {
+	if cfg.PreRequestHook == "" {
+		return body
+	}
+
+	timeoutSeconds := cfg.PreRequestHookTimeout
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = config.DefaultPreRequestHookTimeoutSeconds
+	}
+
+	modified, err := h.runPreRequestHook(ctx, cfg.PreRequestHook, time.Duration(timeoutSeconds)*time.Second, body)
+	if err != nil {
+		h.logger.Warn("Pre-request hook failed, using original request", "hook", cfg.PreRequestHook, "error", err)
+		return body
+	}
+
+	h.logger.Debug("Pre-request hook applied", "hook", cfg.PreRequestHook)
+
+	return modified
+}
+
+func (h *ProxyHandler) runPreRequestHook(ctx context.Context, hook string, timeout time.Duration, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, hook)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on pipes held open by children of a killed hook
+	cmd.WaitDelay = 500 * time.Millisecond
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if !json.Valid(output) {
+		return nil, errors.New("hook output is not valid JSON")
+	}
+
+	return output, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func writeHookScript(t *testing.T, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts require a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700))
+
+	return path
+}
+
+func TestApplyPreRequestHook(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	body := []byte(`{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"Hi"}]}`)
+
+	testCases := []struct {
+		name           string
+		script         string
+		timeout        int
+		expectedSystem any
+	}{
+		{
+			name:           "hook injects system prompt",
+			script:         `sed 's/^{/{"system":"Always answer in French.",/'`,
+			expectedSystem: "Always answer in French.",
+		},
+		{
+			name:   "failing hook falls back to original",
+			script: "echo 'boom' >&2; exit 1",
+		},
+		{
+			name:   "invalid JSON falls back to original",
+			script: "echo 'not json'",
+		},
+		{
+			name:    "slow hook times out",
+			script:  "sleep 5",
+			timeout: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				PreRequestHook:        writeHookScript(t, tc.script),
+				PreRequestHookTimeout: tc.timeout,
+			}
+
+			result := handler.applyPreRequestHook(context.Background(), cfg, body)
+
+			var parsed map[string]any
+			require.NoError(t, json.Unmarshal(result, &parsed))
+			assert.Equal(t, "claude-3-5-sonnet", parsed["model"])
+			assert.Equal(t, tc.expectedSystem, parsed["system"])
+			assert.Len(t, parsed["messages"], 1)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"slices"
+	"sync"
+)
+
+// apiKeyRotator hands out each provider's API keys round-robin, one key per request, to
+// spread the load over the provider's rate limits
+type apiKeyRotator struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func newAPIKeyRotator() *apiKeyRotator {
+	return &apiKeyRotator{next: make(map[string]int)}
+}
+
+// pick returns the key for the next request to the provider
+func (r *apiKeyRotator) pick(provider string, keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	if r == nil || len(keys) == 1 {
+		return keys[0]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.next[provider] % len(keys)
+	r.next[provider] = i + 1
+
+	return keys[i]
+}
+
+// nextKey returns the key after current in keys, wrapping around
+func nextKey(keys []string, current string) string {
+	return keys[(slices.Index(keys, current)+1)%len(keys)]
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// newKeyRotationTestHandler returns a handler for an OpenAI upstream with the given keys that
+// rate limits the keys in limited, and the Authorization headers the upstream saw
+func newKeyRotationTestHandler(t *testing.T, keys []string, limited ...string) (*ProxyHandler, func() []string) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		for _, limitedKey := range limited {
+			if key == limitedKey {
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"error":{"type":"rate_limit_error","message":"slow down"}}`)
+
+				return
+			}
+		}
+
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{
+			Name:    "openai",
+			APIBase: upstream.URL + "/v1/chat/completions",
+			APIKey:  keys[0],
+			APIKeys: keys,
+		}},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	return NewProxyHandler(cfgMgr, registry, logger), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), seen...)
+	}
+}
+
+func sendKeyRotationRequest(t *testing.T, handler http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestServeHTTP_APIKeysRotate(t *testing.T) {
+	handler, seen := newKeyRotationTestHandler(t, []string{"key-1", "key-2", "key-3"})
+
+	for range 4 {
+		rr := sendKeyRotationRequest(t, handler)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	assert.Equal(t, []string{"key-1", "key-2", "key-3", "key-1"}, seen())
+}
+
+func TestServeHTTP_RateLimitedKeyRetriesWithNextKey(t *testing.T) {
+	handler, seen := newKeyRotationTestHandler(t, []string{"key-1", "key-2", "key-3"}, "key-1")
+
+	rr := sendKeyRotationRequest(t, handler)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, []string{"key-1", "key-2"}, seen())
+}
+
+func TestServeHTTP_AllKeysRateLimited(t *testing.T) {
+	handler, seen := newKeyRotationTestHandler(t, []string{"key-1", "key-2"}, "key-1", "key-2")
+
+	rr := sendKeyRotationRequest(t, handler)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, rr.Body.String(), "rate_limit_error")
+	assert.Equal(t, []string{"key-1", "key-2"}, seen(), "each key is tried once")
+}
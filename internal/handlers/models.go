@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// modelsPath is the endpoint listing models; a model's own entry is served below it
+const modelsPath = "/v1/models"
+
+// ModelEntry describes one configured model. ID is the "provider,model" name requests use.
+type ModelEntry struct {
+	Type            string               `json:"type"`
+	ID              string               `json:"id"`
+	DisplayName     string               `json:"display_name"`
+	Provider        string               `json:"provider"`
+	ContextWindow   int                  `json:"context_window,omitempty"`
+	MaxOutputTokens int                  `json:"max_output_tokens,omitempty"`
+	Pricing         *config.ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelList is the JSON document served by the models endpoint
+type ModelList struct {
+	Data    []ModelEntry `json:"data"`
+	HasMore bool         `json:"has_more"`
+}
+
+// ModelsHandler serves the configured models with their metadata at /v1/models and a
+// single model at /v1/models/{model}
+type ModelsHandler struct {
+	config *config.Manager
+	logger *slog.Logger
+}
+
+func NewModelsHandler(cfg *config.Manager, logger *slog.Logger) *ModelsHandler {
+	return &ModelsHandler{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	entries := modelEntries(h.config.Get())
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, modelsPath), "/")
+	if name == "" {
+		h.writeJSON(w, http.StatusOK, ModelList{Data: entries})
+		return
+	}
+
+	entry, ok := findModelEntry(entries, name)
+	if !ok {
+		h.writeJSON(w, http.StatusNotFound, map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    "not_found_error",
+				"message": fmt.Sprintf("model '%s' is not configured", name),
+			},
+		})
+
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, entry)
+}
+
+func (h *ModelsHandler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error("Failed to write models response", "error", err)
+	}
+}
+
+// modelEntries lists every provider's models followed by any models only described in its
+// model_info. A model without its own max_output_tokens reports the provider's cap.
+func modelEntries(cfg *config.Config) []ModelEntry {
+	entries := []ModelEntry{}
+	if cfg == nil {
+		return entries
+	}
+
+	for _, provider := range cfg.Providers {
+		names := slices.Clone(provider.Models)
+
+		var described []string
+
+		for name := range provider.ModelInfo {
+			if !slices.Contains(names, name) {
+				described = append(described, name)
+			}
+		}
+
+		sort.Strings(described)
+		names = append(names, described...)
+
+		for _, name := range names {
+			info := provider.ModelInfo[name]
+
+			entry := ModelEntry{
+				Type:            "model",
+				ID:              provider.Name + "," + name,
+				DisplayName:     name,
+				Provider:        provider.Name,
+				ContextWindow:   info.ContextWindow,
+				MaxOutputTokens: info.MaxOutputTokens,
+				Pricing:         info.Pricing,
+			}
+
+			if entry.MaxOutputTokens == 0 {
+				entry.MaxOutputTokens = provider.MaxOutputTokens
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// findModelEntry looks a model up by its "provider,model" id, or by its bare name, which
+// matches the first provider listing it
+func findModelEntry(entries []ModelEntry, name string) (ModelEntry, bool) {
+	for _, entry := range entries {
+		if entry.ID == name {
+			return entry, true
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.DisplayName == name {
+			return entry, true
+		}
+	}
+
+	return ModelEntry{}, false
+}
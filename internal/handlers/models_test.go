@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestModelsHandler_ServesModelMetadata(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{
+				Name:            "openrouter",
+				APIBase:         "https://openrouter.ai/api/v1/chat/completions",
+				Models:          []string{"anthropic/claude-sonnet-4", "openai/gpt-4o"},
+				MaxOutputTokens: 16384,
+				ModelInfo: map[string]config.ModelInfo{
+					"anthropic/claude-sonnet-4": {
+						ContextWindow:   200000,
+						MaxOutputTokens: 64000,
+						Pricing:         &config.ModelPricing{InputPerMillion: 3, OutputPerMillion: 15},
+					},
+				},
+			},
+		},
+	}))
+
+	handler := NewModelsHandler(cfgMgr, logger)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/models/openrouter,anthropic/claude-sonnet-4", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var entry ModelEntry
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entry))
+	assert.Equal(t, "openrouter,anthropic/claude-sonnet-4", entry.ID)
+	assert.Equal(t, "openrouter", entry.Provider)
+	assert.Equal(t, 200000, entry.ContextWindow)
+	assert.Equal(t, 64000, entry.MaxOutputTokens)
+	require.NotNil(t, entry.Pricing)
+	assert.InDelta(t, 3.0, entry.Pricing.InputPerMillion, 0)
+	assert.InDelta(t, 15.0, entry.Pricing.OutputPerMillion, 0)
+
+	// The list carries every model; one without metadata reports the provider's cap
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var list ModelList
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list.Data, 2)
+	assert.Equal(t, "openrouter,openai/gpt-4o", list.Data[1].ID)
+	assert.Equal(t, 16384, list.Data[1].MaxOutputTokens)
+	assert.Zero(t, list.Data[1].ContextWindow)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/models/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "not_found_error")
+}
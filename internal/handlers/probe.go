@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// ProbeResult is the cached reachability of a single provider
+type ProbeResult struct {
+	Provider  string    `json:"provider"`
+	URL       string    `json:"url"`
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ProviderProber periodically checks that the configured providers accept connections.
+// Any HTTP response counts as reachable; only transport errors (connection refused,
+// DNS failures, timeouts) mark a provider as down.
+type ProviderProber struct {
+	config *config.Manager
+	logger *slog.Logger
+	client *http.Client
+
+	// transport carries the configured upstream proxy and CA settings
+	transport *upstreamTransport
+
+	// probeLocal disables skipping of loopback and socket providers (used by tests)
+	probeLocal bool
+
+	mu      sync.RWMutex
+	results map[string]ProbeResult
+}
+
+func NewProviderProber(config *config.Manager, logger *slog.Logger) *ProviderProber {
+	return &ProviderProber{
+		config: config,
+		logger: logger,
+		client: &http.Client{
+			// A redirect is already proof of reachability
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		results: make(map[string]ProbeResult),
+	}
+}
+
+// Run probes all providers immediately and then on every probe interval until ctx is done
+func (p *ProviderProber) Run(ctx context.Context) {
+	cfg := p.config.Get()
+	if cfg == nil || cfg.HealthProbeInterval < 0 {
+		return
+	}
+
+	interval := time.Duration(cfg.HealthProbeInterval) * time.Second
+	if interval <= 0 {
+		interval = config.DefaultHealthProbeIntervalSeconds * time.Second
+	}
+
+	p.ProbeAll(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.ProbeAll(ctx)
+		}
+	}
+}
+
+// ProbeAll checks every configured provider concurrently and replaces the cached results
+func (p *ProviderProber) ProbeAll(ctx context.Context) {
+	cfg := p.config.Get()
+	if cfg == nil {
+		return
+	}
+
+	timeout := time.Duration(cfg.HealthProbeTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultHealthProbeTimeoutSeconds * time.Second
+	}
+
+	// Probes take the same route as requests, so a provider behind the proxy isn't reported down
+	transport, err := p.transport.get(cfg)
+	if err != nil {
+		p.logger.Error("Skipping provider probes", "error", err)
+		return
+	}
+
+	client := *p.client
+	client.Transport = transport
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]ProbeResult)
+	)
+
+	for _, provider := range cfg.Providers {
+		target, err := url.Parse(provider.APIBase)
+		if err != nil || target.Host == "" {
+			continue
+		}
+
+		if !p.probeLocal && isLocalEndpoint(target) {
+			continue
+		}
+
+		// Nothing to connect to for in-process providers (mock://)
+		if target.Scheme != "http" && target.Scheme != "https" && !strings.HasPrefix(target.Scheme, "unix") {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(name string, target *url.URL) {
+			defer wg.Done()
+
+			result := p.probe(ctx, &client, name, target, timeout)
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(provider.Name, target)
+	}
+
+	wg.Wait()
+
+	p.mu.Lock()
+	p.results = results
+	p.mu.Unlock()
+}
+
+// probe sends a GET to the provider's host root and records whether it answered
+func (p *ProviderProber) probe(ctx context.Context, client *http.Client, name string, target *url.URL, timeout time.Duration) ProbeResult {
+	probeURL := (&url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/"}).String()
+	result := ProbeResult{
+		Provider: name,
+		URL:      probeURL,
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		result.CheckedAt = time.Now()
+
+		return result
+	}
+
+	resp, err := client.Do(req)
+
+	result.LatencyMS = time.Since(started).Milliseconds()
+	result.CheckedAt = time.Now()
+
+	if err != nil {
+		result.Error = err.Error()
+
+		p.logger.Warn("Provider unreachable", "provider", name, "url", probeURL, "error", err)
+
+		return result
+	}
+
+	if err := resp.Body.Close(); err != nil {
+		p.logger.Debug("Failed to close probe response body", "error", err)
+	}
+
+	result.Reachable = true
+
+	return result
+}
+
+// Result returns the cached probe result for a provider, if it has been probed.
+// A nil receiver reports no result.
+func (p *ProviderProber) Result(provider string) (ProbeResult, bool) {
+	if p == nil {
+		return ProbeResult{}, false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result, ok := p.results[provider]
+
+	return result, ok
+}
+
+// Results returns the cached probe results sorted by provider name
+func (p *ProviderProber) Results() []ProbeResult {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]ProbeResult, 0, len(p.results))
+	for _, result := range p.results {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Provider < results[j].Provider
+	})
+
+	return results
+}
+
+// unreachableError describes a provider the last probe could not connect to, or returns
+// nil when the provider is reachable or has not been probed
+func (p *ProviderProber) unreachableError(provider string) error {
+	result, ok := p.Result(provider)
+	if !ok || result.Reachable {
+		return nil
+	}
+
+	return fmt.Errorf("provider '%s' is unreachable (checked %s ago): %s",
+		provider, time.Since(result.CheckedAt).Round(time.Second), result.Error)
+}
+
+// isLocalEndpoint reports whether the provider runs on this machine (loopback or unix socket)
+func isLocalEndpoint(target *url.URL) bool {
+	if strings.HasPrefix(target.Scheme, "unix") {
+		return true
+	}
+
+	host := target.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestProviderProber_ReachableAndUnreachable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Any HTTP answer, even an error status, means the provider is reachable
+	reachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer reachable.Close()
+
+	// A closed server refuses connections
+	unreachable := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	unreachableURL := unreachable.URL
+	unreachable.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: reachable.URL + "/v1/chat/completions", APIKey: "test-key"},
+			{Name: "openrouter", APIBase: unreachableURL + "/api/v1/chat/completions", APIKey: "test-key"},
+		},
+		DomainMappings: map[string]string{"127.0.0.1": "openrouter"},
+	}))
+
+	handler := NewProxyHandler(cfgMgr, providers.NewRegistry(), logger)
+	handler.registry.Initialize()
+	handler.registry.SetDomainMappings(cfgMgr.Get().DomainMappings)
+
+	prober := handler.Prober()
+	prober.probeLocal = true
+	prober.ProbeAll(context.Background())
+
+	results := prober.Results()
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "openai", results[0].Provider)
+	assert.True(t, results[0].Reachable)
+	assert.Empty(t, results[0].Error)
+	assert.False(t, results[0].CheckedAt.IsZero())
+
+	assert.Equal(t, "openrouter", results[1].Provider)
+	assert.False(t, results[1].Reachable)
+	assert.NotEmpty(t, results[1].Error)
+
+	// Readiness reflects the unreachable provider
+	rr := httptest.NewRecorder()
+	NewReadyHandler(prober, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var report ReadinessReport
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.False(t, report.Ready)
+	assert.Len(t, report.Providers, 2)
+
+	// Requests to the unreachable provider fail fast
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openrouter,anthropic/claude-sonnet-4","messages":[{"role":"user","content":"Hi"}]}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "provider 'openrouter' is unreachable")
+}
+
+func TestProviderProber_SkipsLocalProviders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "lmstudio", APIBase: "http://localhost:1234/v1/chat/completions"},
+			{Name: "ollama", APIBase: "http://127.0.0.1:11434/v1/chat/completions"},
+		},
+	}))
+
+	prober := NewProviderProber(cfgMgr, logger)
+	prober.ProbeAll(context.Background())
+
+	assert.Empty(t, prober.Results(), "local providers should not be probed")
+
+	_, ok := prober.Result("lmstudio")
+	assert.False(t, ok)
+
+	// With nothing probed the proxy is ready
+	rr := httptest.NewRecorder()
+	NewReadyHandler(prober, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -2,38 +2,126 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkoukk/tiktoken-go"
 
 	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/middleware"
 	"github.com/mihaisavezi/claude-code-open/internal/providers"
 )
 
+const (
+	// onlineModelSuffix is OpenRouter's model suffix for enabling web search
+	onlineModelSuffix = ":online"
+
+	// ModelOverrideHeader pins a "provider,model" for a single request, bypassing the router
+	ModelOverrideHeader = "X-CCO-Model"
+	// LegacyModelOverrideHeader is accepted for compatibility with claude-code-router clients
+	LegacyModelOverrideHeader = "X-CCR-Model"
+
+	// NoRouteHeader disables bucket routing for a single request, as does the route=off query
+	NoRouteHeader = "X-CCO-No-Route"
+	// LegacyNoRouteHeader is accepted for compatibility with claude-code-router clients
+	LegacyNoRouteHeader = "X-CCR-No-Route"
+
+	// UpstreamUserAgent replaces the client's User-Agent when client telemetry is stripped
+	UpstreamUserAgent = "claude-code-open"
+
+	// upstreamAcceptEncoding lists the response encodings decompressReader understands
+	upstreamAcceptEncoding = "gzip, br, zstd"
+
+	// longContextTokens is the input token count above which requests without a provider
+	// prefix go to the longContext bucket
+	longContextTokens = 60000
+
+	// encodingRetryInterval is how long token counting is skipped after the encoding, which
+	// is downloaded on first use, failed to load
+	encodingRetryInterval = time.Minute
+)
+
 type ProxyHandler struct {
-	config   *config.Manager
-	registry *providers.Registry
-	logger   *slog.Logger
+	config    *config.Manager
+	registry  *providers.Registry
+	logger    *slog.Logger
+	stats     *UsageStats
+	prober    *ProviderProber
+	debug     *DebugCapture
+	transport *upstreamTransport
+	limiter   *concurrencyLimiter
+	apiKeys   *apiKeyRotator
+	streams   sync.WaitGroup
+
+	// validateStreams checks the streams sent to clients against Anthropic's event order
+	validateStreams bool
+
+	// encodingFailedAt is when the token encoding last failed to load, in Unix nanoseconds
+	encodingFailedAt atomic.Int64
 }
 
 func NewProxyHandler(config *config.Manager, registry *providers.Registry, logger *slog.Logger) *ProxyHandler {
+	transport := newUpstreamTransport()
+
+	prober := NewProviderProber(config, logger)
+	prober.transport = transport
+
 	return &ProxyHandler{
-		config:   config,
-		registry: registry,
-		logger:   logger,
+		config:    config,
+		registry:  registry,
+		logger:    logger,
+		stats:     NewUsageStats(),
+		prober:    prober,
+		debug:     NewDebugCapture(),
+		transport: transport,
+		limiter:   newConcurrencyLimiter(),
+		apiKeys:   newAPIKeyRotator(),
 	}
 }
 
+// Stats returns the usage counters collected by the handler
+func (h *ProxyHandler) Stats() *UsageStats {
+	return h.stats
+}
+
+// Prober returns the provider reachability prober consulted before routing
+func (h *ProxyHandler) Prober() *ProviderProber {
+	return h.prober
+}
+
+// DebugCapture returns the exchanges recorded while debug is enabled
+func (h *ProxyHandler) DebugCapture() *DebugCapture {
+	return h.debug
+}
+
+// EnableStreamValidation makes the handler validate the event streams it sends and log
+// violations. Each stream is kept in memory until it ends, so this is meant for debugging.
+func (h *ProxyHandler) EnableStreamValidation() {
+	h.validateStreams = true
+}
+
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Read the configuration once: a reload while the request is in flight applies to later
+	// requests only, so routing, retries and response handling all see the same providers
 	cfg := h.config.Get()
+	started := time.Now()
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
@@ -42,25 +130,112 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject malformed requests up front rather than failing confusingly after routing
+	if err := validateRequestJSON(body); err != nil {
+		h.anthropicError(w, http.StatusBadRequest, "invalid_request_error", "%v", err)
+		return
+	}
+
+	// Clients speaking the OpenAI chat completions format are converted to the Anthropic
+	// format the rest of the pipeline works on
+	if providers.DetectRequestFormat(body) == providers.RequestFormatOpenAI {
+		converted, err := providers.TransformOpenAIToAnthropic(body)
+		if err != nil {
+			h.anthropicError(w, http.StatusBadRequest, "invalid_request_error", "invalid OpenAI-format request: %v", err)
+			return
+		}
+
+		h.logger.Debug("Converted OpenAI-format request to Anthropic format")
+
+		body = converted
+	}
+
+	// Record the exchange for /debug/last when debug is enabled
+	capture := h.startDebugCapture(cfg, body)
+
+	// Let the user's hook rewrite the request before routing
+	body = h.applyPreRequestHook(r.Context(), cfg, body)
+
+	// Honor a per-request model override before any routing rules
+	body = h.applyModelOverride(r.Header, body)
+
 	// Count input tokens
-	inputTokens := h.countInputTokens(string(body))
+	inputTokens := h.countTokens(string(body))
 
 	// Select model and transform request body
-	transformedBody, modelName := h.selectModel(body, inputTokens, &cfg.Router)
+	var (
+		transformedBody []byte
+		modelName       string
+	)
+
+	if routingDisabled(r) {
+		transformedBody, modelName = h.selectRequestedModel(body, cfg)
+	} else {
+		transformedBody, modelName = h.selectModel(body, inputTokens, cfg)
+	}
+
+	// Background work waits behind interactive requests for a concurrency slot
+	priority := routePriority(modelName, &cfg.Router)
 
 	// Find provider for the model
 	provider, providerConfig, err := h.findProvider(modelName, cfg)
 	if err != nil {
-		h.httpError(w, http.StatusBadRequest, "provider not found: %v", err)
+		h.anthropicError(w, http.StatusBadRequest, "invalid_request_error", "provider not found: %v", err)
 		return
 	}
 
-	// Transform from Anthropic format to provider format
-	finalBody, err := provider.TransformRequest(transformedBody)
-	if err != nil {
-		h.logger.Warn("Request transformation failed, using original", "error", err)
+	// Fail fast instead of routing to a provider that refused the last probe
+	if err := h.prober.unreachableError(providerConfig.Name); err != nil {
+		h.anthropicError(w, http.StatusServiceUnavailable, "api_error", "%v", err)
+		return
+	}
+
+	// Web search intent is read off the routed model, before it is mapped to a provider id
+	webSearch := h.isWebSearchRequest(body, modelName, &cfg.Router)
+
+	// Rewrite the model to the id the provider knows it by
+	transformedBody, modelName = h.applyModelMap(transformedBody, modelName, providerConfig)
+
+	var finalBody []byte
+
+	if providerConfig.DisableTransform {
+		// Anthropic-format upstreams get the client's bytes, with only the routed model swapped in
+		// and the configured policy text added to the system prompt
+		if cfg.SystemPrefix != "" || cfg.SystemSuffix != "" {
+			finalBody = h.applySystemPromptAdditions(transformedBody, cfg.SystemPrefix, cfg.SystemSuffix)
+		} else {
+			finalBody = passthroughBody(body, transformedBody)
+		}
+	} else {
+		// Carry web search intent through to the provider (":online" for OpenRouter, stripped elsewhere)
+		transformedBody, modelName = h.applyWebSearch(transformedBody, modelName, provider, webSearch)
+
+		// Fill in max_tokens for providers that require it
+		transformedBody = h.applyDefaultMaxTokens(transformedBody, cfg.DefaultMaxTokens)
+
+		// Fill in the provider's default parameters the client didn't set
+		transformedBody = h.applyDefaultParams(transformedBody, providerConfig.DefaultParams)
 
-		finalBody = transformedBody
+		// Keep max_tokens within what the provider's models can produce
+		transformedBody = h.clampMaxTokens(transformedBody, providerConfig)
+
+		// Wrap the system prompt in the configured policy text
+		transformedBody = h.applySystemPromptAdditions(transformedBody, cfg.SystemPrefix, cfg.SystemSuffix)
+
+		// Ask every provider for the single candidate an Anthropic message can carry
+		transformedBody = h.requestSingleCandidate(transformedBody, provider.Name())
+
+		// Transform from Anthropic format to provider format
+		finalBody, err = provider.TransformRequest(transformedBody)
+		if err != nil {
+			h.logger.Warn("Request transformation failed, using original", "error", err)
+
+			finalBody = transformedBody
+		} else if withRole, err := providers.SetSystemRole(finalBody, providerConfig.SystemRole); err != nil {
+			h.logger.Warn("Failed to set the system message role", "role", providerConfig.SystemRole, "error", err)
+		} else {
+			finalBody = withRole
+		}
 	}
 
 	// Debug: Log request being sent to provider (truncated for readability)
@@ -70,22 +245,47 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.logger.Debug("Sending request to provider", "provider", provider.Name(), "body", string(finalBody))
 	}
 
+	stream := isStreamRequest(transformedBody)
+
 	// Build final endpoint URL (handle special cases like Gemini)
-	finalURL := h.buildEndpointURL(provider, providerConfig.APIBase, modelName)
+	finalURL := h.buildEndpointURL(provider, providerConfig, modelName, stream)
+
+	// A non-streaming request is bounded by the provider's total timeout; a stream may run
+	// for as long as chunks keep arriving, which the idle timeout bounds instead. Either way
+	// the upstream request is canceled when the client goes away.
+	ctx := r.Context()
+
+	timeout := providerConfig.Timeout()
+	if timeout > 0 && !stream {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	// Create upstream request
-	req, err := http.NewRequest(r.Method, finalURL, strings.NewReader(string(finalBody)))
+	req, err := http.NewRequestWithContext(ctx, r.Method, finalURL, strings.NewReader(string(finalBody)))
 	if err != nil {
 		h.httpError(w, http.StatusInternalServerError, "failed to create upstream request: %v", err)
 		return
 	}
 
 	// Copy headers and set auth
-	req.Header = r.Header.Clone()
+	req.Header = h.upstreamHeaders(r.Header, provider, providerConfig, cfg.StripClientTelemetry)
 	if providerConfig.APIKey != "" {
 		h.setAuthHeader(req, provider, providerConfig.APIKey)
 	}
 
+	// Providers with their own credentials (a subscription's OAuth token) sign the request
+	if authorizer, ok := provider.(providers.RequestAuthorizer); ok {
+		if err := authorizer.Authorize(req); err != nil {
+			h.anthropicError(w, http.StatusUnauthorized, "authentication_error", "provider '%s': %v", providerConfig.Name, err)
+			return
+		}
+	}
+
+	capture.setUpstreamRequest(req, finalBody, provider.Name(), modelName, providerConfig.APIKey)
+
 	h.logger.Info("Proxying request",
 		"provider", provider.Name(),
 		"model", modelName,
@@ -93,9 +293,63 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"input_tokens", inputTokens,
 	)
 
+	transport, err := h.transport.get(cfg)
+	if err != nil {
+		h.httpError(w, http.StatusInternalServerError, "invalid upstream transport configuration: %v", err)
+		return
+	}
+
+	// Providers that answer in-process (the mock provider) are their own transport
+	if roundTripper, ok := provider.(http.RoundTripper); ok {
+		transport = roundTripper
+	}
+
+	// Hold a concurrency slot until the response has been relayed, streams included
+	release, err := h.limiter.acquire(r.Context(), cfg, providerConfig, priority)
+	if err != nil {
+		h.anthropicError(w, http.StatusServiceUnavailable, "overloaded_error", "%v", err)
+		return
+	}
+	defer release()
+
 	// Make upstream request
-	resp, err := http.DefaultClient.Do(req)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Do(req)
+
+	// A rate-limited key hands the request on to the provider's next key, once per key
+	if _, signsItself := provider.(providers.RequestAuthorizer); !signsItself && providerConfig.APIKey != "" {
+		keys := providerConfig.Keys()
+		apiKey := providerConfig.APIKey
+
+		for retries := len(keys) - 1; err == nil && resp.StatusCode == http.StatusTooManyRequests && retries > 0; retries-- {
+			apiKey = nextKey(keys, apiKey)
+
+			h.logger.Info("Provider key rate limited, retrying with the next key", "provider", providerConfig.Name)
+
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				h.logger.Warn("Failed to close response body", "error", closeErr)
+			}
+
+			retry := req.Clone(ctx)
+			retry.Body = io.NopCloser(strings.NewReader(string(finalBody)))
+			h.setAuthHeader(retry, provider, apiKey)
+
+			resp, err = client.Do(retry)
+		}
+	}
+
 	if err != nil {
+		if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+			h.logger.Info("Client disconnected before the provider responded", "provider", provider.Name())
+			return
+		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.anthropicError(w, http.StatusGatewayTimeout, "api_error", "provider '%s' did not respond within %s", providerConfig.Name, timeout)
+			return
+		}
+
 		h.httpError(w, http.StatusBadGateway, "upstream request failed: %v", err)
 		return
 	}
@@ -106,15 +360,72 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	w = capture.wrap(w, resp)
+
 	// Handle response based on streaming
-	if provider.IsStreaming(resp.Header) {
-		h.handleStreamingResponse(w, resp, provider, inputTokens)
+	var usage tokenUsage
+
+	// A streamed request may still be answered with JSON (an error, or Gemini's array of
+	// chunks); handleStreamingResponse tells these apart from the body
+	if provider.IsStreaming(streamingHeaders(resp)) || stream {
+		h.streams.Add(1)
+		defer h.streams.Done()
+
+		streamWriter, checker := h.checkStream(w)
+		usage = h.handleStreamingResponse(streamWriter, resp, provider, inputTokens, cfg, providerConfig)
+		h.validateStream(checker, provider.Name(), modelName)
 	} else {
-		h.handleResponse(w, resp, provider, inputTokens)
+		usage = h.handleResponse(w, resp, provider, inputTokens, cfg, providerConfig)
+	}
+
+	// Prefer the upstream's input token count over the local estimate
+	if usage.InputTokens == 0 {
+		usage.InputTokens = inputTokens
+	}
+
+	_, model := providers.ExtractModelFromConfig(modelName)
+	h.stats.record(provider.Name(), model, resp.StatusCode, usage, time.Since(started))
+
+	if usage.Deltas.Count > 0 {
+		timeToFirstToken := usage.Deltas.First.Sub(started)
+		interTokenLatency := usage.Deltas.interTokenLatency()
+
+		h.logger.Info("Stream latency",
+			"provider", provider.Name(),
+			"model", model,
+			"time_to_first_token_ms", timeToFirstToken.Milliseconds(),
+			"inter_token_latency_ms", float64(interTokenLatency)/float64(time.Millisecond),
+			"deltas", usage.Deltas.Count,
+		)
+
+		h.stats.recordStream(timeToFirstToken, interTokenLatency)
+	}
+
+	h.finishDebugCapture(capture, resp, cfg.DebugCaptureSize)
+}
+
+// WaitForStreams blocks until all in-flight streaming responses have finished or ctx is done
+func (h *ProxyHandler) WaitForStreams(ctx context.Context) error {
+	finished := make(chan struct{})
+
+	go func() {
+		h.streams.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func (h *ProxyHandler) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, provider providers.Provider, inputTokens int) {
+// handleStreamingResponse converts the upstream stream to Anthropic events. A stream that
+// sends nothing for the provider's idle timeout (when positive) is ended with an error event.
+func (h *ProxyHandler) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, provider providers.Provider, inputTokens int, cfg *config.Config, providerConfig *config.Provider) (usage tokenUsage) {
+	idleTimeout := providerConfig.IdleTimeout()
+
 	// Handle decompression
 	bodyReader, err := h.decompressReader(resp)
 	if err != nil {
@@ -130,35 +441,149 @@ func (h *ProxyHandler) handleStreamingResponse(w http.ResponseWriter, resp *http
 		}()
 	}
 
+	// Upstreams sometimes answer a streaming request with plain JSON (typically an error),
+	// which must be delivered as JSON rather than wrapped in SSE headers
+	buffered := bufio.NewReader(bodyReader)
+
+	// Telling the formats apart waits no longer than the first ping or the idle timeout
+	sniffWait := idleTimeout
+	if pingInterval := streamPingInterval(cfg); pingInterval > 0 && resp.StatusCode == http.StatusOK &&
+		(sniffWait == 0 || pingInterval < sniffWait) {
+		sniffWait = pingInterval
+	}
+
+	isStream, streamReader := h.isEventStream(resp, buffered, sniffWait)
+	if !isStream {
+		// The body has started arriving, so dropping a byte order mark does not wait on a
+		// silent upstream; event streams drop it with their first line instead
+		skipBOM(buffered)
+
+		// Gemini's streamGenerateContent without alt=sse sends its chunks as one JSON array
+		if resp.StatusCode == http.StatusOK && startsJSONArray(buffered) {
+			return h.handleJSONArrayStream(w, resp, buffered, provider, inputTokens)
+		}
+
+		h.logger.Debug("Upstream response is not an event stream, handling as JSON", "status", resp.StatusCode)
+
+		resp.Header.Del("Content-Encoding")
+		resp.Body = io.NopCloser(buffered)
+
+		return h.handleResponse(w, resp, provider, inputTokens, cfg, providerConfig)
+	}
+
+	bodyReader = streamReader
+
 	// Set streaming headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Copy relevant headers
 	h.copyHeaders(w, resp)
 	w.WriteHeader(resp.StatusCode)
 
+	if providerConfig.DisableTransform {
+		return h.relayStream(w, bodyReader, inputTokens, resp.StatusCode, idleTimeout)
+	}
+
 	// For error responses, capture and print the body
 	var errorBodyLines []string
 
 	captureError := resp.StatusCode != http.StatusOK
 
-	// Create scanner and state
-	scanner := bufio.NewScanner(bodyReader)
+	// Read upstream lines in the background so that pings can be sent while it is silent
+	done := make(chan struct{})
+	defer close(done)
+
+	lines, scanErr := h.scanLines(bodyReader, done)
 	state := &providers.StreamState{}
+	estimator := newOutputEstimator(h.countTokens)
+
+	// Pings are only sent between complete events of a successful stream
+	var (
+		pingTicker *time.Ticker
+		pingC      <-chan time.Time
+	)
+
+	pingInterval := streamPingInterval(cfg)
+	passKeepAlive := cfg != nil && cfg.StreamKeepAliveComments
+	if pingInterval > 0 && !captureError {
+		pingTicker = time.NewTicker(pingInterval)
+		defer pingTicker.Stop()
+
+		pingC = pingTicker.C
+	}
+
+	// A hung upstream is cut off rather than holding the client indefinitely
+	var (
+		idleTimer *time.Timer
+		idleC     <-chan time.Time
+	)
+
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		defer idleTimer.Stop()
+
+		idleC = idleTimer.C
+	}
+
+	var decoder providers.SSEDecoder
+
+	midEvent := false
+
+	for streaming := true; streaming; {
+		var line string
+
+		select {
+		case <-idleC:
+			h.writeIdleTimeoutError(w, idleTimeout)
+			return usage
+		case <-pingC:
+			if midEvent {
+				continue
+			}
+
+			if _, err := w.Write(providers.FormatSSEEvent("ping", map[string]any{"type": "ping"})); err != nil {
+				h.logger.Error("Failed to write ping event", "error", err)
+				return
+			}
+
+			h.flushResponse(w)
+
+			continue
+		case l, ok := <-lines:
+			if !ok {
+				streaming = false
+				continue
+			}
+
+			line = strings.TrimSpace(l)
+
+			// Upstream is active again, restart the silence windows
+			if pingTicker != nil {
+				pingTicker.Reset(pingInterval)
+			}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+			if idleTimer != nil {
+				idleTimer.Reset(idleTimeout)
+			}
+		}
 
 		// Capture error response body
 		if captureError && line != "" {
 			errorBodyLines = append(errorBodyLines, line)
 		}
 
-		// Skip empty lines and comments
-		if line == "" {
+		switch kind, data, ok := decoder.Line(line); kind {
+		case providers.SSEEventEnd:
+			// A blank line dispatches the accumulated event
+			if ok {
+				if err := h.writeStreamData(w, data, captureError, provider, state, estimator, &usage); err != nil {
+					h.logger.Error("Failed to write events", "error", err)
+					return
+				}
+			}
+
 			if _, err := fmt.Fprint(w, "\n"); err != nil {
 				h.logger.Error("Failed to write newline", "error", err)
 				return
@@ -166,233 +591,1259 @@ func (h *ProxyHandler) handleStreamingResponse(w http.ResponseWriter, resp *http
 
 			h.flushResponse(w)
 
-			continue
+			midEvent = false
+		case providers.SSEComment:
+			// Provider noise comments are dropped; generic keep-alives reach the client if configured
+			if passKeepAlive && !captureError && providers.IsKeepAliveComment(line) {
+				if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+					h.logger.Error("Failed to write keep-alive comment", "error", err)
+					return
+				}
+
+				h.flushResponse(w)
+			}
+		case providers.SSEDone:
+			// [DONE] ends the upstream stream; Anthropic streams end with message_stop instead
+			if err := h.finishStream(w, captureError, state, estimator, &usage); err != nil {
+				h.logger.Error("Failed to write final events", "error", err)
+				return
+			}
+
+			h.flushResponse(w)
+
+			streaming = false
+		case providers.SSEData:
+			// An event's data may span several lines per the SSE spec
+			midEvent = true
+		default:
+			// Pass through other SSE lines
+			if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+				h.logger.Error("Failed to write SSE line", "error", err)
+				return
+			}
+
+			h.flushResponse(w)
+
+			midEvent = true
+		}
+	}
+
+	// Dispatch an event the upstream left unterminated
+	if data, ok := decoder.Flush(); ok {
+		if err := h.writeStreamData(w, data, captureError, provider, state, estimator, &usage); err != nil {
+			h.logger.Error("Failed to write events", "error", err)
+		}
+
+		h.flushResponse(w)
+	}
+
+	// Complete a message still waiting for usage when the upstream ended without [DONE]
+	if err := h.finishStream(w, captureError, state, estimator, &usage); err != nil {
+		h.logger.Error("Failed to write final events", "error", err)
+	}
+
+	h.flushResponse(w)
+
+	select {
+	case err := <-scanErr:
+		if err != nil {
+			h.logger.Error("Stream scanning error", "error", err)
+		}
+	default:
+	}
+
+	// Print captured error response body
+	if captureError && len(errorBodyLines) > 0 {
+		fmt.Printf("\nUpstream streaming error response body:\n%s\n", strings.Join(errorBodyLines, "\n"))
+	}
+
+	h.logStreamWarnings(provider, state)
+
+	h.logger.Info("Completed streaming response",
+		"status", resp.StatusCode,
+		"input_tokens", inputTokens,
+		"output_tokens", usage.OutputTokens,
+	)
+
+	return usage
+}
+
+// writeIdleTimeoutError ends a stream whose upstream went silent with an Anthropic error event
+func (h *ProxyHandler) writeIdleTimeoutError(w http.ResponseWriter, idleTimeout time.Duration) {
+	msg := fmt.Sprintf("upstream stream sent nothing for %s and was aborted", idleTimeout)
+	h.logger.Error("Stream idle timeout", "timeout", idleTimeout)
+
+	event := providers.FormatSSEEvent("error", map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    "api_error",
+			"message": msg,
+		},
+	})
+
+	if _, err := w.Write(event); err != nil {
+		h.logger.Error("Failed to write idle timeout error", "error", err)
+		return
+	}
+
+	h.flushResponse(w)
+}
+
+// isStreamRequest reports whether the Anthropic request asks for a streamed response
+func isStreamRequest(body []byte) bool {
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+
+	return json.Unmarshal(body, &request) == nil && request.Stream
+}
+
+// writeStreamData writes the data of one upstream event: transformed through the provider,
+// or as-is for error responses. Chunks the provider cannot transform are dropped.
+func (h *ProxyHandler) writeStreamData(w http.ResponseWriter, data string, captureError bool, provider providers.Provider, state *providers.StreamState, estimator *outputEstimator, usage *tokenUsage) error {
+	if !captureError {
+		events, err := provider.TransformStream([]byte(data), state)
+		if err == nil {
+			if len(events) == 0 {
+				return nil
+			}
+
+			events = estimator.process(events)
+
+			if _, err := w.Write(events); err != nil {
+				return err
+			}
+
+			h.collectStreamUsage(events, usage)
+			usage.Deltas.observe(events, time.Now())
+
+			return nil
 		}
 
-		if strings.HasPrefix(line, ": ") {
-			continue // Skip SSE comments
+		// The provider's own format would break the Anthropic stream the client is parsing,
+		// so a chunk that fails to convert is dropped
+		preview := data
+		if len(preview) > 500 {
+			preview = preview[:500] + "..."
 		}
 
-		// Handle [DONE] message
-		if line == "data: [DONE]" {
-			if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
-				h.logger.Error("Failed to write DONE message", "error", err)
+		h.logger.Warn("Dropping stream chunk that failed to convert", "provider", provider.Name(), "error", err, "data", preview)
+
+		return nil
+	}
+
+	// Multi-line data goes back out as one data: line per line
+	_, err := fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(data, "\n", "\ndata: "))
+
+	return err
+}
+
+// relayStream copies an Anthropic-format stream to the client unchanged, flushing after each
+// event, and picks the token usage out of it for logging and stats
+func (h *ProxyHandler) relayStream(w http.ResponseWriter, body io.Reader, inputTokens, statusCode int, idleTimeout time.Duration) (usage tokenUsage) {
+	type chunk struct {
+		line []byte
+		err  error
+	}
+
+	// Read upstream lines in the background so that a silent upstream hits the idle timeout
+	done := make(chan struct{})
+	defer close(done)
+
+	chunks := make(chan chunk)
+
+	go func() {
+		reader := bufio.NewReader(body)
+
+		for first := true; ; first = false {
+			line, err := reader.ReadBytes('\n')
+			if first {
+				line = bytes.TrimPrefix(line, utf8BOM)
+			}
+
+			select {
+			case chunks <- chunk{line: line, err: err}:
+			case <-done:
 				return
 			}
 
-			h.flushResponse(w)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var (
+		idleTimer *time.Timer
+		idleC     <-chan time.Time
+	)
+
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		defer idleTimer.Stop()
+
+		idleC = idleTimer.C
+	}
+
+	for {
+		var next chunk
+
+		select {
+		case <-idleC:
+			h.writeIdleTimeoutError(w, idleTimeout)
+			return usage
+		case next = <-chunks:
+		}
+
+		if idleTimer != nil {
+			idleTimer.Reset(idleTimeout)
+		}
+
+		if len(next.line) > 0 {
+			if _, writeErr := w.Write(next.line); writeErr != nil {
+				h.logger.Error("Failed to relay stream", "error", writeErr)
+				return usage
+			}
+
+			h.collectStreamUsage(next.line, &usage)
+			usage.Deltas.observe(next.line, time.Now())
+
+			if len(bytes.TrimSpace(next.line)) == 0 {
+				h.flushResponse(w)
+			}
+		}
+
+		if next.err != nil {
+			if !errors.Is(next.err, io.EOF) {
+				h.logger.Error("Failed to read upstream stream", "error", next.err)
+			}
+
+			break
+		}
+	}
+
+	h.flushResponse(w)
+
+	h.logger.Info("Completed streaming response",
+		"status", statusCode,
+		"input_tokens", inputTokens,
+		"output_tokens", usage.OutputTokens,
+	)
+
+	return usage
+}
+
+// finishStream writes the message_delta and message_stop a provider held back waiting for usage
+func (h *ProxyHandler) finishStream(w http.ResponseWriter, captureError bool, state *providers.StreamState, estimator *outputEstimator, usage *tokenUsage) error {
+	if captureError {
+		return nil
+	}
+
+	events := providers.FinishStream(state)
+	if len(events) == 0 {
+		return nil
+	}
+
+	events = estimator.process(events)
+
+	if _, err := w.Write(events); err != nil {
+		return err
+	}
+
+	h.collectStreamUsage(events, usage)
+
+	return nil
+}
+
+// collectStreamUsage picks token counts out of message_start and message_delta events
+func (h *ProxyHandler) collectStreamUsage(events []byte, usage *tokenUsage) {
+	if !bytes.Contains(events, []byte("message_start")) && !bytes.Contains(events, []byte("message_delta")) {
+		return
+	}
+
+	for _, line := range bytes.Split(events, []byte("\n")) {
+		// Passthrough providers return the bare JSON payload without the data: prefix
+		data := bytes.TrimPrefix(line, []byte("data: "))
+		if !bytes.HasPrefix(data, []byte("{")) {
+			continue
+		}
+
+		var event map[string]any
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+
+		eventUsage, _ := event["usage"].(map[string]any)
+		if message, ok := event["message"].(map[string]any); ok && eventUsage == nil {
+			eventUsage, _ = message["usage"].(map[string]any)
+		}
+
+		if input, ok := eventUsage["input_tokens"].(float64); ok && input > 0 {
+			usage.InputTokens = int(input)
+		}
+
+		if output, ok := eventUsage["output_tokens"].(float64); ok && output > 0 {
+			usage.OutputTokens = int(output)
+		}
+	}
+}
+
+// streamingHeaders returns the response headers for streaming detection. net/http moves
+// Transfer-Encoding out of the header map, so it is put back for providers to see.
+func streamingHeaders(resp *http.Response) http.Header {
+	if len(resp.TransferEncoding) == 0 {
+		return resp.Header
+	}
+
+	headers := resp.Header.Clone()
+	headers["Transfer-Encoding"] = resp.TransferEncoding
+
+	return headers
+}
+
+// logStreamWarnings logs the upstream problems the provider worked around during a stream
+func (h *ProxyHandler) logStreamWarnings(provider providers.Provider, state *providers.StreamState) {
+	for _, warning := range state.Warnings {
+		h.logger.Warn("Upstream stream problem", "provider", provider.Name(), "problem", warning)
+	}
+}
+
+// startsJSONArray reports whether the buffered body begins with a JSON array
+func startsJSONArray(body *bufio.Reader) bool {
+	head, _ := body.Peek(body.Buffered())
+	head = bytes.TrimLeft(head, " \t\r\n")
+
+	return len(head) > 0 && head[0] == '['
+}
+
+// handleJSONArrayStream streams a response sent as a JSON array of chunks, transforming
+// each element as it is decoded rather than waiting for the closing bracket
+func (h *ProxyHandler) handleJSONArrayStream(w http.ResponseWriter, resp *http.Response, body io.Reader, provider providers.Provider, inputTokens int) (usage tokenUsage) {
+	h.logger.Debug("Upstream stream is a JSON array, decoding chunks", "provider", provider.Name())
+
+	h.copyHeaders(w, resp)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(resp.StatusCode)
+
+	state := &providers.StreamState{}
+	estimator := newOutputEstimator(h.countTokens)
+	decoder := json.NewDecoder(body)
+
+	// Consume the opening bracket
+	if _, err := decoder.Token(); err != nil {
+		h.logger.Error("Failed to read stream array", "error", err)
+		return usage
+	}
+
+	for decoder.More() {
+		var chunk json.RawMessage
+		if err := decoder.Decode(&chunk); err != nil {
+			h.logger.Error("Failed to decode stream chunk", "error", err)
+			break
+		}
+
+		if err := h.writeStreamData(w, string(chunk), false, provider, state, estimator, &usage); err != nil {
+			h.logger.Error("Failed to write events", "error", err)
+			return usage
+		}
+
+		h.flushResponse(w)
+	}
+
+	if err := h.finishStream(w, false, state, estimator, &usage); err != nil {
+		h.logger.Error("Failed to write final events", "error", err)
+	}
+
+	h.flushResponse(w)
+
+	h.logStreamWarnings(provider, state)
+
+	h.logger.Info("Completed streaming response",
+		"status", resp.StatusCode,
+		"input_tokens", inputTokens,
+		"output_tokens", usage.OutputTokens,
+	)
+
+	return usage
+}
+
+// isEventStream reports whether the upstream body is an SSE stream, and the reader to stream
+// it from. A text/event-stream Content-Type decides at once; otherwise only a body that starts
+// like JSON is treated as non-streaming. An unlabelled body that sends nothing within wait
+// (when positive) is taken for a stream, so that pings and the idle timeout cover it.
+func (h *ProxyHandler) isEventStream(resp *http.Response, body *bufio.Reader, wait time.Duration) (bool, io.Reader) {
+	contentType := resp.Header.Get("Content-Type")
+	if strings.Contains(contentType, providers.ContentTypeEventStream) {
+		return true, body
+	}
+
+	// Wait for the first read from upstream, then inspect whatever it delivered
+	arrived := make(chan struct{})
+
+	go func() {
+		defer close(arrived)
+
+		_, _ = body.Peek(1)
+	}()
+
+	if wait > 0 && !strings.Contains(contentType, "json") {
+		select {
+		case <-arrived:
+		case <-time.After(wait):
+			return true, &pendingReader{ready: arrived, reader: body}
+		}
+	} else {
+		<-arrived
+	}
+
+	// Nothing could be read; the stream loop reports how the body ended
+	if body.Buffered() == 0 {
+		return true, body
+	}
+
+	head, _ := body.Peek(body.Buffered())
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+
+	// Error pages from a CDN in front of the upstream are neither JSON nor SSE
+	if resp.StatusCode != http.StatusOK {
+		return startsSSEField(head), body
+	}
+
+	return len(head) == 0 || (head[0] != '{' && head[0] != '['), body
+}
+
+// pendingReader holds reads back until a Peek still waiting on the body has returned
+type pendingReader struct {
+	ready  <-chan struct{}
+	reader io.Reader
+}
+
+func (r *pendingReader) Read(p []byte) (int, error) {
+	<-r.ready
+
+	return r.reader.Read(p)
+}
+
+// utf8BOM is the byte order mark some providers put before their first line
+var utf8BOM = []byte("\ufeff")
+
+// skipBOM drops a leading byte order mark, which would otherwise hide the first SSE field
+func skipBOM(body *bufio.Reader) {
+	if head, err := body.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		_, _ = body.Discard(len(utf8BOM))
+	}
+}
+
+// startsSSEField reports whether data begins with an event stream field or comment
+func startsSSEField(data []byte) bool {
+	for _, prefix := range []string{"data:", "event:", "id:", "retry:", ":"} {
+		if bytes.HasPrefix(data, []byte(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanLines reads lines from the upstream body until EOF or until done is closed, dropping a
+// byte order mark before the first line. The scan error, if any, is sent before the lines
+// channel is closed.
+func (h *ProxyHandler) scanLines(body io.Reader, done <-chan struct{}) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(body)
+		for first := true; scanner.Scan(); first = false {
+			line := scanner.Text()
+			if first {
+				line = strings.TrimPrefix(line, string(utf8BOM))
+			}
+
+			select {
+			case lines <- line:
+			case <-done:
+				return
+			}
+		}
+
+		scanErr <- scanner.Err()
+	}()
+
+	return lines, scanErr
+}
+
+// streamPingInterval returns how long the upstream may stay silent before a ping is sent, or 0 if disabled
+func streamPingInterval(cfg *config.Config) time.Duration {
+	seconds := config.DefaultStreamPingIntervalSeconds
+
+	if cfg != nil && cfg.StreamPingInterval != 0 {
+		seconds = cfg.StreamPingInterval
+	}
+
+	if seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func (h *ProxyHandler) handleResponse(w http.ResponseWriter, resp *http.Response, provider providers.Provider, inputTokens int, cfg *config.Config, providerConfig *config.Provider) (usage tokenUsage) {
+	// Handle decompression
+	bodyReader, err := h.decompressReader(resp)
+	if err != nil {
+		h.httpError(w, http.StatusBadGateway, "decompression error: %v", err)
+		return
+	}
+
+	if closer, ok := bodyReader.(io.Closer); ok {
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil {
+				h.logger.Warn("Failed to close body reader", "error", closeErr)
+			}
+		}()
+	}
+
+	// Read full response
+	respBody, err := io.ReadAll(bodyReader)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.anthropicError(w, http.StatusGatewayTimeout, "api_error", "timed out reading the upstream response: %v", err)
+			return
+		}
+
+		h.httpError(w, http.StatusBadGateway, "failed to read upstream response: %v", err)
+		return
+	}
+
+	respBody = bytes.TrimPrefix(respBody, utf8BOM)
+
+	var finalBody []byte
+
+	// For error responses, forward original response without transformation
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("\nUpstream error response body:\n%s\n", string(respBody))
+		finalBody = respBody
+
+		// CDNs in front of a gateway answer with HTML or plain text error pages
+		if !json.Valid(respBody) {
+			finalBody = upstreamErrorPage(resp.StatusCode, respBody)
+		}
+	} else if providerConfig.DisableTransform {
+		finalBody = respBody
+	} else {
+		// Transform successful responses
+		transformedBody, err := provider.TransformResponse(respBody)
+		if err != nil {
+			h.logger.Warn("Response transformation failed, using original", "error", err)
+
+			finalBody = respBody
+		} else {
+			if cfg != nil && cfg.PreserveLogprobs {
+				finalBody = h.preserveLogprobs(respBody, transformedBody)
+			} else {
+				finalBody = transformedBody
+			}
+
+			if providerConfig.PreserveUnknownFields {
+				finalBody = h.preserveUnknownFields(respBody, finalBody, provider, providerConfig.Name)
+			}
+
+			// The body has been read to the end, so any trailers have arrived
+			finalBody = h.foldTrailerUsage(finalBody, trailerUsage(resp.Trailer))
+
+			// Some gateways report no usage at all
+			finalBody = h.estimateResponseUsage(finalBody)
+		}
+	}
+
+	// Copy headers and send response
+	h.copyHeaders(w, resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := w.Write(finalBody); err != nil {
+		h.logger.Error("Failed to write response body", "error", err)
+	}
+
+	return h.logResponseTokens(finalBody, resp.StatusCode, inputTokens)
+}
+
+// errorPageSnippetLength caps how much of a non-JSON error page is quoted in the error message
+const errorPageSnippetLength = 200
+
+// upstreamErrorPage wraps a non-JSON upstream error body in an Anthropic error carrying the
+// status code and the start of the page with its whitespace collapsed
+func upstreamErrorPage(statusCode int, body []byte) []byte {
+	snippet := []rune(strings.Join(strings.Fields(string(body)), " "))
+	if len(snippet) > errorPageSnippetLength {
+		snippet = append(snippet[:errorPageSnippetLength], []rune("...")...)
+	}
+
+	message := fmt.Sprintf("upstream returned status %d with a non-JSON body", statusCode)
+	if len(snippet) > 0 {
+		message += ": " + string(snippet)
+	}
+
+	errorBody, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    upstreamErrorType(statusCode),
+			"message": message,
+		},
+	})
+
+	return errorBody
+}
+
+// upstreamErrorType maps an HTTP status to the Anthropic error type clients expect for it
+func upstreamErrorType(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return "authentication_error"
+	case statusCode == http.StatusForbidden:
+		return "permission_error"
+	case statusCode == http.StatusNotFound:
+		return "not_found_error"
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case statusCode == http.StatusServiceUnavailable || statusCode == 529:
+		return "overloaded_error"
+	case statusCode >= 400 && statusCode < 500:
+		return "invalid_request_error"
+	default:
+		return "api_error"
+	}
+}
+
+// preserveLogprobs copies the upstream choice's logprobs into the Anthropic response as
+// openai_logprobs, for preserve_logprobs. Anthropic has no equivalent field.
+func (h *ProxyHandler) preserveLogprobs(upstreamBody, transformedBody []byte) []byte {
+	var upstream struct {
+		Choices []struct {
+			Logprobs json.RawMessage `json:"logprobs"`
+		} `json:"choices"`
+	}
+
+	if err := json.Unmarshal(upstreamBody, &upstream); err != nil || len(upstream.Choices) == 0 {
+		return transformedBody
+	}
+
+	logprobs := upstream.Choices[0].Logprobs
+	if len(logprobs) == 0 || string(logprobs) == "null" {
+		return transformedBody
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(transformedBody, &response); err != nil {
+		return transformedBody
+	}
+
+	response["openai_logprobs"] = logprobs
+
+	updatedBody, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Warn("Failed to preserve logprobs", "error", err)
+		return transformedBody
+	}
+
+	return updatedBody
+}
+
+// knownResponseFields are the upstream response fields each provider's conversion already
+// carries over. Providers not listed answer in the OpenAI format; Anthropic responses are
+// passed through, so all of their fields are in the response already.
+var knownResponseFields = map[string]map[string]bool{
+	"openai": {
+		"id":      true,
+		"object":  true,
+		"created": true,
+		"model":   true,
+		"choices": true,
+		"usage":   true,
+	},
+	"gemini": {
+		"candidates":     true,
+		"promptFeedback": true,
+		"usageMetadata":  true,
+		"modelVersion":   true,
+		"responseId":     true,
+	},
+}
+
+// responseFieldsRead returns the upstream response fields the provider's conversion reads
+func responseFieldsRead(provider string) map[string]bool {
+	if known, ok := knownResponseFields[provider]; ok {
+		return known
+	}
+
+	return knownResponseFields["openai"]
+}
+
+// preserveUnknownFields copies the upstream response's top-level fields that the conversion
+// drops into the Anthropic response as <provider>_<field>, so provider-specific metadata such
+// as system_fingerprint or citations reaches the client. Fields the response already has are
+// left alone, as are fields it has under their own name.
+func (h *ProxyHandler) preserveUnknownFields(upstreamBody, transformedBody []byte, provider providers.Provider, providerName string) []byte {
+	var upstream map[string]json.RawMessage
+	if err := json.Unmarshal(upstreamBody, &upstream); err != nil {
+		return transformedBody
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(transformedBody, &response); err != nil {
+		return transformedBody
+	}
+
+	known := responseFieldsRead(provider.Name())
+	preserved := 0
+
+	for field, value := range upstream {
+		if known[field] {
+			continue
+		}
+
+		if _, exists := response[field]; exists {
+			continue
+		}
+
+		key := providerName + "_" + field
+		if _, exists := response[key]; exists {
+			continue
+		}
+
+		response[key] = value
+		preserved++
+	}
+
+	if preserved == 0 {
+		return transformedBody
+	}
+
+	updatedBody, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Warn("Failed to preserve unknown response fields", "error", err)
+		return transformedBody
+	}
+
+	return updatedBody
+}
+
+// findProvider resolves a "provider,model" name against cfg, the request's configuration
+// snapshot. The returned provider config belongs to that snapshot (or is a copy of it) and
+// must not be looked up again from the manager later in the request.
+func (h *ProxyHandler) findProvider(modelName string, cfg *config.Config) (providers.Provider, *config.Provider, error) {
+	// Parse provider name from model (format: "provider,model" or just "model")
+	parts := strings.SplitN(modelName, ",", 2)
+
+	var providerName string
+	if len(parts) > 1 {
+		providerName = parts[0]
+	}
+
+	// Find provider config
+	var providerConfig *config.Provider
+
+	for i, p := range cfg.Providers {
+		if p.Name == providerName {
+			providerConfig = &cfg.Providers[i]
+			break
+		}
+	}
+
+	var provider providers.Provider
+
+	// source tells the decision log how the implementation was found
+	source := "configured url"
+
+	if providerConfig != nil {
+		_provider, err := h.registry.GetByDomain(providerConfig.APIBase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("no provider implementation for domain: %w", err)
+		}
+
+		// A Claude.ai subscription reaches the same API, signed with its OAuth token
+		if providerConfig.Auth == config.AuthOAuth {
+			if _provider.Name() != "anthropic" {
+				return nil, nil, fmt.Errorf("provider '%s' uses auth '%s', which only Anthropic supports", providerConfig.Name, config.AuthOAuth)
+			}
+
+			oauthProvider, ok := h.registry.Get(providers.AnthropicOAuthName)
+			if !ok {
+				return nil, nil, fmt.Errorf("provider '%s' uses auth '%s', but OAuth is not available", providerConfig.Name, config.AuthOAuth)
+			}
+
+			_provider = oauthProvider
+		}
+
+		provider = _provider
+	} else {
+		_provider, ok := h.registry.Get(providerName)
+		if !ok {
+			available := strings.Join(h.availableProviders(cfg), ", ")
+
+			if providerName == "" {
+				return nil, nil, fmt.Errorf("model '%s' has no provider prefix; use the format \"provider,model\" (available providers: %s)", modelName, available)
+			}
+
+			return nil, nil, fmt.Errorf("provider '%s' for model '%s' is not configured (available providers: %s)", providerName, modelName, available)
+		}
+
+		providerConfig = &config.Provider{
+			Name:    _provider.Name(),
+			APIBase: _provider.GetEndpoint(),
+		}
+
+		provider = _provider
+		source = "built-in provider, not configured"
+	}
+
+	// Use provider-specific API key if available (the next in turn when it has several),
+	// otherwise fallback to CCO_API_KEY. Local keyless providers never receive the shared key.
+	apiKey := h.apiKeys.pick(providerConfig.Name, providerConfig.Keys())
+
+	if apiKey == "" && provider.Name() != "lmstudio" {
+		if ccoAPIKey := os.Getenv("CCO_API_KEY"); ccoAPIKey != "" {
+			apiKey = ccoAPIKey
+
+			h.logger.Debug("Using CCO_API_KEY for provider", "provider", provider.Name())
+		}
+	}
+
+	if apiKey != providerConfig.APIKey {
+		// Resolve on a copy so the chosen key isn't written into the shared config
+		resolved := *providerConfig
+		resolved.APIKey = apiKey
+		providerConfig = &resolved
+	}
+
+	provider.SetAPIKey(apiKey)
+
+	h.logger.Debug("Selected provider",
+		"model", modelName,
+		"provider", providerConfig.Name,
+		"implementation", provider.Name(),
+		"source", source,
+	)
+
+	return provider, providerConfig, nil
+}
+
+// availableProviders lists the configured and built-in provider names, sorted and without duplicates
+func (h *ProxyHandler) availableProviders(cfg *config.Config) []string {
+	seen := make(map[string]bool)
+
+	var names []string
+
+	for _, p := range cfg.Providers {
+		if p.Name != "" && !seen[p.Name] {
+			seen[p.Name] = true
+			names = append(names, p.Name)
+		}
+	}
+
+	for _, name := range h.registry.List() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// isKnownProvider reports whether findProvider can resolve the provider name, either from
+// the configured providers or from the built-in registry
+func (h *ProxyHandler) isKnownProvider(name string, cfg *config.Config) bool {
+	return slices.Contains(h.availableProviders(cfg), name)
+}
+
+// applyModelOverride replaces the body's model with the "provider,model" from the override
+// header. selectModel uses provider-qualified models as-is, so the routing buckets are skipped.
+func (h *ProxyHandler) applyModelOverride(header http.Header, body []byte) []byte {
+	override := strings.TrimSpace(header.Get(ModelOverrideHeader))
+	if override == "" {
+		override = strings.TrimSpace(header.Get(LegacyModelOverrideHeader))
+	}
+
+	if override == "" {
+		return body
+	}
+
+	if !strings.Contains(override, ",") {
+		h.logger.Warn("Ignoring model override without provider prefix", "model", override)
+		return body
+	}
+
+	var modelBody map[string]any
+	if err := json.Unmarshal(body, &modelBody); err != nil {
+		h.logger.Warn("Failed to apply model override", "error", err)
+		return body
+	}
+
+	h.logger.Debug("Applying model override", "from", modelBody["model"], "to", override)
+	modelBody["model"] = override
+
+	updatedBody, err := json.Marshal(modelBody)
+	if err != nil {
+		h.logger.Warn("Failed to apply model override", "error", err)
+		return body
+	}
+
+	return updatedBody
+}
+
+// applyDefaultMaxTokens sets max_tokens to the configured default when the request omits it.
+// Providers map max_tokens to their own field (max_completion_tokens, maxOutputTokens).
+func (h *ProxyHandler) applyDefaultMaxTokens(body []byte, defaultMaxTokens int) []byte {
+	if defaultMaxTokens <= 0 {
+		return body
+	}
+
+	var requestBody map[string]any
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return body
+	}
+
+	if _, hasMaxTokens := requestBody["max_tokens"]; hasMaxTokens {
+		return body
+	}
+
+	requestBody["max_tokens"] = defaultMaxTokens
+
+	updatedBody, err := json.Marshal(requestBody)
+	if err != nil {
+		h.logger.Warn("Failed to apply default max_tokens", "error", err)
+		return body
+	}
+
+	return updatedBody
+}
+
+// minThinkingBudget is the smallest thinking.budget_tokens Anthropic accepts
+const minThinkingBudget = 1024
+
+// clampMaxTokens lowers a max_tokens above the provider's max_output_tokens to that limit.
+// A thinking budget must stay below max_tokens, so it is lowered too, or thinking is dropped
+// when the limit leaves no room for the smallest budget.
+func (h *ProxyHandler) clampMaxTokens(body []byte, providerConfig *config.Provider) []byte {
+	if providerConfig.MaxOutputTokens <= 0 {
+		return body
+	}
+
+	var requestBody map[string]any
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return body
+	}
+
+	maxTokens, ok := requestBody["max_tokens"].(float64)
+	if !ok || maxTokens <= float64(providerConfig.MaxOutputTokens) {
+		return body
+	}
 
-			break
-		}
+	requestBody["max_tokens"] = providerConfig.MaxOutputTokens
 
-		// Process data lines
-		if strings.HasPrefix(line, "data: ") {
-			// For error responses, forward data as-is without transformation
-			if captureError {
-				if _, err := fmt.Fprintf(w, "%s\n\n", line); err != nil {
-					h.logger.Error("Failed to write error response", "error", err)
-					return
-				}
+	if thinking, ok := requestBody["thinking"].(map[string]any); ok {
+		if budget, ok := thinking["budget_tokens"].(float64); ok && budget >= float64(providerConfig.MaxOutputTokens) {
+			if providerConfig.MaxOutputTokens-1 < minThinkingBudget {
+				delete(requestBody, "thinking")
 			} else {
-				jsonData := strings.TrimPrefix(line, "data: ")
-
-				// Transform chunk through provider for successful responses
-				events, err := provider.TransformStream([]byte(jsonData), state)
-				if err != nil {
-					h.logger.Error("Stream transformation error", "error", err)
-					// Send original chunk on error
-					if _, err := fmt.Fprintf(w, "%s\n\n", line); err != nil {
-						h.logger.Error("Failed to write original chunk on transformation error", "error", err)
-						return
-					}
-				} else {
-					if len(events) > 0 {
-						if _, err := w.Write(events); err != nil {
-							h.logger.Error("Failed to write events", "error", err)
-							return
-						}
-					}
-				}
-			}
-
-			h.flushResponse(w)
-		} else {
-			// Pass through other SSE lines
-			if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
-				h.logger.Error("Failed to write SSE line", "error", err)
-				return
+				thinking["budget_tokens"] = providerConfig.MaxOutputTokens - 1
 			}
-
-			h.flushResponse(w)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		h.logger.Error("Stream scanning error", "error", err)
+	updatedBody, err := json.Marshal(requestBody)
+	if err != nil {
+		h.logger.Warn("Failed to clamp max_tokens", "error", err)
+		return body
 	}
 
-	// Print captured error response body
-	if captureError && len(errorBodyLines) > 0 {
-		fmt.Printf("\nUpstream streaming error response body:\n%s\n", strings.Join(errorBodyLines, "\n"))
-	}
+	h.logger.Info("Clamped max_tokens to the provider's limit",
+		"provider", providerConfig.Name, "requested", int(maxTokens), "max_output_tokens", providerConfig.MaxOutputTokens)
 
-	h.logger.Info("Completed streaming response",
-		"status", resp.StatusCode,
-		"input_tokens", inputTokens,
-	)
+	return updatedBody
 }
 
-func (h *ProxyHandler) handleResponse(w http.ResponseWriter, resp *http.Response, provider providers.Provider, inputTokens int) {
-	// Handle decompression
-	bodyReader, err := h.decompressReader(resp)
-	if err != nil {
-		h.httpError(w, http.StatusBadGateway, "decompression error: %v", err)
-		return
+// applyDefaultParams sets each of the provider's default parameters the request doesn't carry
+func (h *ProxyHandler) applyDefaultParams(body []byte, defaults map[string]any) []byte {
+	if len(defaults) == 0 {
+		return body
 	}
 
-	if closer, ok := bodyReader.(io.Closer); ok {
-		defer func() {
-			if closeErr := closer.Close(); closeErr != nil {
-				h.logger.Warn("Failed to close body reader", "error", closeErr)
-			}
-		}()
+	var requestBody map[string]any
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return body
 	}
 
-	// Read full response
-	respBody, err := io.ReadAll(bodyReader)
+	applied := false
+
+	for name, value := range defaults {
+		if _, hasParam := requestBody[name]; hasParam {
+			continue
+		}
+
+		requestBody[name] = value
+		applied = true
+	}
+
+	if !applied {
+		return body
+	}
+
+	updatedBody, err := json.Marshal(requestBody)
 	if err != nil {
-		h.httpError(w, http.StatusBadGateway, "failed to read upstream response: %v", err)
-		return
+		h.logger.Warn("Failed to apply default parameters", "error", err)
+		return body
 	}
 
-	var finalBody []byte
+	return updatedBody
+}
 
-	// For error responses, forward original response without transformation
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("\nUpstream error response body:\n%s\n", string(respBody))
-		finalBody = respBody
-	} else {
-		// Transform successful responses
-		transformedBody, err := provider.TransformResponse(respBody)
-		if err != nil {
-			h.logger.Warn("Response transformation failed, using original", "error", err)
+// validateRequestJSON checks that the body is a JSON object, reporting where parsing failed
+func validateRequestJSON(body []byte) error {
+	var request map[string]json.RawMessage
 
-			finalBody = respBody
-		} else {
-			finalBody = transformedBody
+	err := json.Unmarshal(body, &request)
+	if err == nil {
+		if request == nil {
+			return errors.New("request body must be a JSON object")
 		}
+
+		return nil
 	}
 
-	// Copy headers and send response
-	h.copyHeaders(w, resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("request body is not valid JSON: %v (at byte %d)", syntaxErr, syntaxErr.Offset)
+	}
 
-	if _, err := w.Write(finalBody); err != nil {
-		h.logger.Error("Failed to write response body", "error", err)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("request body must be a JSON object, got %s", typeErr.Value)
 	}
 
-	h.logResponseTokens(finalBody, resp.StatusCode, inputTokens)
+	return fmt.Errorf("request body is not valid JSON: %w", err)
 }
 
-func (h *ProxyHandler) findProvider(modelName string, cfg *config.Config) (providers.Provider, *config.Provider, error) {
-	// Parse provider name from model (format: "provider,model" or just "model")
-	parts := strings.SplitN(modelName, ",", 2)
+// applySystemPromptAdditions puts prefix before and suffix after the request's system prompt,
+// which may be a string or an array of text blocks, adding a system prompt if there is none
+func (h *ProxyHandler) applySystemPromptAdditions(body []byte, prefix, suffix string) []byte {
+	if prefix == "" && suffix == "" {
+		return body
+	}
 
-	var providerName string
-	if len(parts) > 1 {
-		providerName = parts[0]
+	var requestBody map[string]any
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return body
 	}
 
-	// Find provider config
-	var providerConfig *config.Provider
+	switch system := requestBody["system"].(type) {
+	case []any:
+		blocks := make([]any, 0, len(system)+2)
 
-	for i, p := range cfg.Providers {
-		if p.Name == providerName {
-			providerConfig = &cfg.Providers[i]
-			break
+		if prefix != "" {
+			blocks = append(blocks, map[string]any{"type": "text", "text": prefix})
 		}
-	}
 
-	var provider providers.Provider
+		blocks = append(blocks, system...)
 
-	if providerConfig != nil {
-		_provider, err := h.registry.GetByDomain(providerConfig.APIBase)
-		if err != nil {
-			return nil, nil, fmt.Errorf("no provider implementation for domain: %w", err)
+		if suffix != "" {
+			blocks = append(blocks, map[string]any{"type": "text", "text": suffix})
 		}
 
-		provider = _provider
-	} else {
-		_provider, ok := h.registry.Get(providerName)
-		if !ok {
-			return nil, nil, fmt.Errorf("provider '%s' not found in registry", providerName)
-		}
+		requestBody["system"] = blocks
+	default:
+		text, _ := system.(string)
 
-		providerConfig = &config.Provider{
-			Name:    _provider.Name(),
-			APIBase: _provider.GetEndpoint(),
+		parts := make([]string, 0, 3)
+		for _, part := range []string{prefix, text, suffix} {
+			if part != "" {
+				parts = append(parts, part)
+			}
 		}
 
-		provider = _provider
+		requestBody["system"] = strings.Join(parts, "\n\n")
 	}
 
-	// Use provider-specific API key if available, otherwise fallback to CCO_API_KEY
-	var apiKey string
-	if providerConfig != nil {
-		apiKey = providerConfig.APIKey
+	updatedBody, err := json.Marshal(requestBody)
+	if err != nil {
+		h.logger.Warn("Failed to apply system prompt additions", "error", err)
+		return body
 	}
 
-	if apiKey == "" {
-		if ccoAPIKey := os.Getenv("CCO_API_KEY"); ccoAPIKey != "" {
-			apiKey = ccoAPIKey
+	return updatedBody
+}
 
-			h.logger.Debug("Using CCO_API_KEY for provider", "provider", provider.Name())
+// requestSingleCandidate drops an n asking for more than one candidate, and logs it. The
+// Anthropic format has a single answer per message, and without n every provider returns one.
+func (h *ProxyHandler) requestSingleCandidate(body []byte, provider string) []byte {
+	var requestBody map[string]any
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return body
+	}
+
+	n, ok := requestBody["n"].(float64)
+	if !ok || n <= 1 {
+		return body
+	}
+
+	delete(requestBody, "n")
+
+	updatedBody, err := json.Marshal(requestBody)
+	if err != nil {
+		h.logger.Warn("Failed to drop n", "error", err)
+		return body
+	}
+
+	h.logger.Warn("Multiple candidates are not supported, requesting one", "provider", provider, "n", int(n))
+
+	return updatedBody
+}
+
+// resolveAlias expands a model alias from the configuration; other models are returned
+// unchanged. routed reports an alias naming a router bucket, whose route is returned.
+func (h *ProxyHandler) resolveAlias(model string, cfg *config.Config) (resolved string, routed bool) {
+	target, ok := cfg.Aliases[model]
+	if !ok || target == "" {
+		return model, false
+	}
+
+	if route, isBucket := cfg.Router.Route(target); isBucket {
+		if route == "" {
+			h.logger.Warn("Model alias names an unconfigured router bucket, using default route",
+				"alias", model, "bucket", target)
+			route = cfg.Router.Default
 		}
 
-		providerConfig.APIKey = apiKey
+		h.logger.Debug("Expanded model alias", "alias", model, "bucket", target, "model", route)
+
+		return route, true
 	}
 
-	provider.SetAPIKey(apiKey)
+	h.logger.Debug("Expanded model alias", "alias", model, "model", target)
 
-	return provider, providerConfig, nil
+	return target, false
 }
 
-func (h *ProxyHandler) selectModel(inputBody []byte, tokens int, routerConfig *config.RouterConfig) ([]byte, string) {
+func (h *ProxyHandler) selectModel(inputBody []byte, tokens int, cfg *config.Config) ([]byte, string) {
+	routerConfig := &cfg.Router
+
 	var modelBody map[string]any
 	if err := json.Unmarshal(inputBody, &modelBody); err != nil {
 		h.logger.Error("Failed to unmarshal request body for model selection", "error", err)
 		return inputBody, routerConfig.Default
 	}
 
-	// Model selection logic
-	var selectedModel string
+	// Model selection logic; rule records why the model was chosen for the decision log
+	var selectedModel, rule string
 
 	// Check if user provided explicit model in request
-	if model, ok := modelBody["model"].(string); ok && len(model) > 0 {
-		// If model contains comma (provider,model format), use it directly
-		if strings.Contains(model, ",") {
+	requested, _ := modelBody["model"].(string)
+	if len(requested) > 0 {
+		// Aliases resolve before routing; one naming a router bucket selects that bucket's model
+		model, routed := h.resolveAlias(requested, cfg)
+
+		if routed {
 			selectedModel = model
+			rule = "alias of a router bucket"
+		} else if providerName, _, found := strings.Cut(model, ","); found {
+			// If model contains comma (provider,model format), use it directly; background
+			// calls are recognised by model id even under a provider prefix
+			if routerConfig.Background != "" && routerConfig.IsBackgroundModel(model) {
+				selectedModel = routerConfig.Background
+				rule = "background bucket: background model " + model
+			} else if h.isKnownProvider(providerName, cfg) || routerConfig.Default == "" {
+				selectedModel = model
+				rule = "explicit provider"
+			} else {
+				// Routing to a provider that doesn't exist can only fail
+				h.logger.Warn("Unknown provider in requested model, using default route",
+					"model", model, "provider", providerName, "default", routerConfig.Default)
+				selectedModel = routerConfig.Default
+				rule = "unknown provider, default bucket"
+			}
 		} else {
 			// Apply automatic routing logic for non-explicit provider requests
-			if tokens > 60000 && routerConfig.LongContext != "" {
+			if tokens > longContextTokens && routerConfig.LongContext != "" {
 				selectedModel = routerConfig.LongContext
-			} else if strings.HasPrefix(model, "claude-3-5-haiku") && routerConfig.Background != "" {
+				rule = fmt.Sprintf("longContext bucket: %d input tokens over %d", tokens, longContextTokens)
+			} else if routerConfig.Background != "" && routerConfig.IsBackgroundModel(model) {
 				selectedModel = routerConfig.Background
+				rule = "background bucket: background model " + model
 			} else if routerConfig.Think != "" {
 				selectedModel = routerConfig.Think
+				rule = "think bucket: model without provider"
 			} else if routerConfig.WebSearch != "" {
 				selectedModel = routerConfig.WebSearch
+				rule = "webSearch bucket: model without provider"
 			} else {
 				selectedModel = model
+				rule = "no bucket configured, requested model"
 			}
 		}
 	} else {
 		// No model specified, use default
 		selectedModel = routerConfig.Default
+		rule = "default bucket: no model in request"
+	}
+
+	h.logger.Debug("Selected model",
+		"requested", requested,
+		"selected", selectedModel,
+		"rule", rule,
+		"input_tokens", tokens,
+	)
+
+	return h.setRequestModel(inputBody, modelBody, selectedModel)
+}
+
+// routingDisabled reports whether the request opted out of bucket routing through the
+// no-route header or the route=off query parameter
+func routingDisabled(r *http.Request) bool {
+	value := r.Header.Get(NoRouteHeader)
+	if value == "" {
+		value = r.Header.Get(LegacyNoRouteHeader)
+	}
+
+	if value != "" {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		return err != nil || enabled
+	}
+
+	return strings.EqualFold(r.URL.Query().Get("route"), "off")
+}
+
+// selectRequestedModel picks the model without aliases, buckets or rules: a "provider,model"
+// is used as is and anything else falls back to the default route
+func (h *ProxyHandler) selectRequestedModel(inputBody []byte, cfg *config.Config) ([]byte, string) {
+	var modelBody map[string]any
+	if err := json.Unmarshal(inputBody, &modelBody); err != nil {
+		h.logger.Error("Failed to unmarshal request body for model selection", "error", err)
+		return inputBody, cfg.Router.Default
+	}
+
+	selectedModel := cfg.Router.Default
+
+	if model, _ := modelBody["model"].(string); strings.Contains(model, ",") {
+		selectedModel = model
 	}
 
-	// Update model in request body
+	h.logger.Debug("Routing disabled for request", "model", selectedModel)
+
+	return h.setRequestModel(inputBody, modelBody, selectedModel)
+}
+
+// setRequestModel writes the model part of selectedModel into the request body
+func (h *ProxyHandler) setRequestModel(inputBody []byte, modelBody map[string]any, selectedModel string) ([]byte, string) {
 	var finalModel string
 	if parts := strings.SplitN(selectedModel, ",", 2); len(parts) > 1 {
 		finalModel = parts[1]
@@ -400,8 +1851,7 @@ func (h *ProxyHandler) selectModel(inputBody []byte, tokens int, routerConfig *c
 		finalModel = selectedModel
 	}
 
-	// Handle :online suffix for web search (preserve it for OpenRouter)
-	// OpenRouter expects model:online format, so we keep it as-is
+	// The :online web search suffix is kept here and normalized per provider by applyWebSearch
 	modelBody["model"] = finalModel
 
 	updatedBody, err := json.Marshal(modelBody)
@@ -413,10 +1863,137 @@ func (h *ProxyHandler) selectModel(inputBody []byte, tokens int, routerConfig *c
 	return updatedBody, selectedModel
 }
 
-func (h *ProxyHandler) countInputTokens(text string) int {
+// passthroughBody returns the client's request bytes for a provider with transforms disabled,
+// or the routed body when routing changed the model, which the upstream has to see
+func passthroughBody(original, routed []byte) []byte {
+	var originalModel, routedModel struct {
+		Model string `json:"model"`
+	}
+
+	if json.Unmarshal(original, &originalModel) != nil || json.Unmarshal(routed, &routedModel) != nil {
+		return routed
+	}
+
+	if originalModel.Model != routedModel.Model {
+		return routed
+	}
+
+	return original
+}
+
+// isWebSearchRequest reports whether the request asked for web search, either through the
+// client model's :online suffix or because routing selected the WebSearch bucket
+func (h *ProxyHandler) isWebSearchRequest(inputBody []byte, selectedModel string, routerConfig *config.RouterConfig) bool {
+	if routerConfig.WebSearch != "" && selectedModel == routerConfig.WebSearch {
+		return true
+	}
+
+	if strings.HasSuffix(selectedModel, onlineModelSuffix) {
+		return true
+	}
+
+	var modelBody map[string]any
+	if err := json.Unmarshal(inputBody, &modelBody); err != nil {
+		return false
+	}
+
+	model, _ := modelBody["model"].(string)
+
+	return strings.HasSuffix(model, onlineModelSuffix)
+}
+
+// applyModelMap rewrites the request's model through the provider's model_map
+func (h *ProxyHandler) applyModelMap(body []byte, modelName string, providerConfig *config.Provider) ([]byte, string) {
+	if len(providerConfig.ModelMap) == 0 {
+		return body, modelName
+	}
+
+	var modelBody map[string]any
+	if err := json.Unmarshal(body, &modelBody); err != nil {
+		return body, modelName
+	}
+
+	model, _ := modelBody["model"].(string)
+
+	mapped := providerConfig.MapModel(model)
+	if mapped == model {
+		return body, modelName
+	}
+
+	h.logger.Debug("Mapping model to provider id", "provider", providerConfig.Name, "from", model, "to", mapped)
+
+	modelBody["model"] = mapped
+
+	updatedBody, err := json.Marshal(modelBody)
+	if err != nil {
+		h.logger.Error("Failed to marshal mapped model", "error", err)
+		return body, modelName
+	}
+
+	if providerName, _, found := strings.Cut(modelName, ","); found {
+		return updatedBody, providerName + "," + mapped
+	}
+
+	return updatedBody, mapped
+}
+
+// applyWebSearch normalizes the :online suffix for the resolved provider. OpenRouter enables
+// web search through the suffix, so it is added when missing; other providers have no
+// equivalent model suffix, so it is stripped before the request is sent upstream.
+func (h *ProxyHandler) applyWebSearch(body []byte, modelName string, provider providers.Provider, webSearch bool) ([]byte, string) {
+	var modelBody map[string]any
+	if err := json.Unmarshal(body, &modelBody); err != nil {
+		return body, modelName
+	}
+
+	model, ok := modelBody["model"].(string)
+	if !ok || model == "" {
+		return body, modelName
+	}
+
+	var finalModel string
+	if provider.Name() == "openrouter" {
+		finalModel = model
+		if webSearch && !strings.HasSuffix(model, onlineModelSuffix) {
+			finalModel = model + onlineModelSuffix
+		}
+	} else {
+		finalModel = strings.TrimSuffix(model, onlineModelSuffix)
+		if webSearch {
+			h.logger.Debug("Web search suffix not supported by provider, stripping it", "provider", provider.Name(), "model", model)
+		}
+	}
+
+	if finalModel == model {
+		return body, modelName
+	}
+
+	modelBody["model"] = finalModel
+
+	updatedBody, err := json.Marshal(modelBody)
+	if err != nil {
+		h.logger.Error("Failed to marshal web search model update", "error", err)
+		return body, modelName
+	}
+
+	if parts := strings.SplitN(modelName, ",", 2); len(parts) > 1 {
+		return updatedBody, parts[0] + "," + finalModel
+	}
+
+	return updatedBody, finalModel
+}
+
+// countTokens estimates the tokens of text with the cl100k_base encoding
+func (h *ProxyHandler) countTokens(text string) int {
+	if failedAt := h.encodingFailedAt.Load(); failedAt != 0 && time.Since(time.Unix(0, failedAt)) < encodingRetryInterval {
+		return 0
+	}
+
 	tke, err := tiktoken.GetEncoding("cl100k_base")
 	if err != nil {
+		h.encodingFailedAt.Store(time.Now().UnixNano())
 		h.logger.Error("Failed to get tiktoken encoding", "error", err)
+
 		return 0
 	}
 
@@ -438,6 +2015,15 @@ func (h *ProxyHandler) decompressReader(resp *http.Response) (io.Reader, error)
 		bodyReader = gzipReader
 	case "br":
 		bodyReader = brotli.NewReader(resp.Body)
+	case "zstd":
+		// A single-threaded decoder runs without background goroutines, so nothing leaks
+		// when the caller simply stops reading
+		zstdReader, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		bodyReader = zstdReader
 	}
 
 	return bodyReader, nil
@@ -450,6 +2036,11 @@ func (h *ProxyHandler) copyHeaders(w http.ResponseWriter, resp *http.Response) {
 			continue
 		}
 
+		// CORS headers come from the CORS middleware, not the upstream
+		if strings.HasPrefix(key, "Access-Control-") {
+			continue
+		}
+
 		for _, value := range values {
 			w.Header().Add(key, value)
 		}
@@ -468,35 +2059,115 @@ func (h *ProxyHandler) httpError(w http.ResponseWriter, code int, format string,
 	http.Error(w, msg, code)
 }
 
-// buildEndpointURL constructs the final endpoint URL for the provider
-func (h *ProxyHandler) buildEndpointURL(provider providers.Provider, baseURL, modelName string) string {
+// anthropicError writes an error in the Anthropic API format so that clients can surface the message
+func (h *ProxyHandler) anthropicError(w http.ResponseWriter, code int, errorType, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	h.logger.Error("HTTP Error", "code", code, "message", msg)
+
+	errorBody := map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    errorType,
+			"message": msg,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(errorBody); err != nil {
+		h.logger.Error("Failed to write error response", "error", err)
+	}
+}
+
+// buildEndpointURL constructs the final endpoint URL for the provider. A url_template, when
+// configured, decides the URL alone. Otherwise the configured URL is the endpoint itself
+// unless base_is_full_url is false, in which case the provider's endpoint path is appended
+// to it. Gemini's URL is completed with the model and method either way.
+func (h *ProxyHandler) buildEndpointURL(provider providers.Provider, providerConfig *config.Provider, modelName string, stream bool) string {
+	// Extract actual model name from modelName (remove provider prefix if present)
+	actualModel := modelName
+	if parts := strings.SplitN(modelName, ",", 2); len(parts) > 1 {
+		actualModel = parts[1]
+	}
+
+	if template := providerConfig.EndpointTemplate(stream); template != "" {
+		return providerConfig.ExpandURLTemplate(template, actualModel)
+	}
+
+	baseURL := providerConfig.APIBase
+	if !providerConfig.UsesFullURL() {
+		baseURL = strings.TrimSuffix(baseURL, "/") + providers.EndpointPath(provider.Name())
+	}
+
 	// Handle Gemini's special URL requirement
 	if provider.Name() == "gemini" {
-		// Extract actual model name from modelName (remove provider prefix if present)
-		actualModel := modelName
-		if parts := strings.SplitN(modelName, ",", 2); len(parts) > 1 {
-			actualModel = parts[1]
+		// Streams come from streamGenerateContent; alt=sse makes Gemini send SSE data lines
+		// instead of a JSON array of chunks
+		method := "generateContent"
+		if stream {
+			method = "streamGenerateContent?alt=sse"
 		}
 
 		// Gemini requires the model in the URL path
 		// Format: https://generativelanguage.googleapis.com/v1beta/models/{model}:generateContent
 		if strings.HasSuffix(baseURL, "/models") {
-			return fmt.Sprintf("%s/%s:generateContent", baseURL, actualModel)
+			return fmt.Sprintf("%s/%s:%s", baseURL, actualModel, method)
 		} else if strings.Contains(baseURL, "/models/") {
 			// Base URL already has a model specified, replace it
 			baseIndex := strings.LastIndex(baseURL, "/models/")
 			basePart := baseURL[:baseIndex+8] // Keep "/models/"
 
-			return fmt.Sprintf("%s%s:generateContent", basePart, actualModel)
+			return fmt.Sprintf("%s%s:%s", basePart, actualModel, method)
 		}
 		// Fallback to appending the model
-		return fmt.Sprintf("%s/%s:generateContent", strings.TrimSuffix(baseURL, "/"), actualModel)
+		return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(baseURL, "/"), actualModel, method)
 	}
 
 	// For all other providers, use the base URL as-is
 	return baseURL
 }
 
+// upstreamHeaders copies the client headers, dropping Anthropic-specific ones
+// (anthropic-beta, anthropic-version, ...) for providers that don't speak the Anthropic format
+func (h *ProxyHandler) upstreamHeaders(header http.Header, provider providers.Provider, providerConfig *config.Provider, stripTelemetry bool) http.Header {
+	upstream := header.Clone()
+
+	// Ask for every encoding decompressReader handles, whatever the client itself accepts
+	upstream.Set("Accept-Encoding", upstreamAcceptEncoding)
+
+	// Proxy-only headers are never forwarded
+	upstream.Del(ModelOverrideHeader)
+	upstream.Del(LegacyModelOverrideHeader)
+	upstream.Del(NoRouteHeader)
+	upstream.Del(LegacyNoRouteHeader)
+	upstream.Del(middleware.SignatureHeader)
+	upstream.Del(middleware.SignatureTimestampHeader)
+
+	// The SDK's x-stainless-* headers and user agent describe the client, not this proxy
+	if stripTelemetry {
+		for key := range upstream {
+			if strings.HasPrefix(strings.ToLower(key), "x-stainless-") {
+				upstream.Del(key)
+			}
+		}
+
+		upstream.Set("User-Agent", UpstreamUserAgent)
+	}
+
+	if provider.Name() == "anthropic" || provider.Name() == providers.AnthropicOAuthName || providerConfig.DisableTransform {
+		return upstream
+	}
+
+	for key := range upstream {
+		if strings.HasPrefix(strings.ToLower(key), "anthropic-") {
+			upstream.Del(key)
+		}
+	}
+
+	return upstream
+}
+
 // setAuthHeader sets the appropriate authentication header for the provider
 func (h *ProxyHandler) setAuthHeader(req *http.Request, provider providers.Provider, apiKey string) {
 	switch provider.Name() {
@@ -509,18 +2180,28 @@ func (h *ProxyHandler) setAuthHeader(req *http.Request, provider providers.Provi
 	}
 }
 
-func (h *ProxyHandler) logResponseTokens(respBody []byte, statusCode int, inputTokens int) {
+func (h *ProxyHandler) logResponseTokens(respBody []byte, statusCode int, inputTokens int) tokenUsage {
 	logFields := []any{
 		"status", statusCode,
 		"input_tokens", inputTokens,
 	}
 
-	// Try to extract output tokens from response
+	var usage tokenUsage
+
+	// Try to extract token usage from response
 	var response map[string]any
 	if err := json.Unmarshal(respBody, &response); err == nil {
-		if usage, ok := response["usage"].(map[string]any); ok {
-			if outputTokens, ok := usage["output_tokens"]; ok {
+		if responseUsage, ok := response["usage"].(map[string]any); ok {
+			if input, ok := responseUsage["input_tokens"].(float64); ok {
+				usage.InputTokens = int(input)
+			}
+
+			if outputTokens, ok := responseUsage["output_tokens"]; ok {
 				logFields = append(logFields, "output_tokens", outputTokens)
+
+				if output, ok := outputTokens.(float64); ok {
+					usage.OutputTokens = int(output)
+				}
 			}
 		}
 	}
@@ -530,4 +2211,6 @@ func (h *ProxyHandler) logResponseTokens(respBody []byte, statusCode int, inputT
 	} else {
 		h.logger.Info("Successful response", logFields...)
 	}
+
+	return usage
 }
@@ -2,15 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/middleware"
 	"github.com/mihaisavezi/claude-code-open/internal/providers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,7 +78,10 @@ func TestRemoveFieldsRecursively(t *testing.T) {
 
 func TestSelectModel_DynamicProviderSelection(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
-	handler := &ProxyHandler{logger: logger}
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := &ProxyHandler{logger: logger, registry: registry}
 
 	routerConfig := &config.RouterConfig{
 		Default:     "default,claude-3-5-sonnet",
@@ -153,7 +162,7 @@ func TestSelectModel_DynamicProviderSelection(t *testing.T) {
 			require.NoError(t, err)
 
 			// Call selectModel
-			resultBody, selectedModel := handler.selectModel(inputBody, tc.tokens, routerConfig)
+			resultBody, selectedModel := handler.selectModel(inputBody, tc.tokens, &config.Config{Router: *routerConfig})
 
 			// Verify selected model
 			assert.Equal(t, tc.expectedModel, selectedModel, tc.description)
@@ -168,6 +177,73 @@ func TestSelectModel_DynamicProviderSelection(t *testing.T) {
 	}
 }
 
+func TestSelectModel_ModelOverrideHeader(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := &ProxyHandler{logger: logger, registry: registry}
+
+	routerConfig := &config.RouterConfig{
+		Default:     "default,claude-3-5-sonnet",
+		LongContext: "longcontext,claude-3-opus",
+		Background:  "background,claude-3-5-haiku",
+	}
+
+	testCases := []struct {
+		name          string
+		header        string
+		value         string
+		expectedModel string
+		expectedBody  string
+	}{
+		{
+			name:          "override header bypasses routing",
+			header:        ModelOverrideHeader,
+			value:         "openai,gpt-4o",
+			expectedModel: "openai,gpt-4o",
+			expectedBody:  "gpt-4o",
+		},
+		{
+			name:          "legacy override header",
+			header:        LegacyModelOverrideHeader,
+			value:         "openrouter,anthropic/claude-sonnet-4",
+			expectedModel: "openrouter,anthropic/claude-sonnet-4",
+			expectedBody:  "anthropic/claude-sonnet-4",
+		},
+		{
+			name:          "override without provider is ignored",
+			header:        ModelOverrideHeader,
+			value:         "gpt-4o",
+			expectedModel: "longcontext,claude-3-opus",
+			expectedBody:  "claude-3-opus",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputBody, err := json.Marshal(map[string]any{
+				"model":    "claude-3-5-haiku-20241022",
+				"messages": []any{},
+			})
+			require.NoError(t, err)
+
+			header := make(http.Header)
+			header.Set(tc.header, tc.value)
+
+			// Long context and background rules would otherwise apply
+			overriddenBody := handler.applyModelOverride(header, inputBody)
+			resultBody, selectedModel := handler.selectModel(overriddenBody, 100000, &config.Config{Router: *routerConfig})
+
+			assert.Equal(t, tc.expectedModel, selectedModel)
+
+			var parsedResult map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &parsedResult))
+			assert.Equal(t, tc.expectedBody, parsedResult["model"])
+		})
+	}
+}
+
 func TestSelectModel_NoModelProvided(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 	handler := &ProxyHandler{logger: logger}
@@ -186,7 +262,7 @@ func TestSelectModel_NoModelProvided(t *testing.T) {
 	require.NoError(t, err)
 
 	// Call selectModel
-	resultBody, selectedModel := handler.selectModel(inputBody, 1000, routerConfig)
+	resultBody, selectedModel := handler.selectModel(inputBody, 1000, &config.Config{Router: *routerConfig})
 
 	// Should use default
 	assert.Equal(t, "default,claude-3-5-sonnet", selectedModel)
@@ -199,175 +275,2441 @@ func TestSelectModel_NoModelProvided(t *testing.T) {
 	assert.Equal(t, "claude-3-5-sonnet", parsedResult["model"])
 }
 
-func TestHandleResponse_ErrorForwarding(t *testing.T) {
+func TestSelectModel_UnknownProviderFallsBackToDefault(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 
-	// Create a mock provider that would normally transform responses
-	mockProvider := &MockProvider{
-		shouldTransform: true,
-	}
+	registry := providers.NewRegistry()
+	registry.Initialize()
 
-	handler := &ProxyHandler{logger: logger}
+	handler := &ProxyHandler{logger: logger, registry: registry}
+
+	cfg := &config.Config{
+		Providers: []config.Provider{
+			{Name: "work-proxy", APIBase: "https://llm.internal.example/v1/chat/completions"},
+		},
+		Router: config.RouterConfig{
+			Default: "openrouter,anthropic/claude-sonnet-4",
+			Think:   "openai,o3",
+		},
+	}
 
 	testCases := []struct {
-		name            string
-		statusCode      int
-		responseBody    string
-		shouldTransform bool
-		description     string
+		name          string
+		inputModel    string
+		defaultRoute  string
+		expectedModel string
+		expectedBody  string
 	}{
 		{
-			name:            "error response not transformed",
-			statusCode:      400,
-			responseBody:    `{"error":{"type":"invalid_request_error","message":"Invalid model specified"}}`,
-			shouldTransform: false,
-			description:     "error responses should be forwarded without transformation",
+			name:          "unknown provider uses default",
+			inputModel:    "badprovider,foo",
+			defaultRoute:  cfg.Router.Default,
+			expectedModel: "openrouter,anthropic/claude-sonnet-4",
+			expectedBody:  "anthropic/claude-sonnet-4",
 		},
 		{
-			name:            "success response transformed",
-			statusCode:      200,
-			responseBody:    `{"id":"test","choices":[{"message":{"role":"assistant","content":"Hello"}}]}`,
-			shouldTransform: true,
-			description:     "success responses should be transformed",
+			name:          "configured custom provider is kept",
+			inputModel:    "work-proxy,llama-3",
+			defaultRoute:  cfg.Router.Default,
+			expectedModel: "work-proxy,llama-3",
+			expectedBody:  "llama-3",
 		},
 		{
-			name:            "server error not transformed",
-			statusCode:      500,
-			responseBody:    `{"error":{"type":"internal_server_error","message":"Internal server error"}}`,
-			shouldTransform: false,
-			description:     "server errors should be forwarded without transformation",
+			name:          "built-in provider without config is kept",
+			inputModel:    "gemini,gemini-2.5-pro",
+			defaultRoute:  cfg.Router.Default,
+			expectedModel: "gemini,gemini-2.5-pro",
+			expectedBody:  "gemini-2.5-pro",
+		},
+		{
+			name:          "unknown provider without default is left for lookup to report",
+			inputModel:    "badprovider,foo",
+			defaultRoute:  "",
+			expectedModel: "badprovider,foo",
+			expectedBody:  "foo",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Reset mock provider
-			mockProvider.transformCalled = false
+			testCfg := *cfg
+			testCfg.Router.Default = tc.defaultRoute
 
-			// Create mock HTTP response
-			resp := &http.Response{
-				StatusCode: tc.statusCode,
-				Header:     make(http.Header),
-				Body:       io.NopCloser(strings.NewReader(tc.responseBody)),
-			}
-			resp.Header.Set("Content-Type", "application/json")
+			inputBody, err := json.Marshal(map[string]any{
+				"model":    tc.inputModel,
+				"messages": []any{},
+			})
+			require.NoError(t, err)
 
-			// Create response writer
-			w := &MockResponseWriter{
-				headers: make(http.Header),
-				body:    &bytes.Buffer{},
-			}
+			resultBody, selectedModel := handler.selectModel(inputBody, 1000, &testCfg)
+			assert.Equal(t, tc.expectedModel, selectedModel)
 
-			// Call handleResponse
-			handler.handleResponse(w, resp, mockProvider, 100)
+			var parsedResult map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &parsedResult))
+			assert.Equal(t, tc.expectedBody, parsedResult["model"])
+		})
+	}
+}
 
-			// Verify transformation was called only for success responses
-			if tc.shouldTransform {
-				assert.True(t, mockProvider.transformCalled, tc.description)
-			} else {
-				assert.False(t, mockProvider.transformCalled, tc.description)
-			}
+func TestSelectModel_BackgroundModelForms(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 
-			// Verify status code is preserved
-			assert.Equal(t, tc.statusCode, w.statusCode, "status code should be preserved")
+	registry := providers.NewRegistry()
+	registry.Initialize()
 
-			// Verify response body
-			responseBody := w.body.String()
-			if tc.shouldTransform {
-				// For successful responses, we expect transformation
-				assert.Contains(t, responseBody, "TRANSFORMED", "successful response should be transformed")
-			} else {
-				// For error responses, we expect original body
-				assert.Equal(t, tc.responseBody, responseBody, "error response should be forwarded as-is")
-			}
+	handler := &ProxyHandler{logger: logger, registry: registry}
+
+	cfg := &config.Config{
+		Router: config.RouterConfig{
+			Default:    "openrouter,anthropic/claude-sonnet-4",
+			Think:      "openai,o3",
+			Background: "openai,gpt-4o-mini",
+		},
+	}
+
+	testCases := []struct {
+		inputModel    string
+		expectedModel string
+	}{
+		{"claude-3-5-haiku-20241022", "openai,gpt-4o-mini"},
+		{"claude-3-5-haiku-latest", "openai,gpt-4o-mini"},
+		{"anthropic,claude-3-5-haiku-latest", "openai,gpt-4o-mini"},
+		{"openrouter,anthropic/claude-3-5-haiku", "openai,gpt-4o-mini"},
+		{"claude-haiku-4-5-20251001", "openai,gpt-4o-mini"},
+		{"claude-sonnet-4", "openai,o3"},
+		{"anthropic,claude-sonnet-4", "anthropic,claude-sonnet-4"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.inputModel, func(t *testing.T) {
+			inputBody, err := json.Marshal(map[string]any{
+				"model":    tc.inputModel,
+				"messages": []any{},
+			})
+			require.NoError(t, err)
+
+			_, selectedModel := handler.selectModel(inputBody, 1000, cfg)
+			assert.Equal(t, tc.expectedModel, selectedModel)
 		})
 	}
-}
 
-// Mock provider for testing
-type MockProvider struct {
-	transformCalled bool
-	shouldTransform bool
-}
+	// Without a background route the requested model is kept
+	noBackground := *cfg
+	noBackground.Router.Background = ""
 
-func (m *MockProvider) Name() string                                 { return "mock" }
-func (m *MockProvider) SupportsStreaming() bool                      { return true }
-func (m *MockProvider) GetEndpoint() string                          { return "mock" }
-func (m *MockProvider) SetAPIKey(key string)                         {}
-func (m *MockProvider) IsStreaming(headers map[string][]string) bool { return false }
-func (m *MockProvider) TransformStream(chunk []byte, state *providers.StreamState) ([]byte, error) {
-	return chunk, nil
-}
+	inputBody, err := json.Marshal(map[string]any{"model": "anthropic,claude-3-5-haiku-latest"})
+	require.NoError(t, err)
 
-func (m *MockProvider) TransformRequest(request []byte) ([]byte, error) {
-	return request, nil
+	_, selectedModel := handler.selectModel(inputBody, 1000, &noBackground)
+	assert.Equal(t, "anthropic,claude-3-5-haiku-latest", selectedModel)
 }
 
-func (m *MockProvider) TransformResponse(response []byte) ([]byte, error) {
-	m.transformCalled = true
-	if m.shouldTransform {
-		return []byte(`{"transformed": true, "original": "TRANSFORMED"}`), nil
+func TestSelectModel_LogsLongContextDecision(t *testing.T) {
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := &ProxyHandler{logger: logger, registry: registry}
+
+	cfg := &config.Config{
+		Providers: []config.Provider{
+			{Name: "openrouter", APIBase: "https://openrouter.ai/api/v1/chat/completions", APIKey: "sk-secret"},
+		},
+		Router: config.RouterConfig{
+			Default:     "openrouter,anthropic/claude-sonnet-4",
+			Think:       "openrouter,deepseek/deepseek-r1",
+			LongContext: "openrouter,google/gemini-2.5-pro",
+		},
 	}
-	return response, nil
-}
 
-// Mock response writer for testing
-type MockResponseWriter struct {
-	headers    http.Header
-	body       *bytes.Buffer
-	statusCode int
-}
+	inputBody, err := json.Marshal(map[string]any{
+		"model":    "claude-sonnet-4",
+		"messages": []any{},
+	})
+	require.NoError(t, err)
 
-func (m *MockResponseWriter) Header() http.Header {
-	return m.headers
-}
+	_, selectedModel := handler.selectModel(inputBody, 70000, cfg)
+	assert.Equal(t, "openrouter,google/gemini-2.5-pro", selectedModel)
 
-func (m *MockResponseWriter) Write(data []byte) (int, error) {
-	return m.body.Write(data)
-}
+	_, _, err = handler.findProvider(selectedModel, cfg)
+	require.NoError(t, err)
 
-func (m *MockResponseWriter) WriteHeader(statusCode int) {
-	m.statusCode = statusCode
+	output := logs.String()
+	assert.Contains(t, output, `msg="Selected model" requested=claude-sonnet-4 selected=openrouter,google/gemini-2.5-pro`)
+	assert.Contains(t, output, `rule="longContext bucket: 70000 input tokens over 60000"`)
+	assert.Contains(t, output, `msg="Selected provider" model=openrouter,google/gemini-2.5-pro provider=openrouter`)
+	assert.Contains(t, output, `source="configured url"`)
+	assert.NotContains(t, output, "sk-secret")
 }
 
-func TestHandleStreamingResponse_ErrorForwarding(t *testing.T) {
+func TestSelectModel_Aliases(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 
-	// Create a mock provider
-	mockProvider := &MockProvider{shouldTransform: true}
+	registry := providers.NewRegistry()
+	registry.Initialize()
 
-	handler := &ProxyHandler{logger: logger}
+	handler := &ProxyHandler{logger: logger, registry: registry}
 
-	// Test error response body (simulating SSE error stream)
-	errorStreamBody := `data: {"error":{"type":"invalid_request_error","message":"Invalid model specified"}}
+	cfg := &config.Config{
+		Router: config.RouterConfig{
+			Default: "openrouter,anthropic/claude-sonnet-4",
+			Think:   "openai,o3",
+		},
+		Aliases: map[string]string{
+			"sonnet":   "openrouter,anthropic/claude-3.5-sonnet",
+			"thinking": "think",
+			"bg":       "background",
+			"haiku":    "claude-3-5-haiku-20241022",
+		},
+	}
 
-`
+	testCases := []struct {
+		name          string
+		inputModel    string
+		tokens        int
+		expectedModel string
+		expectedBody  string
+	}{
+		{
+			name:          "alias expands to provider and model",
+			inputModel:    "sonnet",
+			tokens:        100000,
+			expectedModel: "openrouter,anthropic/claude-3.5-sonnet",
+			expectedBody:  "anthropic/claude-3.5-sonnet",
+		},
+		{
+			name:          "alias to a router bucket uses its route",
+			inputModel:    "thinking",
+			expectedModel: "openai,o3",
+			expectedBody:  "o3",
+		},
+		{
+			name:          "alias to an unconfigured bucket uses the default route",
+			inputModel:    "bg",
+			expectedModel: "openrouter,anthropic/claude-sonnet-4",
+			expectedBody:  "anthropic/claude-sonnet-4",
+		},
+		{
+			name:          "alias to a bare model goes through routing",
+			inputModel:    "haiku",
+			expectedModel: "openai,o3",
+			expectedBody:  "o3",
+		},
+	}
 
-	// Create mock HTTP response with error status
-	resp := &http.Response{
-		StatusCode: 400,
-		Header:     make(http.Header),
-		Body:       io.NopCloser(strings.NewReader(errorStreamBody)),
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputBody, err := json.Marshal(map[string]any{
+				"model":    tc.inputModel,
+				"messages": []any{},
+			})
+			require.NoError(t, err)
+
+			resultBody, selectedModel := handler.selectModel(inputBody, tc.tokens, cfg)
+			assert.Equal(t, tc.expectedModel, selectedModel)
+
+			var parsedResult map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &parsedResult))
+			assert.Equal(t, tc.expectedBody, parsedResult["model"])
+		})
 	}
-	resp.Header.Set("Content-Type", "text/event-stream")
+}
 
-	// Create response writer
-	w := &MockResponseWriter{
-		headers: make(http.Header),
-		body:    &bytes.Buffer{},
+func TestApplyWebSearch_OnlineSuffix(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := &ProxyHandler{logger: logger, registry: registry}
+
+	routerConfig := &config.RouterConfig{
+		Default:   "openrouter,anthropic/claude-sonnet-4",
+		WebSearch: "openrouter,perplexity/sonar",
 	}
 
-	// Call handleStreamingResponse
-	handler.handleStreamingResponse(w, resp, mockProvider, 100)
+	testCases := []struct {
+		name          string
+		provider      providers.Provider
+		inputModel    string
+		tokens        int
+		expectedModel string
+		expectedBody  string
+	}{
+		{
+			name:          "openrouter preserves client online suffix",
+			provider:      providers.NewOpenRouterProvider(),
+			inputModel:    "openrouter,anthropic/claude-sonnet-4:online",
+			expectedModel: "openrouter,anthropic/claude-sonnet-4:online",
+			expectedBody:  "anthropic/claude-sonnet-4:online",
+		},
+		{
+			name:          "openrouter adds suffix for web search bucket",
+			provider:      providers.NewOpenRouterProvider(),
+			inputModel:    "claude-3-5-sonnet",
+			expectedModel: "openrouter,perplexity/sonar:online",
+			expectedBody:  "perplexity/sonar:online",
+		},
+		{
+			name:          "openrouter leaves regular models untouched",
+			provider:      providers.NewOpenRouterProvider(),
+			inputModel:    "openrouter,anthropic/claude-sonnet-4",
+			expectedModel: "openrouter,anthropic/claude-sonnet-4",
+			expectedBody:  "anthropic/claude-sonnet-4",
+		},
+		{
+			name:          "openai strips online suffix",
+			provider:      providers.NewOpenAIProvider(),
+			inputModel:    "openai,gpt-4o:online",
+			expectedModel: "openai,gpt-4o",
+			expectedBody:  "gpt-4o",
+		},
+	}
 
-	// Verify transformation was NOT called for error response
-	assert.False(t, mockProvider.transformCalled, "error streaming responses should not be transformed")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputBody, err := json.Marshal(map[string]any{
+				"model":    tc.inputModel,
+				"messages": []any{},
+			})
+			require.NoError(t, err)
 
-	// Verify status code is preserved
-	assert.Equal(t, 400, w.statusCode, "error status code should be preserved")
+			selectedBody, selectedModel := handler.selectModel(inputBody, tc.tokens, &config.Config{Router: *routerConfig})
+			webSearch := handler.isWebSearchRequest(inputBody, selectedModel, routerConfig)
+
+			resultBody, resultModel := handler.applyWebSearch(selectedBody, selectedModel, tc.provider, webSearch)
+			assert.Equal(t, tc.expectedModel, resultModel)
+
+			var parsedResult map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &parsedResult))
+			assert.Equal(t, tc.expectedBody, parsedResult["model"])
+		})
+	}
+}
+
+func TestApplyDefaultMaxTokens(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	testCases := []struct {
+		name              string
+		request           map[string]any
+		defaultMaxTokens  int
+		expectedMaxTokens any
+	}{
+		{
+			name:              "injects default when absent",
+			request:           map[string]any{"model": "gpt-4o", "messages": []any{}},
+			defaultMaxTokens:  8192,
+			expectedMaxTokens: float64(8192),
+		},
+		{
+			name:              "keeps client value",
+			request:           map[string]any{"model": "gpt-4o", "messages": []any{}, "max_tokens": 100},
+			defaultMaxTokens:  8192,
+			expectedMaxTokens: float64(100),
+		},
+		{
+			name:              "disabled when unset",
+			request:           map[string]any{"model": "gpt-4o", "messages": []any{}},
+			defaultMaxTokens:  0,
+			expectedMaxTokens: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputBody, err := json.Marshal(tc.request)
+			require.NoError(t, err)
+
+			resultBody := handler.applyDefaultMaxTokens(inputBody, tc.defaultMaxTokens)
+
+			// The OpenAI transform carries the value through as max_completion_tokens
+			transformed, err := providers.NewOpenAIProvider().TransformRequest(resultBody)
+			require.NoError(t, err)
+
+			var openAIRequest map[string]any
+			require.NoError(t, json.Unmarshal(transformed, &openAIRequest))
+			assert.Equal(t, tc.expectedMaxTokens, openAIRequest["max_completion_tokens"])
+			assert.NotContains(t, openAIRequest, "max_tokens")
+		})
+	}
+}
+
+func TestApplyDefaultParams(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	defaults := map[string]any{"temperature": 0, "top_p": 0.9}
+
+	testCases := []struct {
+		name     string
+		request  string
+		defaults map[string]any
+		expected map[string]any
+	}{
+		{
+			name:     "injects defaults when absent",
+			request:  `{"model":"gpt-4o","messages":[]}`,
+			defaults: defaults,
+			expected: map[string]any{"temperature": float64(0), "top_p": 0.9},
+		},
+		{
+			name:     "keeps client values",
+			request:  `{"model":"gpt-4o","messages":[],"temperature":0.7}`,
+			defaults: defaults,
+			expected: map[string]any{"temperature": 0.7, "top_p": 0.9},
+		},
+		{
+			name:     "no defaults configured",
+			request:  `{"model":"gpt-4o","messages":[]}`,
+			defaults: nil,
+			expected: map[string]any{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resultBody := handler.applyDefaultParams([]byte(tc.request), tc.defaults)
+
+			var request map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &request))
+
+			params := map[string]any{}
+
+			for _, name := range []string{"temperature", "top_p"} {
+				if value, ok := request[name]; ok {
+					params[name] = value
+				}
+			}
+
+			assert.Equal(t, tc.expected, params)
+			assert.Equal(t, "gpt-4o", request["model"])
+		})
+	}
+
+	// A request already carrying every default is forwarded untouched
+	request := []byte(`{"model":"gpt-4o",  "temperature":1,"top_p":1}`)
+	assert.Equal(t, request, handler.applyDefaultParams(request, defaults))
+}
+
+func TestClampMaxTokens(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	testCases := []struct {
+		name              string
+		request           string
+		maxOutputTokens   int
+		expectedMaxTokens any
+	}{
+		{"clamped to the limit", `{"model":"gpt-4o","max_tokens":64000,"messages":[]}`, 16384, float64(16384)},
+		{"within the limit", `{"model":"gpt-4o","max_tokens":1024,"messages":[]}`, 16384, float64(1024)},
+		{"no limit configured", `{"model":"gpt-4o","max_tokens":64000,"messages":[]}`, 0, float64(64000)},
+		{"no max_tokens", `{"model":"gpt-4o","messages":[]}`, 16384, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resultBody := handler.clampMaxTokens([]byte(tc.request), &config.Provider{Name: "openai", MaxOutputTokens: tc.maxOutputTokens})
+
+			// The OpenAI transform carries the clamped value through as max_completion_tokens
+			transformed, err := providers.NewOpenAIProvider().TransformRequest(resultBody)
+			require.NoError(t, err)
+
+			var openAIRequest map[string]any
+			require.NoError(t, json.Unmarshal(transformed, &openAIRequest))
+			assert.Equal(t, tc.expectedMaxTokens, openAIRequest["max_completion_tokens"])
+		})
+	}
+}
+
+func TestRequestSingleCandidate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	request := []byte(`{"model":"claude-sonnet-4","n":3,"max_tokens":100,"messages":[]}`)
+
+	// Passthrough providers forward the body as it is, so n must already be gone
+	for _, provider := range []providers.Provider{providers.NewAnthropicProvider(), providers.NewGeminiProvider(), providers.NewOpenAIProvider()} {
+		transformed, err := provider.TransformRequest(handler.requestSingleCandidate(request, provider.Name()))
+		require.NoError(t, err)
+
+		var providerRequest map[string]any
+		require.NoError(t, json.Unmarshal(transformed, &providerRequest))
+		assert.NotContains(t, providerRequest, "n", provider.Name())
+	}
+
+	// A single candidate is forwarded untouched
+	single := []byte(`{"model":"gpt-4o", "n":1}`)
+	assert.Equal(t, single, handler.requestSingleCandidate(single, "openai"))
+}
+
+func TestClampMaxTokens_LowersThinkingBudget(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	testCases := []struct {
+		name             string
+		request          string
+		maxOutputTokens  int
+		expectedThinking any
+	}{
+		{
+			"budget lowered below the limit",
+			`{"model":"claude-sonnet-4","max_tokens":64000,"thinking":{"type":"enabled","budget_tokens":32000},"messages":[]}`,
+			16384,
+			map[string]any{"type": "enabled", "budget_tokens": float64(16383)},
+		},
+		{
+			"budget already below the limit",
+			`{"model":"claude-sonnet-4","max_tokens":64000,"thinking":{"type":"enabled","budget_tokens":8000},"messages":[]}`,
+			16384,
+			map[string]any{"type": "enabled", "budget_tokens": float64(8000)},
+		},
+		{
+			"no room for thinking",
+			`{"model":"claude-sonnet-4","max_tokens":64000,"thinking":{"type":"enabled","budget_tokens":2048},"messages":[]}`,
+			1024,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resultBody := handler.clampMaxTokens([]byte(tc.request), &config.Provider{Name: "anthropic", MaxOutputTokens: tc.maxOutputTokens})
+
+			var request map[string]any
+			require.NoError(t, json.Unmarshal(resultBody, &request))
+			assert.Equal(t, float64(tc.maxOutputTokens), request["max_tokens"])
+			assert.Equal(t, tc.expectedThinking, request["thinking"])
+		})
+	}
+}
+
+func TestServeHTTP_UnknownProviderReturnsError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := NewProxyHandler(config.NewManager(t.TempDir()), registry, logger)
+
+	requestBody := `{"model":"unknown,some-model","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var errorResp map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResp), "error response should be valid JSON")
+	assert.Equal(t, "error", errorResp["type"])
+
+	errorDetails, ok := errorResp["error"].(map[string]any)
+	require.True(t, ok, "error details should be an object")
+	assert.Equal(t, "invalid_request_error", errorDetails["type"])
+
+	message, _ := errorDetails["message"].(string)
+	assert.Contains(t, message, "'unknown'")
+	assert.Contains(t, message, "openrouter", "message should list the available providers")
+	assert.Contains(t, message, "gemini", "message should list the available providers")
+}
+
+func TestServeHTTP_MalformedJSONReturnsError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := NewProxyHandler(config.NewManager(t.TempDir()), registry, logger)
+
+	testCases := []struct {
+		name            string
+		body            string
+		expectedMessage string
+	}{
+		{
+			name:            "syntax error reports its position",
+			body:            `{"model":"openai,gpt-4o","messages":[}`,
+			expectedMessage: "at byte 38",
+		},
+		{
+			name:            "empty body",
+			body:            "",
+			expectedMessage: "not valid JSON",
+		},
+		{
+			name:            "array instead of object",
+			body:            `[{"model":"openai,gpt-4o"}]`,
+			expectedMessage: "must be a JSON object",
+		},
+		{
+			name:            "null",
+			body:            "null",
+			expectedMessage: "must be a JSON object",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+			var errorResp map[string]any
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResp), "error response should be valid JSON")
+
+			errorDetails, ok := errorResp["error"].(map[string]any)
+			require.True(t, ok, "error details should be an object")
+			assert.Equal(t, "invalid_request_error", errorDetails["type"])
+			assert.Contains(t, errorDetails["message"], tc.expectedMessage)
+		})
+	}
+}
+
+func TestServeHTTP_KeylessLocalProvider(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// The shared key must not be forwarded to a local server
+	t.Setenv("CCO_API_KEY", "shared-key")
+
+	var authHeaders []string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"qwen2.5-coder-14b-instruct\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi local\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"qwen2.5-coder-14b-instruct\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"qwen2.5-coder-14b-instruct","choices":[{"index":0,"message":{"role":"assistant","content":"Hi local"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	// Address the test server as localhost; LM Studio on a port other than 1234 is mapped
+	// in the configuration
+	localURL := strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1)
+	localHost := strings.TrimPrefix(localURL, "http://")
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "lmstudio", APIBase: localURL + "/v1/chat/completions"},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{localHost: "lmstudio"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"lmstudio,qwen2.5-coder-14b-instruct","stream":%t,"max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code, "stream=%t: %s", stream, rr.Body.String())
+		assert.Contains(t, rr.Body.String(), "Hi local")
+
+		if stream {
+			assert.Contains(t, rr.Body.String(), "event: message_stop")
+		}
+	}
+
+	assert.Equal(t, []string{"", ""}, authHeaders, "no Authorization header should be sent")
+	assert.Empty(t, cfgMgr.Get().Providers[0].APIKey, "resolving the key must not modify the config")
+}
+
+func TestUpstreamHeaders_AnthropicHeadersByProvider(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	clientHeaders := make(http.Header)
+	clientHeaders.Set("Anthropic-Beta", "prompt-caching-2024-07-31")
+	clientHeaders.Set("Anthropic-Version", "2023-06-01")
+	clientHeaders.Set("Content-Type", "application/json")
+
+	anthropicHeaders := handler.upstreamHeaders(clientHeaders, providers.NewAnthropicProvider(), &config.Provider{}, false)
+	assert.Equal(t, "prompt-caching-2024-07-31", anthropicHeaders.Get("anthropic-beta"))
+	assert.Equal(t, "2023-06-01", anthropicHeaders.Get("anthropic-version"))
+	assert.Equal(t, "application/json", anthropicHeaders.Get("Content-Type"))
+
+	openaiHeaders := handler.upstreamHeaders(clientHeaders, providers.NewOpenAIProvider(), &config.Provider{}, false)
+	assert.Empty(t, openaiHeaders.Get("anthropic-beta"), "beta header should not reach OpenAI-format providers")
+	assert.Empty(t, openaiHeaders.Get("anthropic-version"))
+	assert.Equal(t, "application/json", openaiHeaders.Get("Content-Type"))
+
+	// The client's headers must be left untouched
+	assert.Equal(t, "prompt-caching-2024-07-31", clientHeaders.Get("anthropic-beta"))
+}
+
+func TestUpstreamHeaders_DropsProxyOnlyHeaders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	proxyOnly := []string{
+		ModelOverrideHeader, LegacyModelOverrideHeader, NoRouteHeader, LegacyNoRouteHeader,
+		middleware.SignatureHeader, middleware.SignatureTimestampHeader,
+	}
+
+	clientHeaders := make(http.Header)
+	clientHeaders.Set("Content-Type", "application/json")
+
+	for _, name := range proxyOnly {
+		clientHeaders.Set(name, "1")
+	}
+
+	for _, provider := range []providers.Provider{providers.NewAnthropicProvider(), providers.NewOpenAIProvider()} {
+		upstream := handler.upstreamHeaders(clientHeaders, provider, &config.Provider{}, false)
+
+		for _, name := range proxyOnly {
+			assert.Empty(t, upstream.Values(name), "%s should not reach %s", name, provider.Name())
+		}
+
+		assert.Equal(t, "application/json", upstream.Get("Content-Type"))
+	}
+}
+
+func TestServeHTTP_StripClientTelemetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	for _, strip := range []bool{false, true} {
+		var received http.Header
+
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+		}))
+
+		cfgMgr := config.NewManager(t.TempDir())
+		require.NoError(t, cfgMgr.Save(&config.Config{
+			Providers: []config.Provider{
+				{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+			},
+			StripClientTelemetry: strip,
+		}))
+
+		registry := providers.NewRegistry()
+		registry.Initialize()
+		registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+		handler := NewProxyHandler(cfgMgr, registry, logger)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+			strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("User-Agent", "claude-cli/1.0.0 (external, cli)")
+		req.Header.Set("X-Stainless-Lang", "js")
+		req.Header.Set("X-Stainless-Package-Version", "0.55.1")
+		req.Header.Set("X-Custom", "kept")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		upstream.Close()
+
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "kept", received.Get("X-Custom"), "strip=%t", strip)
+
+		if strip {
+			assert.Empty(t, received.Get("X-Stainless-Lang"))
+			assert.Empty(t, received.Get("X-Stainless-Package-Version"))
+			assert.Equal(t, UpstreamUserAgent, received.Get("User-Agent"))
+		} else {
+			assert.Equal(t, "js", received.Get("X-Stainless-Lang"))
+			assert.Equal(t, "claude-cli/1.0.0 (external, cli)", received.Get("User-Agent"))
+		}
+	}
+}
+
+func TestServeHTTP_SystemPromptAdditions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamBody map[string]any
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamBody))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+		SystemPrefix: "Follow the ACME coding policy.",
+		SystemSuffix: "Never print secrets.",
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	testCases := []struct {
+		name     string
+		system   string
+		expected any
+	}{
+		{
+			name:     "string system prompt",
+			system:   `,"system":"You are Claude Code."`,
+			expected: "Follow the ACME coding policy.\n\nYou are Claude Code.\n\nNever print secrets.",
+		},
+		{
+			name:   "array system prompt",
+			system: `,"system":[{"type":"text","text":"You are Claude Code."}]`,
+			expected: []any{
+				map[string]any{"type": "text", "text": "Follow the ACME coding policy."},
+				map[string]any{"type": "text", "text": "You are Claude Code."},
+				map[string]any{"type": "text", "text": "Never print secrets."},
+			},
+		},
+		{
+			name:     "no system prompt",
+			expected: "Follow the ACME coding policy.\n\nNever print secrets.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100`+tc.system+`,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			messages, ok := upstreamBody["messages"].([]any)
+			require.True(t, ok, "upstream request should have messages")
+
+			systemMessage := messages[0].(map[string]any)
+			assert.Equal(t, "system", systemMessage["role"])
+			assert.Equal(t, tc.expected, systemMessage["content"])
+		})
+	}
+}
+
+func TestHandleResponse_ErrorForwarding(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Create a mock provider that would normally transform responses
+	mockProvider := &MockProvider{
+		shouldTransform: true,
+	}
+
+	handler := &ProxyHandler{logger: logger}
+
+	testCases := []struct {
+		name            string
+		statusCode      int
+		responseBody    string
+		shouldTransform bool
+		description     string
+	}{
+		{
+			name:            "error response not transformed",
+			statusCode:      400,
+			responseBody:    `{"error":{"type":"invalid_request_error","message":"Invalid model specified"}}`,
+			shouldTransform: false,
+			description:     "error responses should be forwarded without transformation",
+		},
+		{
+			name:            "success response transformed",
+			statusCode:      200,
+			responseBody:    `{"id":"test","choices":[{"message":{"role":"assistant","content":"Hello"}}]}`,
+			shouldTransform: true,
+			description:     "success responses should be transformed",
+		},
+		{
+			name:            "server error not transformed",
+			statusCode:      500,
+			responseBody:    `{"error":{"type":"internal_server_error","message":"Internal server error"}}`,
+			shouldTransform: false,
+			description:     "server errors should be forwarded without transformation",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset mock provider
+			mockProvider.transformCalled = false
+
+			// Create mock HTTP response
+			resp := &http.Response{
+				StatusCode: tc.statusCode,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(tc.responseBody)),
+			}
+			resp.Header.Set("Content-Type", "application/json")
+
+			// Create response writer
+			w := &MockResponseWriter{
+				headers: make(http.Header),
+				body:    &bytes.Buffer{},
+			}
+
+			// Call handleResponse
+			handler.handleResponse(w, resp, mockProvider, 100, nil, &config.Provider{})
+
+			// Verify transformation was called only for success responses
+			if tc.shouldTransform {
+				assert.True(t, mockProvider.transformCalled, tc.description)
+			} else {
+				assert.False(t, mockProvider.transformCalled, tc.description)
+			}
+
+			// Verify status code is preserved
+			assert.Equal(t, tc.statusCode, w.statusCode, "status code should be preserved")
+
+			// Verify response body
+			responseBody := w.body.String()
+			if tc.shouldTransform {
+				// For successful responses, we expect transformation
+				assert.Contains(t, responseBody, "TRANSFORMED", "successful response should be transformed")
+			} else {
+				// For error responses, we expect original body
+				assert.Equal(t, tc.responseBody, responseBody, "error response should be forwarded as-is")
+			}
+		})
+	}
+}
+
+func TestHandleResponse_NonJSONErrorPage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	page := "<!DOCTYPE html>\n<html>\n<head><title>502 Bad Gateway</title></head>\n<body>\n" +
+		"<h1>Bad gateway</h1>\n" + strings.Repeat("<p>cloudflare</p>\n", 50) + "</body>\n</html>\n"
+
+	for _, handle := range []struct {
+		name string
+		call func(w http.ResponseWriter, resp *http.Response, provider providers.Provider)
+	}{
+		{"non-streaming", func(w http.ResponseWriter, resp *http.Response, provider providers.Provider) {
+			handler.handleResponse(w, resp, provider, 100, nil, &config.Provider{})
+		}},
+		{"streaming", func(w http.ResponseWriter, resp *http.Response, provider providers.Provider) {
+			handler.handleStreamingResponse(w, resp, provider, 100, nil, &config.Provider{})
+		}},
+	} {
+		t.Run(handle.name, func(t *testing.T) {
+			mockProvider := &MockProvider{shouldTransform: true}
+
+			resp := &http.Response{
+				StatusCode: http.StatusBadGateway,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(page)),
+			}
+			resp.Header.Set("Content-Type", "text/html; charset=UTF-8")
+
+			w := httptest.NewRecorder()
+			handle.call(w, resp, mockProvider)
+
+			assert.False(t, mockProvider.transformCalled)
+			assert.Equal(t, http.StatusBadGateway, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var body struct {
+				Type  string `json:"type"`
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+			assert.Equal(t, "error", body.Type)
+			assert.Equal(t, "api_error", body.Error.Type)
+			assert.True(t, strings.HasPrefix(body.Error.Message,
+				"upstream returned status 502 with a non-JSON body: <!DOCTYPE html> <html> <head><title>502 Bad Gateway</title>"), body.Error.Message)
+			assert.True(t, strings.HasSuffix(body.Error.Message, "..."), "long pages are truncated")
+			assert.Less(t, len(body.Error.Message), len(page))
+		})
+	}
+}
+
+func TestUpstreamErrorPage(t *testing.T) {
+	var body struct {
+		Error map[string]string `json:"error"`
+	}
+
+	require.NoError(t, json.Unmarshal(upstreamErrorPage(http.StatusServiceUnavailable, []byte("  no healthy\n upstream ")), &body))
+	assert.Equal(t, "overloaded_error", body.Error["type"])
+	assert.Equal(t, "upstream returned status 503 with a non-JSON body: no healthy upstream", body.Error["message"])
+
+	require.NoError(t, json.Unmarshal(upstreamErrorPage(http.StatusTooManyRequests, nil), &body))
+	assert.Equal(t, "rate_limit_error", body.Error["type"])
+	assert.Equal(t, "upstream returned status 429 with a non-JSON body", body.Error["message"])
+}
+
+// Mock provider for testing
+type MockProvider struct {
+	transformCalled bool
+	shouldTransform bool
+}
+
+func (m *MockProvider) Name() string                                 { return "mock" }
+func (m *MockProvider) SupportsStreaming() bool                      { return true }
+func (m *MockProvider) GetEndpoint() string                          { return "mock" }
+func (m *MockProvider) SetAPIKey(key string)                         {}
+func (m *MockProvider) IsStreaming(headers map[string][]string) bool { return false }
+func (m *MockProvider) TransformStream(chunk []byte, state *providers.StreamState) ([]byte, error) {
+	return chunk, nil
+}
+
+func (m *MockProvider) TransformRequest(request []byte) ([]byte, error) {
+	return request, nil
+}
+
+func (m *MockProvider) TransformResponse(response []byte) ([]byte, error) {
+	m.transformCalled = true
+	if m.shouldTransform {
+		return []byte(`{"transformed": true, "original": "TRANSFORMED"}`), nil
+	}
+	return response, nil
+}
+
+// Mock response writer for testing
+type MockResponseWriter struct {
+	headers    http.Header
+	body       *bytes.Buffer
+	statusCode int
+}
+
+func (m *MockResponseWriter) Header() http.Header {
+	return m.headers
+}
+
+func (m *MockResponseWriter) Write(data []byte) (int, error) {
+	return m.body.Write(data)
+}
+
+func (m *MockResponseWriter) WriteHeader(statusCode int) {
+	m.statusCode = statusCode
+}
+
+func TestHandleStreamingResponse_ErrorForwarding(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Create a mock provider
+	mockProvider := &MockProvider{shouldTransform: true}
+
+	handler := &ProxyHandler{logger: logger}
+
+	// Test error response body (simulating SSE error stream)
+	errorStreamBody := `data: {"error":{"type":"invalid_request_error","message":"Invalid model specified"}}
+
+`
+
+	// Create mock HTTP response with error status
+	resp := &http.Response{
+		StatusCode: 400,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(errorStreamBody)),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	// Create response writer
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	// Call handleStreamingResponse
+	handler.handleStreamingResponse(w, resp, mockProvider, 100, nil, &config.Provider{})
+
+	// Verify transformation was NOT called for error response
+	assert.False(t, mockProvider.transformCalled, "error streaming responses should not be transformed")
+
+	// Verify status code is preserved
+	assert.Equal(t, 400, w.statusCode, "error status code should be preserved")
+
+	// Verify response body contains original error data
+	responseBody := w.body.String()
+	assert.Contains(t, responseBody, "invalid_request_error", "error response should be forwarded as-is")
+	assert.Contains(t, responseBody, "Invalid model specified", "error message should be preserved")
+}
+
+func TestHandleStreamingResponse_PingDuringStall(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: 1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	// Upstream sends one event, stalls, then finishes
+	bodyReader, bodyWriter := io.Pipe()
+
+	go func() {
+		fmt.Fprint(bodyWriter, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n")
+		time.Sleep(1500 * time.Millisecond)
+		fmt.Fprint(bodyWriter, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+		bodyWriter.Close()
+	}()
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       bodyReader,
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	handler.handleStreamingResponse(w, resp, &MockProvider{}, 100, cfgMgr.Get(), &config.Provider{})
 
-	// Verify response body contains original error data
 	responseBody := w.body.String()
-	assert.Contains(t, responseBody, "invalid_request_error", "error response should be forwarded as-is")
-	assert.Contains(t, responseBody, "Invalid model specified", "error message should be preserved")
+	assert.Equal(t, 1, strings.Count(responseBody, "event: ping\ndata: {\"type\":\"ping\"}\n\n"), "one ping should be sent during the stall")
+
+	// The ping must fall between the two upstream events, not inside one
+	pingIndex := strings.Index(responseBody, "event: ping")
+	assert.Greater(t, pingIndex, strings.Index(responseBody, "message_start\"}"))
+	assert.Less(t, pingIndex, strings.Index(responseBody, "event: message_stop"))
+}
+
+func TestHandleStreamingResponse_MultiLineData(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	// Each event's JSON is split over several data: lines, joined with newlines per the SSE spec
+	upstreamBody := "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\n" +
+		"data: \"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\n" +
+		"data:\"choices\":[{\"index\":0,\"delta\":{},\n" +
+		"data: \"finish_reason\":\"stop\"}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+	responseBody := w.body.String()
+	assert.Contains(t, responseBody, "event: message_start")
+	assert.Contains(t, responseBody, `"text":"Hello"`)
+	assert.Contains(t, responseBody, `"stop_reason":"end_turn"`)
+	assert.Contains(t, responseBody, "event: message_stop")
+	assert.NotContains(t, responseBody, "chatcmpl-1\",\n", "no untransformed fragment should be forwarded")
+}
+
+func TestHandleStreamingResponse_TrailingUsage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	testCases := []struct {
+		name     string
+		trailing string
+	}{
+		{"usage chunk before DONE", "data: {\"id\":\"chatcmpl-1\",\"choices\":[],\"usage\":{\"prompt_tokens\":21,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n"},
+		{"stream ends without usage or DONE", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstreamBody := "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":null}\n\n" +
+				tc.trailing
+
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+			}
+			resp.Header.Set("Content-Type", "text/event-stream")
+
+			w := &MockResponseWriter{
+				headers: make(http.Header),
+				body:    &bytes.Buffer{},
+			}
+
+			usage := handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+			responseBody := w.body.String()
+			assert.Equal(t, 1, strings.Count(responseBody, "event: message_delta"))
+			assert.Equal(t, 1, strings.Count(responseBody, "event: message_stop"))
+			assert.Less(t, strings.Index(responseBody, "event: message_delta"), strings.Index(responseBody, "event: message_stop"))
+
+			if tc.trailing == "" {
+				return
+			}
+
+			// The usage that followed the finish reason is in the final message_delta
+			assert.Contains(t, responseBody, `"usage":{"input_tokens":21,"output_tokens":4}`)
+			assert.Equal(t, 21, usage.InputTokens)
+			assert.Equal(t, 4, usage.OutputTokens)
+			assert.Equal(t, 1, usage.Deltas.Count, "the one text delta should be timed")
+		})
+	}
+}
+
+func TestHandleStreamingResponse_OpenRouterSingleMessageStop(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	// OpenRouter repeats the finish reason in its usage chunk, then ends with [DONE]
+	upstreamBody := "data: {\"id\":\"gen-1\",\"model\":\"anthropic/claude-sonnet-4\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"id\":\"gen-1\",\"model\":\"anthropic/claude-sonnet-4\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2}}\n\n" +
+		"data: {\"id\":\"gen-1\",\"model\":\"anthropic/claude-sonnet-4\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2}}\n\n" +
+		"data: [DONE]\n\n"
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	handler.handleStreamingResponse(w, resp, providers.NewOpenRouterProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+	responseBody := w.body.String()
+	assert.Equal(t, 1, strings.Count(responseBody, "event: message_delta"))
+	assert.Equal(t, 1, strings.Count(responseBody, "event: message_stop"))
+	assert.NotContains(t, responseBody, "[DONE]", "Anthropic streams end with message_stop")
+}
+
+func TestHandleStreamingResponse_JSONBodyFallback(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	// A streaming request answered with a chunked JSON error instead of SSE
+	errorBody := `{"error":{"type":"rate_limit_error","message":"Rate limit exceeded"}}`
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(errorBody)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Transfer-Encoding", "chunked")
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	handler.handleStreamingResponse(w, resp, &MockProvider{}, 100, nil, &config.Provider{})
+
+	assert.Equal(t, http.StatusTooManyRequests, w.statusCode)
+	assert.Equal(t, "application/json", w.headers.Get("Content-Type"), "JSON body must not be labelled as an event stream")
+	assert.JSONEq(t, errorBody, w.body.String(), "JSON error should be delivered untouched")
+}
+
+func TestHandleStreamingResponse_LeadingBOM(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	upstreamBody := "\ufeff  data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		" data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":1}}\n\n" +
+		"data: [DONE]\n\n"
+
+	// Without a Content-Type the stream is recognised by its first bytes, behind the BOM
+	for _, contentType := range []string{"text/event-stream", ""} {
+		t.Run("content type "+contentType, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+			}
+
+			if contentType != "" {
+				resp.Header.Set("Content-Type", contentType)
+			}
+
+			w := &MockResponseWriter{
+				headers: make(http.Header),
+				body:    &bytes.Buffer{},
+			}
+
+			usage := handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+			responseBody := w.body.String()
+			assert.NotContains(t, responseBody, "\ufeff")
+			assert.True(t, strings.HasPrefix(responseBody, "event: message_start"), responseBody)
+			assert.Contains(t, responseBody, `"text":"Hi"`)
+			assert.Contains(t, responseBody, "event: message_stop")
+			assert.Equal(t, 9, usage.InputTokens)
+			assert.Equal(t, 1, usage.OutputTokens)
+		})
+	}
+}
+
+func TestHandleStreamingResponse_DropsUnconvertibleChunk(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+	upstreamBody := "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":2}}\n\n" +
+		"data: [DONE]\n\n"
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+	responseBody := w.body.String()
+	assert.NotContains(t, responseBody, "chatcmpl-1\",\"choices", "the provider's chunk must not leak into the Anthropic stream")
+
+	// Every event is a named Anthropic event with a JSON payload of that type
+	var types []string
+
+	for _, block := range strings.Split(strings.TrimSpace(responseBody), "\n\n") {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+
+		lines := strings.Split(block, "\n")
+		require.Len(t, lines, 2, "event %q", block)
+
+		name, ok := strings.CutPrefix(lines[0], "event: ")
+		require.True(t, ok, "event %q", block)
+
+		data, ok := strings.CutPrefix(lines[1], "data: ")
+		require.True(t, ok, "event %q", block)
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &payload), "event %q", block)
+		assert.Equal(t, name, payload["type"])
+
+		types = append(types, name)
+	}
+
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	}, types)
+}
+
+func TestHandleStreamingResponse_Comments(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstreamBody := ": OPENROUTER PROCESSING\n\n" +
+		"data: {\"id\":\"gen-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		": keep-alive\n\n" +
+		"data: {\"id\":\"gen-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":1}}\n\n" +
+		"data: [DONE]\n\n"
+
+	for _, passKeepAlive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream_keepalive_comments=%v", passKeepAlive), func(t *testing.T) {
+			cfgMgr := config.NewManager(t.TempDir())
+			require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1, StreamKeepAliveComments: passKeepAlive}))
+
+			handler := &ProxyHandler{config: cfgMgr, logger: logger}
+
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+			}
+			resp.Header.Set("Content-Type", "text/event-stream")
+
+			w := &MockResponseWriter{
+				headers: make(http.Header),
+				body:    &bytes.Buffer{},
+			}
+
+			handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, cfgMgr.Get(), &config.Provider{})
+
+			responseBody := w.body.String()
+			assert.NotContains(t, responseBody, "OPENROUTER PROCESSING", "provider noise is always dropped")
+			assert.Contains(t, responseBody, `"text":"Hi"`)
+
+			if passKeepAlive {
+				assert.Contains(t, responseBody, "\n: keep-alive\n")
+			} else {
+				assert.NotContains(t, responseBody, "keep-alive")
+			}
+
+			// The comment doesn't disturb the Anthropic events around it
+			assert.NoError(t, providers.ValidateAnthropicSSE(w.body.Bytes()))
+		})
+	}
+}
+
+func TestServeHTTP_PreserveLogprobs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamRequest map[string]any
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequest = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamRequest))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},`+
+			`"logprobs":{"content":[{"token":"Hi","logprob":-0.01,"top_logprobs":[{"token":"Hi","logprob":-0.01},{"token":"Hello","logprob":-4.6}]}]},`+
+			`"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	for _, preserve := range []bool{true, false} {
+		t.Run(fmt.Sprintf("preserve_logprobs=%v", preserve), func(t *testing.T) {
+			cfgMgr := config.NewManager(t.TempDir())
+			require.NoError(t, cfgMgr.Save(&config.Config{
+				Providers: []config.Provider{
+					{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+				},
+				PreserveLogprobs: preserve,
+			}))
+
+			registry := providers.NewRegistry()
+			registry.Initialize()
+			registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+			handler := NewProxyHandler(cfgMgr, registry, logger)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"logprobs":true,"top_logprobs":2,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			// The client's logprobs parameters reach the upstream either way
+			assert.Equal(t, true, upstreamRequest["logprobs"])
+			assert.Equal(t, float64(2), upstreamRequest["top_logprobs"])
+
+			var response map[string]any
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, "message", response["type"])
+
+			if !preserve {
+				assert.NotContains(t, response, "openai_logprobs")
+				return
+			}
+
+			logprobs, ok := response["openai_logprobs"].(map[string]any)
+			require.True(t, ok, "logprobs should be preserved: %s", rr.Body.String())
+
+			tokens := logprobs["content"].([]any)
+			require.Len(t, tokens, 1)
+			assert.Equal(t, "Hi", tokens[0].(map[string]any)["token"])
+			assert.Len(t, tokens[0].(map[string]any)["top_logprobs"], 2)
+		})
+	}
+}
+
+func TestServeHTTP_ProviderTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key", TimeoutMS: 50},
+		},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	started := time.Now()
+	handler.ServeHTTP(rr, req)
+
+	assert.Less(t, time.Since(started), 2*time.Second)
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"type":"error"`)
+	assert.Contains(t, rr.Body.String(), "did not respond within 50ms")
+}
+
+func TestServeHTTP_StreamIdleTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	release := make(chan struct{})
+
+	// The upstream sends one chunk and then hangs without closing the stream
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			// The total timeout does not apply to streams
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key", TimeoutMS: 10, IdleTimeoutMS: 200},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	started := time.Now()
+	handler.ServeHTTP(rr, req)
+
+	assert.Less(t, time.Since(started), 2*time.Second, "a hung stream must be aborted")
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `"text":"Hi"`, "chunks before the stall are delivered")
+	assert.Contains(t, body, "event: error")
+	assert.Contains(t, body, "sent nothing for 200ms")
+}
+
+func TestHandleStreamingResponse_SilentAfterHeaders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	handler := &ProxyHandler{logger: logger}
+
+	// The upstream sends its headers and then nothing at all
+	body, upstream := io.Pipe()
+	defer upstream.Close()
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       body,
+	}
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, &config.Config{StreamPingInterval: -1}, &config.Provider{IdleTimeoutMS: 200})
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a silent upstream must be cut off by the idle timeout")
+	}
+
+	assert.Contains(t, w.body.String(), "sent nothing for 200ms")
+}
+
+func TestHandleStreamingResponse_SilentPassthroughUpstream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	handler := &ProxyHandler{logger: logger}
+
+	// An Anthropic-format gateway sends one event and then nothing at all
+	body, upstream := io.Pipe()
+	defer upstream.Close()
+
+	go fmt.Fprint(upstream, "event: ping\ndata: {\"type\":\"ping\"}\n\n")
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       body,
+	}
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, &config.Config{StreamPingInterval: -1}, &config.Provider{IdleTimeoutMS: 200, DisableTransform: true})
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a silent passthrough upstream must be cut off by the idle timeout")
+	}
+
+	assert.True(t, strings.HasPrefix(w.body.String(), "event: ping\n"), w.body.String())
+	assert.Contains(t, w.body.String(), "sent nothing for 200ms")
+}
+
+func TestHandleStreamingResponse_SilentUnlabelledUpstream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	handler := &ProxyHandler{logger: logger}
+
+	// Without a Content-Type the format is sniffed from the first bytes, which never come
+	body, upstream := io.Pipe()
+	defer upstream.Close()
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       body,
+	}
+
+	w := &MockResponseWriter{
+		headers: make(http.Header),
+		body:    &bytes.Buffer{},
+	}
+
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		handler.handleStreamingResponse(w, resp, providers.NewOpenAIProvider(), 100, &config.Config{StreamPingInterval: -1}, &config.Provider{IdleTimeoutMS: 200})
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sniffing a silent upstream must not outlast the idle timeout")
+	}
+
+	assert.Equal(t, "text/event-stream", w.headers.Get("Content-Type"))
+	assert.Contains(t, w.body.String(), "sent nothing for")
+}
+
+func TestServeHTTP_GeminiArrayStream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var requestURI string
+
+	// Gemini answers streamGenerateContent without alt=sse with a JSON array of chunks
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.URL.RequestURI()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}],"modelVersion":"gemini-2.5-pro"}`+"\n")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, `,{"candidates":[{"content":{"role":"model","parts":[{"text":" there"}]},"finishReason":"STOP"}],`+
+			`"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":3},"modelVersion":"gemini-2.5-pro"}`+"\n]")
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "gemini", APIBase: upstream.URL + "/v1beta/models", APIKey: "test-key"},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "gemini"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"gemini,gemini-2.5-pro","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", requestURI)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+
+	body := rr.Body.String()
+	assert.Contains(t, body, "event: message_start")
+	assert.Contains(t, body, `"text":"Hello"`)
+	assert.Contains(t, body, `"text":" there"`)
+	assert.Equal(t, 1, strings.Count(body, "event: message_stop"))
+
+	assert.Equal(t, int64(3), handler.Stats().Snapshot().OutputTokens, "usage of the last chunk is recorded")
+}
+
+func TestServeHTTP_NoRouteBypassesBuckets(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamModel string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		upstreamModel, _ = body["model"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+		Router: config.RouterConfig{
+			Default: "openai,gpt-4o",
+			Think:   "openai,o1",
+		},
+		Aliases: map[string]string{"fast": "background"},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	testCases := []struct {
+		name     string
+		model    string
+		target   string
+		header   string
+		expected string
+	}{
+		{name: "routed", model: "claude-sonnet-4", target: "/v1/messages", expected: "o1"},
+		{name: "header uses default", model: "claude-sonnet-4", target: "/v1/messages", header: "true", expected: "gpt-4o"},
+		{name: "header honors provider prefix", model: "openai,gpt-4.1", target: "/v1/messages", header: "1", expected: "gpt-4.1"},
+		{name: "header set to false", model: "claude-sonnet-4", target: "/v1/messages", header: "false", expected: "o1"},
+		{name: "query parameter", model: "claude-sonnet-4", target: "/v1/messages?route=off", expected: "gpt-4o"},
+		{name: "aliases are not resolved", model: "fast", target: "/v1/messages?route=off", expected: "gpt-4o"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstreamModel = ""
+
+			req := httptest.NewRequest(http.MethodPost, tc.target,
+				strings.NewReader(`{"model":"`+tc.model+`","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+			if tc.header != "" {
+				req.Header.Set(NoRouteHeader, tc.header)
+			}
+
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.Equal(t, tc.expected, upstreamModel)
+		})
+	}
+}
+
+func TestServeHTTP_OpenAIFormatRequest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamBody map[string]any
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamBody))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"openai,gpt-4o","max_completion_tokens":100,`+
+		`"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "gpt-4o", upstreamBody["model"])
+	assert.Equal(t, float64(100), upstreamBody["max_completion_tokens"])
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "Be brief."},
+		map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Hi"}}},
+	}, upstreamBody["messages"])
+}
+
+func TestServeHTTP_ModelMap(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var upstreamModel string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		upstreamModel, _ = body["model"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{
+				Name:     "gateway",
+				APIBase:  upstream.URL + "/v1/chat/completions",
+				APIKey:   "test-key",
+				ModelMap: map[string]string{"claude-3-5-sonnet": "anthropic/claude-3.5-sonnet"},
+			},
+		},
+		Router: config.RouterConfig{Default: "gateway,claude-3-5-sonnet"},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	for model, expected := range map[string]string{
+		"gateway,claude-3-5-sonnet": "anthropic/claude-3.5-sonnet",
+		"gateway,gpt-4o":            "gpt-4o",
+	} {
+		t.Run(model, func(t *testing.T) {
+			upstreamModel = ""
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"`+model+`","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.Equal(t, expected, upstreamModel)
+		})
+	}
+}
+
+func TestServeHTTP_DisableTransform(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Unusual spacing and field order would not survive a decode and re-encode
+	const (
+		jsonResponse = `{"type":"message",  "id":"msg_1","role":"assistant","model":"claude-sonnet-4",` +
+			`"content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":7,"output_tokens":3},"x_extra":1}`
+		streamResponse = "event: message_start\n" +
+			`data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","usage":{"input_tokens":7,"output_tokens":1}}}` + "\n\n" +
+			"event: content_block_delta\n" +
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+			"event: message_delta\n" +
+			`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}` + "\n\n" +
+			"event: message_stop\n" +
+			`data: {"type":"message_stop"}` + "\n\n"
+	)
+
+	var (
+		upstreamBody    []byte
+		upstreamHeaders http.Header
+	)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		upstreamHeaders = r.Header.Clone()
+
+		if strings.Contains(string(upstreamBody), `"stream": true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, streamResponse)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, jsonResponse)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "gateway", APIBase: upstream.URL + "/v1/messages", APIKey: "test-key", DisableTransform: true},
+		},
+		Router: config.RouterConfig{Think: "gateway,claude-sonnet-4"},
+	}))
+
+	// The gateway's URL resolves to the OpenAI implementation, whose conversion is skipped
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	for _, tc := range []struct {
+		name     string
+		request  string
+		response string
+	}{
+		{"json", `{"model":"claude-sonnet-4",  "max_tokens":100,"messages":[{"role":"user","content":[{"type":"text","text":"Hi","cache_control":{"type":"ephemeral"}}]}]}`, jsonResponse},
+		{"stream", `{"model":"claude-sonnet-4", "stream": true, "max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`, streamResponse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(tc.request))
+			req.Header.Set("anthropic-version", "2023-06-01")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.Equal(t, tc.request, string(upstreamBody), "request bytes should reach the upstream unchanged")
+			assert.Equal(t, tc.response, rr.Body.String(), "response bytes should reach the client unchanged")
+
+			assert.Equal(t, "2023-06-01", upstreamHeaders.Get("anthropic-version"))
+			assert.Equal(t, "Bearer test-key", upstreamHeaders.Get("Authorization"))
+		})
+	}
+
+	// Usage is still picked out of both responses for the token logs and stats
+	snapshot := handler.Stats().Snapshot()
+	assert.Equal(t, int64(14), snapshot.InputTokens)
+	assert.Equal(t, int64(6), snapshot.OutputTokens)
+	assert.Equal(t, int64(1), snapshot.StreamingRequests)
+
+	// Configured policy text still reaches the upstream's system prompt
+	cfg := cfgMgr.Get()
+	cfg.SystemPrefix = "Follow the ACME coding policy."
+	require.NoError(t, cfgMgr.Save(cfg))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var sent map[string]any
+	require.NoError(t, json.Unmarshal(upstreamBody, &sent))
+	assert.Equal(t, "Follow the ACME coding policy.", sent["system"])
+}
+
+func TestPassthroughBody(t *testing.T) {
+	original := []byte(`{"model":"claude-sonnet-4",  "messages":[]}`)
+
+	assert.Equal(t, original, passthroughBody(original, []byte(`{"messages":[],"model":"claude-sonnet-4"}`)))
+
+	routed := []byte(`{"messages":[],"model":"claude-opus-4"}`)
+	assert.Equal(t, routed, passthroughBody(original, routed), "a routed model has to reach the upstream")
+}
+
+func TestServeHTTP_PreserveUnknownFields(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"sonar","system_fingerprint":"fp_1",`+
+			`"citations":["https://example.com"],"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":3,"completion_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	for _, preserve := range []bool{true, false} {
+		t.Run(fmt.Sprintf("preserve=%t", preserve), func(t *testing.T) {
+			cfgMgr := config.NewManager(t.TempDir())
+			require.NoError(t, cfgMgr.Save(&config.Config{
+				Providers: []config.Provider{
+					{
+						Name:                  "gateway",
+						APIBase:               upstream.URL + "/v1/chat/completions",
+						APIKey:                "test-key",
+						PreserveUnknownFields: preserve,
+					},
+				},
+				Router: config.RouterConfig{Default: "gateway,sonar"},
+			}))
+
+			handler := NewProxyHandler(cfgMgr, registry, logger)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"gateway,sonar","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response map[string]any
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+			if preserve {
+				assert.Equal(t, "fp_1", response["gateway_system_fingerprint"])
+				assert.Equal(t, []any{"https://example.com"}, response["gateway_citations"])
+			} else {
+				assert.NotContains(t, response, "gateway_system_fingerprint")
+				assert.NotContains(t, response, "gateway_citations")
+			}
+
+			// Fields the conversion already carries over are not duplicated
+			assert.NotContains(t, response, "gateway_choices")
+			assert.NotContains(t, response, "gateway_usage")
+			assert.Equal(t, "text", response["content"].([]any)[0].(map[string]any)["type"])
+		})
+	}
+}
+
+func TestPreserveUnknownFields_PerProvider(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	handler := &ProxyHandler{logger: logger}
+
+	// Gemini's candidates and usage are converted; only the rest is preserved
+	geminiResponse := []byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}],` +
+		`"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1},"modelVersion":"gemini-2.5-pro","responseId":"r1",` +
+		`"groundingMetadata":{"webSearchQueries":["weather"]}}`)
+
+	gemini := providers.NewGeminiProvider()
+	transformed, err := gemini.TransformResponse(geminiResponse)
+	require.NoError(t, err)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(handler.preserveUnknownFields(geminiResponse, transformed, gemini, "google"), &response))
+
+	assert.Equal(t, map[string]any{"webSearchQueries": []any{"weather"}}, response["google_groundingMetadata"])
+
+	for _, field := range []string{"candidates", "usageMetadata", "modelVersion", "responseId"} {
+		assert.NotContains(t, response, "google_"+field)
+	}
+
+	// Anthropic responses are passed through, so nothing is copied a second time
+	anthropicResponse := []byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4",` +
+		`"content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`)
+
+	assert.Equal(t, anthropicResponse, handler.preserveUnknownFields(anthropicResponse, anthropicResponse, providers.NewAnthropicProvider(), "claude"))
+}
+
+func TestServeHTTP_ClientCancelCancelsUpstream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	started := make(chan struct{})
+	upstreamCanceled := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		close(started)
+
+		// Keep generating until the proxy gives up on the request
+		select {
+		case <-r.Context().Done():
+			close(upstreamCanceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "gateway", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+		Router: config.RouterConfig{Default: "gateway,gpt-4o"},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"gateway,gpt-4o","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`)).WithContext(ctx)
+
+	served := make(chan struct{})
+
+	go func() {
+		defer close(served)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-upstreamCanceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request was not canceled when the client went away")
+	}
+
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not return after the client went away")
+	}
+}
+
+func TestBuildEndpointURL(t *testing.T) {
+	handler := &ProxyHandler{}
+	base := false
+
+	testCases := []struct {
+		name     string
+		provider providers.Provider
+		config   config.Provider
+		stream   bool
+		expected string
+	}{
+		{
+			name:     "full OpenAI URL",
+			provider: providers.NewOpenAIProvider(),
+			config:   config.Provider{APIBase: "https://gateway.example.com/custom/completions"},
+			expected: "https://gateway.example.com/custom/completions",
+		},
+		{
+			name:     "OpenAI base URL",
+			provider: providers.NewOpenAIProvider(),
+			config:   config.Provider{APIBase: "https://gateway.example.com/v1/", BaseIsFullURL: &base},
+			expected: "https://gateway.example.com/v1/chat/completions",
+		},
+		{
+			name:     "Anthropic base URL",
+			provider: providers.NewAnthropicProvider(),
+			config:   config.Provider{APIBase: "https://api.anthropic.com", BaseIsFullURL: &base},
+			expected: "https://api.anthropic.com/v1/messages",
+		},
+		{
+			name:     "full Gemini URL",
+			provider: providers.NewGeminiProvider(),
+			config:   config.Provider{APIBase: "https://generativelanguage.googleapis.com/v1beta/models"},
+			expected: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent",
+		},
+		{
+			name:     "Gemini base URL",
+			provider: providers.NewGeminiProvider(),
+			config:   config.Provider{APIBase: "https://generativelanguage.googleapis.com/v1beta", BaseIsFullURL: &base},
+			stream:   true,
+			expected: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, handler.buildEndpointURL(tc.provider, &tc.config, "gemini,gemini-2.0-flash", tc.stream))
+		})
+	}
+}
+
+func TestBuildEndpointURL_Template(t *testing.T) {
+	handler := &ProxyHandler{}
+
+	watsonx := config.Provider{
+		APIBase:           "https://us-south.ml.cloud.ibm.com",
+		URLTemplate:       "{base}/ml/v1/text/chat?version={version}&project_id={project}",
+		StreamURLTemplate: "{base}/ml/v1/text/chat_stream?version={version}&project_id={project}",
+		URLParams:         map[string]string{"version": "2024-05-31", "project": "proj-42"},
+	}
+
+	deployment := config.Provider{
+		APIBase:     "https://llm.example.com/openai",
+		URLTemplate: "{base}/deployments/{model}/chat/completions?tenant={tenant}",
+	}
+
+	openAI := providers.NewOpenAIProvider()
+
+	assert.Equal(t, "https://us-south.ml.cloud.ibm.com/ml/v1/text/chat?version=2024-05-31&project_id=proj-42",
+		handler.buildEndpointURL(openAI, &watsonx, "watsonx,ibm/granite-3-8b-instruct", false))
+	assert.Equal(t, "https://us-south.ml.cloud.ibm.com/ml/v1/text/chat_stream?version=2024-05-31&project_id=proj-42",
+		handler.buildEndpointURL(openAI, &watsonx, "watsonx,ibm/granite-3-8b-instruct", true))
+
+	// Without a stream template streams use the same URL; unknown placeholders are kept
+	assert.Equal(t, "https://llm.example.com/openai/deployments/gpt-4o/chat/completions?tenant={tenant}",
+		handler.buildEndpointURL(openAI, &deployment, "azure,gpt-4o", true))
+	assert.Equal(t, []string{"tenant"}, deployment.MissingURLParams())
+	assert.Empty(t, watsonx.MissingURLParams())
+
+	// The template decides the URL even for Gemini
+	gemini := config.Provider{APIBase: "https://gateway.example.com", URLTemplate: "{base}/gemini/{model}"}
+	assert.Equal(t, "https://gateway.example.com/gemini/gemini-2.0-flash",
+		handler.buildEndpointURL(providers.NewGeminiProvider(), &gemini, "gemini,gemini-2.0-flash", false))
+
+	// Values are escaped for their part of the URL and {base} loses its trailing slash
+	escaped := config.Provider{
+		APIBase:     "https://llm.example.com/",
+		URLTemplate: "{base}/models/{model}/chat?model={model}&tag={tag}",
+		URLParams:   map[string]string{"tag": "a&b c"},
+	}
+	assert.Equal(t, "https://llm.example.com/models/ibm%2Fgranite%20v3/chat?model=ibm%2Fgranite+v3&tag=a%26b+c",
+		handler.buildEndpointURL(openAI, &escaped, "escaped,ibm/granite v3", false))
+}
+
+func TestServeHTTP_ReloadMidRequestKeepsSnapshot(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	replacementHits := 0
+
+	replacement := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replacementHits++
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer replacement.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+
+	var seenKeys []string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		seenKeys = append(seenKeys, key)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if key == "key-1" {
+			// Reload while the request is in flight: the provider now points elsewhere and
+			// logprobs would be preserved
+			require.NoError(t, cfgMgr.Save(&config.Config{
+				PreserveLogprobs: true,
+				Providers: []config.Provider{{
+					Name:    "openai",
+					APIBase: replacement.URL + "/v1/chat/completions",
+					APIKey:  "replacement-key",
+				}},
+			}))
+			_, err := cfgMgr.Load()
+			require.NoError(t, err)
+
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"type":"rate_limit_error","message":"slow down"}}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},`+
+			`"logprobs":{"content":[{"token":"Hi","logprob":-0.1}]},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{
+			Name:    "openai",
+			APIBase: upstream.URL + "/v1/chat/completions",
+			APIKey:  "key-1",
+			APIKeys: []string{"key-1", "key-2"},
+		}},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, []string{"key-1", "key-2"}, seenKeys, "the retry should use the provider the request started with")
+	assert.Zero(t, replacementHits, "the reloaded provider should only serve later requests")
+	assert.NotContains(t, rr.Body.String(), "openai_logprobs", "response handling should use the request's configuration")
+}
+
+func TestServeHTTP_DecompressesZstdResponse(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var acceptEncoding string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+
+		encoder, err := zstd.NewWriter(nil)
+		require.NoError(t, err)
+
+		body := encoder.EncodeAll([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,`+
+			`"message":{"role":"assistant","content":"Compressed hello"},"finish_reason":"stop"}]}`), nil)
+		require.NoError(t, encoder.Close())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "zstd")
+		_, _ = w.Write(body)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{
+			Name:    "openai",
+			APIBase: upstream.URL + "/v1/chat/completions",
+			APIKey:  "test-key",
+		}},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	req.Header.Set("Accept-Encoding", "identity")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "gzip, br, zstd", acceptEncoding, "the proxy should advertise every encoding it decompresses")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Contains(t, rr.Body.String(), "Compressed hello")
+}
+
+func TestServeHTTP_ValidateStreamLogsViolations(t *testing.T) {
+	// A delta for a block that was never started, relayed unchanged by a passthrough provider
+	const malformedStream = "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","usage":{"input_tokens":7,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, malformedStream)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "gateway", APIBase: upstream.URL + "/v1/messages", APIKey: "test-key", DisableTransform: true},
+		},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	for _, validate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("validate=%v", validate), func(t *testing.T) {
+			var logs bytes.Buffer
+
+			handler := NewProxyHandler(cfgMgr, registry, slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn})))
+			if validate {
+				handler.EnableStreamValidation()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				strings.NewReader(`{"model":"gateway,claude-sonnet-4","stream":true,"max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, malformedStream, rr.Body.String(), "validation must not change the stream")
+
+			if validate {
+				assert.Contains(t, logs.String(), "not a valid Anthropic event stream")
+				assert.Contains(t, logs.String(), "delta for block 0 outside the block")
+			} else {
+				assert.NotContains(t, logs.String(), "not a valid Anthropic event stream")
+			}
+		})
+	}
 }
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenUsage holds the token counts of a single response
+type tokenUsage struct {
+	InputTokens  int
+	OutputTokens int
+
+	// Streams also time their content deltas, for latency metrics
+	Deltas streamDeltas
+}
+
+// streamDeltas records when a streamed response's content deltas were sent
+type streamDeltas struct {
+	First time.Time
+	Last  time.Time
+	Count int
+}
+
+// observe notes the content deltas among events as sent at now
+func (d *streamDeltas) observe(events []byte, now time.Time) {
+	count := bytes.Count(events, []byte(`"type":"content_block_delta"`))
+	if count == 0 {
+		return
+	}
+
+	if d.Count == 0 {
+		d.First = now
+	}
+
+	d.Last = now
+	d.Count += count
+}
+
+// interTokenLatency returns the average gap between content deltas, or zero with fewer than two
+func (d *streamDeltas) interTokenLatency() time.Duration {
+	if d.Count < 2 {
+		return 0
+	}
+
+	return d.Last.Sub(d.First) / time.Duration(d.Count-1)
+}
+
+// UsageStats accumulates request and token counters since the server started
+type UsageStats struct {
+	started      time.Time
+	requests     atomic.Int64
+	errors       atomic.Int64
+	latencyNanos atomic.Int64
+
+	// Streams with content: time to the first content delta and average gap between deltas
+	streams           atomic.Int64
+	firstTokenNanos   atomic.Int64
+	interTokenNanos   atomic.Int64
+	interTokenStreams atomic.Int64
+
+	mu     sync.Mutex
+	models map[string]*ModelUsage
+}
+
+// ModelUsage is the cumulative usage of a single provider/model pair
+type ModelUsage struct {
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	Requests     int64  `json:"requests"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// StatsSnapshot is the JSON document served by the stats endpoint
+type StatsSnapshot struct {
+	UptimeSeconds    int64        `json:"uptime_seconds"`
+	TotalRequests    int64        `json:"total_requests"`
+	ErrorRequests    int64        `json:"error_requests"`
+	InputTokens      int64        `json:"input_tokens"`
+	OutputTokens     int64        `json:"output_tokens"`
+	AverageLatencyMS float64      `json:"average_latency_ms"`
+	Models           []ModelUsage `json:"models"`
+
+	StreamingRequests          int64   `json:"streaming_requests"`
+	AverageTimeToFirstTokenMS  float64 `json:"average_time_to_first_token_ms"`
+	AverageInterTokenLatencyMS float64 `json:"average_inter_token_latency_ms"`
+}
+
+func NewUsageStats() *UsageStats {
+	return &UsageStats{
+		started: time.Now(),
+		models:  make(map[string]*ModelUsage),
+	}
+}
+
+// record adds a completed request to the counters. A nil receiver is a no-op.
+func (s *UsageStats) record(provider, model string, statusCode int, usage tokenUsage, latency time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.requests.Add(1)
+	s.latencyNanos.Add(int64(latency))
+
+	if statusCode != http.StatusOK {
+		s.errors.Add(1)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := provider + "," + model
+
+	entry, ok := s.models[key]
+	if !ok {
+		entry = &ModelUsage{Provider: provider, Model: model}
+		s.models[key] = entry
+	}
+
+	entry.Requests++
+	entry.InputTokens += int64(usage.InputTokens)
+	entry.OutputTokens += int64(usage.OutputTokens)
+}
+
+// recordStream adds the latencies of a stream that sent content. A nil receiver is a no-op.
+func (s *UsageStats) recordStream(timeToFirstToken, interTokenLatency time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.streams.Add(1)
+	s.firstTokenNanos.Add(int64(timeToFirstToken))
+
+	if interTokenLatency > 0 {
+		s.interTokenStreams.Add(1)
+		s.interTokenNanos.Add(int64(interTokenLatency))
+	}
+}
+
+// Snapshot returns a consistent copy of the current counters
+func (s *UsageStats) Snapshot() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		TotalRequests: s.requests.Load(),
+		ErrorRequests: s.errors.Load(),
+		Models:        []ModelUsage{},
+	}
+
+	if snapshot.TotalRequests > 0 {
+		average := time.Duration(s.latencyNanos.Load() / snapshot.TotalRequests)
+		snapshot.AverageLatencyMS = float64(average) / float64(time.Millisecond)
+	}
+
+	snapshot.StreamingRequests = s.streams.Load()
+	if snapshot.StreamingRequests > 0 {
+		snapshot.AverageTimeToFirstTokenMS = averageMS(s.firstTokenNanos.Load(), snapshot.StreamingRequests)
+	}
+
+	if streams := s.interTokenStreams.Load(); streams > 0 {
+		snapshot.AverageInterTokenLatencyMS = averageMS(s.interTokenNanos.Load(), streams)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.models {
+		snapshot.InputTokens += entry.InputTokens
+		snapshot.OutputTokens += entry.OutputTokens
+		snapshot.Models = append(snapshot.Models, *entry)
+	}
+
+	sort.Slice(snapshot.Models, func(i, j int) bool {
+		if snapshot.Models[i].Provider != snapshot.Models[j].Provider {
+			return snapshot.Models[i].Provider < snapshot.Models[j].Provider
+		}
+
+		return snapshot.Models[i].Model < snapshot.Models[j].Model
+	})
+
+	return snapshot
+}
+
+// averageMS returns the average of a nanosecond total in milliseconds
+func averageMS(totalNanos, count int64) float64 {
+	return float64(time.Duration(totalNanos/count)) / float64(time.Millisecond)
+}
+
+type StatsHandler struct {
+	stats  *UsageStats
+	logger *slog.Logger
+}
+
+func NewStatsHandler(stats *UsageStats, logger *slog.Logger) *StatsHandler {
+	return &StatsHandler{
+		stats:  stats,
+		logger: logger,
+	}
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(h.stats.Snapshot()); err != nil {
+		h.logger.Error("Failed to write stats response", "error", err)
+	}
+}
+
+// MetricsHandler serves the usage counters in the Prometheus text format
+type MetricsHandler struct {
+	stats  *UsageStats
+	logger *slog.Logger
+}
+
+func NewMetricsHandler(stats *UsageStats, logger *slog.Logger) *MetricsHandler {
+	return &MetricsHandler{
+		stats:  stats,
+		logger: logger,
+	}
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.stats.Snapshot()
+
+	var b bytes.Buffer
+
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	metric("cco_uptime_seconds", "gauge", "Seconds since the proxy started.", snapshot.UptimeSeconds)
+	metric("cco_requests_total", "counter", "Proxied requests.", snapshot.TotalRequests)
+	metric("cco_request_errors_total", "counter", "Proxied requests answered with a non-200 status.", snapshot.ErrorRequests)
+	metric("cco_streaming_requests_total", "counter", "Streamed responses that sent content.", snapshot.StreamingRequests)
+	metric("cco_request_latency_average_seconds", "gauge", "Average time to complete a request.", snapshot.AverageLatencyMS/1000)
+	metric("cco_time_to_first_token_average_seconds", "gauge", "Average time from request to the first streamed content delta.", snapshot.AverageTimeToFirstTokenMS/1000)
+	metric("cco_inter_token_latency_average_seconds", "gauge", "Average gap between streamed content deltas.", snapshot.AverageInterTokenLatencyMS/1000)
+
+	b.WriteString("# HELP cco_tokens_total Tokens used, by provider, model and direction.\n# TYPE cco_tokens_total counter\n")
+
+	for _, model := range snapshot.Models {
+		fmt.Fprintf(&b, "cco_tokens_total{provider=%q,model=%q,direction=\"input\"} %d\n", model.Provider, model.Model, model.InputTokens)
+		fmt.Fprintf(&b, "cco_tokens_total{provider=%q,model=%q,direction=\"output\"} %d\n", model.Provider, model.Model, model.OutputTokens)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		h.logger.Error("Failed to write metrics response", "error", err)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestStatsHandler_AccumulatesUsage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":7,\"output_tokens\":1}}}\n\n")
+			fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\n")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type":"message","content":[],"usage":{"input_tokens":10,"output_tokens":5}}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "anthropic", APIBase: upstream.URL + "/v1/messages", APIKey: "test-key"},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "anthropic"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"anthropic,claude-sonnet-4","stream":%t,"messages":[{"role":"user","content":"Hi"}]}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	NewStatsHandler(handler.Stats(), logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var snapshot StatsSnapshot
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &snapshot))
+
+	assert.Equal(t, int64(2), snapshot.TotalRequests)
+	assert.Equal(t, int64(0), snapshot.ErrorRequests)
+	assert.Equal(t, int64(17), snapshot.InputTokens)
+	assert.Equal(t, int64(8), snapshot.OutputTokens)
+	assert.Greater(t, snapshot.AverageLatencyMS, float64(0))
+
+	require.Len(t, snapshot.Models, 1)
+	assert.Equal(t, ModelUsage{
+		Provider:     "anthropic",
+		Model:        "claude-sonnet-4",
+		Requests:     2,
+		InputTokens:  17,
+		OutputTokens: 8,
+	}, snapshot.Models[0])
+}
+
+func TestStats_StreamLatency(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	const pace = 40 * time.Millisecond
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		flusher := w.(http.Flusher)
+
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":7}}}\n\n")
+		flusher.Flush()
+
+		// The model takes a while before the first token, then streams at a steady pace
+		for _, text := range []string{"One", " two", " three"} {
+			time.Sleep(pace)
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", text)
+			flusher.Flush()
+		}
+
+		fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\n")
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "anthropic", APIBase: upstream.URL + "/v1/messages", APIKey: "test-key"},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "anthropic"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"anthropic,claude-sonnet-4","stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	snapshot := handler.Stats().Snapshot()
+	assert.Equal(t, int64(1), snapshot.StreamingRequests)
+	assert.GreaterOrEqual(t, snapshot.AverageTimeToFirstTokenMS, float64(pace.Milliseconds()))
+	assert.GreaterOrEqual(t, snapshot.AverageInterTokenLatencyMS, float64(pace.Milliseconds())/2)
+
+	rr = httptest.NewRecorder()
+	NewMetricsHandler(handler.Stats(), logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cco_streaming_requests_total 1\n")
+	assert.Contains(t, rr.Body.String(), "# TYPE cco_time_to_first_token_average_seconds gauge")
+	assert.Contains(t, rr.Body.String(), `cco_tokens_total{provider="anthropic",model="claude-sonnet-4",direction="output"} 3`)
+}
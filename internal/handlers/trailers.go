@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// usageTrailers are the HTTP trailers read for final usage, each holding a JSON usage object
+// with OpenAI (prompt_tokens) or Anthropic (input_tokens) keys
+var usageTrailers = []string{"X-Usage", "Usage"}
+
+// trailerUsage returns the usage an upstream sent in its trailers, in Anthropic keys. Trailers
+// are only filled in once the body has been read to the end.
+func trailerUsage(trailer http.Header) map[string]any {
+	for _, name := range usageTrailers {
+		value := trailer.Get(name)
+		if value == "" {
+			continue
+		}
+
+		var usage map[string]any
+		if err := json.Unmarshal([]byte(value), &usage); err != nil {
+			continue
+		}
+
+		if _, ok := usage[providers.OpenAITokenMapping.InputTokens]; ok {
+			return providers.MapTokenUsage(usage, providers.OpenAITokenMapping)
+		}
+
+		if _, ok := usage[providers.OpenAITokenMapping.OutputTokens]; ok {
+			return providers.MapTokenUsage(usage, providers.OpenAITokenMapping)
+		}
+
+		return usage
+	}
+
+	return nil
+}
+
+// foldTrailerUsage merges trailer usage into the usage of an Anthropic response; the trailer
+// is sent last, so its counts win
+func (h *ProxyHandler) foldTrailerUsage(body []byte, usage map[string]any) []byte {
+	if len(usage) == 0 {
+		return body
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+
+	responseUsage, _ := response["usage"].(map[string]any)
+	if responseUsage == nil {
+		responseUsage = make(map[string]any)
+	}
+
+	for key, value := range usage {
+		responseUsage[key] = value
+	}
+
+	response["usage"] = responseUsage
+
+	updatedBody, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Warn("Failed to fold trailer usage into the response", "error", err)
+		return body
+	}
+
+	h.logger.Debug("Folded usage from upstream trailers", "usage", usage)
+
+	return updatedBody
+}
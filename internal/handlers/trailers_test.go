@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestServeHTTP_UsageTrailers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Usage")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+
+		w.Header().Set("X-Usage", `{"prompt_tokens":21,"completion_tokens":7}`)
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+	usage, ok := response["usage"].(map[string]any)
+	require.True(t, ok, "response should carry usage: %s", rr.Body.String())
+	assert.Equal(t, float64(21), usage["input_tokens"])
+	assert.Equal(t, float64(7), usage["output_tokens"])
+}
+
+func TestTrailerUsage(t *testing.T) {
+	anthropicKeys := http.Header{}
+	anthropicKeys.Set("Usage", `{"input_tokens":3,"output_tokens":4}`)
+	assert.Equal(t, map[string]any{"input_tokens": float64(3), "output_tokens": float64(4)}, trailerUsage(anthropicKeys))
+
+	invalid := http.Header{}
+	invalid.Set("X-Usage", "not json")
+	assert.Nil(t, trailerUsage(invalid))
+
+	assert.Nil(t, trailerUsage(nil))
+}
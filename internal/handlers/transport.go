@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+// upstreamTransport builds the transport for requests to providers from the proxy
+// settings in the config, and reuses it (and its connections) until they change
+type upstreamTransport struct {
+	mu        sync.Mutex
+	key       string
+	transport http.RoundTripper
+}
+
+func newUpstreamTransport() *upstreamTransport {
+	return &upstreamTransport{}
+}
+
+// get returns the transport for cfg. A nil receiver returns http.DefaultTransport.
+func (t *upstreamTransport) get(cfg *config.Config) (http.RoundTripper, error) {
+	if t == nil {
+		return http.DefaultTransport, nil
+	}
+
+	key := cfg.HTTPProxy + "\x00" + cfg.CACertFile
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil && t.key == key {
+		return t.transport, nil
+	}
+
+	transport, err := buildUpstreamTransport(cfg.HTTPProxy, cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connections of the replaced transport are no longer reachable once idle
+	if previous, ok := t.transport.(*http.Transport); ok {
+		previous.CloseIdleConnections()
+	}
+
+	t.key, t.transport = key, transport
+
+	return transport, nil
+}
+
+// buildUpstreamTransport derives a transport from http.DefaultTransport, which honors
+// HTTPS_PROXY/HTTP_PROXY/NO_PROXY unless an explicit proxy is configured
+func buildUpstreamTransport(proxy, caCertFile string) (*http.Transport, error) {
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("default transport is not an *http.Transport")
+	}
+
+	transport := defaultTransport.Clone()
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid http_proxy %q", proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert_file: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_cert_file %s", caCertFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    roots,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return transport, nil
+}
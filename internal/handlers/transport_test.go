@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestServeHTTP_RoutesThroughConfiguredProxy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var (
+		mu       sync.Mutex
+		proxied  []string
+		upstream = "http://api.openai.com/v1/chat/completions"
+	)
+
+	// The stub proxy answers for the upstream; the real host is never contacted
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer proxy.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream, APIKey: "sk-test"},
+		},
+		HTTPProxy: proxy.URL,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	handler := NewProxyHandler(cfgMgr, registry, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"type":"message"`)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{upstream}, proxied, "the upstream request should go through the proxy")
+}
+
+func TestUpstreamTransport_CACertFile(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer upstream.Close()
+
+	transport := newUpstreamTransport()
+
+	// The test server's self-signed certificate is not trusted by default
+	rt, err := transport.get(&config.Config{})
+	require.NoError(t, err)
+
+	_, err = (&http.Client{Transport: rt}).Get(upstream.URL)
+	require.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: upstream.Certificate().Raw,
+	}), 0o600))
+
+	rt, err = transport.get(&config.Config{CACertFile: caFile})
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: rt}).Get(upstream.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The transport is reused while the settings are unchanged
+	again, err := transport.get(&config.Config{CACertFile: caFile})
+	require.NoError(t, err)
+	assert.Same(t, rt, again)
+}
+
+func TestUpstreamTransport_InvalidSettings(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	testCases := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"proxy without host", &config.Config{HTTPProxy: "proxy.example.com:3128"}},
+		{"missing CA file", &config.Config{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", &config.Config{CACertFile: notPEM}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newUpstreamTransport().get(tc.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+// WebSocketHandler serves Claude requests over a WebSocket. Each text message from the
+// client is a Claude request; every Anthropic stream event of the response is sent back
+// as its own text frame. Requests on one connection are handled one after another.
+type WebSocketHandler struct {
+	proxy    *ProxyHandler
+	logger   *slog.Logger
+	upgrader websocket.Upgrader
+}
+
+func NewWebSocketHandler(proxy *ProxyHandler, logger *slog.Logger) *WebSocketHandler {
+	h := &WebSocketHandler{
+		proxy:  proxy,
+		logger: logger,
+	}
+
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+
+	return h
+}
+
+// checkOrigin accepts non-browser clients, which send no Origin, and browser pages only from
+// cors.allowed_origins: browsers do not apply CORS to WebSockets, so without this check any
+// page the user opens could spend their provider credits through the proxy
+func (h *WebSocketHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if h.proxy.config.Get().CORS.AllowsOrigin(origin) {
+		return true
+	}
+
+	h.logger.Warn("WebSocket connection from disallowed origin", "origin", origin)
+
+	return false
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		h.logger.Warn("WebSocket upgrade failed", "error", err)
+		return
+	}
+
+	defer func() {
+		if err := conn.Close(); err != nil {
+			h.logger.Debug("Failed to close WebSocket connection", "error", err)
+		}
+	}()
+
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger.Debug("WebSocket read failed", "error", err)
+			}
+
+			return
+		}
+
+		if messageType != websocket.TextMessage {
+			if err := h.writeError(conn, "requests must be sent as text messages"); err != nil {
+				return
+			}
+
+			continue
+		}
+
+		if err := h.serveRequest(r, conn, payload); err != nil {
+			h.logger.Warn("WebSocket write failed", "error", err)
+			return
+		}
+	}
+}
+
+// serveRequest runs one Claude request through the proxy with streaming forced on,
+// relaying the resulting events as frames
+func (h *WebSocketHandler) serveRequest(upgrade *http.Request, conn *websocket.Conn, payload []byte) error {
+	var request map[string]any
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return h.writeError(conn, "invalid request JSON: "+err.Error())
+	}
+
+	request["stream"] = true
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return h.writeError(conn, "failed to encode request: "+err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(upgrade.Context(), http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return h.writeError(conn, "failed to create request: "+err.Error())
+	}
+
+	// Carry client headers (anthropic-version, model override, ...) but not the handshake
+	req.Header = upgrade.Header.Clone()
+	for key := range req.Header {
+		if strings.HasPrefix(strings.ToLower(key), "sec-websocket-") {
+			req.Header.Del(key)
+		}
+	}
+
+	req.Header.Del("Upgrade")
+	req.Header.Del("Connection")
+	req.Header.Set("Content-Type", "application/json")
+
+	writer := newFrameWriter(conn)
+	h.proxy.ServeHTTP(writer, req)
+
+	return writer.finish()
+}
+
+// writeError sends an Anthropic-style error event as a frame
+func (h *WebSocketHandler) writeError(conn *websocket.Conn, message string) error {
+	return conn.WriteJSON(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    "invalid_request_error",
+			"message": message,
+		},
+	})
+}
+
+// frameWriter is the http.ResponseWriter handed to the proxy for WebSocket requests.
+// Event streams are split into one frame per event payload; any other response body
+// (a JSON error, or a JSON answer to the streaming request) is sent as a single frame.
+type frameWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	err    error
+}
+
+func newFrameWriter(conn *websocket.Conn) *frameWriter {
+	return &frameWriter{
+		conn:   conn,
+		header: make(http.Header),
+	}
+}
+
+func (fw *frameWriter) Header() http.Header {
+	return fw.header
+}
+
+func (fw *frameWriter) WriteHeader(status int) {
+	if fw.status == 0 {
+		fw.status = status
+	}
+}
+
+func (fw *frameWriter) Write(data []byte) (int, error) {
+	fw.WriteHeader(http.StatusOK)
+
+	if fw.err != nil {
+		return 0, fw.err
+	}
+
+	fw.buf.Write(data)
+
+	if fw.isEventStream() {
+		fw.sendEvents()
+	}
+
+	return len(data), fw.err
+}
+
+// Flush is a no-op; complete events are sent as soon as they are written
+func (fw *frameWriter) Flush() {}
+
+func (fw *frameWriter) isEventStream() bool {
+	return strings.HasPrefix(fw.header.Get("Content-Type"), providers.ContentTypeEventStream)
+}
+
+// sendEvents sends the payload of every complete SSE line buffered so far
+func (fw *frameWriter) sendEvents() {
+	for fw.err == nil {
+		end := bytes.IndexByte(fw.buf.Bytes(), '\n')
+		if end < 0 {
+			return
+		}
+
+		line := strings.TrimSpace(string(fw.buf.Next(end + 1)))
+
+		// Event names, comments and separators have no frame of their own; the
+		// payload's "type" names the event. Bare JSON lines are payloads too.
+		data, isData := strings.CutPrefix(line, "data: ")
+		if !isData {
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+
+			data = line
+		}
+
+		if data == "[DONE]" {
+			continue
+		}
+
+		fw.err = fw.conn.WriteMessage(websocket.TextMessage, []byte(data))
+	}
+}
+
+// finish sends whatever the proxy wrote that was not an event stream
+func (fw *frameWriter) finish() error {
+	if fw.err != nil {
+		return fw.err
+	}
+
+	if fw.isEventStream() {
+		// A final line without a trailing newline
+		if fw.buf.Len() > 0 {
+			fw.buf.WriteByte('\n')
+			fw.sendEvents()
+		}
+
+		return fw.err
+	}
+
+	if body := bytes.TrimSpace(fw.buf.Bytes()); len(body) > 0 {
+		return fw.conn.WriteMessage(websocket.TextMessage, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestWebSocketHandler_StreamsEventsAsFrames(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, content := range []string{"Hello", " over", " WebSocket"} {
+			fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", content)
+		}
+
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", APIBase: upstream.URL + "/v1/chat/completions", APIKey: "test-key"},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	registry := providers.NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{"127.0.0.1": "openai"})
+
+	proxy := NewProxyHandler(cfgMgr, registry, logger)
+
+	server := httptest.NewServer(NewWebSocketHandler(proxy, logger))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/messages/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Streaming is implied; the request does not need to ask for it
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage,
+		[]byte(`{"model":"openai,gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`)))
+
+	var (
+		eventTypes []string
+		text       string
+	)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	for len(eventTypes) == 0 || eventTypes[len(eventTypes)-1] != "message_stop" {
+		messageType, payload, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.TextMessage, messageType)
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(payload, &event), "each frame should be one JSON event: %s", payload)
+
+		eventType, _ := event["type"].(string)
+		eventTypes = append(eventTypes, eventType)
+
+		if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "text_delta" {
+			text += delta["text"].(string)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	}, eventTypes)
+	assert.Equal(t, "Hello over WebSocket", text)
+}
+
+func TestWebSocketHandler_InvalidRequest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{}))
+
+	server := httptest.NewServer(NewWebSocketHandler(NewProxyHandler(cfgMgr, providers.NewRegistry(), logger), logger))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var event map[string]any
+	require.NoError(t, conn.ReadJSON(&event))
+
+	assert.Equal(t, "error", event["type"])
+	assert.Contains(t, event["error"].(map[string]any)["message"], "invalid request JSON")
+}
+
+func TestWebSocketHandler_ChecksOrigin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		CORS: config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+	}))
+
+	server := httptest.NewServer(NewWebSocketHandler(NewProxyHandler(cfgMgr, providers.NewRegistry(), logger), logger))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for origin, allowed := range map[string]bool{
+		"":                        true,
+		"https://app.example.com": true,
+		"https://evil.example":    false,
+	} {
+		header := make(http.Header)
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if allowed {
+			require.NoError(t, err, origin)
+			conn.Close()
+
+			continue
+		}
+
+		require.Error(t, err, origin)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
@@ -39,7 +39,12 @@ type MiddlewareSet struct {
 	StatsigBlocker Middleware
 	MetricsBlocker Middleware
 	Logging        Middleware
+	CORS           Middleware
 	Auth           Middleware
+	Signature      Middleware
+	Compression    Middleware
+	Idempotency    Middleware
+	OutputFormat   Middleware
 }
 
 // NewMiddlewareSet creates a complete set of middleware with proper dependencies
@@ -48,7 +53,12 @@ func NewMiddlewareSet(config *config.Manager, logger *slog.Logger) MiddlewareSet
 		StatsigBlocker: NewStatsigBlockerMiddleware(logger),
 		MetricsBlocker: NewMetricsBlockerMiddleware(logger),
 		Logging:        NewLoggingMiddleware(logger),
+		CORS:           NewCORSMiddleware(config, logger),
 		Auth:           NewAuthMiddleware(config, logger),
+		Signature:      NewSignatureMiddleware(config, logger),
+		Compression:    NewCompressionMiddleware(config, logger),
+		Idempotency:    NewIdempotencyMiddleware(config, logger),
+		OutputFormat:   NewOutputFormatMiddleware(config, logger),
 	}
 }
 
@@ -58,7 +68,28 @@ func (ms MiddlewareSet) DefaultChain() Chain {
 		ms.StatsigBlocker, // Block telemetry first
 		ms.MetricsBlocker, // Block metrics second
 		ms.Logging,        // Log requests third
-		ms.Auth,           // Authenticate last
+		ms.CORS,           // Answer preflights before auth
+		ms.Auth,           // Authenticate fifth
+		ms.Signature,      // Verify the body signature sixth
+		ms.Compression,    // Gzip large responses, replays included
+		ms.Idempotency,    // Replay duplicate requests last
+	)
+}
+
+// ProxyChain returns the middleware chain for the proxied API: the default chain, with
+// responses converted to the configured output format before they are cached for replay
+func (ms MiddlewareSet) ProxyChain() Chain {
+	return ms.DefaultChain().Then(ms.OutputFormat)
+}
+
+// WebSocketChain returns the middleware chain for WebSocket endpoints (no idempotency replay)
+func (ms MiddlewareSet) WebSocketChain() Chain {
+	return New(
+		ms.StatsigBlocker, // Block telemetry first
+		ms.MetricsBlocker, // Block metrics second
+		ms.Logging,        // Log requests third
+		ms.Auth,           // Authenticate fourth
+		ms.Signature,      // Verify the (empty) handshake body signature last
 	)
 }
 
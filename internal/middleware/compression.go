@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+type CompressionMiddleware struct {
+	config *config.Manager
+	logger *slog.Logger
+}
+
+// NewCompressionMiddleware gzips responses of at least gzip_min_bytes for clients that accept
+// gzip. Event streams pass through as they are written; without a threshold nothing changes.
+func NewCompressionMiddleware(config *config.Manager, logger *slog.Logger) func(http.Handler) http.Handler {
+	cm := &CompressionMiddleware{
+		config: config,
+		logger: logger,
+	}
+
+	return cm.middleware
+}
+
+func (cm *CompressionMiddleware) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minBytes := cm.config.Get().GzipMinBytes
+		if minBytes <= 0 || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+			minBytes:       minBytes,
+		}
+
+		next.ServeHTTP(gw, r)
+
+		if err := gw.finish(); err != nil {
+			cm.logger.Error("Failed to write compressed response", "error", err)
+		}
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, directly or through "*"
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// gzipResponseWriter holds back a complete response to decide whether it is worth
+// compressing. A flush or an event stream switches it to writing through unchanged.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status        int
+	minBytes      int
+	body          bytes.Buffer
+	headerWritten bool
+	passthrough   bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.headerWritten {
+		return
+	}
+
+	gw.status = status
+	gw.headerWritten = true
+
+	// Streams and responses that are already encoded are never held back
+	if strings.HasPrefix(gw.Header().Get("Content-Type"), "text/event-stream") || gw.Header().Get("Content-Encoding") != "" {
+		gw.startPassthrough()
+	}
+}
+
+func (gw *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !gw.headerWritten {
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	if gw.passthrough {
+		return gw.ResponseWriter.Write(data)
+	}
+
+	return gw.body.Write(data)
+}
+
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.passthrough {
+		if !gw.headerWritten {
+			gw.WriteHeader(http.StatusOK)
+		}
+
+		gw.startPassthrough()
+	}
+
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// startPassthrough sends the status and anything held back, then writes through
+func (gw *gzipResponseWriter) startPassthrough() {
+	gw.passthrough = true
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	if gw.body.Len() > 0 {
+		_, _ = gw.ResponseWriter.Write(gw.body.Bytes())
+		gw.body.Reset()
+	}
+}
+
+// finish sends a held back response, gzipped when it reaches the size threshold and
+// compression makes it smaller
+func (gw *gzipResponseWriter) finish() error {
+	if gw.passthrough {
+		return nil
+	}
+
+	gw.Header().Add("Vary", "Accept-Encoding")
+
+	body := gw.body.Bytes()
+
+	if len(body) >= gw.minBytes {
+		compressed, err := gzipBytes(body)
+		if err != nil {
+			return err
+		}
+
+		if len(compressed) < len(body) {
+			gw.Header().Set("Content-Encoding", "gzip")
+			gw.Header().Set("Content-Length", strconv.Itoa(len(compressed)))
+
+			body = compressed
+		}
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+	_, err := gw.ResponseWriter.Write(body)
+
+	return err
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestCompressionMiddleware_GzipsLargeResponses(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{GzipMinBytes: 1024}))
+
+	largeBody := `{"type":"message","content":[{"type":"text","text":"` + strings.Repeat("All work and no play. ", 200) + `"}]}`
+	smallBody := `{"type":"message","content":[]}`
+
+	handler := NewCompressionMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if r.URL.Query().Get("size") == "small" {
+			fmt.Fprint(w, smallBody)
+		} else {
+			fmt.Fprint(w, largeBody)
+		}
+	}))
+
+	send := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := send("/v1/messages", "gzip, br")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Less(t, rr.Body.Len(), len(largeBody))
+
+	reader, err := gzip.NewReader(rr.Body)
+	require.NoError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(decompressed))
+
+	// Below the threshold, or for clients without gzip, the body is sent as is
+	for _, tc := range []struct{ target, acceptEncoding, body string }{
+		{"/v1/messages?size=small", "gzip", smallBody},
+		{"/v1/messages", "", largeBody},
+		{"/v1/messages", "br, gzip;q=0", largeBody},
+	} {
+		rr := send(tc.target, tc.acceptEncoding)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"), tc.target+" "+tc.acceptEncoding)
+		assert.Equal(t, tc.body, rr.Body.String())
+	}
+}
+
+func TestCompressionMiddleware_StreamsPassThrough(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{GzipMinBytes: 1}))
+
+	stream := "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+	handler := NewCompressionMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, stream)
+		w.(http.Flusher).Flush()
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, stream, rr.Body.String())
+	assert.True(t, rr.Flushed)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, expected := range map[string]bool{
+		"gzip":              true,
+		"br, GZIP;q=0.5":    true,
+		"*":                 true,
+		"":                  false,
+		"identity":          false,
+		"gzip;q=0":          false,
+		"br, gzip; q=0.000": false,
+	} {
+		assert.Equal(t, expected, acceptsGzip(header), header)
+	}
+}
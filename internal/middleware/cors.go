@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-API-Key, anthropic-version, anthropic-beta, Idempotency-Key, X-CCO-Model, X-CCR-Model"
+)
+
+type CORSMiddleware struct {
+	config *config.Manager
+	logger *slog.Logger
+}
+
+func NewCORSMiddleware(config *config.Manager, logger *slog.Logger) func(http.Handler) http.Handler {
+	cm := &CORSMiddleware{
+		config: config,
+		logger: logger,
+	}
+
+	return cm.middleware
+}
+
+// middleware adds CORS headers for allowed origins and answers preflight requests
+// itself, before authentication, since browsers send preflights without credentials
+func (cm *CORSMiddleware) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cfg := cm.config.Get()
+		if cfg == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+
+		if !cfg.CORS.AllowsOrigin(origin) {
+			if preflight {
+				cm.logger.Warn("CORS preflight from disallowed origin", "origin", origin)
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+
+				return
+			}
+
+			// Without CORS headers the browser withholds the response
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		maxAge := cfg.CORS.MaxAgeSeconds
+		if maxAge <= 0 {
+			maxAge = config.DefaultCORSMaxAgeSeconds
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func newCORSTestChain(t *testing.T, calls *int) http.Handler {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		APIKey: "proxy-key",
+		CORS:   config.CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}},
+	}))
+
+	return New(NewCORSMiddleware(cfgMgr, logger), NewAuthMiddleware(cfgMgr, logger)).Handler(newCountingHandler(calls))
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	calls := 0
+	handler := newCORSTestChain(t, &calls)
+
+	// Preflights carry no credentials and must not reach auth or the proxy
+	req := httptest.NewRequest(http.MethodOptions, "/v1/messages", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-api-key")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, "http://localhost:3000", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), http.MethodPost)
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "X-API-Key")
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+
+	// The actual request gets the same origin header on the streaming response
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("X-API-Key", "proxy-key")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "http://localhost:3000", rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_DisallowedOrigin(t *testing.T) {
+	calls := 0
+	handler := newCORSTestChain(t, &calls)
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/messages", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 0, calls)
+
+	// Simple requests still reach the handler, but without CORS headers the browser blocks the response
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("X-API-Key", "proxy-key")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_WildcardAndNoOrigin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		CORS: config.CORSConfig{AllowedOrigins: []string{"*"}},
+	}))
+
+	calls := 0
+	handler := NewCORSMiddleware(cfgMgr, logger)(newCountingHandler(&calls))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Origin", "https://app.example")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "https://app.example", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// Non-browser clients send no Origin and get no CORS headers
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+type IdempotencyMiddleware struct {
+	cache  *idempotencyCache
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	inFlight map[string]chan struct{}
+}
+
+func NewIdempotencyMiddleware(configManager *config.Manager, logger *slog.Logger) func(http.Handler) http.Handler {
+	cfg := configManager.Get()
+
+	size := cfg.Idempotency.CacheSize
+	if size <= 0 {
+		size = config.DefaultIdempotencyCacheSize
+	}
+
+	ttlSeconds := cfg.Idempotency.TTLSeconds
+	if ttlSeconds <= 0 {
+		ttlSeconds = config.DefaultIdempotencyTTLSeconds
+	}
+
+	ttl := time.Duration(ttlSeconds) * time.Second
+
+	im := &IdempotencyMiddleware{
+		cache:    newIdempotencyCache(size, ttl),
+		logger:   logger,
+		inFlight: make(map[string]chan struct{}),
+	}
+
+	return im.middleware
+}
+
+func (im *IdempotencyMiddleware) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The body is part of the key so that a reused key with a different request is not
+		// answered with another request's response
+		bodyHash := sha256.Sum256(body)
+		cacheKey := r.Method + " " + r.URL.Path + " " + key + " " + hex.EncodeToString(bodyHash[:])
+
+		for {
+			if cached, ok := im.cache.get(cacheKey); ok {
+				im.logger.Info("Replaying cached response for idempotency key", "key", key, "status", cached.status)
+				im.replay(w, cached)
+
+				return
+			}
+
+			done, first := im.begin(cacheKey)
+			if first {
+				defer im.end(cacheKey, done)
+				break
+			}
+
+			// A retry of a request that is still running waits for it instead of reaching the
+			// provider a second time
+			select {
+			case <-done:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		recorder := &recordingResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		// A response cut short by the client going away is incomplete
+		if r.Context().Err() != nil {
+			return
+		}
+
+		// Only successful responses are cached so that retries after upstream failures still reach the provider
+		if recorder.status >= http.StatusOK && recorder.status < http.StatusMultipleChoices {
+			im.cache.add(cacheKey, &cachedResponse{
+				status: recorder.status,
+				header: cacheableHeader(w.Header()),
+				body:   recorder.body.Bytes(),
+			})
+		}
+	})
+}
+
+// begin registers a request for key as in flight. When another request already is, it
+// returns that request's done channel and false.
+func (im *IdempotencyMiddleware) begin(key string) (chan struct{}, bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if done, ok := im.inFlight[key]; ok {
+		return done, false
+	}
+
+	done := make(chan struct{})
+	im.inFlight[key] = done
+
+	return done, true
+}
+
+// end releases the requests waiting on key
+func (im *IdempotencyMiddleware) end(key string, done chan struct{}) {
+	im.mu.Lock()
+	delete(im.inFlight, key)
+	im.mu.Unlock()
+
+	close(done)
+}
+
+// cacheableHeader copies the response headers to replay. The CORS headers depend on the
+// request's origin and are set again for each request ahead of this middleware.
+func cacheableHeader(header http.Header) http.Header {
+	cached := header.Clone()
+
+	for key := range cached {
+		if key == "Vary" || strings.HasPrefix(key, "Access-Control-") {
+			delete(cached, key)
+		}
+	}
+
+	return cached
+}
+
+func (im *IdempotencyMiddleware) replay(w http.ResponseWriter, cached *cachedResponse) {
+	// Replace rather than add, so a header set earlier in the chain is not doubled
+	for key, values := range cached.header {
+		w.Header()[key] = slices.Clone(values)
+	}
+
+	w.Header().Set(IdempotencyReplayedHeader, "true")
+	w.WriteHeader(cached.status)
+
+	if _, err := w.Write(cached.body); err != nil {
+		im.logger.Error("Failed to write replayed response", "error", err)
+	}
+}
+
+// recordingResponseWriter passes the response through while keeping a copy for replay
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(data []byte) (int, error) {
+	rw.body.Write(data)
+	return rw.ResponseWriter.Write(data)
+}
+
+func (rw *recordingResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+type idempotencyEntry struct {
+	key       string
+	response  *cachedResponse
+	expiresAt time.Time
+}
+
+// idempotencyCache is a size-bounded LRU cache whose entries expire after a fixed TTL
+type idempotencyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newIdempotencyCache(size int, ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *idempotencyCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*idempotencyEntry)
+	if c.now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.response, true
+}
+
+func (c *idempotencyCache) add(key string, response *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &idempotencyEntry{
+		key:       key,
+		response:  response,
+		expiresAt: c.now().Add(c.ttl),
+	}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idempotencyEntry).key)
+	}
+}
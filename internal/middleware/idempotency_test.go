@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func newCountingHandler(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "event: message_stop\ndata: {\"call\":%d}\n\n", *calls)
+	})
+}
+
+func TestIdempotencyMiddleware_ReplaysCachedResponse(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mw := NewIdempotencyMiddleware(config.NewManager(t.TempDir()), logger)
+
+	calls := 0
+	handler := mw(newCountingHandler(&calls))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	first := send("retry-1")
+	second := send("retry-1")
+
+	assert.Equal(t, 1, calls, "repeated idempotency key should not reach the handler again")
+	assert.Equal(t, first.Body.String(), second.Body.String(), "replayed body should match the original")
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, "text/event-stream", second.Header().Get("Content-Type"))
+	assert.Equal(t, "true", second.Header().Get(IdempotencyReplayedHeader))
+	assert.Empty(t, first.Header().Get(IdempotencyReplayedHeader))
+
+	// A different key or no key is always forwarded
+	send("retry-2")
+	send("")
+	send("")
+	assert.Equal(t, 4, calls)
+}
+
+func TestIdempotencyMiddleware_ReplaysBehindCORS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		CORS: config.CORSConfig{AllowedOrigins: []string{"https://app.example", "https://other.example"}},
+	}))
+
+	calls := 0
+	handler := New(NewCORSMiddleware(cfgMgr, logger), NewIdempotencyMiddleware(cfgMgr, logger)).Handler(newCountingHandler(&calls))
+
+	send := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+		req.Header.Set("Origin", origin)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	send("https://app.example")
+
+	for _, origin := range []string{"https://app.example", "https://other.example"} {
+		replayed := send(origin)
+
+		assert.Equal(t, "true", replayed.Header().Get(IdempotencyReplayedHeader))
+		assert.Equal(t, []string{origin}, replayed.Header().Values("Access-Control-Allow-Origin"), "a replay should carry one origin, the requesting one")
+		assert.Equal(t, []string{"Origin"}, replayed.Header().Values("Vary"))
+		assert.Equal(t, []string{"text/event-stream"}, replayed.Header().Values("Content-Type"))
+	}
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotencyMiddleware_DoesNotCacheErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mw := NewIdempotencyMiddleware(config.NewManager(t.TempDir()), logger)
+
+	calls := 0
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+	}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2, calls, "failed responses should not be replayed")
+}
+
+func TestIdempotencyMiddleware_KeysOnRequestBody(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mw := NewIdempotencyMiddleware(config.NewManager(t.TempDir()), logger)
+
+	calls := 0
+	handler := mw(newCountingHandler(&calls))
+
+	for _, body := range []string{`{"model":"a"}`, `{"model":"b"}`, `{"model":"a"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2, calls, "a reused key with a different body should not replay the other response")
+}
+
+func TestIdempotencyMiddleware_DoesNotCacheCancelledRequests(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mw := NewIdempotencyMiddleware(config.NewManager(t.TempDir()), logger)
+
+	calls := 0
+	handler := mw(newCountingHandler(&calls))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil).WithContext(ctx)
+	req.Header.Set(IdempotencyKeyHeader, "retry-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set(IdempotencyKeyHeader, "retry-1")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, 2, calls, "a response cut short by the client should not be replayed")
+	assert.Empty(t, rr.Header().Get(IdempotencyReplayedHeader))
+}
+
+func TestIdempotencyMiddleware_CoalescesConcurrentRequests(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mw := NewIdempotencyMiddleware(config.NewManager(t.TempDir()), logger)
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		close(started)
+		<-release
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "done")
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send() }()
+
+	<-started
+
+	second := make(chan *httptest.ResponseRecorder)
+	go func() { second <- send() }()
+
+	// Give the duplicate time to reach the middleware before the first request finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "done", (<-first).Body.String())
+
+	replayed := <-second
+	assert.Equal(t, "done", replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, 1, calls, "a duplicate of a running request should wait for its response")
+}
+
+func TestIdempotencyCache_TTLExpiry(t *testing.T) {
+	now := time.Now()
+	cache := newIdempotencyCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.add("key", &cachedResponse{status: http.StatusOK, body: []byte("cached")})
+
+	cached, ok := cache.get("key")
+	require.True(t, ok, "entry should be available before TTL")
+	assert.Equal(t, []byte("cached"), cached.body)
+
+	now = now.Add(2 * time.Minute)
+
+	_, ok = cache.get("key")
+	assert.False(t, ok, "entry should expire after TTL")
+}
+
+func TestIdempotencyCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newIdempotencyCache(2, time.Minute)
+
+	cache.add("a", &cachedResponse{status: http.StatusOK})
+	cache.add("b", &cachedResponse{status: http.StatusOK})
+
+	// Touch "a" so that "b" becomes the least recently used entry
+	_, ok := cache.get("a")
+	require.True(t, ok)
+
+	cache.add("c", &cachedResponse{status: http.StatusOK})
+
+	_, ok = cache.get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+
+	_, ok = cache.get("c")
+	assert.True(t, ok)
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+type OutputFormatMiddleware struct {
+	config *config.Manager
+	logger *slog.Logger
+}
+
+// NewOutputFormatMiddleware converts successful Anthropic responses and event streams to the
+// OpenAI chat completion format for OpenAI clients when output_format is "openai". Anthropic
+// clients and errors are left as they are.
+func NewOutputFormatMiddleware(config *config.Manager, logger *slog.Logger) func(http.Handler) http.Handler {
+	om := &OutputFormatMiddleware{
+		config: config,
+		logger: logger,
+	}
+
+	return om.middleware
+}
+
+func (om *OutputFormatMiddleware) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if om.config.Get().OutputFormat != config.OutputFormatOpenAI {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		openAIClient, err := isOpenAIClient(r)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		if !openAIClient {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ow := &openAIOutputWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+			stream:         providers.NewAnthropicToOpenAIStream(),
+			logger:         om.logger,
+		}
+
+		next.ServeHTTP(ow, r)
+
+		if err := ow.finish(); err != nil {
+			om.logger.Error("Failed to write OpenAI-format response", "error", err)
+		}
+	})
+}
+
+// isOpenAIClient reports whether the request came from an OpenAI client: one posting to the
+// chat completions path, or sending a request only the OpenAI format allows
+func isOpenAIClient(r *http.Request) (bool, error) {
+	if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		return true, nil
+	}
+
+	if r.Body == nil {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return false, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return providers.DetectRequestFormat(body) == providers.RequestFormatOpenAI, nil
+}
+
+// Modes of an openAIOutputWriter, chosen when the status is written
+const (
+	outputPassthrough = iota
+	outputJSON
+	outputStream
+)
+
+// openAIOutputWriter transcodes what the proxy writes: a JSON message is held back and
+// converted whole, and an event stream is converted event by event as it is written
+type openAIOutputWriter struct {
+	http.ResponseWriter
+	status        int
+	mode          int
+	body          bytes.Buffer
+	headerWritten bool
+	stream        *providers.AnthropicToOpenAIStream
+	logger        *slog.Logger
+}
+
+func (ow *openAIOutputWriter) WriteHeader(status int) {
+	if ow.headerWritten {
+		return
+	}
+
+	ow.status = status
+	ow.headerWritten = true
+
+	if status == http.StatusOK {
+		switch contentType := ow.Header().Get("Content-Type"); {
+		case strings.HasPrefix(contentType, "text/event-stream"):
+			ow.mode = outputStream
+		case strings.HasPrefix(contentType, "application/json"):
+			ow.mode = outputJSON
+		}
+	}
+
+	if ow.mode != outputJSON {
+		ow.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ow *openAIOutputWriter) Write(data []byte) (int, error) {
+	if !ow.headerWritten {
+		ow.WriteHeader(http.StatusOK)
+	}
+
+	switch ow.mode {
+	case outputJSON:
+		return ow.body.Write(data)
+	case outputStream:
+		ow.body.Write(data)
+
+		if err := ow.writeEvents(false); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	default:
+		return ow.ResponseWriter.Write(data)
+	}
+}
+
+func (ow *openAIOutputWriter) Flush() {
+	// A held back JSON body is only sent once it is complete
+	if ow.mode == outputJSON {
+		return
+	}
+
+	if flusher, ok := ow.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// writeEvents converts the complete events buffered so far, and the rest too when final.
+// Comment lines such as keep-alives are forwarded unchanged.
+func (ow *openAIOutputWriter) writeEvents(final bool) error {
+	for {
+		buffered := ow.body.String()
+
+		block, rest, found := strings.Cut(buffered, "\n\n")
+		if !found {
+			if !final || strings.TrimSpace(buffered) == "" {
+				return nil
+			}
+
+			block, rest = buffered, ""
+		}
+
+		ow.body.Reset()
+		ow.body.WriteString(rest)
+
+		if err := ow.writeEvent(block); err != nil {
+			return err
+		}
+	}
+}
+
+func (ow *openAIOutputWriter) writeEvent(block string) error {
+	if strings.HasPrefix(strings.TrimSpace(block), ":") {
+		_, err := ow.ResponseWriter.Write([]byte(block + "\n\n"))
+		return err
+	}
+
+	events, err := providers.ParseSSEEvents([]byte(block))
+	if err != nil {
+		ow.logger.Warn("Dropping stream event that could not be converted to OpenAI format", "error", err)
+		return nil
+	}
+
+	for _, event := range events {
+		if chunk := ow.stream.Convert(event); len(chunk) > 0 {
+			if _, err := ow.ResponseWriter.Write(chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// finish converts and sends a held back JSON message, or whatever is left of a stream. A body
+// that is not an Anthropic message, such as a count_tokens result, is sent unchanged.
+func (ow *openAIOutputWriter) finish() error {
+	switch ow.mode {
+	case outputStream:
+		return ow.writeEvents(true)
+	case outputJSON:
+		body := ow.body.Bytes()
+
+		var response struct {
+			Type string `json:"type"`
+		}
+
+		if json.Unmarshal(body, &response) == nil && response.Type == "message" {
+			if converted, err := providers.AnthropicToOpenAIResponse(body); err != nil {
+				ow.logger.Warn("Response not converted to OpenAI format", "error", err)
+			} else {
+				body = converted
+			}
+		}
+
+		ow.ResponseWriter.WriteHeader(ow.status)
+		_, err := ow.ResponseWriter.Write(body)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+const anthropicStream = "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"model\":\"claude-sonnet-4\",\"usage\":{\"input_tokens\":3}}}\n\n" +
+	": keep-alive\n\n" +
+	"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+	"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n" +
+	"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+	"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":1}}\n\n" +
+	"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+func TestOutputFormatMiddleware_ConvertsStreams(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{OutputFormat: config.OutputFormatOpenAI}))
+
+	handler := NewOutputFormatMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		// Writes do not line up with event boundaries
+		for i := 0; i < len(anthropicStream); i += 37 {
+			fmt.Fprint(w, anthropicStream[i:min(i+37, len(anthropicStream))])
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, rr.Flushed)
+
+	blocks := strings.Split(strings.TrimSpace(rr.Body.String()), "\n\n")
+	require.Len(t, blocks, 5, rr.Body.String())
+
+	assert.Equal(t, ": keep-alive", blocks[1])
+	assert.Equal(t, "data: [DONE]", blocks[4])
+	assert.NotContains(t, rr.Body.String(), "event:")
+
+	var textChunk map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(blocks[2], "data: ")), &textChunk))
+	assert.Equal(t, "chat.completion.chunk", textChunk["object"])
+	assert.Equal(t, map[string]any{"content": "Hello"}, textChunk["choices"].([]any)[0].(map[string]any)["delta"])
+
+	var finalChunk map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(blocks[3], "data: ")), &finalChunk))
+	assert.Equal(t, "stop", finalChunk["choices"].([]any)[0].(map[string]any)["finish_reason"])
+	assert.Equal(t, float64(4), finalChunk["usage"].(map[string]any)["total_tokens"])
+}
+
+func TestOutputFormatMiddleware_ConvertsJSON(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{OutputFormat: config.OutputFormatOpenAI}))
+
+	message := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Hello"}],"stop_reason":"max_tokens","usage":{"input_tokens":3,"output_tokens":1}}`
+	errorBody := `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`
+
+	handler := NewOutputFormatMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, errorBody)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, message)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var completion map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &completion))
+	assert.Equal(t, "chat.completion", completion["object"])
+
+	choice := completion["choices"].([]any)[0].(map[string]any)
+	assert.Equal(t, "length", choice["finish_reason"])
+	assert.Equal(t, "Hello", choice["message"].(map[string]any)["content"])
+
+	// Errors keep their Anthropic shape
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions?fail=1", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, errorBody, rr.Body.String())
+
+	// The default output format leaves responses untouched
+	require.NoError(t, cfgMgr.Save(&config.Config{}))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	assert.Equal(t, message, rr.Body.String())
+}
+
+func TestOutputFormatMiddleware_OnlyConvertsForOpenAIClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{OutputFormat: config.OutputFormatOpenAI}))
+
+	message := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Hello"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`
+
+	var received string
+
+	handler := NewOutputFormatMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if strings.HasSuffix(r.URL.Path, "/count_tokens") {
+			fmt.Fprint(w, `{"input_tokens":3}`)
+			return
+		}
+
+		fmt.Fprint(w, message)
+	}))
+
+	send := func(target, body string) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		return rr.Body.String()
+	}
+
+	// Claude Code and other Anthropic clients keep getting Anthropic messages
+	anthropicRequest := `{"model":"claude-sonnet-4","max_tokens":100,"system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`
+	assert.Equal(t, message, send("/v1/messages", anthropicRequest))
+	assert.Equal(t, anthropicRequest, received, "the request body should still reach the handler")
+
+	// A request only the OpenAI format allows is answered in that format on any path
+	openAIRequest := `{"model":"gpt-4o","max_completion_tokens":100,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`
+	assert.Contains(t, send("/v1/messages", openAIRequest), `"object":"chat.completion"`)
+	assert.Equal(t, openAIRequest, received)
+
+	// Responses that are not messages are sent as they are
+	assert.Equal(t, `{"input_tokens":3}`, send("/v1/messages/count_tokens", openAIRequest))
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the signed request, optionally prefixed "sha256="
+	SignatureHeader = "X-Ccr-Signature"
+
+	// SignatureTimestampHeader carries the Unix time in seconds at which the request was signed
+	SignatureTimestampHeader = "X-Ccr-Timestamp"
+
+	// signatureMaxSkew is how far a signature's timestamp may be from the proxy's clock
+	signatureMaxSkew = 5 * time.Minute
+
+	// maxSignedBodyBytes caps the body read before its signature is verified (Anthropic's own
+	// request size limit)
+	maxSignedBodyBytes = 32 << 20
+)
+
+type SignatureMiddleware struct {
+	config *config.Manager
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewSignatureMiddleware rejects requests that are not signed with the configured
+// inbound_hmac_secret; without a secret every request passes
+func NewSignatureMiddleware(config *config.Manager, logger *slog.Logger) func(http.Handler) http.Handler {
+	sm := &SignatureMiddleware{
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+
+	return sm.middleware
+}
+
+func (sm *SignatureMiddleware) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := sm.config.Get().InboundHMACSecret
+		if secret == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		err = sm.verify(secret, r.Header.Get(SignatureTimestampHeader), r.Method, r.URL.RequestURI(), body, r.Header.Get(SignatureHeader))
+		if err != nil {
+			sm.logger.Error("Signature verification failed", "error", err, "remote_addr", r.RemoteAddr)
+			http.Error(w, "Request signature not valid", http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Sign returns the signature for the SignatureHeader of a request sent at timestamp (Unix
+// seconds, also sent in SignatureTimestampHeader) to requestURI, the path and query
+func Sign(secret string, timestamp int64, method, requestURI string, body []byte) string {
+	return hex.EncodeToString(requestMAC(secret, strconv.FormatInt(timestamp, 10), method, requestURI, body))
+}
+
+// requestMAC covers the timestamp, method and path as well as the body, so a signature is
+// only valid for one request and only for a short while
+func requestMAC(secret, timestamp, method, requestURI string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", timestamp, method, requestURI)
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+func (sm *SignatureMiddleware) verify(secret, timestamp, method, requestURI string, body []byte, signature string) error {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	if signature == "" {
+		return errors.New("no request signature provided")
+	}
+
+	timestamp = strings.TrimSpace(timestamp)
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("no valid request timestamp provided")
+	}
+
+	if skew := sm.now().Sub(time.Unix(seconds, 0)); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return fmt.Errorf("request timestamp is %s away from the proxy's clock", skew.Round(time.Second))
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("request signature is not hex encoded")
+	}
+
+	if !hmac.Equal(got, requestMAC(secret, timestamp, method, requestURI, body)) {
+		return errors.New("request signature does not match the request")
+	}
+
+	return nil
+}
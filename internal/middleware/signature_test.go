@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestSignatureMiddleware_VerifiesRequestSignature(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{InboundHMACSecret: "shared-secret"}))
+
+	var received string
+
+	handler := NewSignatureMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	body := `{"model":"openrouter,openai/gpt-4o","messages":[]}`
+	now := time.Now().Unix()
+
+	send := func(method, target, timestamp, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if timestamp != "" {
+			req.Header.Set("x-ccr-timestamp", timestamp)
+		}
+
+		if signature != "" {
+			req.Header.Set("x-ccr-signature", signature)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	timestamp := strconv.FormatInt(now, 10)
+	valid := Sign("shared-secret", now, http.MethodPost, "/v1/messages", []byte(body))
+
+	rr := send(http.MethodPost, "/v1/messages", timestamp, valid)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, body, received, "the verified body should still reach the handler")
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/messages", timestamp, "sha256="+valid).Code)
+
+	received = ""
+
+	old := now - 600
+
+	for name, tc := range map[string]struct{ method, target, timestamp, signature string }{
+		"missing signature": {http.MethodPost, "/v1/messages", timestamp, ""},
+		"missing timestamp": {http.MethodPost, "/v1/messages", "", valid},
+		"wrong secret":      {http.MethodPost, "/v1/messages", timestamp, Sign("other-secret", now, http.MethodPost, "/v1/messages", []byte(body))},
+		"other body":        {http.MethodPost, "/v1/messages", timestamp, Sign("shared-secret", now, http.MethodPost, "/v1/messages", []byte(body+" "))},
+		"other path":        {http.MethodPost, "/admin/reload", timestamp, valid},
+		"other method":      {http.MethodPut, "/v1/messages", timestamp, valid},
+		"other timestamp":   {http.MethodPost, "/v1/messages", strconv.FormatInt(now+1, 10), valid},
+		"expired":           {http.MethodPost, "/v1/messages", strconv.FormatInt(old, 10), Sign("shared-secret", old, http.MethodPost, "/v1/messages", []byte(body))},
+		"not hex":           {http.MethodPost, "/v1/messages", timestamp, "not-a-signature"},
+	} {
+		assert.Equal(t, http.StatusUnauthorized, send(tc.method, tc.target, tc.timestamp, tc.signature).Code, name)
+	}
+
+	assert.Empty(t, received, "rejected requests should not reach the handler")
+}
+
+func TestSignatureMiddleware_RejectsOversizedBody(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{InboundHMACSecret: "shared-secret"}))
+
+	handler := NewSignatureMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("an oversized request should not reach the handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(strings.Repeat("x", maxSignedBodyBytes+1)))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
+
+func TestSignatureMiddleware_DisabledWithoutSecret(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{}))
+
+	handler := NewSignatureMiddleware(cfgMgr, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader("{}")))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -14,22 +14,89 @@ import (
 )
 
 type Manager struct {
-	pidFile string
-	refFile string
-	mu      sync.RWMutex
+	pidFile    string
+	refFile    string
+	profile    string
+	configPath string
+	mu         sync.RWMutex
 }
 
 func NewManager(baseDir string) *Manager {
-	// Determine which PID filename to use based on baseDir
-	pidFilename := ".claude-code-open.pid"
-	if strings.Contains(baseDir, "claude-code-router") {
-		pidFilename = ".claude-code-router.pid"
+	return NewProfileManager(baseDir, "")
+}
+
+// NewProfileManager namespaces the PID and reference files by profile so that
+// several profiles can run side by side
+func NewProfileManager(baseDir, profile string) *Manager {
+	pidName := pidBaseName(baseDir)
+	refName := "claude-code-reference-count"
+
+	if profile != "" {
+		pidName += "." + profile
+		refName += "." + profile
 	}
 
 	return &Manager{
-		pidFile: filepath.Join(baseDir, pidFilename),
-		refFile: filepath.Join(os.TempDir(), "claude-code-reference-count.txt"),
+		pidFile: filepath.Join(baseDir, pidName+".pid"),
+		refFile: filepath.Join(os.TempDir(), refName+".txt"),
+		profile: profile,
+	}
+}
+
+// NewFileManager returns the manager of an instance using the config file at configPath.
+// The PID file sits next to the config and is named after it like a profile's (work.yaml
+// runs as "work"), except for config.yaml and config.json, which use the default name.
+func NewFileManager(configPath string) *Manager {
+	name := strings.TrimSuffix(filepath.Base(configPath), filepath.Ext(configPath))
+	if name == "config" {
+		name = ""
+	}
+
+	m := NewProfileManager(filepath.Dir(configPath), name)
+	m.configPath = configPath
+
+	return m
+}
+
+// ProfileManagers returns a manager for every profile with a PID file in baseDir,
+// the default profile included
+func ProfileManagers(baseDir string) ([]*Manager, error) {
+	pidName := pidBaseName(baseDir)
+
+	matches, err := filepath.Glob(filepath.Join(baseDir, pidName+"*.pid"))
+	if err != nil {
+		return nil, fmt.Errorf("list pid files: %w", err)
+	}
+
+	managers := make([]*Manager, 0, len(matches))
+
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), pidName), ".pid")
+
+		switch {
+		case suffix == "":
+			managers = append(managers, NewManager(baseDir))
+		case strings.HasPrefix(suffix, ".") && len(suffix) > 1:
+			managers = append(managers, NewProfileManager(baseDir, suffix[1:]))
+		}
+	}
+
+	return managers, nil
+}
+
+// pidBaseName is the PID file name of the default profile, without extension
+func pidBaseName(baseDir string) string {
+	// Determine which PID filename to use based on baseDir
+	if strings.Contains(baseDir, "claude-code-router") {
+		return ".claude-code-router"
 	}
+
+	return ".claude-code-open"
+}
+
+// Profile returns the profile the manager belongs to, empty for the default profile
+func (m *Manager) Profile() string {
+	return m.profile
 }
 
 func (m *Manager) WritePID() error {
@@ -110,6 +177,28 @@ func (m *Manager) CleanupPID() {
 	}
 }
 
+// PruneStale removes the PID file of a service that is no longer running and resets
+// the reference count when no live service owns it, as left behind by a crash.
+// It reports whether anything was removed.
+func (m *Manager) PruneStale() bool {
+	if pid := m.ReadPID(); pid != 0 && syscall.Kill(pid, 0) == nil {
+		return false
+	}
+
+	pruned := false
+
+	for _, path := range []string{m.pidFile, m.refFile} {
+		if _, err := os.Stat(path); err == nil {
+			pruned = true
+		}
+	}
+
+	m.CleanupPID()
+	m.CleanupRef()
+
+	return pruned
+}
+
 func (m *Manager) IncrementRef() {
 	m.writeRef(m.ReadRef() + 1)
 }
@@ -177,8 +266,15 @@ func (m *Manager) StartServiceIfNeeded() (bool, error) {
 		return false, nil // Service was already running
 	}
 
-	// Start service in background
-	cmd := exec.Command(os.Args[0], "start")
+	// Start service in background with the same config file or profile
+	args := []string{"start"}
+	if m.configPath != "" {
+		args = append(args, "--config", m.configPath)
+	} else if m.profile != "" {
+		args = append(args, "--profile", m.profile)
+	}
+
+	cmd := exec.Command(os.Args[0], args...)
 	if err := cmd.Start(); err != nil {
 		return false, fmt.Errorf("failed to start service: %w", err)
 	}
@@ -0,0 +1,76 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_ProfilePIDFilesAreIsolated(t *testing.T) {
+	baseDir := t.TempDir()
+
+	defaultMgr := NewManager(baseDir)
+	workMgr := NewProfileManager(baseDir, "work")
+
+	assert.Equal(t, filepath.Join(baseDir, ".claude-code-open.pid"), defaultMgr.pidFile)
+	assert.Equal(t, filepath.Join(baseDir, ".claude-code-open.work.pid"), workMgr.pidFile)
+	assert.NotEqual(t, defaultMgr.refFile, workMgr.refFile)
+
+	// Writing the PID of one profile leaves the other untouched
+	require.NoError(t, workMgr.WritePID())
+	assert.Equal(t, os.Getpid(), workMgr.ReadPID())
+	assert.Equal(t, 0, defaultMgr.ReadPID())
+
+	workMgr.CleanupPID()
+	assert.Equal(t, 0, workMgr.ReadPID())
+}
+
+func TestNewFileManager_PIDFileFollowsConfig(t *testing.T) {
+	baseDir := t.TempDir()
+
+	assert.Equal(t, filepath.Join(baseDir, ".claude-code-open.pid"), NewFileManager(filepath.Join(baseDir, "config.yaml")).pidFile)
+
+	workMgr := NewFileManager(filepath.Join(baseDir, "work.json"))
+	assert.Equal(t, filepath.Join(baseDir, ".claude-code-open.work.pid"), workMgr.pidFile)
+	assert.Equal(t, filepath.Join(baseDir, "work.json"), workMgr.configPath)
+}
+
+func TestManager_PruneStale(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process signals are not supported on Windows")
+	}
+
+	// Keep the reference file of the test out of the real temporary directory
+	t.Setenv("TMPDIR", t.TempDir())
+
+	procMgr := NewProfileManager(t.TempDir(), "crashed")
+
+	// The PID of a process that has exited stands in for a crashed service
+	exited := exec.Command("true")
+	require.NoError(t, exited.Run())
+
+	require.NoError(t, os.WriteFile(procMgr.pidFile, []byte(strconv.Itoa(exited.Process.Pid)), 0o600))
+	procMgr.IncrementRef()
+	require.Equal(t, 1, procMgr.ReadRef())
+
+	assert.True(t, procMgr.PruneStale())
+	assert.NoFileExists(t, procMgr.pidFile)
+	assert.NoFileExists(t, procMgr.refFile)
+	assert.Equal(t, 0, procMgr.ReadRef())
+
+	assert.False(t, procMgr.PruneStale(), "nothing is left to prune")
+
+	// The files of a live service are kept
+	require.NoError(t, procMgr.WritePID())
+	procMgr.IncrementRef()
+
+	assert.False(t, procMgr.PruneStale())
+	assert.Equal(t, os.Getpid(), procMgr.ReadPID())
+	assert.Equal(t, 1, procMgr.ReadRef())
+}
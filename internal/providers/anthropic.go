@@ -1,9 +1,5 @@
 package providers
 
-import (
-	"strings"
-)
-
 type AnthropicProvider struct {
 	name     string
 	endpoint string
@@ -33,15 +29,7 @@ func (p *AnthropicProvider) SetAPIKey(key string) {
 }
 
 func (p *AnthropicProvider) IsStreaming(headers map[string][]string) bool {
-	if contentType, ok := headers["Content-Type"]; ok {
-		for _, ct := range contentType {
-			if ct == "text/event-stream" || strings.Contains(ct, "stream") {
-				return true
-			}
-		}
-	}
-
-	return false
+	return DetectStreaming(headers)
 }
 
 func (p *AnthropicProvider) TransformRequest(request []byte) ([]byte, error) {
@@ -0,0 +1,297 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AnthropicOAuthName is the provider name of Anthropic accessed with a Claude.ai subscription
+	AnthropicOAuthName = "anthropic-oauth"
+
+	// AnthropicOAuthCredentialsFile holds the subscription's tokens in the config directory.
+	// It has the shape of Claude Code's .credentials.json, so that file can be copied in.
+	AnthropicOAuthCredentialsFile = "anthropic-oauth.json"
+
+	// AnthropicOAuthBeta is the anthropic-beta flag the API requires for OAuth access tokens
+	AnthropicOAuthBeta = "oauth-2025-04-20"
+
+	anthropicOAuthTokenURL = "https://console.anthropic.com/v1/oauth/token"
+	anthropicOAuthClientID = "9d1c250a-e61b-44d9-88ed-5944d1962f5e"
+
+	// anthropicOAuthRefreshMargin refreshes a token this long before it expires, so it
+	// doesn't expire while a request is in flight
+	anthropicOAuthRefreshMargin = time.Minute
+
+	// anthropicOAuthRefreshTimeout bounds a token refresh, which outlives the request that
+	// started it so that a client going away does not waste the rotated refresh token
+	anthropicOAuthRefreshTimeout = 30 * time.Second
+)
+
+// AnthropicOAuthCredentials are the tokens of a Claude Pro/Max login
+type AnthropicOAuthCredentials struct {
+	AccessToken      string   `json:"accessToken"`
+	RefreshToken     string   `json:"refreshToken"`
+	ExpiresAt        int64    `json:"expiresAt"` // Unix milliseconds
+	Scopes           []string `json:"scopes,omitempty"`
+	SubscriptionType string   `json:"subscriptionType,omitempty"`
+}
+
+type anthropicOAuthFile struct {
+	ClaudeAiOauth *AnthropicOAuthCredentials `json:"claudeAiOauth"`
+}
+
+// RequestAuthorizer is implemented by providers that authenticate upstream requests
+// themselves rather than with the configured API key
+type RequestAuthorizer interface {
+	Authorize(req *http.Request) error
+}
+
+// AnthropicOAuthProvider talks to the Anthropic API like AnthropicProvider, but signs
+// requests with the OAuth access token of a Claude.ai subscription. The token is read
+// from credentialsPath and refreshed, and written back, when it is about to expire.
+type AnthropicOAuthProvider struct {
+	*AnthropicProvider
+
+	credentialsPath string
+	tokenURL        string
+	client          *http.Client
+	now             func() time.Time
+	logger          *slog.Logger
+
+	mu          sync.Mutex
+	credentials *AnthropicOAuthCredentials
+}
+
+func NewAnthropicOAuthProvider(credentialsPath string) *AnthropicOAuthProvider {
+	return &AnthropicOAuthProvider{
+		AnthropicProvider: &AnthropicProvider{
+			name:     AnthropicOAuthName,
+			endpoint: "https://api.anthropic.com/v1/messages",
+		},
+		credentialsPath: credentialsPath,
+		tokenURL:        anthropicOAuthTokenURL,
+		client:          &http.Client{Timeout: anthropicOAuthRefreshTimeout},
+		now:             time.Now,
+		logger:          slog.Default(),
+	}
+}
+
+// Authorize sets the bearer token and OAuth beta flag on an upstream request, replacing
+// any API key the client sent
+func (p *AnthropicOAuthProvider) Authorize(req *http.Request) error {
+	token, err := p.AccessToken(req.Context())
+	if err != nil {
+		return err
+	}
+
+	req.Header.Del("x-api-key")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("anthropic-beta", addAnthropicBeta(req.Header.Get("anthropic-beta"), AnthropicOAuthBeta))
+
+	return nil
+}
+
+// AccessToken returns a valid access token, refreshing it first if it has expired
+func (p *AnthropicOAuthProvider) AccessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.credentials == nil {
+		credentials, err := p.loadCredentials()
+		if err != nil {
+			return "", err
+		}
+
+		p.credentials = credentials
+	}
+
+	expiresAt := time.UnixMilli(p.credentials.ExpiresAt)
+	if p.credentials.ExpiresAt == 0 || p.now().Add(anthropicOAuthRefreshMargin).Before(expiresAt) {
+		return p.credentials.AccessToken, nil
+	}
+
+	if err := p.refresh(ctx); err != nil {
+		return "", err
+	}
+
+	return p.credentials.AccessToken, nil
+}
+
+func (p *AnthropicOAuthProvider) loadCredentials() (*AnthropicOAuthCredentials, error) {
+	data, err := os.ReadFile(p.credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth credentials (copy ~/.claude/.credentials.json to %s): %w", p.credentialsPath, err)
+	}
+
+	var file anthropicOAuthFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse OAuth credentials %s: %w", p.credentialsPath, err)
+	}
+
+	if file.ClaudeAiOauth == nil || file.ClaudeAiOauth.AccessToken == "" {
+		return nil, fmt.Errorf("no claudeAiOauth access token in %s", p.credentialsPath)
+	}
+
+	return file.ClaudeAiOauth, nil
+}
+
+// refresh exchanges the refresh token for new tokens and saves them. A token that cannot
+// be saved is still used; it is refreshed again after the next restart.
+func (p *AnthropicOAuthProvider) refresh(ctx context.Context) error {
+	if p.credentials.RefreshToken == "" {
+		return errors.New("OAuth access token has expired and there is no refresh token; log in again")
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), anthropicOAuthRefreshTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": p.credentials.RefreshToken,
+		"client_id":     anthropicOAuthClientID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal token refresh request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create token refresh request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OAuth token refresh failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read token refresh response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OAuth token refresh failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal(respBody, &tokens); err != nil {
+		return fmt.Errorf("failed to parse token refresh response: %w", err)
+	}
+
+	if tokens.AccessToken == "" {
+		return errors.New("OAuth token refresh returned no access token")
+	}
+
+	refreshed := *p.credentials
+	refreshed.AccessToken = tokens.AccessToken
+	refreshed.ExpiresAt = p.now().Add(time.Duration(tokens.ExpiresIn) * time.Second).UnixMilli()
+
+	// The refresh token rotates when the server sends a new one
+	if tokens.RefreshToken != "" {
+		refreshed.RefreshToken = tokens.RefreshToken
+	}
+
+	p.credentials = &refreshed
+
+	if err := p.saveCredentials(&refreshed); err != nil {
+		p.logger.Error("Failed to save refreshed OAuth credentials", "path", p.credentialsPath, "error", err)
+	}
+
+	return nil
+}
+
+// saveCredentials writes the tokens into the credentials file, keeping the file's other
+// keys, and replaces the file in one rename so a crash cannot leave it half written
+func (p *AnthropicOAuthProvider) saveCredentials(credentials *AnthropicOAuthCredentials) error {
+	file := make(map[string]json.RawMessage)
+	oauth := make(map[string]json.RawMessage)
+
+	if data, err := os.ReadFile(p.credentialsPath); err == nil {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("parse %s: %w", p.credentialsPath, err)
+		}
+
+		if existing, ok := file["claudeAiOauth"]; ok {
+			if err := json.Unmarshal(existing, &oauth); err != nil {
+				return fmt.Errorf("parse claudeAiOauth in %s: %w", p.credentialsPath, err)
+			}
+		}
+	}
+
+	updated, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("marshal OAuth credentials: %w", err)
+	}
+
+	if err := json.Unmarshal(updated, &oauth); err != nil {
+		return fmt.Errorf("merge OAuth credentials: %w", err)
+	}
+
+	if file["claudeAiOauth"], err = json.Marshal(oauth); err != nil {
+		return fmt.Errorf("marshal OAuth credentials: %w", err)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal OAuth credentials file: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(p.credentialsPath), "."+filepath.Base(p.credentialsPath)+".*")
+	if err != nil {
+		return fmt.Errorf("create temporary credentials file: %w", err)
+	}
+	defer func() { _ = os.Remove(temp.Name()) }()
+
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write temporary credentials file: %w", err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write temporary credentials file: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), p.credentialsPath); err != nil {
+		return fmt.Errorf("replace %s: %w", p.credentialsPath, err)
+	}
+
+	return nil
+}
+
+// addAnthropicBeta adds a flag to a comma-separated anthropic-beta header value
+func addAnthropicBeta(header, beta string) string {
+	var flags []string
+
+	for _, flag := range strings.Split(header, ",") {
+		flag = strings.TrimSpace(flag)
+		if flag == beta {
+			return header
+		}
+
+		if flag != "" {
+			flags = append(flags, flag)
+		}
+	}
+
+	return strings.Join(append(flags, beta), ",")
+}
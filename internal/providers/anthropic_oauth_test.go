@@ -0,0 +1,203 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOAuthProvider writes credentials expiring at expiresAt and returns a provider
+// refreshing them against tokenServer
+func newTestOAuthProvider(t *testing.T, tokenServer *httptest.Server, expiresAt time.Time) (*AnthropicOAuthProvider, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), AnthropicOAuthCredentialsFile)
+	data, err := json.Marshal(anthropicOAuthFile{ClaudeAiOauth: &AnthropicOAuthCredentials{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    expiresAt.UnixMilli(),
+		Scopes:       []string{"user:inference"},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	provider := NewAnthropicOAuthProvider(path)
+	provider.tokenURL = tokenServer.URL
+
+	return provider, path
+}
+
+func TestAnthropicOAuthProvider_BasicMethods(t *testing.T) {
+	provider := NewAnthropicOAuthProvider("unused")
+
+	assert.Equal(t, AnthropicOAuthName, provider.Name())
+	assert.Equal(t, "https://api.anthropic.com/v1/messages", provider.GetEndpoint())
+
+	request := []byte(`{"model":"claude-sonnet-4","messages":[]}`)
+	transformed, err := provider.TransformRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, request, transformed)
+}
+
+func TestAnthropicOAuthProvider_RefreshesExpiredToken(t *testing.T) {
+	var refreshRequest map[string]string
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&refreshRequest))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	provider, path := newTestOAuthProvider(t, tokenServer, time.Now().Add(-time.Minute))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("x-api-key", "proxy-key")
+	req.Header.Set("anthropic-beta", "interleaved-thinking-2025-05-14")
+
+	require.NoError(t, provider.Authorize(req))
+
+	assert.Equal(t, "refresh_token", refreshRequest["grant_type"])
+	assert.Equal(t, "old-refresh", refreshRequest["refresh_token"])
+	assert.NotEmpty(t, refreshRequest["client_id"])
+
+	assert.Equal(t, "Bearer new-access", req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("x-api-key"))
+	assert.Equal(t, "interleaved-thinking-2025-05-14,"+AnthropicOAuthBeta, req.Header.Get("anthropic-beta"))
+
+	// The refreshed tokens are saved for the next start
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved anthropicOAuthFile
+	require.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, "new-access", saved.ClaudeAiOauth.AccessToken)
+	assert.Equal(t, "new-refresh", saved.ClaudeAiOauth.RefreshToken)
+	assert.Equal(t, []string{"user:inference"}, saved.ClaudeAiOauth.Scopes)
+	assert.Greater(t, saved.ClaudeAiOauth.ExpiresAt, time.Now().Add(50*time.Minute).UnixMilli())
+}
+
+func TestAnthropicOAuthProvider_RefreshKeepsOtherCredentials(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	provider, path := newTestOAuthProvider(t, tokenServer, time.Now().Add(-time.Minute))
+
+	// Claude Code's credentials file carries more than the subscription tokens
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	require.NoError(t, os.WriteFile(path, []byte(`{"claudeAiOauth":{"accessToken":"old-access","refreshToken":"old-refresh",`+
+		`"expiresAt":`+strconv.FormatInt(expired, 10)+`,"rateLimitTier":"max"},"mcpOAuth":{"server":{"accessToken":"mcp"}}}`), 0600))
+
+	// The refresh is not abandoned when the request that started it is
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	token, err := provider.AccessToken(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "new-access", token)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved map[string]map[string]any
+	require.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, map[string]any{"accessToken": "mcp"}, saved["mcpOAuth"]["server"])
+	assert.Equal(t, "new-access", saved["claudeAiOauth"]["accessToken"])
+	assert.Equal(t, "new-refresh", saved["claudeAiOauth"]["refreshToken"])
+	assert.Equal(t, "max", saved["claudeAiOauth"]["rateLimitTier"])
+
+	// No temporary files are left next to the credentials
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestAnthropicOAuthProvider_RefreshedTokenIsUsedWhenSaveFails(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"new-access","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	provider, path := newTestOAuthProvider(t, tokenServer, time.Now().Add(time.Hour))
+
+	token, err := provider.AccessToken(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "old-access", token)
+
+	// The credentials directory goes away, so the refreshed tokens cannot be written
+	require.NoError(t, os.RemoveAll(filepath.Dir(path)))
+
+	provider.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	token, err = provider.AccessToken(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "new-access", token)
+}
+
+func TestAnthropicOAuthProvider_ValidTokenIsNotRefreshed(t *testing.T) {
+	refreshes := 0
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+
+		_, _ = w.Write([]byte(`{"access_token":"new-access","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	provider, _ := newTestOAuthProvider(t, tokenServer, time.Now().Add(time.Hour))
+
+	for range 2 {
+		token, err := provider.AccessToken(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "old-access", token)
+	}
+
+	assert.Zero(t, refreshes)
+
+	// Shortly before expiry the token is refreshed rather than used
+	provider.now = func() time.Time { return time.Now().Add(time.Hour - 30*time.Second) }
+
+	token, err := provider.AccessToken(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "new-access", token)
+	assert.Equal(t, 1, refreshes)
+}
+
+func TestAnthropicOAuthProvider_RefreshFailure(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer tokenServer.Close()
+
+	provider, path := newTestOAuthProvider(t, tokenServer, time.Now().Add(-time.Minute))
+
+	_, err := provider.AccessToken(t.Context())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+
+	// The stored credentials are left as they were
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "old-refresh")
+}
+
+func TestAnthropicOAuthProvider_MissingCredentials(t *testing.T) {
+	provider := NewAnthropicOAuthProvider(filepath.Join(t.TempDir(), AnthropicOAuthCredentialsFile))
+
+	_, err := provider.AccessToken(t.Context())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ".credentials.json")
+}
@@ -4,16 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
 
 const (
 	// Common role and content type constants
-	RoleAssistant      = "assistant"
-	RoleUser           = "user"
-	ContentTypeText    = "text"
-	ContentTypeToolUse = "tool_use"
+	RoleAssistant       = "assistant"
+	RoleUser            = "user"
+	ContentTypeText     = "text"
+	ContentTypeToolUse  = "tool_use"
+	ContentTypeThinking = "thinking"
 
 	// Stop reason constants
 	StopReasonEndTurn = "end_turn"
@@ -162,6 +164,47 @@ func RemoveFieldsRecursively(data any, fieldsToRemove []string) any {
 	}
 }
 
+// schemaFields hold JSON schemas written by the client, where a key such as cache_control
+// or metadata names a property rather than an Anthropic field
+var schemaFields = map[string]bool{
+	"input_schema": true,
+	"parameters":   true,
+	"schema":       true,
+}
+
+// RemoveRequestFields removes fields from a request like RemoveFieldsRecursively, but
+// copies tool and output schemas unchanged so their properties survive
+func RemoveRequestFields(data any, fieldsToRemove []string) any {
+	switch v := data.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+
+		for key, value := range v {
+			if slices.Contains(fieldsToRemove, key) {
+				continue
+			}
+
+			if schemaFields[key] {
+				result[key] = value
+				continue
+			}
+
+			result[key] = RemoveRequestFields(value, fieldsToRemove)
+		}
+
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = RemoveRequestFields(item, fieldsToRemove)
+		}
+
+		return result
+	default:
+		return v
+	}
+}
+
 // CreateAnthropicContent creates Anthropic content blocks from text
 func CreateAnthropicContent(text string) []map[string]any {
 	if text == "" {
@@ -216,10 +259,165 @@ type ProviderInterface interface {
 	convertStopReason(reason string) *string
 }
 
+// startPendingToolBlocks starts tool_use blocks that are still waiting for an upstream id,
+// giving them a synthetic id derived from the tool call index, and flushes their buffered
+// arguments. The block for exceptIndex, if any, keeps waiting.
+func startPendingToolBlocks(state *StreamState, exceptIndex int) []byte {
+	var events []byte
+
+	for index := 0; index < len(state.ContentBlocks); index++ {
+		block, ok := state.ContentBlocks[index]
+		if !ok || block.Type != ContentTypeToolUse || block.StartSent || block.ToolName == "" || block.ToolCallIndex == exceptIndex {
+			continue
+		}
+
+		if block.ToolCallID == "" {
+			block.ToolCallID = fmt.Sprintf("toolu_idx%d", block.ToolCallIndex)
+		}
+
+		events = append(events, FormatSSEEvent("content_block_start", map[string]any{
+			"type":  "content_block_start",
+			"index": index,
+			"content_block": map[string]any{
+				"type":  ContentTypeToolUse,
+				"id":    block.ToolCallID,
+				"name":  block.ToolName,
+				"input": map[string]any{},
+			},
+		})...)
+		block.StartSent = true
+
+		if block.Arguments != "" {
+			block.SentArguments += block.Arguments
+			events = append(events, FormatSSEEvent("content_block_delta", map[string]any{
+				"type":  "content_block_delta",
+				"index": index,
+				"delta": map[string]any{
+					"type":         "input_json_delta",
+					"partial_json": block.Arguments,
+				},
+			})...)
+		}
+	}
+
+	return events
+}
+
+// repairToolInputs completes the input JSON of open tool_use blocks whose arguments stopped
+// mid-value (typically a stream cut at max_tokens), so that clients can parse it. Input
+// that can't be completed is reported in the state's warnings.
+func repairToolInputs(state *StreamState) []byte {
+	var events []byte
+
+	for index := 0; index < len(state.ContentBlocks); index++ {
+		block, ok := state.ContentBlocks[index]
+		if !ok || block.Type != ContentTypeToolUse || !block.StartSent || block.StopSent ||
+			block.SentArguments == "" || json.Valid([]byte(block.SentArguments)) {
+			continue
+		}
+
+		completion, ok := completeJSON(block.SentArguments)
+		if !ok {
+			state.Warnings = append(state.Warnings,
+				fmt.Sprintf("arguments of tool call %s (%s) are not valid JSON and could not be completed", block.ToolName, block.ToolCallID))
+
+			continue
+		}
+
+		block.SentArguments += completion
+		state.Warnings = append(state.Warnings,
+			fmt.Sprintf("arguments of tool call %s (%s) were truncated and completed with %q", block.ToolName, block.ToolCallID, completion))
+
+		events = append(events, FormatSSEEvent("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]any{
+				"type":         "input_json_delta",
+				"partial_json": completion,
+			},
+		})...)
+	}
+
+	return events
+}
+
+// jsonValueCompletions finish a value cut short after the open strings are closed: nothing,
+// a missing value or key, or the rest of a literal
+var jsonValueCompletions = []string{"", "null", ":null", `"":null`, "0", "e", "ue", "rue", "l", "ll", "ull", "se", "lse", "alse"}
+
+// completeJSON returns text that makes the truncated JSON document partial valid, closing
+// its open string, objects and arrays
+func completeJSON(partial string) (string, bool) {
+	var (
+		closers  []byte
+		inString bool
+		escaped  bool
+	)
+
+	for i := 0; i < len(partial); i++ {
+		c := partial[i]
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			closers = append(closers, '}')
+		case c == '[':
+			closers = append(closers, ']')
+		case c == '}' || c == ']':
+			if len(closers) == 0 || closers[len(closers)-1] != c {
+				return "", false
+			}
+
+			closers = closers[:len(closers)-1]
+		}
+	}
+
+	var prefix strings.Builder
+
+	if escaped {
+		prefix.WriteByte('\\')
+	}
+
+	if inString {
+		prefix.WriteByte('"')
+	}
+
+	suffix := make([]byte, 0, len(closers))
+	for i := len(closers) - 1; i >= 0; i-- {
+		suffix = append(suffix, closers[i])
+	}
+
+	for _, value := range jsonValueCompletions {
+		completion := prefix.String() + value + string(suffix)
+		if json.Valid([]byte(partial + completion)) {
+			return completion, true
+		}
+	}
+
+	return "", false
+}
+
 // HandleFinishReason processes finish reasons and sends appropriate events
 func HandleFinishReason(p ProviderInterface, reason string, chunk map[string]any, state *StreamState, getUsage func(map[string]any) map[string]any) []byte {
+	// Some upstreams repeat the finish reason (OpenRouter's usage chunk); the message is already complete
+	if state.MessageStopSent {
+		return nil
+	}
+
 	var events []byte
 
+	// Tool calls whose id never arrived are started now so they aren't lost
+	events = append(events, startPendingToolBlocks(state, -1)...)
+
+	// Truncated tool arguments are completed before their blocks stop
+	events = append(events, repairToolInputs(state)...)
+
 	// Send content_block_stop for all active content blocks
 	for index, contentBlock := range state.ContentBlocks {
 		if contentBlock.StartSent && !contentBlock.StopSent {
@@ -245,19 +443,101 @@ func HandleFinishReason(p ProviderInterface, reason string, chunk map[string]any
 	if getUsage != nil {
 		usageData := getUsage(chunk)
 		if len(usageData) > 0 {
+			state.Usage.add(usageData)
 			messageDeltaEvent["usage"] = usageData
 		}
 	}
 
-	events = append(events, p.formatSSEEvent("message_delta", messageDeltaEvent)...)
+	state.finalDelta = messageDeltaEvent
+
+	// Usage that follows the finish reason (OpenAI's trailing chunk) is still to come
+	if !state.Usage.Reported {
+		return events
+	}
 
-	// Send message_stop
-	messageStopEvent := map[string]any{
+	return append(events, finishMessage(state)...)
+}
+
+// FinishStream sends the message_delta and message_stop still held back for usage when
+// the upstream stream ends. It returns nothing once the message is complete.
+func FinishStream(state *StreamState) []byte {
+	if state == nil || state.finalDelta == nil {
+		return nil
+	}
+
+	return finishMessage(state)
+}
+
+// finishMessage sends the held back message_delta, carrying the accumulated usage, and message_stop
+func finishMessage(state *StreamState) []byte {
+	messageDeltaEvent := state.finalDelta
+	state.finalDelta = nil
+	state.MessageStopSent = true
+
+	usage, _ := messageDeltaEvent["usage"].(map[string]any)
+	if usage == nil {
+		usage = make(map[string]any)
+	}
+
+	state.Usage.applyTo(usage)
+
+	if len(usage) > 0 {
+		messageDeltaEvent["usage"] = usage
+	}
+
+	events := FormatSSEEvent("message_delta", messageDeltaEvent)
+
+	return append(events, FormatSSEEvent("message_stop", map[string]any{
 		"type": "message_stop",
+	})...)
+}
+
+// add records the counts present in an Anthropic-format usage map
+func (u *StreamUsage) add(usage map[string]any) {
+	for key, field := range map[string]*int{
+		"input_tokens":                &u.InputTokens,
+		"output_tokens":               &u.OutputTokens,
+		"cache_read_input_tokens":     &u.CacheReadInputTokens,
+		"cache_creation_input_tokens": &u.CacheCreationInputTokens,
+	} {
+		if count, ok := usageCount(usage[key]); ok {
+			*field = count
+			u.Reported = true
+		}
 	}
-	events = append(events, p.formatSSEEvent("message_stop", messageStopEvent)...)
+}
 
-	return events
+// applyTo writes the accumulated counts into a message_delta usage map
+func (u *StreamUsage) applyTo(usage map[string]any) {
+	if !u.Reported {
+		return
+	}
+
+	usage["input_tokens"] = u.InputTokens
+	usage["output_tokens"] = u.OutputTokens
+
+	if u.CacheReadInputTokens > 0 {
+		usage["cache_read_input_tokens"] = u.CacheReadInputTokens
+	}
+
+	if u.CacheCreationInputTokens > 0 {
+		usage["cache_creation_input_tokens"] = u.CacheCreationInputTokens
+	}
+}
+
+// usageCount reads a token count decoded from JSON or set by Go code
+func usageCount(value any) (int, bool) {
+	switch count := value.(type) {
+	case float64:
+		return int(count), true
+	case int:
+		return count, true
+	case json.Number:
+		n, err := count.Int64()
+		return int(n), err == nil
+	default:
+		return 0, false
+	}
 }
 
 // StreamProviderInterface extends ProviderInterface for stream processing
@@ -268,6 +548,13 @@ type StreamProviderInterface interface {
 	handleToolCalls(toolCalls []any, state *StreamState) []byte
 	handleTextContent(content string, state *StreamState) []byte
 	handleFinishReason(reason string, chunk map[string]any, state *StreamState) []byte
+	convertUsage(usage map[string]any) map[string]any
+}
+
+// reasoningStreamProvider is implemented by providers whose models stream their
+// reasoning in a separate reasoning_content field
+type reasoningStreamProvider interface {
+	handleReasoningContent(reasoning string, state *StreamState) []byte
 }
 
 // ConvertOpenAIStyleToAnthropicStream handles OpenAI-style streaming responses (OpenAI/Nvidia)
@@ -288,6 +575,10 @@ func ConvertOpenAIStyleToAnthropicStream(data []byte, state *StreamState, provid
 		state.Model = model
 	}
 
+	if usage, ok := rawChunk["usage"].(map[string]any); ok {
+		state.Usage.add(provider.convertUsage(usage))
+	}
+
 	// Handle choices array
 	if choices, ok := rawChunk["choices"].([]any); ok && len(choices) > 0 {
 		if firstChoice, ok := choices[0].(map[string]any); ok {
@@ -305,6 +596,13 @@ func ConvertOpenAIStyleToAnthropicStream(data []byte, state *StreamState, provid
 					state.ContentBlocks = make(map[int]*ContentBlockState)
 				}
 
+				// Reasoning arrives ahead of the answer and becomes a thinking block
+				if reasoning, ok := delta["reasoning_content"].(string); ok && reasoning != "" {
+					if reasoningProvider, ok := provider.(reasoningStreamProvider); ok {
+						events = append(events, reasoningProvider.handleReasoningContent(reasoning, state)...)
+					}
+				}
+
 				// Check if we have tool calls - if so, prioritize them over text content
 				if toolCalls, ok := delta["tool_calls"].([]any); ok {
 					toolEvents := provider.handleToolCalls(toolCalls, state)
@@ -313,6 +611,10 @@ func ConvertOpenAIStyleToAnthropicStream(data []byte, state *StreamState, provid
 					// Only handle text content if no tool calls are present
 					textEvents := provider.handleTextContent(content, state)
 					events = append(events, textEvents...)
+				} else if refusal, ok := delta["refusal"].(string); ok && refusal != "" {
+					// Refusals are surfaced to the client as regular text
+					textEvents := provider.handleTextContent(refusal, state)
+					events = append(events, textEvents...)
 				}
 			}
 
@@ -326,9 +628,103 @@ func ConvertOpenAIStyleToAnthropicStream(data []byte, state *StreamState, provid
 		}
 	}
 
+	// The usage chunk after the finish reason completes the message
+	if state.finalDelta != nil && state.Usage.Reported {
+		events = append(events, finishMessage(state)...)
+	}
+
 	return events, nil
 }
 
+// ResponseFormat describes a structured output request. A nil Schema means plain JSON output.
+type ResponseFormat struct {
+	Name   string
+	Schema map[string]any
+	Strict bool
+}
+
+// ExtractResponseFormat reads a structured output request from either Anthropic's
+// output_format or an OpenAI-style response_format field
+func ExtractResponseFormat(request map[string]any) *ResponseFormat {
+	format, ok := request["output_format"].(map[string]any)
+	if !ok {
+		format, ok = request["response_format"].(map[string]any)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	switch format["type"] {
+	case "json_schema":
+		responseFormat := &ResponseFormat{Name: "response"}
+
+		// OpenAI nests the schema under json_schema, Anthropic puts it on the format itself
+		if jsonSchema, ok := format["json_schema"].(map[string]any); ok {
+			if name, ok := jsonSchema["name"].(string); ok && name != "" {
+				responseFormat.Name = name
+			}
+
+			responseFormat.Schema, _ = jsonSchema["schema"].(map[string]any)
+			responseFormat.Strict, _ = jsonSchema["strict"].(bool)
+		} else {
+			responseFormat.Schema, _ = format["schema"].(map[string]any)
+			responseFormat.Strict = true
+		}
+
+		return responseFormat
+	case "json_object":
+		return &ResponseFormat{}
+	}
+
+	return nil
+}
+
+// ToolErrorPrefix marks the content of a failed tool call in formats without an error flag
+const ToolErrorPrefix = "Error: "
+
+// TransformToolResultContent returns the content of a tool_result block for an OpenAI tool
+// message. OpenAI has no is_error flag, so the content of failed calls is prefixed with
+// ToolErrorPrefix to keep the model from reading it as output.
+func TransformToolResultContent(block map[string]any) any {
+	content := block["content"]
+
+	if isError, _ := block["is_error"].(bool); !isError {
+		return content
+	}
+
+	switch c := content.(type) {
+	case string:
+		return ToolErrorPrefix + c
+	case []any:
+		if len(c) == 0 {
+			break
+		}
+
+		parts := make([]any, 0, len(c)+1)
+
+		if first, ok := c[0].(map[string]any); ok && first["type"] == "text" {
+			text, _ := first["text"].(string)
+
+			marked := make(map[string]any, len(first))
+			for key, value := range first {
+				marked[key] = value
+			}
+
+			marked["text"] = ToolErrorPrefix + text
+			parts = append(parts, marked)
+			c = c[1:]
+		} else {
+			parts = append(parts, map[string]any{"type": "text", "text": strings.TrimSuffix(ToolErrorPrefix, " ")})
+		}
+
+		return append(parts, c...)
+	}
+
+	// Without content there is nothing to mark, only the failure to report
+	return strings.TrimSuffix(ToolErrorPrefix, ": ")
+}
+
 // TransformAssistantMessage converts assistant messages with tool_use to tool_calls format
 func TransformAssistantMessage(msgMap map[string]any, content []any) map[string]any {
 	transformedMsg := make(map[string]any)
@@ -381,9 +777,14 @@ func TransformAssistantMessage(msgMap map[string]any, content []any) map[string]
 		}
 	}
 
-	if textContent.Len() > 0 {
+	// Several OpenAI-compatible providers reject an empty string next to tool_calls and
+	// expect null, as OpenAI itself sends
+	switch {
+	case textContent.Len() > 0:
 		transformedMsg["content"] = textContent.String()
-	} else {
+	case len(toolCalls) > 0:
+		transformedMsg["content"] = nil
+	default:
 		transformedMsg["content"] = ""
 	}
 
@@ -439,6 +840,71 @@ func TransformTools(tools []any) ([]any, error) {
 	return transformedTools, nil
 }
 
+// TransformToolChoice converts an Anthropic tool_choice to the OpenAI form: auto stays
+// auto, any becomes required, none stays none and {type:tool,name} forces that function.
+// Values already in OpenAI form pass through. Unknown forms return nil.
+func TransformToolChoice(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		if _, isString := toolChoice.(string); isString {
+			return toolChoice
+		}
+
+		return nil
+	}
+
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		name, _ := choice["name"].(string)
+		if name == "" {
+			return nil
+		}
+
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": name},
+		}
+	case "function":
+		return choice
+	}
+
+	return nil
+}
+
+// metadataUserID returns the end-user id Anthropic requests carry in metadata.user_id
+func metadataUserID(request map[string]any) string {
+	metadata, _ := request["metadata"].(map[string]any)
+	userID, _ := metadata["user_id"].(string)
+
+	return userID
+}
+
+// DetectStreaming reports whether response headers announce a stream: an event-stream
+// content type, or chunked transfer encoding, which some providers stream JSON with
+func DetectStreaming(headers map[string][]string) bool {
+	for _, ct := range headers["Content-Type"] {
+		if strings.Contains(strings.ToLower(ct), "stream") {
+			return true
+		}
+	}
+
+	for _, te := range headers["Transfer-Encoding"] {
+		for _, coding := range strings.Split(te, ",") {
+			if strings.EqualFold(strings.TrimSpace(coding), TransferEncodingChunked) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // OpenAITransformerInterface defines methods that OpenAI-compatible providers need
 type OpenAITransformerInterface interface {
 	removeAnthropicSpecificFields(request map[string]any) map[string]any
@@ -446,6 +912,34 @@ type OpenAITransformerInterface interface {
 	transformTools(tools []any) ([]any, error)
 }
 
+// maxTopLogprobs is the most alternatives per token OpenAI returns
+const maxTopLogprobs = 20
+
+// normalizeLogprobs passes logprobs and top_logprobs through in a form OpenAI accepts: a
+// non-boolean logprobs or non-numeric top_logprobs is dropped, top_logprobs is clamped to
+// 0-20, and asking for top_logprobs turns logprobs on unless it was turned off explicitly,
+// since OpenAI rejects top_logprobs without it
+func normalizeLogprobs(request map[string]any) {
+	logprobs, hasLogprobs := request["logprobs"].(bool)
+	if !hasLogprobs {
+		delete(request, "logprobs")
+	}
+
+	topLogprobs, hasTopLogprobs := request["top_logprobs"]
+	if !hasTopLogprobs {
+		return
+	}
+
+	count, ok := topLogprobs.(float64)
+	if !ok || (hasLogprobs && !logprobs) {
+		delete(request, "top_logprobs")
+		return
+	}
+
+	request["top_logprobs"] = int(min(max(count, 0), maxTopLogprobs))
+	request["logprobs"] = true
+}
+
 // TransformAnthropicToOpenAI is a shared transformation function for OpenAI-compatible providers
 func TransformAnthropicToOpenAI(anthropicRequest []byte, transformer OpenAITransformerInterface) ([]byte, error) {
 	var request map[string]any
@@ -453,9 +947,16 @@ func TransformAnthropicToOpenAI(anthropicRequest []byte, transformer OpenAITrans
 		return nil, fmt.Errorf("failed to unmarshal Anthropic request: %w", err)
 	}
 
+	// metadata is usually stripped below, but its user_id maps to OpenAI's user field
+	userID := metadataUserID(request)
+
 	// Remove Anthropic-specific fields that OpenAI doesn't support
 	cleanedRequest := transformer.removeAnthropicSpecificFields(request)
 
+	if _, hasUser := cleanedRequest["user"]; !hasUser && userID != "" {
+		cleanedRequest["user"] = userID
+	}
+
 	// Handle system parameter - convert it to a system message in messages array
 	if systemContent, hasSystem := cleanedRequest["system"]; hasSystem {
 		if messages, ok := cleanedRequest["messages"].([]any); ok {
@@ -479,6 +980,32 @@ func TransformAnthropicToOpenAI(anthropicRequest []byte, transformer OpenAITrans
 		delete(cleanedRequest, "max_tokens")
 	}
 
+	// Map structured output requests to OpenAI's response_format
+	if responseFormat := ExtractResponseFormat(cleanedRequest); responseFormat != nil {
+		if responseFormat.Schema != nil {
+			cleanedRequest["response_format"] = map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   responseFormat.Name,
+					"schema": responseFormat.Schema,
+					"strict": responseFormat.Strict,
+				},
+			}
+		} else {
+			cleanedRequest["response_format"] = map[string]any{"type": "json_object"}
+		}
+	}
+
+	delete(cleanedRequest, "output_format")
+
+	// Anthropic responses carry a single candidate and only choices[0] is converted, so
+	// extra choices would be billed and then discarded
+	if n, ok := cleanedRequest["n"].(float64); ok && n > 1 {
+		cleanedRequest["n"] = 1
+	}
+
+	normalizeLogprobs(cleanedRequest)
+
 	// Transform any Anthropic-specific message formats if needed
 	if messages, ok := cleanedRequest["messages"].([]any); ok {
 		cleanedRequest["messages"] = transformer.transformMessages(messages)
@@ -501,9 +1028,52 @@ func TransformAnthropicToOpenAI(anthropicRequest []byte, transformer OpenAITrans
 		}
 	}
 
+	if toolChoice, hasToolChoice := cleanedRequest["tool_choice"]; hasToolChoice {
+		// Anthropic nests the parallel tool use switch in tool_choice
+		if choice, ok := toolChoice.(map[string]any); ok && choice["disable_parallel_tool_use"] == true {
+			cleanedRequest["parallel_tool_calls"] = false
+		}
+
+		if converted := TransformToolChoice(toolChoice); converted != nil {
+			cleanedRequest["tool_choice"] = converted
+		} else {
+			delete(cleanedRequest, "tool_choice")
+		}
+	}
+
 	return json.Marshal(cleanedRequest)
 }
 
+// SetSystemRole renames the system messages of an OpenAI chat request to role, for models
+// that take their instructions as "developer" messages. Other requests are returned unchanged.
+func SetSystemRole(openAIRequest []byte, role string) ([]byte, error) {
+	if role == "" || role == "system" {
+		return openAIRequest, nil
+	}
+
+	var request map[string]any
+	if err := json.Unmarshal(openAIRequest, &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OpenAI request: %w", err)
+	}
+
+	messages, _ := request["messages"].([]any)
+
+	renamed := false
+
+	for _, message := range messages {
+		if msg, ok := message.(map[string]any); ok && msg["role"] == "system" {
+			msg["role"] = role
+			renamed = true
+		}
+	}
+
+	if !renamed {
+		return openAIRequest, nil
+	}
+
+	return json.Marshal(request)
+}
+
 // Common response structures
 type CommonResponse struct {
 	ID      string                 `json:"id"`
@@ -527,6 +1097,7 @@ type CommonChoice struct {
 type CommonMessage struct {
 	Role         string                 `json:"role,omitempty"`
 	Content      *string                `json:"content,omitempty"`
+	Refusal      *string                `json:"refusal,omitempty"`
 	ToolCalls    []CommonToolCall       `json:"tool_calls,omitempty"`
 	ToolCallID   *string                `json:"tool_call_id,omitempty"`
 	FunctionCall *CommonFunctionCall    `json:"function_call,omitempty"`
@@ -544,8 +1115,18 @@ type CommonFunctionCall struct {
 }
 
 type CommonUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	PromptTokensDetails     *CommonPromptDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CommonCompletionDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type CommonPromptDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type CommonCompletionDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
 }
 
 // Anthropic response structures
@@ -571,8 +1152,11 @@ type AnthropicContent struct {
 }
 
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+	// ReasoningTokens is the part of OutputTokens spent on reasoning (not an Anthropic field)
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
 }
 
 type AnthropicError struct {
@@ -633,8 +1217,11 @@ func ConvertToAnthropic(responseData []byte, errorTypeMapper func(string) string
 
 	anthropicResp.Content = content
 
-	// Convert stop reason
-	if choice.FinishReason != nil {
+	// Convert stop reason; a refusal is a complete answer rather than a filtered one
+	if message.Refusal != nil && *message.Refusal != "" {
+		stopReason := "end_turn"
+		anthropicResp.StopReason = &stopReason
+	} else if choice.FinishReason != nil {
 		stopReason := ConvertStopReason(*choice.FinishReason)
 		anthropicResp.StopReason = stopReason
 	}
@@ -645,6 +1232,15 @@ func ConvertToAnthropic(responseData []byte, errorTypeMapper func(string) string
 			InputTokens:  commonResp.Usage.PromptTokens,
 			OutputTokens: commonResp.Usage.CompletionTokens,
 		}
+
+		if details := commonResp.Usage.PromptTokensDetails; details != nil {
+			usage.CacheReadInputTokens = details.CachedTokens
+		}
+
+		if details := commonResp.Usage.CompletionTokensDetails; details != nil {
+			usage.ReasoningTokens = details.ReasoningTokens
+		}
+
 		anthropicResp.Usage = usage
 	}
 
@@ -660,6 +1256,12 @@ func convertMessageContent(message *CommonMessage, toolCallIDConverter func(stri
 			Type: "text",
 			Text: message.Content,
 		})
+	} else if message.Refusal != nil && *message.Refusal != "" {
+		// Newer OpenAI models return refusals in a dedicated field instead of content
+		content = append(content, AnthropicContent{
+			Type: "text",
+			Text: message.Refusal,
+		})
 	}
 
 	// Handle tool calls
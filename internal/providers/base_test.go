@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transformStreamChunks runs the chunks through the provider as one stream, including the
+// end-of-stream flush, and returns the usage of the final message_delta
+func transformStreamChunks(t *testing.T, provider Provider, chunks []map[string]any) (string, map[string]any) {
+	t.Helper()
+
+	state := &StreamState{}
+
+	var stream strings.Builder
+
+	for _, chunk := range chunks {
+		chunkJSON, err := json.Marshal(chunk)
+		require.NoError(t, err)
+
+		events, err := provider.TransformStream(chunkJSON, state)
+		require.NoError(t, err)
+
+		stream.Write(events)
+	}
+
+	stream.Write(FinishStream(state))
+
+	var usage map[string]any
+
+	for _, line := range strings.Split(stream.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		if event["type"] == "message_delta" {
+			require.Nil(t, usage, "only one message_delta may be sent")
+			usage, _ = event["usage"].(map[string]any)
+		}
+	}
+
+	require.Equal(t, 1, strings.Count(stream.String(), "event: message_stop"))
+
+	return stream.String(), usage
+}
+
+func TestStreamUsage_LatestReportWins(t *testing.T) {
+	var usage StreamUsage
+
+	usage.add(map[string]any{"input_tokens": 10, "output_tokens": 1})
+	usage.add(map[string]any{"output_tokens": float64(7), "cache_read_input_tokens": float64(4)})
+	usage.add(map[string]any{"server_tool_use": map[string]any{"web_search_requests": 1}})
+
+	assert.Equal(t, StreamUsage{
+		InputTokens:          10,
+		OutputTokens:         7,
+		CacheReadInputTokens: 4,
+		Reported:             true,
+	}, usage)
+
+	delta := map[string]any{"server_tool_use": "kept"}
+	usage.applyTo(delta)
+
+	assert.Equal(t, map[string]any{
+		"input_tokens":            10,
+		"output_tokens":           7,
+		"cache_read_input_tokens": 4,
+		"server_tool_use":         "kept",
+	}, delta)
+}
+
+func TestDetectStreaming(t *testing.T) {
+	testCases := []struct {
+		name     string
+		headers  map[string][]string
+		expected bool
+	}{
+		{"event stream", map[string][]string{"Content-Type": {"text/event-stream; charset=utf-8"}}, true},
+		{"chunked JSON", map[string][]string{"Content-Type": {"application/json"}, "Transfer-Encoding": {"chunked"}}, true},
+		{"chunked only", map[string][]string{"Transfer-Encoding": {"chunked"}}, true},
+		{"chunked after another coding", map[string][]string{"Transfer-Encoding": {"gzip, Chunked"}}, true},
+		{"plain JSON", map[string][]string{"Content-Type": {"application/json"}}, false},
+		{"no headers", map[string][]string{}, false},
+	}
+
+	providers := []Provider{
+		NewAnthropicProvider(),
+		NewOpenAIProvider(),
+		NewOpenRouterProvider(),
+		NewNvidiaProvider(),
+		NewGeminiProvider(),
+		NewMockProvider("", nil),
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DetectStreaming(tc.headers))
+
+			for _, provider := range providers {
+				assert.Equal(t, tc.expected, provider.IsStreaming(tc.headers), provider.Name())
+			}
+		})
+	}
+}
+
+func TestCompleteJSON(t *testing.T) {
+	testCases := []struct {
+		partial  string
+		expected string
+		ok       bool
+	}{
+		{`{"path":"/tmp/a`, `"}`, true},
+		{`{"path":"/tmp/a"`, `}`, true},
+		{`{"path":`, `null}`, true},
+		{`{"path":"/tmp/a",`, `"":null}`, true},
+		{`{"pa`, `":null}`, true},
+		{`{"edits":[{"old":"a","new":"b"},`, `null]}`, true},
+		{`{"recursive":tr`, `ue}`, true},
+		{`{"text":"brace } and quote \" inside`, `"}`, true},
+		{`{"text":"ends with a backslash \`, `\"}`, true},
+		{`{"a":1}}`, ``, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.partial, func(t *testing.T) {
+			completion, ok := completeJSON(tc.partial)
+			require.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, completion)
+
+			if ok {
+				assert.True(t, json.Valid([]byte(tc.partial+completion)))
+			}
+		})
+	}
+}
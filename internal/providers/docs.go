@@ -87,10 +87,11 @@ Each provider implements bidirectional transformations between Claude and provid
 ```
 
 #### Tool Choice Validation
-- **Removes** `tool_choice` when no tools are provided
-- **Removes** `tool_choice` when tools array is empty or null
-- **Preserves** `tool_choice` when valid tools are present
-- **Prevents** "tool_choice may only be specified while providing tools" errors
+  - **Removes** `tool_choice` when no tools are provided
+  - **Removes** `tool_choice` when tools array is empty or null
+  - **Preserves** `tool_choice` when valid tools are present, converted to the OpenAI form
+    (`auto` → `"auto"`, `any` → `"required"`, `{type: tool, name}` → `{type: function, function: {name}}`)
+  - **Prevents** "tool_choice may only be specified while providing tools" errors
 
 ## Implementation Steps
 
@@ -145,15 +146,8 @@ Create a new provider struct and implement basic methods:
 Implement IsStreaming to detect if a response is streamed:
 
 	func (p *NewProvider) IsStreaming(headers map[string][]string) bool {
-		// Check for streaming indicators in response headers
-		if contentType, ok := headers["Content-Type"]; ok {
-			for _, ct := range contentType {
-				if ct == "text/event-stream" || strings.Contains(ct, "stream") {
-					return true
-				}
-			}
-		}
-		return false
+		// Event-stream content types and chunked transfer encoding
+		return DetectStreaming(headers)
 	}
 
 ### 3. Request Transformation
@@ -421,12 +415,21 @@ Generate events in Claude's expected format:
 
 **Tool Choice Validation:**
 - `tool_choice` removed if `tools` is missing, null, or empty array
-- `tool_choice` preserved if valid `tools` array is provided
+- `tool_choice` preserved if valid `tools` array is provided, converted with `TransformToolChoice`
+- `disable_parallel_tool_use` → `parallel_tool_calls: false`
+
+**Tool Results:**
+- `tool_result` → `{"role": "tool", "tool_call_id": ...}` message
+- `is_error: true` → content prefixed with `ToolErrorPrefix` ("Error: "); Gemini gets `functionResponse.response.error` instead
+
+**Metadata:**
+- `metadata.user_id` → `user` (metadata itself is removed unless `store` is true)
 
 **Usage/Tokens:**
 - `usage.prompt_tokens` → `usage.input_tokens`
 - `usage.completion_tokens` → `usage.output_tokens`
 - `usage.prompt_tokens_details.cached_tokens` → `usage.cache_read_input_tokens`
+- `usage.completion_tokens_details.reasoning_tokens` → `usage.reasoning_tokens` (non-streaming OpenAI and Nvidia responses; already included in `output_tokens`)
 - `usage.cache_creation_input_tokens` → `usage.cache_creation_input_tokens` (preserved)
 - `usage.server_tool_use.web_search_requests` → `usage.server_tool_use.web_search_requests` (preserved)
 
@@ -491,6 +494,18 @@ Generate events in Claude's expected format:
 - Test web search responses with annotations
 - Verify Claude format compliance and SSE event structure
 
+### Whole Streams
+ProcessSSEStream runs a recorded upstream SSE stream through TransformStream with one
+StreamState, as the proxy does, and returns the Anthropic events in order:
+
+	events, err := ProcessSSEStream(strings.NewReader(recorded), NewOpenAIProvider())
+
+Both split the upstream lines into events with SSEDecoder, so a stream that passes here
+is read the same way by the proxy.
+
+stream_test.go checks recorded streams for a valid event sequence; add one when a
+provider's stream format changes.
+
 ## Registration
 
 Add provider to registry in `registry.go`:
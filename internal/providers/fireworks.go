@@ -0,0 +1,17 @@
+package providers
+
+// FireworksProvider targets Fireworks AI's OpenAI-compatible chat completions API.
+// Model IDs are account-scoped paths (e.g. accounts/fireworks/models/...), which pass
+// through the provider,model routing unchanged.
+type FireworksProvider struct {
+	*OpenAIProvider
+}
+
+func NewFireworksProvider() *FireworksProvider {
+	return &FireworksProvider{
+		OpenAIProvider: &OpenAIProvider{
+			name:     "fireworks",
+			endpoint: "https://api.fireworks.ai/inference/v1/chat/completions",
+		},
+	}
+}
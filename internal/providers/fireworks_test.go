@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireworksProvider_BasicMethods(t *testing.T) {
+	provider := NewFireworksProvider()
+
+	assert.Equal(t, "fireworks", provider.Name())
+	assert.True(t, provider.SupportsStreaming())
+	assert.Equal(t, "https://api.fireworks.ai/inference/v1/chat/completions", provider.GetEndpoint())
+
+	provider.SetAPIKey("test-key")
+	assert.Equal(t, "test-key", provider.apiKey)
+}
+
+func TestFireworksProvider_ModelIDWithSlashes(t *testing.T) {
+	providerName, model := ExtractModelFromConfig("fireworks,accounts/fireworks/models/llama-v3p1-405b-instruct")
+
+	assert.Equal(t, "fireworks", providerName)
+	assert.Equal(t, "accounts/fireworks/models/llama-v3p1-405b-instruct", model)
+}
+
+func TestFireworksProvider_TransformRequest(t *testing.T) {
+	provider := NewFireworksProvider()
+
+	anthropicRequest := map[string]any{
+		"model":      "accounts/fireworks/models/llama-v3p1-405b-instruct",
+		"system":     "You are a helpful assistant",
+		"max_tokens": 100,
+		"messages": []any{
+			map[string]any{
+				"role":    "user",
+				"content": "Hello, world!",
+			},
+		},
+	}
+
+	anthropicJSON, err := json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err := provider.TransformRequest(anthropicJSON)
+	require.NoError(t, err)
+
+	var fireworksReq map[string]any
+	err = json.Unmarshal(result, &fireworksReq)
+	require.NoError(t, err)
+
+	// Model ID must pass through untouched
+	assert.Equal(t, "accounts/fireworks/models/llama-v3p1-405b-instruct", fireworksReq["model"])
+
+	assert.NotContains(t, fireworksReq, "system", "system field should be removed from root")
+	messages, ok := fireworksReq["messages"].([]any)
+	require.True(t, ok, "messages should be an array")
+	require.Len(t, messages, 2, "should have system + user message")
+	assert.Equal(t, "system", messages[0].(map[string]any)["role"])
+	assert.Equal(t, float64(100), fireworksReq["max_completion_tokens"])
+}
+
+func TestFireworksProvider_Transform(t *testing.T) {
+	provider := NewFireworksProvider()
+
+	fireworksResponse := map[string]any{
+		"id":    "fw-123",
+		"model": "accounts/fireworks/models/llama-v3p1-405b-instruct",
+		"choices": []map[string]any{
+			{
+				"index": 0,
+				"message": map[string]any{
+					"role":    "assistant",
+					"content": "Hello from Fireworks",
+				},
+				"finish_reason": "stop",
+			},
+		},
+		"usage": map[string]any{
+			"prompt_tokens":     9,
+			"completion_tokens": 4,
+		},
+	}
+
+	fireworksJSON, err := json.Marshal(fireworksResponse)
+	require.NoError(t, err)
+
+	result, err := provider.TransformResponse(fireworksJSON)
+	require.NoError(t, err)
+
+	var anthropicResp map[string]any
+	err = json.Unmarshal(result, &anthropicResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, "message", anthropicResp["type"])
+	assert.Equal(t, "accounts/fireworks/models/llama-v3p1-405b-instruct", anthropicResp["model"])
+	assert.Equal(t, "end_turn", anthropicResp["stop_reason"])
+
+	content, ok := anthropicResp["content"].([]any)
+	require.True(t, ok)
+	require.Len(t, content, 1)
+	assert.Equal(t, "Hello from Fireworks", content[0].(map[string]any)["text"])
+}
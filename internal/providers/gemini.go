@@ -1,11 +1,16 @@
 package providers
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 )
 
 type GeminiProvider struct {
@@ -41,23 +46,7 @@ func (p *GeminiProvider) SetAPIKey(key string) {
 }
 
 func (p *GeminiProvider) IsStreaming(headers map[string][]string) bool {
-	if contentType, ok := headers["Content-Type"]; ok {
-		for _, ct := range contentType {
-			if ct == "text/event-stream" || strings.Contains(ct, "stream") {
-				return true
-			}
-		}
-	}
-
-	if transferEncoding, ok := headers["Transfer-Encoding"]; ok {
-		for _, te := range transferEncoding {
-			if te == "chunked" {
-				return true
-			}
-		}
-	}
-
-	return false
+	return DetectStreaming(headers)
 }
 
 func (p *GeminiProvider) TransformRequest(request []byte) ([]byte, error) {
@@ -99,6 +88,8 @@ type geminiContent struct {
 
 type geminiPart struct {
 	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
 	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
 }
@@ -157,6 +148,31 @@ func (p *GeminiProvider) convertGeminiToAnthropic(geminiData []byte) ([]byte, er
 		return json.Marshal(anthropicResp)
 	}
 
+	// A blocked prompt gets no candidates at all; like a stream, the answer says so in a text
+	// block rather than with an error body sent under a 200 status
+	if len(geminiResp.Candidates) == 0 && geminiResp.PromptFeedback != nil && geminiResp.PromptFeedback.BlockReason != "" {
+		reason := geminiResp.PromptFeedback.BlockReason
+		message := geminiBlockMessage("prompt", reason, geminiResp.PromptFeedback.SafetyRatings)
+
+		anthropicResp := anthropicResponse{
+			ID:         geminiResp.ResponseID,
+			Type:       "message",
+			Role:       "assistant",
+			Model:      geminiResp.ModelVersion,
+			Content:    []anthropicContent{{Type: "text", Text: &message}},
+			StopReason: p.convertStopReason(reason),
+		}
+
+		if geminiResp.UsageMetadata != nil {
+			anthropicResp.Usage = &anthropicUsage{
+				InputTokens:  geminiResp.UsageMetadata.PromptTokenCount,
+				OutputTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+			}
+		}
+
+		return json.Marshal(anthropicResp)
+	}
+
 	// Handle streaming vs non-streaming responses
 	if len(geminiResp.Candidates) == 0 {
 		return nil, errors.New("no candidates in Gemini response")
@@ -172,7 +188,13 @@ func (p *GeminiProvider) convertGeminiToAnthropic(geminiData []byte) ([]byte, er
 	}
 
 	// Convert content
-	content := p.convertGeminiContent(candidate.Content)
+	content := p.convertGeminiContent(candidate.Content, geminiResp.ResponseID)
+
+	// A blocked candidate comes without content; say so rather than answer with empty text
+	if geminiBlockedReasons[candidate.FinishReason] && !hasGeminiOutput(candidate.Content) {
+		message := geminiBlockMessage("response", candidate.FinishReason, candidate.SafetyRatings)
+		content = []anthropicContent{{Type: "text", Text: &message}}
+	}
 
 	anthropicResp.Content = content
 
@@ -193,7 +215,59 @@ func (p *GeminiProvider) convertGeminiToAnthropic(geminiData []byte) ([]byte, er
 	return json.Marshal(anthropicResp)
 }
 
-func (p *GeminiProvider) convertGeminiContent(content *geminiContent) []anthropicContent {
+// geminiBlockedReasons are the finish reasons for which Gemini withholds the candidate's content
+var geminiBlockedReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// geminiBlockMessage explains a block of the prompt or response, naming the safety categories
+// Gemini flagged
+func geminiBlockMessage(subject, reason string, ratings []geminiSafetyRating) string {
+	var categories []string
+
+	for _, rating := range ratings {
+		if rating.Blocked {
+			categories = append(categories, rating.Category)
+		}
+	}
+
+	// Not every block marks the rating that caused it
+	if len(categories) == 0 {
+		for _, rating := range ratings {
+			if rating.Probability == "HIGH" {
+				categories = append(categories, rating.Category)
+			}
+		}
+	}
+
+	message := fmt.Sprintf("[Gemini blocked the %s: %s", subject, reason)
+	if len(categories) > 0 {
+		message += " (" + strings.Join(categories, ", ") + ")"
+	}
+
+	return message + "]"
+}
+
+// hasGeminiOutput reports whether a candidate's content has any text or function call
+func hasGeminiOutput(content *geminiContent) bool {
+	if content == nil {
+		return false
+	}
+
+	for _, part := range content.Parts {
+		if part.Text != "" || part.FunctionCall != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *GeminiProvider) convertGeminiContent(content *geminiContent, responseID string) []anthropicContent {
 	if content == nil {
 		// Return empty text block if no content
 		emptyText := ""
@@ -206,7 +280,34 @@ func (p *GeminiProvider) convertGeminiContent(content *geminiContent) []anthropi
 
 	var result []anthropicContent
 
+	// Per-response counters and key give each function call and response a unique id
+	var functionCalls, functionResponses int
+
+	responseKey := geminiResponseKey(responseID)
+
 	for _, part := range content.Parts {
+		// Handle thinking content, keeping it out of the visible answer
+		if part.Thought {
+			thinking := anthropicContent{
+				Type:     ContentTypeThinking,
+				Thinking: &part.Text,
+			}
+			if part.ThoughtSignature != "" {
+				thinking.Signature = &part.ThoughtSignature
+			}
+
+			result = append(result, thinking)
+
+			continue
+		}
+
+		// A signature on a later part belongs to the preceding thinking block
+		if part.ThoughtSignature != "" && len(result) > 0 {
+			if last := &result[len(result)-1]; last.Type == ContentTypeThinking && last.Signature == nil {
+				last.Signature = &part.ThoughtSignature
+			}
+		}
+
 		// Handle text content
 		if part.Text != "" {
 			result = append(result, anthropicContent{
@@ -217,7 +318,9 @@ func (p *GeminiProvider) convertGeminiContent(content *geminiContent) []anthropi
 
 		// Handle function calls (tool use)
 		if part.FunctionCall != nil {
-			id := fmt.Sprintf("toolu_%d", time.Now().UnixNano())
+			id := geminiToolUseID(part.FunctionCall.Name, functionCalls, responseKey)
+			functionCalls++
+
 			result = append(result, anthropicContent{
 				Type:  "tool_use",
 				ID:    &id,
@@ -228,7 +331,9 @@ func (p *GeminiProvider) convertGeminiContent(content *geminiContent) []anthropi
 
 		// Handle function responses (tool results)
 		if part.FunctionResponse != nil {
-			id := fmt.Sprintf("toolu_%s_%d", part.FunctionResponse.Name, time.Now().UnixNano())
+			id := geminiToolUseID(part.FunctionResponse.Name, functionResponses, responseKey)
+			functionResponses++
+
 			result = append(result, anthropicContent{
 				Type:      "tool_result",
 				ToolUseID: &id,
@@ -309,6 +414,20 @@ func (p *GeminiProvider) convertGeminiToAnthropicStream(geminiData []byte, state
 		state.Model = modelVersion
 	}
 
+	// Every chunk carries the usage so far
+	if usageMetadata, ok := rawChunk["usageMetadata"].(map[string]any); ok {
+		state.Usage.add(p.convertUsage(usageMetadata))
+	}
+
+	// A blocked prompt ends the stream before any candidate
+	if candidates, _ := rawChunk["candidates"].([]any); len(candidates) == 0 {
+		if feedback, ok := rawChunk["promptFeedback"].(map[string]any); ok {
+			if reason, _ := feedback["blockReason"].(string); reason != "" {
+				return p.streamBlockMessage(geminiData, "prompt", reason, rawChunk, state), nil
+			}
+		}
+	}
+
 	// Handle candidates array
 	if candidates, ok := rawChunk["candidates"].([]any); ok && len(candidates) > 0 {
 		if firstCandidate, ok := candidates[0].(map[string]any); ok {
@@ -336,6 +455,10 @@ func (p *GeminiProvider) convertGeminiToAnthropicStream(geminiData []byte, state
 			// Handle finish_reason
 			if finishReason, ok := firstCandidate["finishReason"]; ok && finishReason != nil {
 				if reason, ok := finishReason.(string); ok {
+					if geminiBlockedReasons[reason] && !hasStartedBlocks(state) {
+						return append(events, p.streamBlockMessage(geminiData, "response", reason, rawChunk, state)...), nil
+					}
+
 					finishEvents := p.handleFinishReason(reason, rawChunk, state)
 					events = append(events, finishEvents...)
 				}
@@ -346,6 +469,47 @@ func (p *GeminiProvider) convertGeminiToAnthropicStream(geminiData []byte, state
 	return events, nil
 }
 
+// streamBlockMessage ends a stream whose prompt or response Gemini blocked with a text block
+// explaining the block
+func (p *GeminiProvider) streamBlockMessage(geminiData []byte, subject, reason string, chunk map[string]any, state *StreamState) []byte {
+	var events []byte
+
+	if !state.MessageStartSent {
+		events = append(events, p.formatSSEEvent("message_start", p.createMessageStartEvent(state.MessageID, state.Model, chunk))...)
+		state.MessageStartSent = true
+	}
+
+	if state.ContentBlocks == nil {
+		state.ContentBlocks = make(map[int]*ContentBlockState)
+	}
+
+	var ratings []geminiSafetyRating
+
+	var blocked geminiResponse
+	if err := json.Unmarshal(geminiData, &blocked); err == nil {
+		if subject == "prompt" && blocked.PromptFeedback != nil {
+			ratings = blocked.PromptFeedback.SafetyRatings
+		} else if len(blocked.Candidates) > 0 {
+			ratings = blocked.Candidates[0].SafetyRatings
+		}
+	}
+
+	events = append(events, p.handleTextContent(geminiBlockMessage(subject, reason, ratings), state)...)
+
+	return append(events, p.handleFinishReason(reason, chunk, state)...)
+}
+
+// hasStartedBlocks reports whether any content block has been started in the stream
+func hasStartedBlocks(state *StreamState) bool {
+	for _, block := range state.ContentBlocks {
+		if block.StartSent {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *GeminiProvider) createMessageStartEvent(messageID, model string, firstChunk map[string]any) map[string]any {
 	usage := map[string]any{
 		"input_tokens":  0,
@@ -386,8 +550,25 @@ func (p *GeminiProvider) formatSSEEvent(eventType string, data map[string]any) [
 func (p *GeminiProvider) handleGeminiParts(parts []any, state *StreamState) []byte {
 	var events []byte
 
+	// Count function calls per name within this chunk so parallel calls to the
+	// same function stay distinct while a call split across chunks is merged
+	callOrdinals := make(map[string]int)
+
 	for _, part := range parts {
 		if partMap, ok := part.(map[string]any); ok {
+			signature, _ := partMap["thoughtSignature"].(string)
+
+			// Handle thinking content
+			if thought, _ := partMap["thought"].(bool); thought {
+				text, _ := partMap["text"].(string)
+				events = append(events, p.handleThinkingContent(text, signature, state)...)
+
+				continue
+			}
+
+			// Any other part ends the thinking block
+			events = append(events, p.closeThinkingBlock(signature, state)...)
+
 			// Handle text content
 			if text, ok := partMap["text"].(string); ok && text != "" {
 				textEvents := p.handleTextContent(text, state)
@@ -396,8 +577,10 @@ func (p *GeminiProvider) handleGeminiParts(parts []any, state *StreamState) []by
 
 			// Handle function calls
 			if functionCall, ok := partMap["functionCall"].(map[string]any); ok {
-				functionEvents := p.handleFunctionCall(functionCall, state)
+				name, _ := functionCall["name"].(string)
+				functionEvents := p.handleFunctionCall(functionCall, callOrdinals[name], state)
 				events = append(events, functionEvents...)
+				callOrdinals[name]++
 			}
 		}
 	}
@@ -409,8 +592,7 @@ func (p *GeminiProvider) handleGeminiParts(parts []any, state *StreamState) []by
 func (p *GeminiProvider) handleTextContent(content string, state *StreamState) []byte {
 	var events []byte
 
-	// Get or create text content block at index 0
-	textIndex := p.getOrCreateTextBlock(state)
+	textIndex := p.getOrCreateBlock(ContentTypeText, state)
 	contentBlock := state.ContentBlocks[textIndex]
 
 	// Send content_block_start event if needed
@@ -425,51 +607,264 @@ func (p *GeminiProvider) handleTextContent(content string, state *StreamState) [
 	return events
 }
 
-// handleFunctionCall processes function call streaming
-func (p *GeminiProvider) handleFunctionCall(functionCall map[string]any, state *StreamState) []byte {
+// handleThinkingContent streams thought parts as an Anthropic thinking block
+func (p *GeminiProvider) handleThinkingContent(thinking, signature string, state *StreamState) []byte {
+	var events []byte
+
+	thinkingIndex := p.getOrCreateBlock(ContentTypeThinking, state)
+	contentBlock := state.ContentBlocks[thinkingIndex]
+
+	if !contentBlock.StartSent {
+		events = append(events, p.createThinkingBlockStartEvent(thinkingIndex)...)
+		contentBlock.StartSent = true
+	}
+
+	if signature != "" {
+		contentBlock.Signature = signature
+	}
+
+	if thinking != "" {
+		events = append(events, p.createDeltaEvent(thinkingIndex, map[string]any{
+			"type":     "thinking_delta",
+			"thinking": thinking,
+		})...)
+	}
+
+	return events
+}
+
+// closeThinkingBlock sends the signature and stops the open thinking block, if any
+func (p *GeminiProvider) closeThinkingBlock(signature string, state *StreamState) []byte {
+	var events []byte
+
+	for index, block := range state.ContentBlocks {
+		if block.Type != ContentTypeThinking || !block.StartSent || block.StopSent {
+			continue
+		}
+
+		if block.Signature == "" {
+			block.Signature = signature
+		}
+
+		if block.Signature != "" {
+			events = append(events, p.createDeltaEvent(index, map[string]any{
+				"type":      "signature_delta",
+				"signature": block.Signature,
+			})...)
+		}
+
+		events = append(events, p.formatSSEEvent("content_block_stop", map[string]any{
+			"type":  "content_block_stop",
+			"index": index,
+		})...)
+		block.StopSent = true
+	}
+
+	return events
+}
+
+// handleFunctionCall processes function call streaming. Calls are tracked by
+// name and per-chunk ordinal so that a chunk resending a call with more arguments
+// is merged into its tool_use block; any other repeat opens a new block.
+func (p *GeminiProvider) handleFunctionCall(functionCall map[string]any, ordinal int, state *StreamState) []byte {
 	var events []byte
 
 	name, _ := functionCall["name"].(string)
 	args, _ := functionCall["args"].(map[string]any)
 
-	// Create new content block for tool use
-	contentBlockIndex := len(state.ContentBlocks)
-	toolCallID := fmt.Sprintf("toolu_gemini_%d", time.Now().UnixNano())
+	contentBlockIndex := p.findOrCreateFunctionCallBlock(name, ordinal, args, state)
+	contentBlock := state.ContentBlocks[contentBlockIndex]
+
+	// Send content_block_start event once per tool_use block
+	if !contentBlock.StartSent {
+		events = append(events, p.createToolBlockStartEvent(contentBlockIndex, contentBlock)...)
+		contentBlock.StartSent = true
+	}
+
+	// Send only the argument keys not yet streamed as input_json_delta
+	if newPart := p.calculateArgumentsDelta(args, contentBlock); newPart != "" {
+		contentBlock.Arguments += newPart
+		events = append(events, p.createInputDeltaEvent(contentBlockIndex, newPart)...)
+	}
+
+	return events
+}
+
+// findOrCreateFunctionCallBlock locates the open tool_use block that a function call
+// continues or creates a new one
+func (p *GeminiProvider) findOrCreateFunctionCallBlock(name string, ordinal int, args map[string]any, state *StreamState) int {
+	latest := -1
 
+	for blockIdx, block := range state.ContentBlocks {
+		if block.Type == ContentTypeToolUse && !block.StopSent && block.ToolName == name && block.ToolCallIndex == ordinal && blockIdx > latest {
+			latest = blockIdx
+		}
+	}
+
+	if latest >= 0 && p.continuesArguments(args, state.ContentBlocks[latest]) {
+		return latest
+	}
+
+	// Number tool_use blocks per response, matching the non-streaming ids
+	functionCalls := 0
+	for _, block := range state.ContentBlocks {
+		if block.Type == ContentTypeToolUse {
+			functionCalls++
+		}
+	}
+
+	contentBlockIndex := len(state.ContentBlocks)
 	state.ContentBlocks[contentBlockIndex] = &ContentBlockState{
-		Type:       "tool_use",
-		ToolCallID: toolCallID,
-		ToolName:   name,
-		Arguments:  "",
+		Type:          ContentTypeToolUse,
+		ToolCallID:    geminiToolUseID(name, functionCalls, geminiResponseKey(state.MessageID)),
+		ToolCallIndex: ordinal,
+		ToolName:      name,
+		Arguments:     "",
 	}
 
-	contentBlock := state.ContentBlocks[contentBlockIndex]
+	return contentBlockIndex
+}
 
-	// Send content_block_start event
-	events = append(events, p.createToolBlockStartEvent(contentBlockIndex, contentBlock)...)
-	contentBlock.StartSent = true
+// continuesArguments reports whether args resend every argument already streamed for
+// the block, unchanged, and add at least one more. Anything else is a separate call
+// that happens to share the function name.
+func (p *GeminiProvider) continuesArguments(args map[string]any, block *ContentBlockState) bool {
+	if block.Arguments == "" {
+		return false
+	}
+
+	sent := make(map[string]any)
+	if err := json.Unmarshal([]byte(block.Arguments+"}"), &sent); err != nil {
+		return false
+	}
 
-	// Send function arguments as input_json_delta if we have args
-	if args != nil {
-		argsJSON, err := json.Marshal(args)
-		if err == nil {
-			events = append(events, p.createInputDeltaEvent(contentBlockIndex, string(argsJSON))...)
+	if len(args) <= len(sent) {
+		return false
+	}
+
+	for key, value := range sent {
+		current, exists := args[key]
+		if !exists {
+			return false
+		}
+
+		currentJSON, _ := json.Marshal(current)
+		valueJSON, _ := json.Marshal(value)
+
+		if !bytes.Equal(currentJSON, valueJSON) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// calculateArgumentsDelta builds the partial JSON for argument keys that have not
+// been streamed yet. The object is left open so later chunks can append keys; it
+// is closed by closeToolArguments when the block stops.
+func (p *GeminiProvider) calculateArgumentsDelta(args map[string]any, block *ContentBlockState) string {
+	sent := make(map[string]any)
+	if block.Arguments != "" {
+		if err := json.Unmarshal([]byte(block.Arguments+"}"), &sent); err != nil {
+			return ""
+		}
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		if _, exists := sent[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var delta strings.Builder
+
+	for _, key := range keys {
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			continue
+		}
+
+		valueJSON, err := json.Marshal(args[key])
+		if err != nil {
+			continue
+		}
+
+		if block.Arguments == "" && delta.Len() == 0 {
+			delta.WriteString("{")
+		} else {
+			delta.WriteString(",")
+		}
+
+		delta.Write(keyJSON)
+		delta.WriteString(":")
+		delta.Write(valueJSON)
+	}
+
+	return delta.String()
+}
+
+// closeToolArguments emits the closing brace for tool_use blocks whose input is still open
+func (p *GeminiProvider) closeToolArguments(state *StreamState) []byte {
+	var events []byte
+
+	indices := make([]int, 0, len(state.ContentBlocks))
+	for index := range state.ContentBlocks {
+		indices = append(indices, index)
+	}
+
+	sort.Ints(indices)
+
+	for _, index := range indices {
+		block := state.ContentBlocks[index]
+		if block.Type == ContentTypeToolUse && block.StartSent && !block.StopSent && block.Arguments != "" {
+			block.Arguments += "}"
+			events = append(events, p.createInputDeltaEvent(index, "}")...)
 		}
 	}
 
 	return events
 }
 
-// getOrCreateTextBlock gets or creates text content block at index 0
-func (p *GeminiProvider) getOrCreateTextBlock(state *StreamState) int {
-	textIndex := 0
-	if _, exists := state.ContentBlocks[textIndex]; !exists {
-		state.ContentBlocks[textIndex] = &ContentBlockState{
-			Type: "text",
+// getOrCreateBlock returns the open content block of the given type or appends a new one
+func (p *GeminiProvider) getOrCreateBlock(blockType string, state *StreamState) int {
+	for index, block := range state.ContentBlocks {
+		if block.Type == blockType && !block.StopSent {
+			return index
 		}
 	}
 
-	return textIndex
+	index := len(state.ContentBlocks)
+	state.ContentBlocks[index] = &ContentBlockState{
+		Type: blockType,
+	}
+
+	return index
+}
+
+// createThinkingBlockStartEvent creates content_block_start event for thinking
+func (p *GeminiProvider) createThinkingBlockStartEvent(index int) []byte {
+	contentBlockStartEvent := map[string]any{
+		"type":  "content_block_start",
+		"index": index,
+		"content_block": map[string]any{
+			"type":     ContentTypeThinking,
+			"thinking": "",
+		},
+	}
+
+	return p.formatSSEEvent("content_block_start", contentBlockStartEvent)
+}
+
+// createDeltaEvent creates a content_block_delta event with the given delta
+func (p *GeminiProvider) createDeltaEvent(index int, delta map[string]any) []byte {
+	return p.formatSSEEvent("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": delta,
+	})
 }
 
 // createTextBlockStartEvent creates content_block_start event for text
@@ -532,13 +927,19 @@ func (p *GeminiProvider) createInputDeltaEvent(index int, partialJSON string) []
 
 // handleFinishReason processes finish reasons and sends appropriate events
 func (p *GeminiProvider) handleFinishReason(reason string, chunk map[string]any, state *StreamState) []byte {
-	return HandleFinishReason(p, reason, chunk, state, func(chunk map[string]any) map[string]any {
+	events := p.closeThinkingBlock("", state)
+	events = append(events, p.closeToolArguments(state)...)
+
+	events = append(events, HandleFinishReason(p, reason, chunk, state, func(chunk map[string]any) map[string]any {
 		if usageMetadata, ok := chunk["usageMetadata"].(map[string]any); ok {
 			return p.convertUsage(usageMetadata)
 		}
 
 		return nil
-	})
+	})...)
+
+	// Gemini reports usage with the finish reason at the latest; nothing follows it
+	return append(events, FinishStream(state)...)
 }
 
 // convertUsage handles usage information conversion
@@ -554,9 +955,70 @@ func (p *GeminiProvider) convertUsage(usage map[string]any) map[string]any {
 		anthropicUsage["output_tokens"] = candidatesTokens
 	}
 
+	if cachedTokens, ok := usage["cachedContentTokenCount"]; ok {
+		anthropicUsage["cache_read_input_tokens"] = cachedTokens
+	}
+
 	return anthropicUsage
 }
 
+// geminiSystemInstruction converts a string or text block system prompt into Gemini's
+// systemInstruction, which keeps it out of the conversation turns
+func geminiSystemInstruction(system any) map[string]any {
+	var parts []any
+
+	switch value := system.(type) {
+	case string:
+		if value != "" {
+			parts = append(parts, map[string]any{"text": value})
+		}
+	case []any:
+		for _, block := range value {
+			blockMap, _ := block.(map[string]any)
+			if text, ok := blockMap["text"].(string); ok && text != "" {
+				parts = append(parts, map[string]any{"text": text})
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil
+	}
+
+	return map[string]any{"parts": parts}
+}
+
+// geminiMaxStopSequences is the number of stop sequences Gemini accepts
+const geminiMaxStopSequences = 5
+
+// geminiStopSequences collects stop_sequences, or an OpenAI-style stop string or list,
+// keeping the first geminiMaxStopSequences non-empty entries
+func geminiStopSequences(request map[string]any) []string {
+	stop, ok := request["stop_sequences"]
+	if !ok {
+		stop = request["stop"]
+	}
+
+	var candidates []any
+
+	switch value := stop.(type) {
+	case string:
+		candidates = []any{value}
+	case []any:
+		candidates = value
+	}
+
+	var sequences []string
+
+	for _, candidate := range candidates {
+		if sequence, ok := candidate.(string); ok && sequence != "" && len(sequences) < geminiMaxStopSequences {
+			sequences = append(sequences, sequence)
+		}
+	}
+
+	return sequences
+}
+
 // transformAnthropicToGemini converts Anthropic/Claude format to Gemini format
 func (p *GeminiProvider) transformAnthropicToGemini(requestBody []byte) ([]byte, error) {
 	var anthropicReq map[string]any
@@ -574,6 +1036,10 @@ func (p *GeminiProvider) transformAnthropicToGemini(requestBody []byte) ([]byte,
 
 	geminiReq["contents"] = contents
 
+	if systemInstruction := geminiSystemInstruction(anthropicReq["system"]); systemInstruction != nil {
+		geminiReq["systemInstruction"] = systemInstruction
+	}
+
 	// Convert generation config
 	generationConfig := make(map[string]any)
 
@@ -593,6 +1059,19 @@ func (p *GeminiProvider) transformAnthropicToGemini(requestBody []byte) ([]byte,
 		generationConfig["topK"] = int(topK)
 	}
 
+	if stopSequences := geminiStopSequences(anthropicReq); len(stopSequences) > 0 {
+		generationConfig["stopSequences"] = stopSequences
+	}
+
+	// Structured outputs; Gemini's schema dialect rejects some JSON Schema keywords
+	if responseFormat := ExtractResponseFormat(anthropicReq); responseFormat != nil {
+		generationConfig["responseMimeType"] = "application/json"
+
+		if responseFormat.Schema != nil {
+			generationConfig["responseSchema"] = RemoveFieldsRecursively(responseFormat.Schema, []string{"$schema", "additionalProperties"})
+		}
+	}
+
 	if len(generationConfig) > 0 {
 		geminiReq["generationConfig"] = generationConfig
 	}
@@ -602,6 +1081,10 @@ func (p *GeminiProvider) transformAnthropicToGemini(requestBody []byte) ([]byte,
 		geminiTools := p.convertAnthropicToolsToGemini(tools)
 
 		geminiReq["tools"] = geminiTools
+
+		if toolConfig := p.convertToolChoice(anthropicReq["tool_choice"]); toolConfig != nil {
+			geminiReq["toolConfig"] = toolConfig
+		}
 	}
 
 	// Convert safety settings if needed
@@ -632,26 +1115,13 @@ func (p *GeminiProvider) transformAnthropicToGemini(requestBody []byte) ([]byte,
 func (p *GeminiProvider) convertAnthropicMessagesToGeminiContents(anthropicReq map[string]any) ([]any, error) {
 	var contents []any
 
-	// Handle system message first
-	if systemContent, hasSystem := anthropicReq["system"]; hasSystem {
-		if systemStr, ok := systemContent.(string); ok {
-			systemContent := map[string]any{
-				"parts": []any{
-					map[string]any{
-						"text": systemStr,
-					},
-				},
-				"role": RoleUser,
-			}
-			contents = append(contents, systemContent)
-		}
-	}
-
-	// Convert messages
+	// Convert messages; the system prompt goes into systemInstruction instead
 	if messages, ok := anthropicReq["messages"].([]any); ok {
+		toolNames := p.collectToolUseNames(messages)
+
 		for _, message := range messages {
 			if msgMap, ok := message.(map[string]any); ok {
-				geminiContent, err := p.convertAnthropicMessageToGemini(msgMap)
+				geminiContent, err := p.convertAnthropicMessageToGemini(msgMap, toolNames)
 				if err != nil {
 					return nil, err
 				}
@@ -666,7 +1136,34 @@ func (p *GeminiProvider) convertAnthropicMessagesToGeminiContents(anthropicReq m
 	return contents, nil
 }
 
-func (p *GeminiProvider) convertAnthropicMessageToGemini(message map[string]any) (map[string]any, error) {
+// collectToolUseNames maps the id of every tool_use block in the conversation to its
+// function name, so tool_result blocks can name the function Gemini expects
+func (p *GeminiProvider) collectToolUseNames(messages []any) map[string]string {
+	toolNames := make(map[string]string)
+
+	for _, message := range messages {
+		msgMap, _ := message.(map[string]any)
+		blocks, _ := msgMap["content"].([]any)
+
+		for _, block := range blocks {
+			blockMap, _ := block.(map[string]any)
+			if blockMap["type"] != "tool_use" {
+				continue
+			}
+
+			id, _ := blockMap["id"].(string)
+			name, _ := blockMap["name"].(string)
+
+			if id != "" && name != "" {
+				toolNames[id] = name
+			}
+		}
+	}
+
+	return toolNames
+}
+
+func (p *GeminiProvider) convertAnthropicMessageToGemini(message map[string]any, toolNames map[string]string) (map[string]any, error) {
 	role, _ := message["role"].(string)
 	content := message["content"]
 
@@ -682,7 +1179,7 @@ func (p *GeminiProvider) convertAnthropicMessageToGemini(message map[string]any)
 		// Array of content blocks
 		for _, block := range contentType {
 			if blockMap, ok := block.(map[string]any); ok {
-				part := p.convertContentBlockToGeminiPart(blockMap)
+				part := p.convertContentBlockToGeminiPart(blockMap, toolNames)
 
 				if part != nil {
 					parts = append(parts, part)
@@ -705,7 +1202,7 @@ func (p *GeminiProvider) convertAnthropicMessageToGemini(message map[string]any)
 	}, nil
 }
 
-func (p *GeminiProvider) convertContentBlockToGeminiPart(block map[string]any) map[string]any {
+func (p *GeminiProvider) convertContentBlockToGeminiPart(block map[string]any, toolNames map[string]string) map[string]any {
 	blockType, _ := block["type"].(string)
 
 	switch blockType {
@@ -749,10 +1246,20 @@ func (p *GeminiProvider) convertContentBlockToGeminiPart(block map[string]any) m
 				response = map[string]any{}
 			}
 
+			// Gemini reads a failed call from an "error" field of the response
+			if isError, _ := block["is_error"].(bool); isError {
+				errorContent := block["content"]
+				if errorContent == nil {
+					errorContent = "tool call failed"
+				}
+
+				response = map[string]any{"error": errorContent}
+			}
+
 			return map[string]any{
 				"functionResponse": map[string]any{
-					"name":     toolUseID, // Use tool_use_id as function name reference
-					"response": response,  // Structured object instead of plain string
+					"name":     geminiFunctionName(toolUseID, toolNames),
+					"response": response, // Structured object instead of plain string
 				},
 			}
 		}
@@ -761,6 +1268,97 @@ func (p *GeminiProvider) convertContentBlockToGeminiPart(block map[string]any) m
 	return nil
 }
 
+// geminiToolUseID builds a tool_use id from the function name, the call's position in the
+// response and the response's key, so calls from different turns never share an id
+func geminiToolUseID(name string, counter int, responseKey string) string {
+	return fmt.Sprintf("toolu_%s_%d_%s", name, counter, responseKey)
+}
+
+// geminiResponseKeyBytes is the size of the response key in tool_use ids, hex encoded
+const geminiResponseKeyBytes = 6
+
+// geminiResponseKey derives the unique part of a response's tool_use ids from its
+// responseId, or picks a random one for a response without
+func geminiResponseKey(responseID string) string {
+	if responseID != "" {
+		sum := sha256.Sum256([]byte(responseID))
+		return hex.EncodeToString(sum[:geminiResponseKeyBytes])
+	}
+
+	key := make([]byte, geminiResponseKeyBytes)
+	_, _ = rand.Read(key)
+
+	return hex.EncodeToString(key)
+}
+
+// isGeminiResponseKey reports whether s looks like a key made by geminiResponseKey
+func isGeminiResponseKey(s string) bool {
+	if len(s) != 2*geminiResponseKeyBytes {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
+
+// geminiFunctionName resolves the function a tool_result answers: from the matching
+// tool_use in the conversation, else from an id built by geminiToolUseID, else the id itself
+func geminiFunctionName(toolUseID string, toolNames map[string]string) string {
+	if name, ok := toolNames[toolUseID]; ok {
+		return name
+	}
+
+	if trimmed, ok := strings.CutPrefix(toolUseID, "toolu_"); ok {
+		// Ids from before the response key was added end in the counter
+		if sep := strings.LastIndex(trimmed, "_"); sep > 0 && isGeminiResponseKey(trimmed[sep+1:]) {
+			trimmed = trimmed[:sep]
+		}
+
+		if sep := strings.LastIndex(trimmed, "_"); sep > 0 {
+			if _, err := strconv.Atoi(trimmed[sep+1:]); err == nil {
+				return trimmed[:sep]
+			}
+		}
+	}
+
+	return toolUseID
+}
+
+// convertToolChoice maps an Anthropic tool_choice to Gemini's toolConfig: auto is AUTO,
+// any is ANY, none is NONE and {type:tool,name} is ANY restricted to that function
+func (p *GeminiProvider) convertToolChoice(toolChoice any) map[string]any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var config map[string]any
+
+	switch choice["type"] {
+	case "auto":
+		config = map[string]any{"mode": "AUTO"}
+	case "any":
+		config = map[string]any{"mode": "ANY"}
+	case "none":
+		config = map[string]any{"mode": "NONE"}
+	case "tool":
+		name, _ := choice["name"].(string)
+		if name == "" {
+			return nil
+		}
+
+		config = map[string]any{
+			"mode":                 "ANY",
+			"allowedFunctionNames": []string{name},
+		}
+	default:
+		return nil
+	}
+
+	return map[string]any{"functionCallingConfig": config}
+}
+
 func (p *GeminiProvider) convertAnthropicToolsToGemini(tools []any) []any {
 	var geminiTools []any
 
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -100,12 +101,11 @@ func TestGeminiProvider_TransformRequest(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify system instructions conversion
-	if systemInstructions, ok := geminiReq["systemInstruction"]; ok {
-		systemInstr := systemInstructions.(map[string]any)
-		parts := systemInstr["parts"].([]any)
-		firstPart := parts[0].(map[string]any)
-		assert.Equal(t, "You are a helpful assistant", firstPart["text"])
-	}
+	systemInstr, ok := geminiReq["systemInstruction"].(map[string]any)
+	require.True(t, ok, "systemInstruction should be set")
+	parts := systemInstr["parts"].([]any)
+	firstPart := parts[0].(map[string]any)
+	assert.Equal(t, "You are a helpful assistant", firstPart["text"])
 
 	// Verify model field is not included (Gemini uses URL-based model selection)
 	assert.NotContains(t, geminiReq, "model", "model should not be in request body for Gemini")
@@ -122,6 +122,122 @@ func TestGeminiProvider_TransformRequest(t *testing.T) {
 	}
 }
 
+func TestGeminiProvider_TransformRequestSystemInstruction(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	request := `{"model":"gemini-2.5-pro","max_tokens":100,` +
+		`"system":[{"type":"text","text":"You are Claude Code."},{"type":"text","text":"Be concise.","cache_control":{"type":"ephemeral"}}],` +
+		`"messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"},{"role":"user","content":"List files"}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var geminiReq map[string]any
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+	assert.Equal(t, map[string]any{"parts": []any{
+		map[string]any{"text": "You are Claude Code."},
+		map[string]any{"text": "Be concise."},
+	}}, geminiReq["systemInstruction"])
+
+	// The conversation holds only the real turns, starting with the user's message
+	contents := geminiReq["contents"].([]any)
+	require.Len(t, contents, 3)
+	assert.Equal(t, []any{map[string]any{"text": "Hi"}}, contents[0].(map[string]any)["parts"])
+	assert.Equal(t, "model", contents[1].(map[string]any)["role"])
+}
+
+func TestGeminiProvider_TransformRequest_ResponseFormat(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	anthropicRequest := map[string]any{
+		"model":      "gemini-2.0-flash",
+		"max_tokens": 100,
+		"messages": []any{
+			map[string]any{"role": "user", "content": "Answer in JSON"},
+		},
+		"output_format": map[string]any{
+			"type": "json_schema",
+			"schema": map[string]any{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"type":    "object",
+				"properties": map[string]any{
+					"answer": map[string]any{"type": "string"},
+				},
+				"required":             []string{"answer"},
+				"additionalProperties": false,
+			},
+		},
+	}
+
+	anthropicJSON, err := json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err := provider.TransformRequest(anthropicJSON)
+	require.NoError(t, err)
+
+	var geminiReq map[string]any
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+	genConfig, ok := geminiReq["generationConfig"].(map[string]any)
+	require.True(t, ok, "generationConfig should be set")
+	assert.Equal(t, "application/json", genConfig["responseMimeType"])
+
+	responseSchema, ok := genConfig["responseSchema"].(map[string]any)
+	require.True(t, ok, "responseSchema should be set")
+	assert.Equal(t, "object", responseSchema["type"])
+	assert.Contains(t, responseSchema, "properties")
+	assert.NotContains(t, responseSchema, "$schema", "unsupported keywords should be removed")
+	assert.NotContains(t, responseSchema, "additionalProperties", "unsupported keywords should be removed")
+	assert.NotContains(t, geminiReq, "output_format")
+
+	// JSON mode without a schema only sets the MIME type
+	anthropicRequest["output_format"] = nil
+	anthropicRequest["response_format"] = map[string]any{"type": "json_object"}
+
+	anthropicJSON, err = json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err = provider.TransformRequest(anthropicJSON)
+	require.NoError(t, err)
+
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+	genConfig = geminiReq["generationConfig"].(map[string]any)
+	assert.Equal(t, "application/json", genConfig["responseMimeType"])
+	assert.NotContains(t, genConfig, "responseSchema")
+}
+
+func TestGeminiProvider_TransformRequestStopSequences(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	testCases := []struct {
+		name     string
+		stop     string
+		expected any
+	}{
+		{name: "stop_sequences", stop: `"stop_sequences":["END","\n\nHuman:"]`, expected: []any{"END", "\n\nHuman:"}},
+		{name: "stop string", stop: `"stop":"END"`, expected: []any{"END"}},
+		{name: "capped at five", stop: `"stop_sequences":["a","b","","c","d","e","f"]`, expected: []any{"a", "b", "c", "d", "e"}},
+		{name: "none", stop: `"stop_sequences":[]`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := `{"model":"gemini-2.5-flash","max_tokens":100,` + tc.stop + `,"messages":[{"role":"user","content":"Hi"}]}`
+
+			result, err := provider.TransformRequest([]byte(request))
+			require.NoError(t, err)
+
+			var geminiReq map[string]any
+			require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+			genConfig := geminiReq["generationConfig"].(map[string]any)
+			assert.Equal(t, tc.expected, genConfig["stopSequences"])
+			assert.NotContains(t, geminiReq, "stop_sequences")
+		})
+	}
+}
+
 func TestGeminiProvider_Transform(t *testing.T) {
 	provider := NewGeminiProvider()
 
@@ -308,6 +424,177 @@ func TestGeminiProvider_FunctionCallsTransform(t *testing.T) {
 	}
 }
 
+func TestGeminiProvider_ToolCallRoundTrip(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	// Turn 1: Gemini calls the same function twice
+	geminiResponse := map[string]any{
+		"responseId": "resp-1",
+		"candidates": []map[string]any{
+			{
+				"content": map[string]any{
+					"role": "model",
+					"parts": []map[string]any{
+						{"functionCall": map[string]any{"name": "get_weather", "args": map[string]any{"location": "Paris"}}},
+						{"functionCall": map[string]any{"name": "get_weather", "args": map[string]any{"location": "Rome"}}},
+					},
+				},
+				"finishReason": "STOP",
+			},
+		},
+	}
+
+	geminiJSON, err := json.Marshal(geminiResponse)
+	require.NoError(t, err)
+
+	first, err := provider.TransformResponse(geminiJSON)
+	require.NoError(t, err)
+
+	second, err := provider.TransformResponse(geminiJSON)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(first), string(second), "ids should be deterministic for a response")
+
+	var anthropicResp map[string]any
+	require.NoError(t, json.Unmarshal(first, &anthropicResp))
+
+	content := anthropicResp["content"].([]any)
+	require.Len(t, content, 2)
+
+	firstID := content[0].(map[string]any)["id"].(string)
+	secondID := content[1].(map[string]any)["id"].(string)
+	assert.Equal(t, geminiToolUseID("get_weather", 0, geminiResponseKey("resp-1")), firstID)
+	assert.Equal(t, geminiToolUseID("get_weather", 1, geminiResponseKey("resp-1")), secondID)
+
+	// A later turn calling the same function gets other ids, with or without a responseId
+	for _, responseID := range []string{"resp-2", ""} {
+		geminiResponse["responseId"] = responseID
+
+		geminiJSON, err := json.Marshal(geminiResponse)
+		require.NoError(t, err)
+
+		later, err := provider.TransformResponse(geminiJSON)
+		require.NoError(t, err)
+
+		var laterResp map[string]any
+		require.NoError(t, json.Unmarshal(later, &laterResp))
+		assert.NotEqual(t, firstID, laterResp["content"].([]any)[0].(map[string]any)["id"])
+	}
+
+	// Turn 2: the client sends the tool calls back with their results
+	anthropicRequest := map[string]any{
+		"model":      "gemini-2.0-flash",
+		"max_tokens": 100,
+		"messages": []any{
+			map[string]any{"role": "user", "content": "Weather in Paris and Rome?"},
+			map[string]any{"role": "assistant", "content": content},
+			map[string]any{
+				"role": "user",
+				"content": []any{
+					map[string]any{"type": "tool_result", "tool_use_id": firstID, "content": "18C"},
+					map[string]any{"type": "tool_result", "tool_use_id": secondID, "content": "24C"},
+				},
+			},
+		},
+	}
+
+	requestJSON, err := json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err := provider.TransformRequest(requestJSON)
+	require.NoError(t, err)
+
+	var geminiReq map[string]any
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+	contents := geminiReq["contents"].([]any)
+	require.Len(t, contents, 3)
+
+	modelParts := contents[1].(map[string]any)["parts"].([]any)
+	require.Len(t, modelParts, 2)
+	assert.Equal(t, "get_weather", modelParts[0].(map[string]any)["functionCall"].(map[string]any)["name"])
+
+	resultParts := contents[2].(map[string]any)["parts"].([]any)
+	require.Len(t, resultParts, 2)
+
+	for i, expected := range []string{"18C", "24C"} {
+		functionResponse := resultParts[i].(map[string]any)["functionResponse"].(map[string]any)
+		assert.Equal(t, "get_weather", functionResponse["name"], "functionResponse should name the called function")
+		assert.Equal(t, expected, functionResponse["response"].(map[string]any)["content"])
+	}
+}
+
+func TestGeminiProvider_TransformRequestToolResultError(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	request := `{"model":"gemini-2.0-flash","max_tokens":100,"messages":[` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"toolu_read_0","name":"read","input":{"path":"/missing"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_read_0","content":"File does not exist.","is_error":true}]}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var geminiReq map[string]any
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+	contents := geminiReq["contents"].([]any)
+	require.Len(t, contents, 2)
+
+	parts := contents[1].(map[string]any)["parts"].([]any)
+	functionResponse := parts[0].(map[string]any)["functionResponse"].(map[string]any)
+	assert.Equal(t, "read", functionResponse["name"])
+	assert.Equal(t, map[string]any{"error": "File does not exist."}, functionResponse["response"])
+}
+
+func TestGeminiProvider_ToolResultNamesFromForeignIDs(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	// A conversation started on another provider carries ids that don't encode the function
+	request := `{"model":"gemini-2.5-pro","max_tokens":100,"messages":[` +
+		`{"role":"user","content":"Check the repo"},` +
+		`{"role":"assistant","content":[` +
+		`{"type":"tool_use","id":"toolu_01A09q90qw90lq917835lq9","name":"Bash","input":{"command":"git status"}},` +
+		`{"type":"tool_use","id":"call_Xk2","name":"Read","input":{"file_path":"README.md"}}]},` +
+		`{"role":"user","content":[` +
+		`{"type":"tool_result","tool_use_id":"call_Xk2","content":"# Project"},` +
+		`{"type":"tool_result","tool_use_id":"toolu_01A09q90qw90lq917835lq9","content":"clean"}]}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var geminiReq map[string]any
+	require.NoError(t, json.Unmarshal(result, &geminiReq))
+
+	contents := geminiReq["contents"].([]any)
+	require.Len(t, contents, 3)
+
+	parts := contents[2].(map[string]any)["parts"].([]any)
+	require.Len(t, parts, 2)
+
+	for i, expected := range []string{"Read", "Bash"} {
+		functionResponse := parts[i].(map[string]any)["functionResponse"].(map[string]any)
+		assert.Equal(t, expected, functionResponse["name"], "functionResponse should name the called function, not the tool id")
+	}
+}
+
+func TestGeminiFunctionName(t *testing.T) {
+	testCases := []struct {
+		toolUseID string
+		toolNames map[string]string
+		expected  string
+	}{
+		{"call_abc", map[string]string{"call_abc": "ls"}, "ls"},
+		{"toolu_get_weather_3", nil, "get_weather"},
+		{geminiToolUseID("get_weather", 3, geminiResponseKey("resp-1")), nil, "get_weather"},
+		{geminiToolUseID("step_2", 0, geminiResponseKey("")), nil, "step_2"},
+		{"toolu_abc123", nil, "toolu_abc123"},
+		{"unknown", nil, "unknown"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, geminiFunctionName(tc.toolUseID, tc.toolNames), tc.toolUseID)
+	}
+}
+
 func TestGeminiProvider_ErrorHandling(t *testing.T) {
 	provider := NewGeminiProvider()
 
@@ -447,6 +734,318 @@ func TestGeminiProvider_StreamingFunctionCalls(t *testing.T) {
 	assert.Contains(t, eventStr, "UTC")
 }
 
+func TestGeminiProvider_StreamingFunctionCallAcrossChunks(t *testing.T) {
+	provider := NewGeminiProvider()
+	state := &StreamState{}
+
+	functionCallChunk := func(args map[string]any) []byte {
+		chunk := map[string]any{
+			"responseId":   "gemini-response-123",
+			"modelVersion": "gemini-2.0-flash",
+			"candidates": []map[string]any{
+				{
+					"index": 0,
+					"content": map[string]any{
+						"role": "model",
+						"parts": []map[string]any{
+							{
+								"functionCall": map[string]any{
+									"name": "get_weather",
+									"args": args,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		chunkJSON, err := json.Marshal(chunk)
+		require.NoError(t, err)
+
+		return chunkJSON
+	}
+
+	var combined strings.Builder
+
+	// First chunk carries part of the arguments
+	events, err := provider.TransformStream(functionCallChunk(map[string]any{"location": "Paris"}), state)
+	require.NoError(t, err)
+	combined.Write(events)
+
+	// Second chunk repeats the call with the remaining arguments
+	events, err = provider.TransformStream(functionCallChunk(map[string]any{"location": "Paris", "unit": "celsius"}), state)
+	require.NoError(t, err)
+	combined.Write(events)
+
+	finishChunk, err := json.Marshal(map[string]any{
+		"candidates": []map[string]any{
+			{
+				"index":        0,
+				"finishReason": "STOP",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	events, err = provider.TransformStream(finishChunk, state)
+	require.NoError(t, err)
+	combined.Write(events)
+
+	toolStarts := 0
+
+	var partialJSON strings.Builder
+
+	for _, line := range strings.Split(combined.String(), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+
+		switch event["type"] {
+		case "content_block_start":
+			if block, ok := event["content_block"].(map[string]any); ok && block["type"] == "tool_use" {
+				toolStarts++
+			}
+		case "content_block_delta":
+			if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "input_json_delta" {
+				partialJSON.WriteString(delta["partial_json"].(string))
+			}
+		}
+	}
+
+	assert.Equal(t, 1, toolStarts, "function call split across chunks should produce a single tool_use block")
+
+	var input map[string]any
+	require.NoError(t, json.Unmarshal([]byte(partialJSON.String()), &input), "streamed input should be valid JSON")
+	assert.Equal(t, "Paris", input["location"])
+	assert.Equal(t, "celsius", input["unit"])
+}
+
+func TestGeminiProvider_StreamingRepeatedFunctionCall(t *testing.T) {
+	provider := NewGeminiProvider()
+	state := &StreamState{}
+
+	functionCallChunk := func(path string) []byte {
+		chunkJSON, err := json.Marshal(map[string]any{
+			"responseId":   "gemini-response-123",
+			"modelVersion": "gemini-2.0-flash",
+			"candidates": []map[string]any{
+				{
+					"index": 0,
+					"content": map[string]any{
+						"role": "model",
+						"parts": []map[string]any{
+							{"functionCall": map[string]any{"name": "read_file", "args": map[string]any{"path": path}}},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return chunkJSON
+	}
+
+	finishChunk, err := json.Marshal(map[string]any{
+		"candidates": []map[string]any{{"index": 0, "finishReason": "STOP"}},
+	})
+	require.NoError(t, err)
+
+	var combined strings.Builder
+
+	for _, chunk := range [][]byte{functionCallChunk("a.go"), functionCallChunk("b.go"), finishChunk} {
+		events, err := provider.TransformStream(chunk, state)
+		require.NoError(t, err)
+		combined.Write(events)
+	}
+
+	var ids []string
+
+	inputs := make(map[float64]*strings.Builder)
+
+	for _, line := range strings.Split(combined.String(), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+
+		switch event["type"] {
+		case "content_block_start":
+			if block, ok := event["content_block"].(map[string]any); ok && block["type"] == "tool_use" {
+				ids = append(ids, block["id"].(string))
+				inputs[event["index"].(float64)] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "input_json_delta" {
+				inputs[event["index"].(float64)].WriteString(delta["partial_json"].(string))
+			}
+		}
+	}
+
+	require.Len(t, ids, 2, "a second call with the same name should get its own tool_use block")
+	assert.NotEqual(t, ids[0], ids[1])
+
+	paths := make([]string, 0, len(inputs))
+
+	for _, index := range []float64{0, 1} {
+		require.Contains(t, inputs, index)
+
+		var input map[string]any
+		require.NoError(t, json.Unmarshal([]byte(inputs[index].String()), &input))
+		paths = append(paths, input["path"].(string))
+	}
+
+	assert.Equal(t, []string{"a.go", "b.go"}, paths)
+}
+
+func TestGeminiProvider_TransformThinkingParts(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	geminiResponse := map[string]any{
+		"responseId":   "gemini-response-123",
+		"modelVersion": "gemini-2.5-pro",
+		"candidates": []map[string]any{
+			{
+				"content": map[string]any{
+					"role": "model",
+					"parts": []map[string]any{
+						{
+							"text":    "The user wants a greeting.",
+							"thought": true,
+						},
+						{
+							"text":             "Hello!",
+							"thoughtSignature": "sig-123",
+						},
+					},
+				},
+				"finishReason": "STOP",
+			},
+		},
+	}
+
+	geminiJSON, err := json.Marshal(geminiResponse)
+	require.NoError(t, err)
+
+	result, err := provider.TransformResponse(geminiJSON)
+	require.NoError(t, err)
+
+	var anthropicResp map[string]any
+	err = json.Unmarshal(result, &anthropicResp)
+	require.NoError(t, err)
+
+	content, ok := anthropicResp["content"].([]any)
+	require.True(t, ok)
+	require.Len(t, content, 2, "thinking and answer should be separate blocks")
+
+	thinkingBlock := content[0].(map[string]any)
+	assert.Equal(t, "thinking", thinkingBlock["type"])
+	assert.Equal(t, "The user wants a greeting.", thinkingBlock["thinking"])
+	assert.Equal(t, "sig-123", thinkingBlock["signature"])
+	assert.NotContains(t, thinkingBlock, "text")
+
+	textBlock := content[1].(map[string]any)
+	assert.Equal(t, "text", textBlock["type"])
+	assert.Equal(t, "Hello!", textBlock["text"])
+}
+
+func TestGeminiProvider_StreamingThinkingParts(t *testing.T) {
+	provider := NewGeminiProvider()
+	state := &StreamState{}
+
+	chunks := []map[string]any{
+		{
+			"responseId":   "gemini-stream-123",
+			"modelVersion": "gemini-2.5-pro",
+			"candidates": []map[string]any{
+				{
+					"content": map[string]any{
+						"role": "model",
+						"parts": []map[string]any{
+							{"text": "Thinking it over.", "thought": true},
+						},
+					},
+				},
+			},
+		},
+		{
+			"candidates": []map[string]any{
+				{
+					"content": map[string]any{
+						"role": "model",
+						"parts": []map[string]any{
+							{"text": "Hello!", "thoughtSignature": "sig-123"},
+						},
+					},
+					"finishReason": "STOP",
+				},
+			},
+		},
+	}
+
+	var events []map[string]any
+
+	for _, chunk := range chunks {
+		chunkJSON, err := json.Marshal(chunk)
+		require.NoError(t, err)
+
+		result, err := provider.TransformStream(chunkJSON, state)
+		require.NoError(t, err)
+
+		for _, line := range strings.Split(string(result), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var event map[string]any
+				require.NoError(t, json.Unmarshal([]byte(data), &event))
+				events = append(events, event)
+			}
+		}
+	}
+
+	var types []string
+
+	blockTypes := make(map[float64]string)
+	thinking, text := "", ""
+	signature := ""
+
+	for _, event := range events {
+		eventType := event["type"].(string)
+		types = append(types, eventType)
+
+		switch eventType {
+		case "content_block_start":
+			block := event["content_block"].(map[string]any)
+			blockTypes[event["index"].(float64)] = block["type"].(string)
+		case "content_block_delta":
+			delta := event["delta"].(map[string]any)
+			switch delta["type"] {
+			case "thinking_delta":
+				thinking += delta["thinking"].(string)
+			case "signature_delta":
+				signature = delta["signature"].(string)
+			case "text_delta":
+				text += delta["text"].(string)
+			}
+		}
+	}
+
+	assert.Equal(t, map[float64]string{0: "thinking", 1: "text"}, blockTypes)
+	assert.Equal(t, "Thinking it over.", thinking)
+	assert.Equal(t, "Hello!", text, "thinking must not leak into the answer")
+	assert.Equal(t, "sig-123", signature)
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta",
+		"content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta",
+		"content_block_stop", "message_delta", "message_stop",
+	}, types)
+}
+
 func TestGeminiProvider_ConvertUsage(t *testing.T) {
 	provider := NewGeminiProvider()
 
@@ -528,3 +1127,136 @@ func TestGeminiProvider_EmptyContent(t *testing.T) {
 		assert.Equal(t, "", text.(string))
 	}
 }
+
+func TestGeminiProvider_SafetyBlocks(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	t.Run("blocked response", func(t *testing.T) {
+		result, err := provider.TransformResponse([]byte(`{"responseId":"r1","modelVersion":"gemini-2.0-flash","candidates":[{"index":0,` +
+			`"finishReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"},` +
+			`{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true}]}]}`))
+		require.NoError(t, err)
+
+		var anthropicResp map[string]any
+		require.NoError(t, json.Unmarshal(result, &anthropicResp))
+
+		assert.Equal(t, "message", anthropicResp["type"])
+		assert.Equal(t, "stop_sequence", anthropicResp["stop_reason"])
+
+		content := anthropicResp["content"].([]any)
+		require.Len(t, content, 1)
+		assert.Equal(t, "[Gemini blocked the response: SAFETY (HARM_CATEGORY_DANGEROUS_CONTENT)]", content[0].(map[string]any)["text"])
+	})
+
+	t.Run("blocked prompt", func(t *testing.T) {
+		result, err := provider.TransformResponse([]byte(`{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":` +
+			`[{"category":"HARM_CATEGORY_HATE_SPEECH","probability":"HIGH"}]},"modelVersion":"gemini-2.0-flash"}`))
+		require.NoError(t, err)
+
+		var anthropicResp map[string]any
+		require.NoError(t, json.Unmarshal(result, &anthropicResp))
+
+		// The same labelled text block a stream ends with, not an error body under a 200
+		assert.Equal(t, "message", anthropicResp["type"])
+		assert.Equal(t, "stop_sequence", anthropicResp["stop_reason"])
+
+		content := anthropicResp["content"].([]any)
+		require.Len(t, content, 1)
+		assert.Equal(t, "[Gemini blocked the prompt: SAFETY (HARM_CATEGORY_HATE_SPEECH)]", content[0].(map[string]any)["text"])
+
+		events, err := provider.TransformStream([]byte(`{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":`+
+			`[{"category":"HARM_CATEGORY_HATE_SPEECH","probability":"HIGH"}]},"modelVersion":"gemini-2.0-flash"}`), &StreamState{})
+		require.NoError(t, err)
+
+		parsed, err := ParseSSEEvents(events)
+		require.NoError(t, err)
+		require.Len(t, parsed, 6)
+		assert.Equal(t, content[0].(map[string]any)["text"], parsed[2].Data["delta"].(map[string]any)["text"])
+		assert.Equal(t, "stop_sequence", parsed[4].Data["delta"].(map[string]any)["stop_reason"])
+	})
+
+	t.Run("blocked stream", func(t *testing.T) {
+		state := &StreamState{}
+
+		events, err := provider.TransformStream([]byte(`{"candidates":[{"finishReason":"SAFETY","safetyRatings":`+
+			`[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true}]}],"modelVersion":"gemini-2.0-flash"}`), state)
+		require.NoError(t, err)
+
+		parsed, err := ParseSSEEvents(events)
+		require.NoError(t, err)
+
+		assertValidEventSequence(t, parsed)
+		assert.Equal(t, []string{"message_start", "content_block_start:text", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}, eventTypes(parsed))
+
+		delta := parsed[2].Data["delta"].(map[string]any)
+		assert.Equal(t, "[Gemini blocked the response: SAFETY (HARM_CATEGORY_HARASSMENT)]", delta["text"])
+		assert.Equal(t, "stop_sequence", parsed[4].Data["delta"].(map[string]any)["stop_reason"])
+	})
+}
+
+func TestGeminiProvider_StreamingUsagePerChunk(t *testing.T) {
+	textChunk := func(text string, usage map[string]any) map[string]any {
+		chunk := map[string]any{
+			"responseId":   "gemini-usage",
+			"modelVersion": "gemini-2.5-flash",
+			"candidates": []map[string]any{
+				{"content": map[string]any{"role": "model", "parts": []map[string]any{{"text": text}}}},
+			},
+		}
+
+		if usage != nil {
+			chunk["usageMetadata"] = usage
+		}
+
+		return chunk
+	}
+
+	finishChunk := textChunk("", nil)
+	finishChunk["candidates"].([]map[string]any)[0]["finishReason"] = "STOP"
+
+	// Each chunk reports the running totals; the finish chunk reports none
+	_, usage := transformStreamChunks(t, NewGeminiProvider(), []map[string]any{
+		textChunk("Hello", map[string]any{"promptTokenCount": 50, "candidatesTokenCount": 1}),
+		textChunk(" there", map[string]any{"promptTokenCount": 50, "candidatesTokenCount": 3, "cachedContentTokenCount": 20}),
+		finishChunk,
+	})
+
+	assert.Equal(t, map[string]any{
+		"input_tokens":            float64(50),
+		"output_tokens":           float64(3),
+		"cache_read_input_tokens": float64(20),
+	}, usage)
+}
+
+func TestGeminiProvider_TransformRequestToolChoice(t *testing.T) {
+	provider := NewGeminiProvider()
+
+	testCases := []struct {
+		name       string
+		toolChoice string
+		expected   any
+	}{
+		{"auto", `{"type":"auto"}`, map[string]any{"mode": "AUTO"}},
+		{"any", `{"type":"any"}`, map[string]any{"mode": "ANY"}},
+		{"none", `{"type":"none"}`, map[string]any{"mode": "NONE"}},
+		{"specific tool", `{"type":"tool","name":"get_weather"}`, map[string]any{
+			"mode":                 "ANY",
+			"allowedFunctionNames": []any{"get_weather"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"Weather?"}],` +
+				`"tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":` + tc.toolChoice + `}`
+
+			result, err := provider.TransformRequest([]byte(request))
+			require.NoError(t, err)
+
+			var transformed map[string]any
+			require.NoError(t, json.Unmarshal(result, &transformed))
+			assert.Equal(t, map[string]any{"functionCallingConfig": tc.expected}, transformed["toolConfig"])
+			assert.NotContains(t, transformed, "tool_choice")
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package providers
+
+// LMStudioProvider targets LM Studio's local OpenAI-compatible server. It runs without
+// an API key, so no Authorization header is sent unless one is configured.
+type LMStudioProvider struct {
+	*OpenAIProvider
+}
+
+func NewLMStudioProvider() *LMStudioProvider {
+	return &LMStudioProvider{
+		OpenAIProvider: &OpenAIProvider{
+			name:     "lmstudio",
+			endpoint: "http://localhost:1234/v1/chat/completions",
+		},
+	}
+}
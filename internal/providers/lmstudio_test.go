@@ -0,0 +1,16 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLMStudioProvider_BasicMethods(t *testing.T) {
+	provider := NewLMStudioProvider()
+
+	assert.Equal(t, "lmstudio", provider.Name())
+	assert.True(t, provider.SupportsStreaming())
+	assert.Equal(t, "http://localhost:1234/v1/chat/completions", provider.GetEndpoint())
+	assert.Empty(t, provider.apiKey, "LM Studio needs no API key by default")
+}
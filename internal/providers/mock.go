@@ -0,0 +1,254 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MockEndpoint is the mock provider's API base; requests to it never leave the process
+	MockEndpoint = "mock://mock"
+
+	// DefaultMockText is the reply of a mock provider configured without text or tool calls
+	DefaultMockText = "This is a mock response from claude-code-open."
+)
+
+// MockToolCall is a tool call the mock provider answers with
+type MockToolCall struct {
+	Name  string
+	Input map[string]any
+}
+
+// MockProvider answers every request with a canned Anthropic message, streamed or not,
+// without any network call. It is registered only when a "mock" provider is configured
+// or the server runs with --mock, for testing the Claude Code integration end to end.
+//
+// The proxy sends requests through RoundTrip instead of an HTTP client, so the rest of
+// the request path (routing, transformation, streaming, usage) runs as for real providers.
+type MockProvider struct {
+	name      string
+	text      string
+	toolCalls []MockToolCall
+}
+
+func NewMockProvider(text string, toolCalls []MockToolCall) *MockProvider {
+	if text == "" && len(toolCalls) == 0 {
+		text = DefaultMockText
+	}
+
+	return &MockProvider{
+		name:      "mock",
+		text:      text,
+		toolCalls: toolCalls,
+	}
+}
+
+func (p *MockProvider) Name() string {
+	return p.name
+}
+
+func (p *MockProvider) SupportsStreaming() bool {
+	return true
+}
+
+func (p *MockProvider) GetEndpoint() string {
+	return MockEndpoint
+}
+
+func (p *MockProvider) SetAPIKey(string) {}
+
+func (p *MockProvider) IsStreaming(headers map[string][]string) bool {
+	return DetectStreaming(headers)
+}
+
+func (p *MockProvider) TransformRequest(request []byte) ([]byte, error) {
+	// The mock speaks the Anthropic format
+	return request, nil
+}
+
+func (p *MockProvider) TransformResponse(response []byte) ([]byte, error) {
+	return response, nil
+}
+
+// TransformStream formats the data of one mock event as an Anthropic SSE event
+func (p *MockProvider) TransformStream(chunk []byte, _ *StreamState) ([]byte, error) {
+	var event map[string]any
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse mock event: %w", err)
+	}
+
+	eventType, _ := event["type"].(string)
+
+	return FormatSSEEvent(eventType, event), nil
+}
+
+// RoundTrip answers the upstream request with the canned message
+func (p *MockProvider) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mock request: %w", err)
+		}
+
+		if err := req.Body.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse mock request: %w", err)
+	}
+
+	message := p.message(request.Model, len(body))
+
+	var (
+		responseBody []byte
+		contentType  string
+	)
+
+	if request.Stream {
+		responseBody = p.streamEvents(message)
+		contentType = ContentTypeEventStream
+	} else {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+
+		responseBody = data
+		contentType = "application/json"
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(responseBody)),
+		ContentLength: int64(len(responseBody)),
+		Request:       req,
+	}, nil
+}
+
+// message builds the canned reply. Token counts are rough but deterministic: a token
+// per four request bytes and per word of output.
+func (p *MockProvider) message(model string, requestSize int) map[string]any {
+	content := make([]any, 0, 1+len(p.toolCalls))
+	outputTokens := len(strings.Fields(p.text))
+
+	if p.text != "" {
+		content = append(content, map[string]any{"type": "text", "text": p.text})
+	}
+
+	for i, call := range p.toolCalls {
+		input := call.Input
+		if input == nil {
+			input = map[string]any{}
+		}
+
+		content = append(content, map[string]any{
+			"type":  "tool_use",
+			"id":    fmt.Sprintf("toolu_mock_%d", i+1),
+			"name":  call.Name,
+			"input": input,
+		})
+		outputTokens++
+	}
+
+	stopReason := StopReasonEndTurn
+	if len(p.toolCalls) > 0 {
+		stopReason = "tool_use"
+	}
+
+	return map[string]any{
+		"id":            "msg_mock",
+		"type":          "message",
+		"role":          "assistant",
+		"model":         model,
+		"content":       content,
+		"stop_reason":   stopReason,
+		"stop_sequence": nil,
+		"usage": map[string]any{
+			"input_tokens":  max(requestSize/4, 1),
+			"output_tokens": outputTokens,
+		},
+	}
+}
+
+// streamEvents renders the message as the data lines of an Anthropic event stream,
+// sending text a word at a time and tool input as a single JSON delta
+func (p *MockProvider) streamEvents(message map[string]any) []byte {
+	var stream bytes.Buffer
+
+	writeEvent := func(event map[string]any) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(&stream, "data: %s\n\n", data)
+	}
+
+	usage, _ := message["usage"].(map[string]any)
+
+	start := make(map[string]any, len(message))
+	for key, value := range message {
+		start[key] = value
+	}
+
+	start["content"] = []any{}
+	start["stop_reason"] = nil
+	start["usage"] = map[string]any{"input_tokens": usage["input_tokens"], "output_tokens": 0}
+
+	writeEvent(map[string]any{"type": "message_start", "message": start})
+
+	content, _ := message["content"].([]any)
+
+	for index, item := range content {
+		block, _ := item.(map[string]any)
+
+		switch block["type"] {
+		case "text":
+			writeEvent(map[string]any{"type": "content_block_start", "index": index,
+				"content_block": map[string]any{"type": "text", "text": ""}})
+
+			text, _ := block["text"].(string)
+			for _, word := range strings.SplitAfter(text, " ") {
+				writeEvent(map[string]any{"type": "content_block_delta", "index": index,
+					"delta": map[string]any{"type": "text_delta", "text": word}})
+			}
+		case "tool_use":
+			writeEvent(map[string]any{"type": "content_block_start", "index": index,
+				"content_block": map[string]any{"type": "tool_use", "id": block["id"], "name": block["name"], "input": map[string]any{}}})
+
+			input, _ := json.Marshal(block["input"])
+			writeEvent(map[string]any{"type": "content_block_delta", "index": index,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": string(input)}})
+		}
+
+		writeEvent(map[string]any{"type": "content_block_stop", "index": index})
+	}
+
+	writeEvent(map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": message["stop_reason"], "stop_sequence": nil},
+		"usage": usage,
+	})
+	writeEvent(map[string]any{"type": "message_stop"})
+
+	return stream.Bytes()
+}
@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockProvider_RoundTripMessage(t *testing.T) {
+	provider := NewMockProvider("", []MockToolCall{
+		{Name: "Bash", Input: map[string]any{"command": "ls"}},
+	})
+
+	req, err := http.NewRequest(http.MethodPost, MockEndpoint,
+		strings.NewReader(`{"model":"test-model","messages":[{"role":"user","content":"List files"}]}`))
+	require.NoError(t, err)
+
+	resp, err := provider.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, provider.IsStreaming(resp.Header))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var message map[string]any
+	require.NoError(t, json.Unmarshal(body, &message))
+
+	assert.Equal(t, "test-model", message["model"])
+	assert.Equal(t, "tool_use", message["stop_reason"])
+	assert.Equal(t, []any{map[string]any{
+		"type":  "tool_use",
+		"id":    "toolu_mock_1",
+		"name":  "Bash",
+		"input": map[string]any{"command": "ls"},
+	}}, message["content"], "only tool calls are sent when no text is configured")
+}
+
+func TestMockProvider_DefaultText(t *testing.T) {
+	provider := NewMockProvider("", nil)
+
+	req, err := http.NewRequest(http.MethodPost, MockEndpoint, strings.NewReader(`{"model":"m","stream":true}`))
+	require.NoError(t, err)
+
+	resp, err := provider.RoundTrip(req)
+	require.NoError(t, err)
+	assert.True(t, provider.IsStreaming(resp.Header))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var text strings.Builder
+
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		events, err := provider.TransformStream([]byte(data), nil)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(events), "event: "+event["type"].(string)+"\n"))
+
+		if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "text_delta" {
+			text.WriteString(delta["text"].(string))
+		}
+	}
+
+	assert.Equal(t, DefaultMockText, text.String())
+}
@@ -39,23 +39,7 @@ func (p *NvidiaProvider) SetAPIKey(key string) {
 }
 
 func (p *NvidiaProvider) IsStreaming(headers map[string][]string) bool {
-	if contentType, ok := headers["Content-Type"]; ok {
-		for _, ct := range contentType {
-			if ct == "text/event-stream" || strings.Contains(ct, "stream") {
-				return true
-			}
-		}
-	}
-
-	if transferEncoding, ok := headers["Transfer-Encoding"]; ok {
-		for _, te := range transferEncoding {
-			if te == "chunked" {
-				return true
-			}
-		}
-	}
-
-	return false
+	return DetectStreaming(headers)
 }
 
 func (p *NvidiaProvider) TransformRequest(request []byte) ([]byte, error) {
@@ -165,8 +149,10 @@ func (p *NvidiaProvider) formatSSEEvent(eventType string, data map[string]any) [
 func (p *NvidiaProvider) handleTextContent(content string, state *StreamState) []byte {
 	var events []byte
 
-	// Get or create text content block at index 0
-	textIndex := p.getOrCreateTextBlock(state)
+	// The answer follows the reasoning, so the thinking block ends here
+	events = append(events, p.closeThinkingBlock(state)...)
+
+	textIndex := p.getOrCreateBlock(ContentTypeText, state)
 	contentBlock := state.ContentBlocks[textIndex]
 
 	// Send content_block_start event if needed
@@ -181,10 +167,55 @@ func (p *NvidiaProvider) handleTextContent(content string, state *StreamState) [
 	return events
 }
 
+// handleReasoningContent streams reasoning_content from reasoning models as thinking deltas
+func (p *NvidiaProvider) handleReasoningContent(reasoning string, state *StreamState) []byte {
+	var events []byte
+
+	thinkingIndex := p.getOrCreateBlock(ContentTypeThinking, state)
+	contentBlock := state.ContentBlocks[thinkingIndex]
+
+	if !contentBlock.StartSent {
+		events = append(events, p.createThinkingBlockStartEvent(thinkingIndex)...)
+		contentBlock.StartSent = true
+	}
+
+	events = append(events, p.formatSSEEvent("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": thinkingIndex,
+		"delta": map[string]any{
+			"type":     "thinking_delta",
+			"thinking": reasoning,
+		},
+	})...)
+
+	return events
+}
+
+// closeThinkingBlock stops the open thinking block, if any
+func (p *NvidiaProvider) closeThinkingBlock(state *StreamState) []byte {
+	var events []byte
+
+	for index, block := range state.ContentBlocks {
+		if block.Type != ContentTypeThinking || !block.StartSent || block.StopSent {
+			continue
+		}
+
+		events = append(events, p.formatSSEEvent("content_block_stop", map[string]any{
+			"type":  "content_block_stop",
+			"index": index,
+		})...)
+		block.StopSent = true
+	}
+
+	return events
+}
+
 // handleToolCalls processes tool call streaming
 func (p *NvidiaProvider) handleToolCalls(toolCalls []any, state *StreamState) []byte {
 	var events []byte
 
+	events = append(events, p.closeThinkingBlock(state)...)
+
 	for _, toolCall := range toolCalls {
 		if tcMap, ok := toolCall.(map[string]any); ok {
 			toolCallEvents := p.handleSingleToolCall(tcMap, state)
@@ -202,6 +233,11 @@ func (p *NvidiaProvider) handleSingleToolCall(toolCall map[string]any, state *St
 	// Parse tool call data
 	toolCallData := p.parseToolCallData(toolCall)
 
+	// An earlier tool call still waiting for its id can't wait past the next one
+	if toolCallData.HasIndex {
+		events = append(events, startPendingToolBlocks(state, toolCallData.Index)...)
+	}
+
 	// Find or create content block
 	contentBlockIndex := p.findOrCreateContentBlock(toolCallData, state)
 	if contentBlockIndex == -1 {
@@ -217,15 +253,22 @@ func (p *NvidiaProvider) handleSingleToolCall(toolCall map[string]any, state *St
 	if !contentBlock.StartSent && p.shouldSendStartEvent(contentBlock) {
 		events = append(events, p.createContentBlockStartEvent(contentBlockIndex, contentBlock)...)
 		contentBlock.StartSent = true
+
+		// Flush arguments buffered while waiting for the ID
+		if contentBlock.Arguments != "" {
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, contentBlock.Arguments)...)
+		}
 	}
 
-	// Handle argument streaming
-	if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
+	// Handle argument streaming, buffering until content_block_start is sent
+	if toolCallData.Arguments != "" && !contentBlock.StartSent {
+		contentBlock.Arguments += toolCallData.Arguments
+	} else if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
 		newPart := p.calculateArgumentsDelta(toolCallData.Arguments, contentBlock.Arguments)
 		contentBlock.Arguments = toolCallData.Arguments
 
 		if newPart != "" {
-			events = append(events, p.createInputDeltaEvent(contentBlockIndex, newPart)...)
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, newPart)...)
 		}
 	}
 
@@ -287,8 +330,10 @@ func (p *NvidiaProvider) findOrCreateContentBlock(data NvidiaToolCallData, state
 		}
 	}
 
-	// Create new content block if we have an ID (first chunk)
-	if data.ID != "" {
+	// Create new content block on the first chunk. Some gateways send only the
+	// index and function name first and the ID in a later chunk, so the index
+	// alone is enough to start tracking the tool call.
+	if data.ID != "" || data.HasIndex {
 		contentBlockIndex := len(state.ContentBlocks)
 		state.ContentBlocks[contentBlockIndex] = &ContentBlockState{
 			Type:          "tool_use",
@@ -309,6 +354,11 @@ func (p *NvidiaProvider) updateContentBlock(block *ContentBlockState, data Nvidi
 	if data.FunctionName != "" {
 		block.ToolName = data.FunctionName
 	}
+
+	// Backfill the ID when it arrives after the block was created
+	if block.ToolCallID == "" && data.ID != "" {
+		block.ToolCallID = data.ID
+	}
 }
 
 // shouldSendStartEvent determines if content_block_start event should be sent
@@ -357,8 +407,10 @@ func (p *NvidiaProvider) calculateArgumentsDelta(newArgs, oldArgs string) string
 	return newArgs
 }
 
-// createInputDeltaEvent creates input_json_delta SSE event
-func (p *NvidiaProvider) createInputDeltaEvent(index int, partialJSON string) []byte {
+// createInputDeltaEvent creates input_json_delta SSE event, recording what the block has sent
+func (p *NvidiaProvider) createInputDeltaEvent(index int, block *ContentBlockState, partialJSON string) []byte {
+	block.SentArguments += partialJSON
+
 	inputDeltaEvent := map[string]any{
 		"type":  "content_block_delta",
 		"index": index,
@@ -371,16 +423,35 @@ func (p *NvidiaProvider) createInputDeltaEvent(index int, partialJSON string) []
 	return p.formatSSEEvent("content_block_delta", inputDeltaEvent)
 }
 
-// getOrCreateTextBlock gets or creates text content block at index 0
-func (p *NvidiaProvider) getOrCreateTextBlock(state *StreamState) int {
-	textIndex := 0
-	if _, exists := state.ContentBlocks[textIndex]; !exists {
-		state.ContentBlocks[textIndex] = &ContentBlockState{
-			Type: "text",
+// getOrCreateBlock returns the open content block of the given type, creating it after
+// any existing blocks
+func (p *NvidiaProvider) getOrCreateBlock(blockType string, state *StreamState) int {
+	for index, block := range state.ContentBlocks {
+		if block.Type == blockType && !block.StopSent {
+			return index
 		}
 	}
 
-	return textIndex
+	index := len(state.ContentBlocks)
+	state.ContentBlocks[index] = &ContentBlockState{
+		Type: blockType,
+	}
+
+	return index
+}
+
+// createThinkingBlockStartEvent creates content_block_start event for thinking
+func (p *NvidiaProvider) createThinkingBlockStartEvent(index int) []byte {
+	contentBlockStartEvent := map[string]any{
+		"type":  "content_block_start",
+		"index": index,
+		"content_block": map[string]any{
+			"type":     ContentTypeThinking,
+			"thinking": "",
+		},
+	}
+
+	return p.formatSSEEvent("content_block_start", contentBlockStartEvent)
 }
 
 // createTextBlockStartEvent creates content_block_start event for text
@@ -463,7 +534,7 @@ func (p *NvidiaProvider) removeAnthropicSpecificFields(request map[string]any) m
 		fieldsToRemove = append(fieldsToRemove, "metadata")
 	}
 
-	cleaned := p.removeFieldsRecursively(request, fieldsToRemove).(map[string]any)
+	cleaned := RemoveRequestFields(request, fieldsToRemove).(map[string]any)
 
 	if tools, hasTools := cleaned["tools"]; !hasTools || tools == nil {
 		delete(cleaned, "tool_choice")
@@ -474,39 +545,6 @@ func (p *NvidiaProvider) removeAnthropicSpecificFields(request map[string]any) m
 	return cleaned
 }
 
-func (p *NvidiaProvider) removeFieldsRecursively(data any, fieldsToRemove []string) any {
-	switch v := data.(type) {
-	case map[string]any:
-		result := make(map[string]any)
-
-		for key, value := range v {
-			shouldRemove := false
-
-			for _, field := range fieldsToRemove {
-				if key == field {
-					shouldRemove = true
-					break
-				}
-			}
-
-			if !shouldRemove {
-				result[key] = p.removeFieldsRecursively(value, fieldsToRemove)
-			}
-		}
-
-		return result
-	case []any:
-		result := make([]any, len(v))
-		for i, item := range v {
-			result[i] = p.removeFieldsRecursively(item, fieldsToRemove)
-		}
-
-		return result
-	default:
-		return v
-	}
-}
-
 func (p *NvidiaProvider) transformTools(tools []any) ([]any, error) {
 	return TransformTools(tools)
 }
@@ -554,7 +592,7 @@ func (p *NvidiaProvider) extractToolResults(content []any) []any {
 					toolMessage := map[string]any{
 						"role":         "tool",
 						"tool_call_id": toolCallID,
-						"content":      blockMap["content"],
+						"content":      TransformToolResultContent(blockMap),
 					}
 					toolMessages = append(toolMessages, toolMessage)
 				}
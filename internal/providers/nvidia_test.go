@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -423,6 +424,149 @@ func TestNvidiaProvider_TransformStream(t *testing.T) {
 	assert.Contains(t, eventStr, "end_turn")
 }
 
+func TestNvidiaProvider_StreamingReasoningContent(t *testing.T) {
+	testCases := []struct {
+		name       string
+		answer     map[string]any
+		blockTypes map[float64]string
+		stopReason string
+	}{
+		{
+			name:       "reasoning then text",
+			answer:     map[string]any{"content": "The answer is 4."},
+			blockTypes: map[float64]string{0: "thinking", 1: "text"},
+			stopReason: "end_turn",
+		},
+		{
+			name: "reasoning then tool call",
+			answer: map[string]any{
+				"tool_calls": []map[string]any{
+					{
+						"index": 0,
+						"id":    "call_123",
+						"type":  "function",
+						"function": map[string]any{
+							"name":      "calculator",
+							"arguments": `{"expression":"2+2"}`,
+						},
+					},
+				},
+			},
+			blockTypes: map[float64]string{0: "thinking", 1: "tool_use"},
+			stopReason: "tool_use",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := NewNvidiaProvider()
+			state := &StreamState{}
+
+			finishReason := "stop"
+			if tc.stopReason == "tool_use" {
+				finishReason = "tool_calls"
+			}
+
+			chunks := []map[string]any{
+				{
+					"id":    "chatcmpl-nvidia-r1",
+					"model": "deepseek-ai/deepseek-r1",
+					"choices": []map[string]any{
+						{"index": 0, "delta": map[string]any{"role": "assistant", "content": "", "reasoning_content": "Two plus two"}},
+					},
+				},
+				{
+					"id":    "chatcmpl-nvidia-r1",
+					"model": "deepseek-ai/deepseek-r1",
+					"choices": []map[string]any{
+						{"index": 0, "delta": map[string]any{"reasoning_content": " is four."}},
+					},
+				},
+				{
+					"id":    "chatcmpl-nvidia-r1",
+					"model": "deepseek-ai/deepseek-r1",
+					"choices": []map[string]any{
+						{"index": 0, "delta": tc.answer},
+					},
+				},
+				{
+					"id":    "chatcmpl-nvidia-r1",
+					"model": "deepseek-ai/deepseek-r1",
+					"choices": []map[string]any{
+						{"index": 0, "delta": map[string]any{}, "finish_reason": finishReason},
+					},
+				},
+			}
+
+			var stream []byte
+
+			for _, chunk := range chunks {
+				chunkJSON, err := json.Marshal(chunk)
+				require.NoError(t, err)
+
+				result, err := provider.TransformStream(chunkJSON, state)
+				require.NoError(t, err)
+
+				stream = append(stream, result...)
+			}
+
+			// No usage was reported, so the message completes at the end of the stream
+			stream = append(stream, FinishStream(state)...)
+
+			var events []map[string]any
+
+			for _, line := range strings.Split(string(stream), "\n") {
+				if data, ok := strings.CutPrefix(line, "data: "); ok {
+					var event map[string]any
+					require.NoError(t, json.Unmarshal([]byte(data), &event))
+					events = append(events, event)
+				}
+			}
+
+			blockTypes := make(map[float64]string)
+			thinking, text := "", ""
+			thinkingStopped := false
+
+			for _, event := range events {
+				index, _ := event["index"].(float64)
+
+				switch event["type"] {
+				case "content_block_start":
+					// The thinking block must be closed before the answer starts
+					if len(blockTypes) > 0 {
+						assert.True(t, thinkingStopped, "thinking block still open when block %v started", index)
+					}
+
+					blockTypes[index] = event["content_block"].(map[string]any)["type"].(string)
+				case "content_block_stop":
+					if blockTypes[index] == "thinking" {
+						thinkingStopped = true
+					}
+				case "content_block_delta":
+					delta := event["delta"].(map[string]any)
+					switch delta["type"] {
+					case "thinking_delta":
+						assert.Equal(t, 0.0, index)
+						thinking += delta["thinking"].(string)
+					case "text_delta":
+						text += delta["text"].(string)
+					}
+				case "message_delta":
+					assert.Equal(t, tc.stopReason, event["delta"].(map[string]any)["stop_reason"])
+				}
+			}
+
+			assert.Equal(t, tc.blockTypes, blockTypes)
+			assert.Equal(t, "Two plus two is four.", thinking)
+			assert.NotContains(t, text, "Two plus two", "reasoning must not leak into the answer")
+
+			if tc.stopReason == "end_turn" {
+				assert.Equal(t, "The answer is 4.", text)
+			}
+		})
+	}
+}
+
 func TestNvidiaProvider_StreamingToolCalls(t *testing.T) {
 	provider := NewNvidiaProvider()
 	state := &StreamState{}
@@ -561,3 +705,16 @@ func TestNvidiaProvider_MapNvidiaErrorType(t *testing.T) {
 		})
 	}
 }
+
+func TestNvidiaProvider_StreamingUsageInFinishChunk(t *testing.T) {
+	_, usage := transformStreamChunks(t, NewNvidiaProvider(), []map[string]any{
+		{"id": "chatcmpl-nv", "model": "meta/llama-3.1-70b-instruct", "choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": "Hi"}}}},
+		{"id": "chatcmpl-nv", "model": "meta/llama-3.1-70b-instruct", "choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}},
+			"usage": map[string]any{"prompt_tokens": 30, "completion_tokens": 2}},
+	})
+
+	assert.Equal(t, map[string]any{
+		"input_tokens":  float64(30),
+		"output_tokens": float64(2),
+	}, usage)
+}
@@ -39,23 +39,7 @@ func (p *OpenAIProvider) SetAPIKey(key string) {
 }
 
 func (p *OpenAIProvider) IsStreaming(headers map[string][]string) bool {
-	if contentType, ok := headers["Content-Type"]; ok {
-		for _, ct := range contentType {
-			if ct == ContentTypeEventStream || strings.Contains(ct, "stream") {
-				return true
-			}
-		}
-	}
-
-	if transferEncoding, ok := headers["Transfer-Encoding"]; ok {
-		for _, te := range transferEncoding {
-			if te == TransferEncodingChunked {
-				return true
-			}
-		}
-	}
-
-	return false
+	return DetectStreaming(headers)
 }
 
 func (p *OpenAIProvider) TransformRequest(request []byte) ([]byte, error) {
@@ -90,6 +74,8 @@ type anthropicResponse struct {
 type anthropicContent struct {
 	Type      string                 `json:"type"`
 	Text      *string                `json:"text,omitempty"`
+	Thinking  *string                `json:"thinking,omitempty"`
+	Signature *string                `json:"signature,omitempty"`
 	ID        *string                `json:"id,omitempty"`
 	Name      *string                `json:"name,omitempty"`
 	Input     map[string]any `json:"input,omitempty"`
@@ -238,6 +224,11 @@ func (p *OpenAIProvider) handleSingleToolCall(toolCall map[string]any, state *St
 	// Parse tool call data
 	toolCallData := p.parseToolCallData(toolCall)
 
+	// An earlier tool call still waiting for its id can't wait past the next one
+	if toolCallData.HasIndex {
+		events = append(events, startPendingToolBlocks(state, toolCallData.Index)...)
+	}
+
 	// Find or create content block
 	contentBlockIndex := p.findOrCreateContentBlock(toolCallData, state)
 	if contentBlockIndex == -1 {
@@ -253,15 +244,22 @@ func (p *OpenAIProvider) handleSingleToolCall(toolCall map[string]any, state *St
 	if !contentBlock.StartSent && p.shouldSendStartEvent(contentBlock) {
 		events = append(events, p.createContentBlockStartEvent(contentBlockIndex, contentBlock)...)
 		contentBlock.StartSent = true
+
+		// Flush arguments buffered while waiting for the ID
+		if contentBlock.Arguments != "" {
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, contentBlock.Arguments)...)
+		}
 	}
 
-	// Handle argument streaming
-	if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
+	// Handle argument streaming, buffering until content_block_start is sent
+	if toolCallData.Arguments != "" && !contentBlock.StartSent {
+		contentBlock.Arguments += toolCallData.Arguments
+	} else if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
 		newPart := p.calculateArgumentsDelta(toolCallData.Arguments, contentBlock.Arguments)
 		contentBlock.Arguments = toolCallData.Arguments
 
 		if newPart != "" {
-			events = append(events, p.createInputDeltaEvent(contentBlockIndex, newPart)...)
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, newPart)...)
 		}
 	}
 
@@ -323,8 +321,10 @@ func (p *OpenAIProvider) findOrCreateContentBlock(data OpenAIToolCallData, state
 		}
 	}
 
-	// Create new content block if we have an ID (first chunk)
-	if data.ID != "" {
+	// Create new content block on the first chunk. Some gateways send only the
+	// index and function name first and the ID in a later chunk, so the index
+	// alone is enough to start tracking the tool call.
+	if data.ID != "" || data.HasIndex {
 		contentBlockIndex := len(state.ContentBlocks)
 		state.ContentBlocks[contentBlockIndex] = &ContentBlockState{
 			Type:          "tool_use",
@@ -345,6 +345,11 @@ func (p *OpenAIProvider) updateContentBlock(block *ContentBlockState, data OpenA
 	if data.FunctionName != "" {
 		block.ToolName = data.FunctionName
 	}
+
+	// Backfill the ID when it arrives after the block was created
+	if block.ToolCallID == "" && data.ID != "" {
+		block.ToolCallID = data.ID
+	}
 }
 
 // shouldSendStartEvent determines if content_block_start event should be sent
@@ -393,8 +398,10 @@ func (p *OpenAIProvider) calculateArgumentsDelta(newArgs, oldArgs string) string
 	return newArgs
 }
 
-// createInputDeltaEvent creates input_json_delta SSE event
-func (p *OpenAIProvider) createInputDeltaEvent(index int, partialJSON string) []byte {
+// createInputDeltaEvent creates input_json_delta SSE event, recording what the block has sent
+func (p *OpenAIProvider) createInputDeltaEvent(index int, block *ContentBlockState, partialJSON string) []byte {
+	block.SentArguments += partialJSON
+
 	inputDeltaEvent := map[string]any{
 		"type":  "content_block_delta",
 		"index": index,
@@ -499,7 +506,14 @@ func (p *OpenAIProvider) removeAnthropicSpecificFields(request map[string]any) m
 		fieldsToRemove = append(fieldsToRemove, "metadata")
 	}
 
-	cleaned := p.removeFieldsRecursively(request, fieldsToRemove).(map[string]any)
+	cleaned := RemoveRequestFields(request, fieldsToRemove).(map[string]any)
+
+	// Streams only report usage when asked to, in a chunk after the finish reason
+	if stream, _ := cleaned["stream"].(bool); stream {
+		if _, hasStreamOptions := cleaned["stream_options"]; !hasStreamOptions {
+			cleaned["stream_options"] = map[string]any{"include_usage": true}
+		}
+	}
 
 	if tools, hasTools := cleaned["tools"]; !hasTools || tools == nil {
 		delete(cleaned, "tool_choice")
@@ -510,39 +524,6 @@ func (p *OpenAIProvider) removeAnthropicSpecificFields(request map[string]any) m
 	return cleaned
 }
 
-func (p *OpenAIProvider) removeFieldsRecursively(data any, fieldsToRemove []string) any {
-	switch v := data.(type) {
-	case map[string]any:
-		result := make(map[string]any)
-
-		for key, value := range v {
-			shouldRemove := false
-
-			for _, field := range fieldsToRemove {
-				if key == field {
-					shouldRemove = true
-					break
-				}
-			}
-
-			if !shouldRemove {
-				result[key] = p.removeFieldsRecursively(value, fieldsToRemove)
-			}
-		}
-
-		return result
-	case []any:
-		result := make([]any, len(v))
-		for i, item := range v {
-			result[i] = p.removeFieldsRecursively(item, fieldsToRemove)
-		}
-
-		return result
-	default:
-		return v
-	}
-}
-
 func (p *OpenAIProvider) transformTools(tools []any) ([]any, error) {
 	return TransformTools(tools)
 }
@@ -590,7 +571,7 @@ func (p *OpenAIProvider) extractToolResults(content []any) []any {
 					toolMessage := map[string]any{
 						"role":         "tool",
 						"tool_call_id": toolCallID,
-						"content":      blockMap["content"],
+						"content":      TransformToolResultContent(blockMap),
 					}
 					toolMessages = append(toolMessages, toolMessage)
 				}
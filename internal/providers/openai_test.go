@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -133,6 +134,97 @@ func TestOpenAIProvider_TransformRequest(t *testing.T) {
 	assert.Equal(t, "auto", openaiReq["tool_choice"])
 }
 
+func TestOpenAIProvider_TransformRequest_ResponseFormat(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	schema := map[string]any{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]any{
+			"answer": map[string]any{"type": "string"},
+		},
+		"required":             []string{"answer"},
+		"additionalProperties": false,
+	}
+
+	testCases := []struct {
+		name     string
+		field    string
+		format   map[string]any
+		expected map[string]any
+	}{
+		{
+			name:   "anthropic output_format",
+			field:  "output_format",
+			format: map[string]any{"type": "json_schema", "schema": schema},
+			expected: map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "response",
+					"schema": schema,
+					"strict": true,
+				},
+			},
+		},
+		{
+			name:  "openai response_format",
+			field: "response_format",
+			format: map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "answer",
+					"schema": schema,
+				},
+			},
+			expected: map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "answer",
+					"schema": schema,
+					"strict": false,
+				},
+			},
+		},
+		{
+			name:     "json mode",
+			field:    "response_format",
+			format:   map[string]any{"type": "json_object"},
+			expected: map[string]any{"type": "json_object"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			anthropicRequest := map[string]any{
+				"model":      "gpt-4o",
+				"max_tokens": 100,
+				"messages": []any{
+					map[string]any{"role": "user", "content": "Answer in JSON"},
+				},
+				tc.field: tc.format,
+			}
+
+			anthropicJSON, err := json.Marshal(anthropicRequest)
+			require.NoError(t, err)
+
+			result, err := provider.TransformRequest(anthropicJSON)
+			require.NoError(t, err)
+
+			var openaiReq map[string]any
+			require.NoError(t, json.Unmarshal(result, &openaiReq))
+
+			expectedJSON, err := json.Marshal(tc.expected)
+			require.NoError(t, err)
+
+			actualJSON, err := json.Marshal(openaiReq["response_format"])
+			require.NoError(t, err)
+
+			assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+			assert.NotContains(t, openaiReq, "output_format")
+		})
+	}
+}
+
 func TestOpenAIProvider_Transform(t *testing.T) {
 	provider := NewOpenAIProvider()
 
@@ -427,6 +519,78 @@ func TestOpenAIProvider_TransformStream(t *testing.T) {
 	assert.Contains(t, eventStr, "end_turn")
 }
 
+func TestOpenAIProvider_Refusal(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	openaiResponse := map[string]any{
+		"id":    "chatcmpl-123",
+		"model": "gpt-4o",
+		"choices": []map[string]any{
+			{
+				"index": 0,
+				"message": map[string]any{
+					"role":    "assistant",
+					"content": nil,
+					"refusal": "I'm sorry, I can't help with that.",
+				},
+				"finish_reason": "content_filter",
+			},
+		},
+	}
+
+	openaiJSON, err := json.Marshal(openaiResponse)
+	require.NoError(t, err)
+
+	result, err := provider.TransformResponse(openaiJSON)
+	require.NoError(t, err)
+
+	var anthropicResp map[string]any
+	err = json.Unmarshal(result, &anthropicResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, "end_turn", anthropicResp["stop_reason"])
+
+	content, ok := anthropicResp["content"].([]any)
+	require.True(t, ok)
+	require.Len(t, content, 1)
+
+	textBlock := content[0].(map[string]any)
+	assert.Equal(t, "text", textBlock["type"])
+	assert.Equal(t, "I'm sorry, I can't help with that.", textBlock["text"])
+}
+
+func TestOpenAIProvider_StreamingRefusal(t *testing.T) {
+	provider := NewOpenAIProvider()
+	state := &StreamState{}
+
+	refusalChunk := map[string]any{
+		"id":    "chatcmpl-123",
+		"model": "gpt-4o",
+		"choices": []map[string]any{
+			{
+				"index": 0,
+				"delta": map[string]any{
+					"role":    "assistant",
+					"content": nil,
+					"refusal": "I'm sorry",
+				},
+			},
+		},
+	}
+
+	chunkJSON, err := json.Marshal(refusalChunk)
+	require.NoError(t, err)
+
+	events, err := provider.TransformStream(chunkJSON, state)
+	require.NoError(t, err)
+
+	eventStr := string(events)
+	assert.Contains(t, eventStr, "event: message_start")
+	assert.Contains(t, eventStr, "event: content_block_start")
+	assert.Contains(t, eventStr, `"type":"text_delta"`)
+	assert.Contains(t, eventStr, "I'm sorry")
+}
+
 func TestOpenAIProvider_StreamingToolCalls(t *testing.T) {
 	provider := NewOpenAIProvider()
 	state := &StreamState{}
@@ -499,6 +663,187 @@ func TestOpenAIProvider_StreamingToolCalls(t *testing.T) {
 	assert.Contains(t, eventStr, "/home")
 }
 
+func TestOpenAIProvider_StreamingToolCallsDeferredID(t *testing.T) {
+	provider := NewOpenAIProvider()
+	state := &StreamState{}
+
+	chunks := []map[string]any{
+		// First chunk carries only index, name and an argument fragment
+		{
+			"id":    "chatcmpl-123",
+			"model": "gpt-4",
+			"choices": []map[string]any{
+				{
+					"index": 0,
+					"delta": map[string]any{
+						"tool_calls": []map[string]any{
+							{
+								"index": 0,
+								"function": map[string]any{
+									"name":      "ls",
+									"arguments": "{\"path\":",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		// ID arrives in the second chunk with the rest of the arguments
+		{
+			"id":    "chatcmpl-123",
+			"model": "gpt-4",
+			"choices": []map[string]any{
+				{
+					"index": 0,
+					"delta": map[string]any{
+						"tool_calls": []map[string]any{
+							{
+								"index": 0,
+								"id":    "call_late456",
+								"type":  "function",
+								"function": map[string]any{
+									"arguments": "\"/home\"}",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	chunkJSON, err := json.Marshal(chunks[0])
+	require.NoError(t, err)
+
+	events, err := provider.TransformStream(chunkJSON, state)
+	require.NoError(t, err)
+	assert.NotContains(t, string(events), "content_block_start", "block should not start before the ID arrives")
+	assert.NotContains(t, string(events), "input_json_delta", "arguments should be buffered until the block starts")
+
+	chunkJSON, err = json.Marshal(chunks[1])
+	require.NoError(t, err)
+
+	events, err = provider.TransformStream(chunkJSON, state)
+	require.NoError(t, err)
+
+	eventStr := string(events)
+	assert.Contains(t, eventStr, "event: content_block_start")
+	assert.Contains(t, eventStr, "toolu_late456")
+	assert.Contains(t, eventStr, `"name":"ls"`)
+	assert.Less(t, strings.Index(eventStr, "content_block_start"), strings.Index(eventStr, "input_json_delta"))
+
+	// Reassemble the streamed arguments
+	var arguments string
+	for _, line := range strings.Split(eventStr, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "input_json_delta" {
+			arguments += delta["partial_json"].(string)
+		}
+	}
+
+	assert.JSONEq(t, `{"path":"/home"}`, arguments)
+}
+
+func TestOpenAIProvider_StreamingToolCallsWithoutID(t *testing.T) {
+	provider := NewOpenAIProvider()
+	state := &StreamState{}
+
+	toolCallChunk := func(index int, name, arguments string) map[string]any {
+		function := map[string]any{"arguments": arguments}
+		if name != "" {
+			function["name"] = name
+		}
+
+		return map[string]any{
+			"id":    "chatcmpl-123",
+			"model": "gpt-4",
+			"choices": []map[string]any{
+				{
+					"index": 0,
+					"delta": map[string]any{
+						"tool_calls": []map[string]any{
+							{"index": index, "function": function},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	// Two tool calls, neither ever carrying an id
+	chunks := []map[string]any{
+		toolCallChunk(0, "ls", "{\"path\":"),
+		toolCallChunk(0, "", "\"/home\"}"),
+		toolCallChunk(1, "cat", "{\"file\":\"a.txt\"}"),
+		{
+			"id":    "chatcmpl-123",
+			"model": "gpt-4",
+			"choices": []map[string]any{
+				{"index": 0, "delta": map[string]any{}, "finish_reason": "tool_calls"},
+			},
+		},
+	}
+
+	var stream strings.Builder
+
+	for _, chunk := range chunks {
+		chunkJSON, err := json.Marshal(chunk)
+		require.NoError(t, err)
+
+		events, err := provider.TransformStream(chunkJSON, state)
+		require.NoError(t, err)
+
+		stream.Write(events)
+	}
+
+	// Without usage the message is completed when the upstream stream ends
+	stream.Write(FinishStream(state))
+
+	// Collect the started blocks and their reassembled arguments by content block index
+	ids := make(map[float64]string)
+	names := make(map[float64]string)
+	arguments := make(map[float64]string)
+
+	for _, line := range strings.Split(stream.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		index, _ := event["index"].(float64)
+
+		switch event["type"] {
+		case "content_block_start":
+			block := event["content_block"].(map[string]any)
+			ids[index] = block["id"].(string)
+			names[index] = block["name"].(string)
+		case "content_block_delta":
+			_, started := ids[index]
+			require.True(t, started, "delta for block %v sent before its start", index)
+
+			arguments[index] += event["delta"].(map[string]any)["partial_json"].(string)
+		}
+	}
+
+	assert.Equal(t, map[float64]string{0: "toolu_idx0", 1: "toolu_idx1"}, ids)
+	assert.Equal(t, map[float64]string{0: "ls", 1: "cat"}, names)
+	assert.JSONEq(t, `{"path":"/home"}`, arguments[0])
+	assert.JSONEq(t, `{"file":"a.txt"}`, arguments[1])
+	assert.Equal(t, 2, strings.Count(stream.String(), "event: content_block_stop"))
+	assert.Contains(t, stream.String(), `"stop_reason":"tool_use"`)
+}
+
 func TestOpenAIProvider_ConvertUsage(t *testing.T) {
 	provider := NewOpenAIProvider()
 
@@ -539,3 +884,379 @@ func TestOpenAIProvider_ConvertToolCallID(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenAIProvider_StreamingTrailingUsage(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	// Streaming requests ask for the usage chunk
+	request, err := provider.TransformRequest([]byte(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(request), `"stream_options":{"include_usage":true}`)
+
+	stream, usage := transformStreamChunks(t, provider, []map[string]any{
+		{"id": "chatcmpl-1", "model": "gpt-4o", "choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": "Hi"}}}, "usage": nil},
+		{"id": "chatcmpl-1", "model": "gpt-4o", "choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}}, "usage": nil},
+		{"id": "chatcmpl-1", "model": "gpt-4o", "choices": []map[string]any{}, "usage": map[string]any{
+			"prompt_tokens":         12,
+			"completion_tokens":     7,
+			"prompt_tokens_details": map[string]any{"cached_tokens": 4},
+		}},
+	})
+
+	assert.Contains(t, stream, `"stop_reason":"end_turn"`)
+	assert.Equal(t, map[string]any{
+		"input_tokens":            float64(12),
+		"output_tokens":           float64(7),
+		"cache_read_input_tokens": float64(4),
+	}, usage)
+}
+
+func TestOpenAIProvider_TransformRequestToolChoice(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	testCases := []struct {
+		name       string
+		toolChoice string
+		expected   any
+	}{
+		{"auto", `{"type":"auto"}`, "auto"},
+		{"any", `{"type":"any"}`, "required"},
+		{"none", `{"type":"none"}`, "none"},
+		{"specific tool", `{"type":"tool","name":"get_weather"}`, map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": "get_weather"},
+		}},
+		{"already OpenAI form", `"required"`, "required"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := `{"model":"gpt-4o","messages":[{"role":"user","content":"Weather?"}],` +
+				`"tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":` + tc.toolChoice + `}`
+
+			result, err := provider.TransformRequest([]byte(request))
+			require.NoError(t, err)
+
+			var transformed map[string]any
+			require.NoError(t, json.Unmarshal(result, &transformed))
+			assert.Equal(t, tc.expected, transformed["tool_choice"])
+			assert.NotContains(t, transformed, "parallel_tool_calls")
+		})
+	}
+
+	t.Run("disable parallel tool use", func(t *testing.T) {
+		request := `{"model":"gpt-4o","messages":[{"role":"user","content":"Weather?"}],` +
+			`"tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":{"type":"any","disable_parallel_tool_use":true}}`
+
+		result, err := provider.TransformRequest([]byte(request))
+		require.NoError(t, err)
+
+		var transformed map[string]any
+		require.NoError(t, json.Unmarshal(result, &transformed))
+		assert.Equal(t, "required", transformed["tool_choice"])
+		assert.Equal(t, false, transformed["parallel_tool_calls"])
+	})
+}
+
+func TestOpenAIProvider_TransformResponseUsageDetails(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	response := `{"id":"chatcmpl-1","model":"o3","choices":[{"index":0,"message":{"role":"assistant","content":"42"},"finish_reason":"stop"}],` +
+		`"usage":{"prompt_tokens":120,"completion_tokens":80,` +
+		`"prompt_tokens_details":{"cached_tokens":100},"completion_tokens_details":{"reasoning_tokens":64}}}`
+
+	result, err := provider.TransformResponse([]byte(response))
+	require.NoError(t, err)
+
+	var anthropicResp map[string]any
+	require.NoError(t, json.Unmarshal(result, &anthropicResp))
+
+	assert.Equal(t, map[string]any{
+		"input_tokens":            float64(120),
+		"output_tokens":           float64(80),
+		"cache_read_input_tokens": float64(100),
+		"reasoning_tokens":        float64(64),
+	}, anthropicResp["usage"])
+
+	// Without details the usage stays minimal
+	result, err = provider.TransformResponse([]byte(`{"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(result), `"usage":{"input_tokens":5,"output_tokens":1}`)
+}
+
+func TestOpenAIProvider_TransformRequestMultipleCandidates(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	request := `{"model":"gpt-4o","n":2,"max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var transformed map[string]any
+	require.NoError(t, json.Unmarshal(result, &transformed))
+	assert.Equal(t, float64(1), transformed["n"], "only the first choice is converted, so a single one is requested")
+}
+
+func TestOpenAIProvider_TransformRequestMetadataUserID(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	request := `{"model":"gpt-4o","max_tokens":100,"metadata":{"user_id":"user_abc123"},"messages":[{"role":"user","content":"Hi"}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var transformed map[string]any
+	require.NoError(t, json.Unmarshal(result, &transformed))
+	assert.Equal(t, "user_abc123", transformed["user"])
+	assert.NotContains(t, transformed, "metadata", "metadata is still removed without store")
+}
+
+func TestOpenAIProvider_TransformRequestToolCacheControl(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	request := `{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}],"tools":[` +
+		`{"name":"set_cache","description":"Configure a cache","cache_control":{"type":"ephemeral"},` +
+		`"input_schema":{"type":"object","properties":{"cache_control":{"type":"string"},"metadata":{"type":"object"}},"required":["cache_control"]}}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var transformed map[string]any
+	require.NoError(t, json.Unmarshal(result, &transformed))
+
+	tools, ok := transformed["tools"].([]any)
+	require.True(t, ok)
+	require.Len(t, tools, 1)
+
+	tool, ok := tools[0].(map[string]any)
+	require.True(t, ok)
+	assert.NotContains(t, tool, "cache_control")
+	assert.Equal(t, "function", tool["type"])
+
+	function, ok := tool["function"].(map[string]any)
+	require.True(t, ok)
+	assert.NotContains(t, function, "cache_control")
+	assert.Equal(t, "set_cache", function["name"])
+	assert.Equal(t, "Configure a cache", function["description"])
+
+	// Schema properties that share a name with a stripped field are part of the tool
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"cache_control": map[string]any{"type": "string"},
+			"metadata":      map[string]any{"type": "object"},
+		},
+		"required": []any{"cache_control"},
+	}, function["parameters"])
+}
+
+func TestOpenAIProvider_TransformRequestLogprobs(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	testCases := []struct {
+		name     string
+		params   string
+		expected map[string]any
+	}{
+		{"logprobs passed through", `"logprobs":true`, map[string]any{"logprobs": true}},
+		{"top_logprobs passed through", `"logprobs":true,"top_logprobs":5`, map[string]any{"logprobs": true, "top_logprobs": float64(5)}},
+		{"top_logprobs turns logprobs on", `"top_logprobs":3`, map[string]any{"logprobs": true, "top_logprobs": float64(3)}},
+		{"top_logprobs clamped", `"logprobs":true,"top_logprobs":50`, map[string]any{"logprobs": true, "top_logprobs": float64(20)}},
+		{"top_logprobs dropped when logprobs is off", `"logprobs":false,"top_logprobs":5`, map[string]any{"logprobs": false}},
+		{"invalid values dropped", `"logprobs":"yes","top_logprobs":"many"`, map[string]any{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := `{"model":"gpt-4o","max_tokens":100,` + tc.params + `,"messages":[{"role":"user","content":"Hi"}]}`
+
+			result, err := provider.TransformRequest([]byte(request))
+			require.NoError(t, err)
+
+			var transformed map[string]any
+			require.NoError(t, json.Unmarshal(result, &transformed))
+
+			logprobs := map[string]any{}
+
+			for _, field := range []string{"logprobs", "top_logprobs"} {
+				if value, ok := transformed[field]; ok {
+					logprobs[field] = value
+				}
+			}
+
+			assert.Equal(t, tc.expected, logprobs)
+		})
+	}
+}
+
+func TestOpenAIProvider_TransformRequestAssistantToolCallContent(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	toolUse := `{"type":"tool_use","id":"toolu_1","name":"read_file","input":{"path":"main.go"}}`
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected any
+	}{
+		{"tool calls without text", `[` + toolUse + `]`, nil},
+		{"tool calls with text", `[{"type":"text","text":"Let me look."},` + toolUse + `]`, "Let me look."},
+		{"no text and no tool calls", `[{"type":"thinking","thinking":"Hmm"}]`, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := `{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Read main.go"},` +
+				`{"role":"assistant","content":` + tc.content + `}]}`
+
+			result, err := provider.TransformRequest([]byte(request))
+			require.NoError(t, err)
+
+			var transformed struct {
+				Messages []map[string]any `json:"messages"`
+			}
+			require.NoError(t, json.Unmarshal(result, &transformed))
+			require.Len(t, transformed.Messages, 2)
+
+			assistant := transformed.Messages[1]
+			require.Contains(t, assistant, "content", "content must be present, as null when empty")
+			assert.Equal(t, tc.expected, assistant["content"])
+
+			if strings.Contains(tc.content, "tool_use") {
+				toolCalls, ok := assistant["tool_calls"].([]any)
+				require.True(t, ok)
+				require.Len(t, toolCalls, 1)
+				assert.Equal(t, "call_1", toolCalls[0].(map[string]any)["id"])
+			}
+		})
+	}
+}
+
+func TestOpenAIProvider_TransformRequestDeveloperSystemRole(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	request := `{"model":"o3","max_tokens":100,"system":"Be brief.","messages":[{"role":"user","content":"Hello"}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	unchanged, err := SetSystemRole(result, "system")
+	require.NoError(t, err)
+	assert.Equal(t, result, unchanged)
+
+	result, err = SetSystemRole(result, "developer")
+	require.NoError(t, err)
+
+	var transformed struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(result, &transformed))
+	require.Len(t, transformed.Messages, 2)
+
+	assert.Equal(t, "developer", transformed.Messages[0]["role"])
+	assert.Equal(t, "Be brief.", transformed.Messages[0]["content"])
+	assert.Equal(t, "user", transformed.Messages[1]["role"])
+}
+
+func TestOpenAIProvider_TransformRequestToolResultError(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	request := `{"model":"gpt-4o","max_tokens":100,"messages":[` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"/missing"}},` +
+		`{"type":"tool_use","id":"toolu_2","name":"Bash","input":{"command":"make"}},` +
+		`{"type":"tool_use","id":"toolu_3","name":"Read","input":{"file_path":"/notes"}}]},` +
+		`{"role":"user","content":[` +
+		`{"type":"tool_result","tool_use_id":"toolu_1","content":"File does not exist.","is_error":true},` +
+		`{"type":"tool_result","tool_use_id":"toolu_2","content":[{"type":"text","text":"make: *** No rule"}],"is_error":true},` +
+		`{"type":"tool_result","tool_use_id":"toolu_3","content":"notes","is_error":false}]}]}`
+
+	result, err := provider.TransformRequest([]byte(request))
+	require.NoError(t, err)
+
+	var transformed map[string]any
+	require.NoError(t, json.Unmarshal(result, &transformed))
+
+	messages := transformed["messages"].([]any)
+	require.Len(t, messages, 4)
+
+	assert.Equal(t, "call_1", messages[1].(map[string]any)["tool_call_id"])
+	assert.Equal(t, "Error: File does not exist.", messages[1].(map[string]any)["content"])
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Error: make: *** No rule"}}, messages[2].(map[string]any)["content"])
+	assert.Equal(t, "notes", messages[3].(map[string]any)["content"], "successful results are unchanged")
+}
+
+func TestTransformToolResultContent(t *testing.T) {
+	testCases := []struct {
+		name     string
+		block    map[string]any
+		expected any
+	}{
+		{"success", map[string]any{"content": "ok"}, "ok"},
+		{"error string", map[string]any{"content": "denied", "is_error": true}, "Error: denied"},
+		{"error without content", map[string]any{"is_error": true}, "Error"},
+		{"error with empty blocks", map[string]any{"content": []any{}, "is_error": true}, "Error"},
+		{
+			"error starting with an image",
+			map[string]any{"content": []any{map[string]any{"type": "image"}}, "is_error": true},
+			[]any{map[string]any{"type": "text", "text": "Error:"}, map[string]any{"type": "image"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, TransformToolResultContent(tc.block))
+		})
+	}
+}
+
+func TestOpenAIProvider_StreamingTruncatedToolArguments(t *testing.T) {
+	provider := NewOpenAIProvider()
+
+	toolCallChunk := func(arguments string, withID bool) map[string]any {
+		toolCall := map[string]any{"index": 0, "function": map[string]any{"arguments": arguments}}
+		if withID {
+			toolCall["id"] = "call_abc123"
+			toolCall["type"] = "function"
+			toolCall["function"] = map[string]any{"name": "Write", "arguments": arguments}
+		}
+
+		return map[string]any{
+			"id":      "chatcmpl-123",
+			"model":   "gpt-4o",
+			"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"tool_calls": []any{toolCall}}}},
+		}
+	}
+
+	// The output limit cuts the arguments inside a string value
+	stream, _ := transformStreamChunks(t, provider, []map[string]any{
+		toolCallChunk("", true),
+		toolCallChunk(`{"file_path":"/tmp/notes.txt",`, false),
+		toolCallChunk(`"content":"line one\nline tw`, false),
+		{
+			"id":      "chatcmpl-123",
+			"model":   "gpt-4o",
+			"choices": []any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": "length"}},
+		},
+	})
+
+	var input strings.Builder
+
+	for _, line := range strings.Split(stream, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		if delta, ok := event["delta"].(map[string]any); ok && delta["type"] == "input_json_delta" {
+			input.WriteString(delta["partial_json"].(string))
+		}
+	}
+
+	var parsed map[string]any
+	require.NoError(t, json.Unmarshal([]byte(input.String()), &parsed), "tool input must parse: %s", input.String())
+	assert.Equal(t, map[string]any{"file_path": "/tmp/notes.txt", "content": "line one\nline tw"}, parsed)
+	assert.Less(t, strings.Index(stream, "input_json_delta"), strings.Index(stream, "content_block_stop"))
+}
@@ -39,23 +39,7 @@ func (p *OpenRouterProvider) SetAPIKey(key string) {
 }
 
 func (p *OpenRouterProvider) IsStreaming(headers map[string][]string) bool {
-	if contentType, ok := headers["Content-Type"]; ok {
-		for _, ct := range contentType {
-			if ct == "text/event-stream" || strings.Contains(ct, "stream") {
-				return true
-			}
-		}
-	}
-
-	if transferEncoding, ok := headers["Transfer-Encoding"]; ok {
-		for _, te := range transferEncoding {
-			if te == "chunked" {
-				return true
-			}
-		}
-	}
-
-	return false
+	return DetectStreaming(headers)
 }
 
 func (p *OpenRouterProvider) TransformRequest(request []byte) ([]byte, error) {
@@ -90,6 +74,10 @@ func (p *OpenRouterProvider) TransformStream(chunk []byte, state *StreamState) (
 		state.Model = model
 	}
 
+	if usage, ok := orChunk["usage"].(map[string]any); ok {
+		state.Usage.add(p.convertUsage(usage))
+	}
+
 	// Handle choices array
 	if choices, ok := orChunk["choices"].([]any); ok && len(choices) > 0 {
 		if firstChoice, ok := choices[0].(map[string]any); ok {
@@ -123,6 +111,11 @@ func (p *OpenRouterProvider) TransformStream(chunk []byte, state *StreamState) (
 		}
 	}
 
+	// The usage chunk after the finish reason completes the message
+	if state.finalDelta != nil && state.Usage.Reported {
+		events = append(events, finishMessage(state)...)
+	}
+
 	return events, nil
 }
 
@@ -431,6 +424,11 @@ func (p *OpenRouterProvider) handleSingleToolCall(toolCall map[string]any, state
 	// Parse tool call data using helper
 	toolCallData := p.parseToolCallData(toolCall)
 
+	// An earlier tool call still waiting for its id can't wait past the next one
+	if toolCallData.HasIndex {
+		events = append(events, startPendingToolBlocks(state, toolCallData.Index)...)
+	}
+
 	// Find or create content block
 	contentBlockIndex := p.findOrCreateContentBlock(toolCallData, state)
 	if contentBlockIndex == -1 {
@@ -446,15 +444,22 @@ func (p *OpenRouterProvider) handleSingleToolCall(toolCall map[string]any, state
 	if !contentBlock.StartSent && p.shouldSendStartEvent(contentBlock) {
 		events = append(events, p.createContentBlockStartEvent(contentBlockIndex, contentBlock)...)
 		contentBlock.StartSent = true
+
+		// Flush arguments buffered while waiting for the ID
+		if contentBlock.Arguments != "" {
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, contentBlock.Arguments)...)
+		}
 	}
 
-	// Handle argument streaming
-	if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
+	// Handle argument streaming, buffering until content_block_start is sent
+	if toolCallData.Arguments != "" && !contentBlock.StartSent {
+		contentBlock.Arguments += toolCallData.Arguments
+	} else if toolCallData.Arguments != "" && toolCallData.Arguments != contentBlock.Arguments {
 		newPart := p.calculateArgumentsDelta(toolCallData.Arguments, contentBlock.Arguments)
 		contentBlock.Arguments = toolCallData.Arguments
 
 		if newPart != "" {
-			events = append(events, p.createInputDeltaEvent(contentBlockIndex, newPart)...)
+			events = append(events, p.createInputDeltaEvent(contentBlockIndex, contentBlock, newPart)...)
 		}
 	}
 
@@ -518,8 +523,10 @@ func (p *OpenRouterProvider) findOrCreateContentBlock(data ToolCallData, state *
 		}
 	}
 
-	// Create new content block if we have an ID (first chunk)
-	if data.ID != "" {
+	// Create new content block on the first chunk. Some gateways send only the
+	// index and function name first and the ID in a later chunk, so the index
+	// alone is enough to start tracking the tool call.
+	if data.ID != "" || data.HasIndex {
 		contentBlockIndex := len(state.ContentBlocks)
 		state.ContentBlocks[contentBlockIndex] = &ContentBlockState{
 			Type:          "tool_use",
@@ -540,6 +547,11 @@ func (p *OpenRouterProvider) updateContentBlock(block *ContentBlockState, data T
 	if data.FunctionName != "" {
 		block.ToolName = data.FunctionName
 	}
+
+	// Backfill the ID when it arrives after the block was created
+	if block.ToolCallID == "" && data.ID != "" {
+		block.ToolCallID = data.ID
+	}
 }
 
 // shouldSendStartEvent determines if content_block_start event should be sent
@@ -575,8 +587,10 @@ func (p *OpenRouterProvider) calculateArgumentsDelta(newArgs, oldArgs string) st
 	return newArgs
 }
 
-// createInputDeltaEvent creates input_json_delta SSE event
-func (p *OpenRouterProvider) createInputDeltaEvent(index int, partialJSON string) []byte {
+// createInputDeltaEvent creates input_json_delta SSE event, recording what the block has sent
+func (p *OpenRouterProvider) createInputDeltaEvent(index int, block *ContentBlockState, partialJSON string) []byte {
+	block.SentArguments += partialJSON
+
 	inputDeltaEvent := map[string]any{
 		"type":  "content_block_delta",
 		"index": index,
@@ -655,7 +669,7 @@ func (p *OpenRouterProvider) removeAnthropicSpecificFields(request map[string]an
 		fieldsToRemove = append(fieldsToRemove, "metadata")
 	}
 
-	cleaned := p.removeFieldsRecursively(request, fieldsToRemove).(map[string]any)
+	cleaned := RemoveRequestFields(request, fieldsToRemove).(map[string]any)
 
 	// Handle tool_choice logic: only remove if no tools are present, tools is null, or tools is empty array
 	if tools, hasTools := cleaned["tools"]; !hasTools || tools == nil {
@@ -667,40 +681,6 @@ func (p *OpenRouterProvider) removeAnthropicSpecificFields(request map[string]an
 	return cleaned
 }
 
-// removeFieldsRecursively removes specified fields from a nested structure
-func (p *OpenRouterProvider) removeFieldsRecursively(data any, fieldsToRemove []string) any {
-	switch v := data.(type) {
-	case map[string]any:
-		result := make(map[string]any)
-
-		for key, value := range v {
-			shouldRemove := false
-
-			for _, field := range fieldsToRemove {
-				if key == field {
-					shouldRemove = true
-					break
-				}
-			}
-
-			if !shouldRemove {
-				result[key] = p.removeFieldsRecursively(value, fieldsToRemove)
-			}
-		}
-
-		return result
-	case []any:
-		result := make([]any, len(v))
-		for i, item := range v {
-			result[i] = p.removeFieldsRecursively(item, fieldsToRemove)
-		}
-
-		return result
-	default:
-		return v
-	}
-}
-
 // transformTools converts Claude tools to OpenAI format
 func (p *OpenRouterProvider) transformTools(tools []any) ([]any, error) {
 	return TransformTools(tools)
@@ -757,7 +737,7 @@ func (p *OpenRouterProvider) extractToolResults(content []any) []any {
 					toolMessage := map[string]any{
 						"role":         "tool",
 						"tool_call_id": toolCallID,
-						"content":      blockMap["content"],
+						"content":      TransformToolResultContent(blockMap),
 					}
 					toolMessages = append(toolMessages, toolMessage)
 				}
@@ -81,6 +81,56 @@ func TestOpenRouterProvider_TransformRequest(t *testing.T) {
 	assert.Equal(t, "auto", openrouterReq["tool_choice"])
 }
 
+func TestOpenRouterProvider_TransformRequest_StripsCacheControl(t *testing.T) {
+	provider := NewOpenRouterProvider()
+
+	anthropicRequest := map[string]any{
+		"model": "anthropic/claude-sonnet-4",
+		"system": []any{
+			map[string]any{
+				"type":          "text",
+				"text":          "You are a helpful assistant",
+				"cache_control": map[string]any{"type": "ephemeral"},
+			},
+		},
+		"messages": []any{
+			map[string]any{
+				"role": "user",
+				"content": []any{
+					map[string]any{
+						"type":          "text",
+						"text":          "Hello, world!",
+						"cache_control": map[string]any{"type": "ephemeral"},
+					},
+				},
+			},
+		},
+		"metadata":    map[string]any{"user_id": "user-123"},
+		"tool_choice": map[string]any{"type": "auto"},
+	}
+
+	anthropicJSON, err := json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err := provider.TransformRequest(anthropicJSON)
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(result), "cache_control", "cache_control should be stripped at every level")
+
+	var openrouterReq map[string]any
+	err = json.Unmarshal(result, &openrouterReq)
+	require.NoError(t, err)
+
+	// Without tools, tool_choice would be rejected upstream
+	assert.NotContains(t, openrouterReq, "tool_choice", "tool_choice should be removed when no tools are present")
+	assert.NotContains(t, openrouterReq, "metadata", "metadata should be removed when store is not enabled")
+
+	messages, ok := openrouterReq["messages"].([]any)
+	require.True(t, ok, "messages should be an array")
+	require.Len(t, messages, 2, "should have system + user message")
+	assert.Equal(t, "system", messages[0].(map[string]any)["role"])
+}
+
 func TestOpenRouterProvider_Transform(t *testing.T) {
 	provider := NewOpenRouterProvider()
 
@@ -451,3 +501,21 @@ func TestOpenRouterProvider_StreamingToolCalls(t *testing.T) {
 	startEventCount := strings.Count(combinedResult, "content_block_start")
 	assert.Equal(t, 2, startEventCount, "should have exactly 2 content_block_start events (message_start + tool_use)")
 }
+
+func TestOpenRouterProvider_StreamingUsageInFinishChunk(t *testing.T) {
+	_, usage := transformStreamChunks(t, NewOpenRouterProvider(), []map[string]any{
+		{"id": "gen-1", "model": "anthropic/claude-sonnet-4", "choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": "Hi"}}}},
+		{"id": "gen-1", "model": "anthropic/claude-sonnet-4", "choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}},
+			"usage": map[string]any{
+				"prompt_tokens":               40,
+				"completion_tokens":           5,
+				"cache_creation_input_tokens": 8,
+				"server_tool_use":             map[string]any{"web_search_requests": 1},
+			}},
+	})
+
+	assert.Equal(t, float64(40), usage["input_tokens"])
+	assert.Equal(t, float64(5), usage["output_tokens"])
+	assert.Equal(t, float64(8), usage["cache_creation_input_tokens"])
+	assert.Equal(t, map[string]any{"web_search_requests": float64(1)}, usage["server_tool_use"], "non-token usage should be kept")
+}
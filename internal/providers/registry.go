@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 // Provider interface defines the contract for all LLM providers
@@ -28,22 +29,48 @@ type StreamState struct {
 	// Content block tracking for multiple blocks (text, tool_use, etc.)
 	ContentBlocks map[int]*ContentBlockState
 	CurrentIndex  int
+
+	// Usage accumulates token counts from whichever chunks carry them
+	Usage StreamUsage
+
+	// finalDelta is a message_delta held back until usage arrives or the stream ends
+	finalDelta map[string]any
+
+	// MessageStopSent is set once message_stop is sent; later finish reasons are ignored
+	MessageStopSent bool
+
+	// Warnings describes upstream problems worked around during the stream, for the proxy to log
+	Warnings []string
+}
+
+// StreamUsage is the latest token usage reported during a stream. Providers report
+// running totals, so each report replaces the counts it contains.
+type StreamUsage struct {
+	InputTokens              int
+	OutputTokens             int
+	CacheReadInputTokens     int
+	CacheCreationInputTokens int
+	Reported                 bool
 }
 
 // ContentBlockState tracks individual content block state during streaming
 type ContentBlockState struct {
-	Type          string // "text" or "tool_use"
+	Type          string // "text", "thinking" or "tool_use"
 	StartSent     bool
 	StopSent      bool
 	ToolCallID    string // For tool_use blocks
 	ToolCallIndex int    // OpenRouter tool call index for tracking across chunks
 	ToolName      string // For tool_use blocks
 	Arguments     string // Accumulated arguments for tool_use blocks
+	SentArguments string // input_json_delta sent to the client for tool_use blocks
+	Signature     string // Signature for thinking blocks
 }
 
 // Registry manages provider instances
 type Registry struct {
 	providers map[string]Provider
+
+	mu             sync.RWMutex
 	domainMappings map[string]string
 }
 
@@ -64,49 +91,116 @@ func (r *Registry) Get(name string) (Provider, bool) {
 	return provider, exists
 }
 
+// SetDomainMappings replaces the configured domain mappings; it is safe to call while
+// requests are being routed
 func (r *Registry) SetDomainMappings(mappings map[string]string) {
-    r.domainMappings = mappings
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.domainMappings = mappings
+}
+
+// defaultDomainProviders maps well-known API domains to provider names. A domain also
+// covers its subdomains (eu.api.openai.com matches api.openai.com).
+var defaultDomainProviders = map[string]string{
+	"openrouter.ai":                     "openrouter",
+	"api.openrouter.ai":                 "openrouter",
+	"api.openai.com":                    "openai",
+	"openai.com":                        "openai",
+	"api.anthropic.com":                 "anthropic",
+	"anthropic.com":                     "anthropic",
+	"integrate.api.nvidia.com":          "nvidia",
+	"api.nvidia.com":                    "nvidia",
+	"generativelanguage.googleapis.com": "gemini",
+	"googleapis.com":                    "gemini",
+	"api.fireworks.ai":                  "fireworks",
+	"api.together.xyz":                  "together",
+	"localhost:1234":                    "lmstudio",
+	"mock":                              "mock",
+}
+
+// endpointPaths are the paths providers append to an API base URL that isn't a full
+// endpoint URL, following each API's SDK convention for its base URL
+var endpointPaths = map[string]string{
+	"anthropic":        "/v1/messages",
+	AnthropicOAuthName: "/v1/messages",
+	"gemini":           "/models",
+}
+
+// EndpointPath returns the path the named provider appends to an API base URL. Providers
+// speaking the OpenAI chat completions API use /chat/completions after a ".../v1" base.
+func EndpointPath(providerName string) string {
+	if path, ok := endpointPaths[providerName]; ok {
+		return path
+	}
+
+	return "/chat/completions"
 }
 
-// GetByDomain returns a provider based on the API base URL domain
+// GetByDomain returns a provider based on the API base URL. Configured domain mappings
+// are consulted before the built-in ones; either may name a domain, a host:port, or a
+// domain with a base path ("gateway.example.com/openai"), and the most specific match
+// wins. Base URLs on unknown hosts fall back to a path segment naming a provider, as
+// gateways commonly use (".../v1/account/gateway/openai").
 func (r *Registry) GetByDomain(apiBase string) (Provider, error) {
-    u, err := url.Parse(apiBase)
-    if err != nil {
-        return nil, fmt.Errorf("invalid API base URL: %w", err)
-    }
-
-    domain := strings.ToLower(u.Hostname())
-
-    // Check config-based mappings first
-    if r.domainMappings != nil {
-        if providerName, exists := r.domainMappings[domain]; exists {
-            if provider, found := r.Get(providerName); found {
-                return provider, nil
-            }
-        }
-    }
-
-    // Fall back to hardcoded mappings
-    domainProviderMap := map[string]string{
-		"openrouter.ai":                     "openrouter",
-		"api.openrouter.ai":                 "openrouter",
-		"api.openai.com":                    "openai",
-		"openai.com":                        "openai",
-		"api.anthropic.com":                 "anthropic",
-		"anthropic.com":                     "anthropic",
-		"integrate.api.nvidia.com":          "nvidia",
-		"api.nvidia.com":                    "nvidia",
-		"generativelanguage.googleapis.com": "gemini",
-		"googleapis.com":                    "gemini",
+	u, err := url.Parse(apiBase)
+	if err == nil && u.Host == "" {
+		// Tolerate base URLs written without a scheme
+		u, err = url.Parse("https://" + apiBase)
 	}
 
-    if providerName, exists := domainProviderMap[domain]; exists {
-        if provider, found := r.Get(providerName); found {
-            return provider, nil
-        }
-    }
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid API base URL: %s", apiBase)
+	}
+
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	path := strings.ToLower(u.Path)
+
+	r.mu.RLock()
+	configured := r.domainMappings
+	r.mu.RUnlock()
+
+	for _, mappings := range []map[string]string{configured, defaultDomainProviders} {
+		if providerName, ok := matchDomain(mappings, host, hostname, path); ok {
+			if provider, found := r.Get(providerName); found {
+				return provider, nil
+			}
+		}
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if provider, found := r.Get(segment); found {
+			return provider, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no provider found for domain: %s", hostname)
+}
+
+// matchDomain returns the provider of the most specific mapping key matching the URL
+func matchDomain(mappings map[string]string, host, hostname, path string) (string, bool) {
+	var bestKey, bestProvider string
+
+	for key, providerName := range mappings {
+		key = strings.ToLower(strings.TrimSuffix(key, "/"))
+		keyHost, keyPath, hasPath := strings.Cut(key, "/")
+
+		if keyHost != host && keyHost != hostname && !strings.HasSuffix(hostname, "."+keyHost) {
+			continue
+		}
+
+		if hasPath && path != "/"+keyPath && !strings.HasPrefix(path, "/"+keyPath+"/") {
+			continue
+		}
+
+		// Longer keys are more specific; ties are broken by name so the result is stable
+		if len(key) > len(bestKey) || (len(key) == len(bestKey) && key < bestKey) {
+			bestKey, bestProvider = key, providerName
+		}
+	}
 
-    return nil, fmt.Errorf("no provider found for domain: %s", domain)
+	return bestProvider, bestKey != ""
 }
 
 // List returns all registered provider names
@@ -126,4 +220,7 @@ func (r *Registry) Initialize() {
 	r.Register(NewAnthropicProvider())
 	r.Register(NewNvidiaProvider())
 	r.Register(NewGeminiProvider())
+	r.Register(NewFireworksProvider())
+	r.Register(NewTogetherProvider())
+	r.Register(NewLMStudioProvider())
 }
@@ -36,6 +36,9 @@ func TestRegistry_GetByDomain(t *testing.T) {
 		{"https://api.nvidia.com/v1/chat/completions", "nvidia"},
 		{"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent", "gemini"},
 		{"https://googleapis.com/v1beta/models/gemini-2.0-flash:streamGenerateContent", "gemini"},
+		{"https://api.fireworks.ai/inference/v1/chat/completions", "fireworks"},
+		{"https://api.together.xyz/v1/chat/completions", "together"},
+		{"http://localhost:1234/v1/chat/completions", "lmstudio"},
 	}
 
 	for _, tc := range testCases {
@@ -43,6 +46,56 @@ func TestRegistry_GetByDomain(t *testing.T) {
 		require.NoError(t, err, "should get provider for domain %s", tc.domain)
 		assert.Equal(t, tc.expected, provider.Name(), "provider name should match for domain %s", tc.domain)
 	}
+
+	// Other local servers (Ollama, vLLM, a local gateway) are not taken for LM Studio
+	_, err := registry.GetByDomain("http://localhost:11434/v1/chat/completions")
+	assert.Error(t, err)
+}
+
+func TestRegistry_GetByDomain_SubdomainsAndPaths(t *testing.T) {
+	registry := NewRegistry()
+	registry.Initialize()
+	registry.SetDomainMappings(map[string]string{
+		"llm.example.com":            "openai",
+		"gateway.example.com/claude": "anthropic",
+		"gateway.example.com/gemini": "gemini",
+		"localhost:8080":             "openrouter",
+	})
+
+	testCases := []struct {
+		apiBase  string
+		expected string
+	}{
+		// Subdomains of built-in and configured domains
+		{"https://eu.api.openai.com/v1/chat/completions", "openai"},
+		{"https://us-east.integrate.api.nvidia.com/v1/chat/completions", "nvidia"},
+		{"https://internal.llm.example.com/v1/chat/completions", "openai"},
+		// Base paths pick between providers behind the same host
+		{"https://gateway.example.com/claude/v1/messages", "anthropic"},
+		{"https://gateway.example.com/gemini/v1beta/models", "gemini"},
+		{"https://GATEWAY.example.com/Claude", "anthropic"},
+		// A mapping with a port wins over the host-only built-in mapping
+		{"http://localhost:8080/v1/chat/completions", "openrouter"},
+		{"http://localhost:1234/v1/chat/completions", "lmstudio"},
+		// Missing scheme
+		{"api.together.xyz/v1/chat/completions", "together"},
+		// Unknown host: a path segment naming a provider
+		{"https://gateway.ai.cloudflare.com/v1/account/my-gateway/openrouter/chat/completions", "openrouter"},
+	}
+
+	for _, tc := range testCases {
+		provider, err := registry.GetByDomain(tc.apiBase)
+		require.NoError(t, err, "should get provider for %s", tc.apiBase)
+		assert.Equal(t, tc.expected, provider.Name(), "provider name should match for %s", tc.apiBase)
+	}
+
+	// A base path must match whole segments
+	_, err := registry.GetByDomain("https://gateway.example.com/claude-old/v1/messages")
+	assert.Error(t, err)
+
+	// Suffix matching follows label boundaries
+	_, err = registry.GetByDomain("https://notopenai.com/v1/chat/completions")
+	assert.Error(t, err)
 }
 
 func TestRegistry_GetByDomain_InvalidURL(t *testing.T) {
@@ -67,7 +120,7 @@ func TestRegistry_List(t *testing.T) {
 
 	providers := registry.List()
 
-	expectedProviders := []string{"openrouter", "openai", "anthropic", "nvidia", "gemini"}
+	expectedProviders := []string{"openrouter", "openai", "anthropic", "nvidia", "gemini", "fireworks", "together", "lmstudio"}
 	assert.Len(t, providers, len(expectedProviders), "should have expected number of providers")
 
 	// Check that all expected providers are present
@@ -0,0 +1,360 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RequestFormat is the API shape of a client request
+type RequestFormat string
+
+const (
+	RequestFormatAnthropic RequestFormat = "anthropic"
+	RequestFormatOpenAI    RequestFormat = "openai"
+)
+
+// DetectRequestFormat tells OpenAI chat completion requests apart from Anthropic messages
+// requests. Only fields that Anthropic does not accept count as OpenAI markers: system, tool
+// and developer roles, tool_calls, tool_call_id, image_url parts, function tools and
+// max_completion_tokens. A request that is valid in both shapes is Anthropic.
+func DetectRequestFormat(body []byte) RequestFormat {
+	var request map[string]any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return RequestFormatAnthropic
+	}
+
+	if _, ok := request["max_completion_tokens"]; ok {
+		return RequestFormatOpenAI
+	}
+
+	tools, _ := request["tools"].([]any)
+	for _, tool := range tools {
+		if toolMap, ok := tool.(map[string]any); ok && toolMap["type"] == "function" {
+			return RequestFormatOpenAI
+		}
+	}
+
+	messages, _ := request["messages"].([]any)
+	for _, message := range messages {
+		msgMap, ok := message.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		switch msgMap["role"] {
+		case "system", "developer", "tool":
+			return RequestFormatOpenAI
+		}
+
+		if _, ok := msgMap["tool_calls"]; ok {
+			return RequestFormatOpenAI
+		}
+
+		if _, ok := msgMap["tool_call_id"]; ok {
+			return RequestFormatOpenAI
+		}
+
+		parts, _ := msgMap["content"].([]any)
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok && partMap["type"] == "image_url" {
+				return RequestFormatOpenAI
+			}
+		}
+	}
+
+	return RequestFormatAnthropic
+}
+
+// TransformOpenAIToAnthropic converts an OpenAI chat completion request into an Anthropic
+// messages request. System and developer messages become the system prompt, tool messages
+// become tool_result blocks of a user turn, and parameters Anthropic has no equivalent for
+// are dropped.
+func TransformOpenAIToAnthropic(openAIRequest []byte) ([]byte, error) {
+	var request map[string]any
+	if err := json.Unmarshal(openAIRequest, &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OpenAI request: %w", err)
+	}
+
+	result := make(map[string]any)
+
+	for _, field := range []string{"model", "temperature", "top_p", "stream"} {
+		if value, ok := request[field]; ok {
+			result[field] = value
+		}
+	}
+
+	if maxTokens, ok := request["max_completion_tokens"]; ok {
+		result["max_tokens"] = maxTokens
+	} else if maxTokens, ok := request["max_tokens"]; ok {
+		result["max_tokens"] = maxTokens
+	}
+
+	switch stop := request["stop"].(type) {
+	case string:
+		result["stop_sequences"] = []any{stop}
+	case []any:
+		result["stop_sequences"] = stop
+	}
+
+	if user, ok := request["user"].(string); ok && user != "" {
+		result["metadata"] = map[string]any{"user_id": user}
+	}
+
+	messages, _ := request["messages"].([]any)
+
+	system, converted, err := convertOpenAIMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if system != "" {
+		result["system"] = system
+	}
+
+	result["messages"] = converted
+
+	if tools, ok := request["tools"].([]any); ok && len(tools) > 0 {
+		result["tools"] = convertOpenAITools(tools)
+
+		if toolChoice := convertOpenAIToolChoice(request["tool_choice"], request["parallel_tool_calls"]); toolChoice != nil {
+			result["tool_choice"] = toolChoice
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+// convertOpenAIMessages splits out the system prompt and converts the remaining messages,
+// merging consecutive user turns such as a run of tool results
+func convertOpenAIMessages(messages []any) (string, []any, error) {
+	var (
+		system    []string
+		converted []any
+	)
+
+	appendMessage := func(role string, content []any) {
+		if len(converted) > 0 {
+			if last := converted[len(converted)-1].(map[string]any); last["role"] == role {
+				last["content"] = append(last["content"].([]any), content...)
+				return
+			}
+		}
+
+		converted = append(converted, map[string]any{"role": role, "content": content})
+	}
+
+	for i, message := range messages {
+		msgMap, ok := message.(map[string]any)
+		if !ok {
+			return "", nil, fmt.Errorf("message %d is not an object", i)
+		}
+
+		role, _ := msgMap["role"].(string)
+
+		switch role {
+		case "system", "developer":
+			if text := openAIContentText(msgMap["content"]); text != "" {
+				system = append(system, text)
+			}
+		case "tool":
+			toolCallID, _ := msgMap["tool_call_id"].(string)
+			appendMessage("user", []any{map[string]any{
+				"type":        "tool_result",
+				"tool_use_id": toolCallID,
+				"content":     openAIContentText(msgMap["content"]),
+			}})
+		case "assistant":
+			content := convertOpenAIContent(msgMap["content"])
+
+			toolCalls, _ := msgMap["tool_calls"].([]any)
+			for _, toolCall := range toolCalls {
+				block, err := convertOpenAIToolCall(toolCall)
+				if err != nil {
+					return "", nil, fmt.Errorf("message %d: %w", i, err)
+				}
+
+				content = append(content, block)
+			}
+
+			if len(content) > 0 {
+				appendMessage("assistant", content)
+			}
+		case "user":
+			appendMessage("user", convertOpenAIContent(msgMap["content"]))
+		default:
+			return "", nil, fmt.Errorf("message %d has unsupported role '%s'", i, role)
+		}
+	}
+
+	return strings.Join(system, "\n\n"), converted, nil
+}
+
+// convertOpenAIContent converts string or part array content into Anthropic content blocks
+func convertOpenAIContent(content any) []any {
+	switch value := content.(type) {
+	case string:
+		if value == "" {
+			return []any{}
+		}
+
+		return []any{map[string]any{"type": "text", "text": value}}
+	case []any:
+		blocks := make([]any, 0, len(value))
+
+		for _, part := range value {
+			partMap, ok := part.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			switch partMap["type"] {
+			case "text":
+				blocks = append(blocks, map[string]any{"type": "text", "text": partMap["text"]})
+			case "image_url":
+				if block := convertOpenAIImage(partMap["image_url"]); block != nil {
+					blocks = append(blocks, block)
+				}
+			}
+		}
+
+		return blocks
+	}
+
+	return []any{}
+}
+
+// convertOpenAIImage turns an image_url part into an image block, decoding data URLs into
+// base64 sources
+func convertOpenAIImage(imageURL any) map[string]any {
+	var url string
+
+	switch value := imageURL.(type) {
+	case string:
+		url = value
+	case map[string]any:
+		url, _ = value["url"].(string)
+	}
+
+	if url == "" {
+		return nil
+	}
+
+	if dataURL, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(dataURL, ";base64,"); ok {
+			return map[string]any{
+				"type":   "image",
+				"source": map[string]any{"type": "base64", "media_type": mediaType, "data": data},
+			}
+		}
+	}
+
+	return map[string]any{
+		"type":   "image",
+		"source": map[string]any{"type": "url", "url": url},
+	}
+}
+
+// openAIContentText flattens string or part array content into its text
+func openAIContentText(content any) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+
+	var texts []string
+
+	for _, block := range convertOpenAIContent(content) {
+		if text, ok := block.(map[string]any)["text"].(string); ok {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// convertOpenAIToolCall turns an assistant tool call into a tool_use block
+func convertOpenAIToolCall(toolCall any) (map[string]any, error) {
+	callMap, _ := toolCall.(map[string]any)
+	function, _ := callMap["function"].(map[string]any)
+
+	id, _ := callMap["id"].(string)
+	name, _ := function["name"].(string)
+
+	input := map[string]any{}
+
+	if arguments, _ := function["arguments"].(string); strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+			return nil, fmt.Errorf("invalid arguments for tool call '%s': %w", name, err)
+		}
+	}
+
+	return map[string]any{
+		"type":  "tool_use",
+		"id":    id,
+		"name":  name,
+		"input": input,
+	}, nil
+}
+
+// convertOpenAITools turns function tools into Anthropic tool definitions
+func convertOpenAITools(tools []any) []any {
+	converted := make([]any, 0, len(tools))
+
+	for _, tool := range tools {
+		toolMap, _ := tool.(map[string]any)
+
+		function, ok := toolMap["function"].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		anthropicTool := map[string]any{"name": function["name"]}
+
+		if description, ok := function["description"].(string); ok && description != "" {
+			anthropicTool["description"] = description
+		}
+
+		if parameters, ok := function["parameters"].(map[string]any); ok {
+			anthropicTool["input_schema"] = parameters
+		} else {
+			anthropicTool["input_schema"] = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+
+		converted = append(converted, anthropicTool)
+	}
+
+	return converted
+}
+
+// convertOpenAIToolChoice maps tool_choice and parallel_tool_calls to Anthropic's tool_choice
+func convertOpenAIToolChoice(toolChoice, parallelToolCalls any) map[string]any {
+	var converted map[string]any
+
+	switch value := toolChoice.(type) {
+	case string:
+		switch value {
+		case "auto":
+			converted = map[string]any{"type": "auto"}
+		case "required":
+			converted = map[string]any{"type": "any"}
+		case "none":
+			converted = map[string]any{"type": "none"}
+		}
+	case map[string]any:
+		if function, ok := value["function"].(map[string]any); ok {
+			converted = map[string]any{"type": "tool", "name": function["name"]}
+		}
+	}
+
+	if parallelToolCalls == false {
+		if converted == nil {
+			converted = map[string]any{"type": "auto"}
+		}
+
+		if converted["type"] != "none" {
+			converted["disable_parallel_tool_use"] = true
+		}
+	}
+
+	return converted
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRequestFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected RequestFormat
+	}{
+		{
+			name:     "plain user message",
+			body:     `{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`,
+			expected: RequestFormatAnthropic,
+		},
+		{
+			name:     "anthropic system and content blocks",
+			body:     `{"model":"claude-sonnet-4","system":"Be brief","messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+			expected: RequestFormatAnthropic,
+		},
+		{
+			name:     "anthropic tool use",
+			body:     `{"model":"claude-sonnet-4","tools":[{"name":"ls","input_schema":{"type":"object"}}],"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"ls","input":{}}]},{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"a.go"}]}]}`,
+			expected: RequestFormatAnthropic,
+		},
+		{
+			name:     "system message",
+			body:     `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hi"}]}`,
+			expected: RequestFormatOpenAI,
+		},
+		{
+			name:     "assistant tool calls",
+			body:     `{"model":"gpt-4o","messages":[{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"ls","arguments":"{}"}}]}]}`,
+			expected: RequestFormatOpenAI,
+		},
+		{
+			name:     "function tools",
+			body:     `{"model":"gpt-4o","tools":[{"type":"function","function":{"name":"ls"}}],"messages":[{"role":"user","content":"Hi"}]}`,
+			expected: RequestFormatOpenAI,
+		},
+		{
+			name:     "image_url part",
+			body:     `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			expected: RequestFormatOpenAI,
+		},
+		{
+			name:     "max_completion_tokens",
+			body:     `{"model":"gpt-4o","max_completion_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`,
+			expected: RequestFormatOpenAI,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DetectRequestFormat([]byte(tc.body)))
+		})
+	}
+}
+
+func TestTransformOpenAIToAnthropic(t *testing.T) {
+	request := `{
+		"model": "openai,gpt-4o",
+		"max_completion_tokens": 512,
+		"temperature": 0.2,
+		"stream": true,
+		"stop": "END",
+		"user": "user-42",
+		"n": 1,
+		"parallel_tool_calls": false,
+		"tools": [{"type":"function","function":{"name":"read_file","description":"Read a file","parameters":{"type":"object","properties":{"path":{"type":"string"}}}}}],
+		"tool_choice": "required",
+		"messages": [
+			{"role":"system","content":"Be brief."},
+			{"role":"developer","content":[{"type":"text","text":"Use tools."}]},
+			{"role":"user","content":[{"type":"text","text":"What is in these?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0"}}]},
+			{"role":"assistant","content":"Reading.","tool_calls":[
+				{"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"a.txt\"}"}},
+				{"id":"call_2","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"b.txt\"}"}}
+			]},
+			{"role":"tool","tool_call_id":"call_1","content":"alpha"},
+			{"role":"tool","tool_call_id":"call_2","content":"beta"},
+			{"role":"user","content":"Summarize."}
+		]
+	}`
+
+	result, err := TransformOpenAIToAnthropic([]byte(request))
+	require.NoError(t, err)
+
+	var converted map[string]any
+	require.NoError(t, json.Unmarshal(result, &converted))
+
+	assert.Equal(t, "openai,gpt-4o", converted["model"])
+	assert.Equal(t, float64(512), converted["max_tokens"])
+	assert.Equal(t, 0.2, converted["temperature"])
+	assert.Equal(t, true, converted["stream"])
+	assert.Equal(t, []any{"END"}, converted["stop_sequences"])
+	assert.Equal(t, map[string]any{"user_id": "user-42"}, converted["metadata"])
+	assert.Equal(t, "Be brief.\n\nUse tools.", converted["system"])
+	assert.NotContains(t, converted, "n")
+	assert.NotContains(t, converted, "max_completion_tokens")
+
+	assert.Equal(t, []any{map[string]any{
+		"name":         "read_file",
+		"description":  "Read a file",
+		"input_schema": map[string]any{"type": "object", "properties": map[string]any{"path": map[string]any{"type": "string"}}},
+	}}, converted["tools"])
+	assert.Equal(t, map[string]any{"type": "any", "disable_parallel_tool_use": true}, converted["tool_choice"])
+
+	assert.Equal(t, []any{
+		map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "text", "text": "What is in these?"},
+			map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png", "data": "iVBORw0"}},
+		}},
+		map[string]any{"role": "assistant", "content": []any{
+			map[string]any{"type": "text", "text": "Reading."},
+			map[string]any{"type": "tool_use", "id": "call_1", "name": "read_file", "input": map[string]any{"path": "a.txt"}},
+			map[string]any{"type": "tool_use", "id": "call_2", "name": "read_file", "input": map[string]any{"path": "b.txt"}},
+		}},
+		map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "tool_result", "tool_use_id": "call_1", "content": "alpha"},
+			map[string]any{"type": "tool_result", "tool_use_id": "call_2", "content": "beta"},
+			map[string]any{"type": "text", "text": "Summarize."},
+		}},
+	}, converted["messages"], "tool results and the following user message should form one user turn")
+
+	// The converted request is recognized as Anthropic and not converted again
+	assert.Equal(t, RequestFormatAnthropic, DetectRequestFormat(result))
+}
+
+func TestTransformOpenAIToAnthropic_InvalidToolArguments(t *testing.T) {
+	request := `{"model":"gpt-4o","messages":[{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"ls","arguments":"{not json"}}]}]}`
+
+	_, err := TransformOpenAIToAnthropic([]byte(request))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid arguments for tool call 'ls'")
+}
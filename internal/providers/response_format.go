@@ -0,0 +1,275 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnthropicToOpenAIResponse converts an Anthropic messages response to an OpenAI chat
+// completion: text blocks become the message content, thinking its reasoning_content and
+// tool_use blocks its tool_calls.
+func AnthropicToOpenAIResponse(body []byte) ([]byte, error) {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("invalid Anthropic response: %w", err)
+	}
+
+	if response["type"] != "message" {
+		return nil, fmt.Errorf("not an Anthropic message: type %v", response["type"])
+	}
+
+	var text, reasoning strings.Builder
+
+	var toolCalls []any
+
+	content, _ := response["content"].([]any)
+	for _, block := range content {
+		blockMap, ok := block.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		switch blockMap["type"] {
+		case "text":
+			blockText, _ := blockMap["text"].(string)
+			text.WriteString(blockText)
+		case "thinking":
+			thinking, _ := blockMap["thinking"].(string)
+			reasoning.WriteString(thinking)
+		case "tool_use":
+			toolCalls = append(toolCalls, openAIToolCall(blockMap))
+		}
+	}
+
+	message := map[string]any{
+		"role":    "assistant",
+		"content": nil,
+	}
+
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+
+	if reasoning.Len() > 0 {
+		message["reasoning_content"] = reasoning.String()
+	}
+
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	completion := map[string]any{
+		"id":      response["id"],
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   response["model"],
+		"choices": []any{
+			map[string]any{
+				"index":         0,
+				"message":       message,
+				"finish_reason": openAIFinishReason(response["stop_reason"]),
+			},
+		},
+	}
+
+	if usage, ok := response["usage"].(map[string]any); ok {
+		completion["usage"] = openAIUsage(usage)
+	}
+
+	return json.Marshal(completion)
+}
+
+// AnthropicToOpenAIStream converts an Anthropic event stream to OpenAI chat completion
+// chunks, one event at a time
+type AnthropicToOpenAIStream struct {
+	id      any
+	model   any
+	created int64
+	// toolCalls maps the index of a tool_use block to the index of its tool call
+	toolCalls map[int]int
+	usage     map[string]any
+}
+
+func NewAnthropicToOpenAIStream() *AnthropicToOpenAIStream {
+	return &AnthropicToOpenAIStream{
+		created:   time.Now().Unix(),
+		toolCalls: make(map[int]int),
+		usage:     make(map[string]any),
+	}
+}
+
+// Convert returns the SSE data lines for one Anthropic event. message_delta carries the
+// finish reason and the usage, message_stop ends the stream with [DONE] and an error event
+// is sent as an OpenAI error payload; pings and block boundaries produce nothing.
+func (s *AnthropicToOpenAIStream) Convert(event StreamEvent) []byte {
+	index := -1
+	if value, ok := usageCount(event.Data["index"]); ok {
+		index = value
+	}
+
+	switch event.Type {
+	case "message_start":
+		message, _ := event.Data["message"].(map[string]any)
+		s.id = message["id"]
+		s.model = message["model"]
+		s.mergeUsage(message["usage"])
+
+		return s.chunk(map[string]any{"role": "assistant", "content": ""}, nil, nil)
+	case "content_block_start":
+		block, _ := event.Data["content_block"].(map[string]any)
+
+		switch block["type"] {
+		case "text":
+			if text, _ := block["text"].(string); text != "" {
+				return s.chunk(map[string]any{"content": text}, nil, nil)
+			}
+		case "tool_use":
+			toolCall := openAIToolCall(block)
+			toolCall["index"] = len(s.toolCalls)
+
+			// The input normally follows in input_json_delta events, which the client appends
+			if input, _ := block["input"].(map[string]any); len(input) == 0 {
+				toolCall["function"].(map[string]any)["arguments"] = ""
+			}
+
+			s.toolCalls[index] = len(s.toolCalls)
+
+			return s.chunk(map[string]any{"tool_calls": []any{toolCall}}, nil, nil)
+		}
+	case "content_block_delta":
+		delta, _ := event.Data["delta"].(map[string]any)
+
+		switch delta["type"] {
+		case "text_delta":
+			return s.chunk(map[string]any{"content": delta["text"]}, nil, nil)
+		case "thinking_delta":
+			return s.chunk(map[string]any{"reasoning_content": delta["thinking"]}, nil, nil)
+		case "input_json_delta":
+			toolIndex, ok := s.toolCalls[index]
+			if !ok {
+				return nil
+			}
+
+			return s.chunk(map[string]any{
+				"tool_calls": []any{
+					map[string]any{
+						"index":    toolIndex,
+						"function": map[string]any{"arguments": delta["partial_json"]},
+					},
+				},
+			}, nil, nil)
+		}
+	case "message_delta":
+		delta, _ := event.Data["delta"].(map[string]any)
+		s.mergeUsage(event.Data["usage"])
+
+		return s.chunk(map[string]any{}, openAIFinishReason(delta["stop_reason"]), openAIUsage(s.usage))
+	case "message_stop":
+		return []byte("data: [DONE]\n\n")
+	case "error":
+		return sseData(map[string]any{"error": event.Data["error"]})
+	}
+
+	return nil
+}
+
+func (s *AnthropicToOpenAIStream) chunk(delta map[string]any, finishReason any, usage map[string]any) []byte {
+	chunk := map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []any{
+			map[string]any{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+
+	if usage != nil {
+		chunk["usage"] = usage
+	}
+
+	return sseData(chunk)
+}
+
+// mergeUsage keeps the latest value of each usage field: message_start reports the input
+// tokens and message_delta the output tokens
+func (s *AnthropicToOpenAIStream) mergeUsage(usage any) {
+	usageMap, _ := usage.(map[string]any)
+	for key, value := range usageMap {
+		s.usage[key] = value
+	}
+}
+
+// sseData formats a payload as an SSE data line; OpenAI streams have no event names
+func sseData(payload any) []byte {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+
+	return []byte("data: " + string(data) + "\n\n")
+}
+
+// openAIToolCall converts a tool_use block, with its input as the JSON arguments
+func openAIToolCall(block map[string]any) map[string]any {
+	arguments := "{}"
+
+	if input, ok := block["input"].(map[string]any); ok {
+		if encoded, err := json.Marshal(input); err == nil {
+			arguments = string(encoded)
+		}
+	}
+
+	return map[string]any{
+		"id":   block["id"],
+		"type": "function",
+		"function": map[string]any{
+			"name":      block["name"],
+			"arguments": arguments,
+		},
+	}
+}
+
+// openAIFinishReason maps an Anthropic stop reason to an OpenAI finish reason
+func openAIFinishReason(stopReason any) any {
+	switch stopReason {
+	case nil:
+		return nil
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// openAIUsage converts Anthropic usage; OpenAI's prompt tokens include the cached ones
+func openAIUsage(usage map[string]any) map[string]any {
+	inputTokens, _ := usageCount(usage["input_tokens"])
+	outputTokens, _ := usageCount(usage["output_tokens"])
+	cacheRead, _ := usageCount(usage["cache_read_input_tokens"])
+	cacheCreation, _ := usageCount(usage["cache_creation_input_tokens"])
+
+	promptTokens := inputTokens + cacheRead + cacheCreation
+
+	converted := map[string]any{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": outputTokens,
+		"total_tokens":      promptTokens + outputTokens,
+	}
+
+	if cacheRead > 0 {
+		converted["prompt_tokens_details"] = map[string]any{"cached_tokens": cacheRead}
+	}
+
+	return converted
+}
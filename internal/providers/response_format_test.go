@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropicToOpenAIResponse(t *testing.T) {
+	anthropicResponse := `{
+		"id": "msg_1",
+		"type": "message",
+		"role": "assistant",
+		"model": "claude-sonnet-4",
+		"content": [
+			{"type": "thinking", "thinking": "The user wants the weather."},
+			{"type": "text", "text": "Let me check."},
+			{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+	}`
+
+	converted, err := AnthropicToOpenAIResponse([]byte(anthropicResponse))
+	require.NoError(t, err)
+
+	var completion map[string]any
+	require.NoError(t, json.Unmarshal(converted, &completion))
+
+	assert.Equal(t, "msg_1", completion["id"])
+	assert.Equal(t, "chat.completion", completion["object"])
+	assert.Equal(t, "claude-sonnet-4", completion["model"])
+
+	choice := completion["choices"].([]any)[0].(map[string]any)
+	assert.Equal(t, "tool_calls", choice["finish_reason"])
+
+	message := choice["message"].(map[string]any)
+	assert.Equal(t, "assistant", message["role"])
+	assert.Equal(t, "Let me check.", message["content"])
+	assert.Equal(t, "The user wants the weather.", message["reasoning_content"])
+
+	toolCall := message["tool_calls"].([]any)[0].(map[string]any)
+	assert.Equal(t, "toolu_1", toolCall["id"])
+	assert.Equal(t, "function", toolCall["type"])
+	assert.Equal(t, "get_weather", toolCall["function"].(map[string]any)["name"])
+	assert.JSONEq(t, `{"city":"Paris"}`, toolCall["function"].(map[string]any)["arguments"].(string))
+
+	assert.Equal(t, map[string]any{
+		"prompt_tokens":         float64(15),
+		"completion_tokens":     float64(7),
+		"total_tokens":          float64(22),
+		"prompt_tokens_details": map[string]any{"cached_tokens": float64(5)},
+	}, completion["usage"])
+
+	_, err = AnthropicToOpenAIResponse([]byte(`{"type":"error","error":{"type":"api_error","message":"boom"}}`))
+	assert.Error(t, err, "errors are not messages")
+}
+
+func TestAnthropicToOpenAIStream(t *testing.T) {
+	stream := validMessageStart + validPing + validBlockStart + validBlockDelta + validBlockStop +
+		sseEvent("content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`) +
+		sseEvent("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`) +
+		sseEvent("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`) +
+		sseEvent("content_block_stop", `{"type":"content_block_stop","index":1}`) +
+		sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`) +
+		validMessageStop
+
+	events, err := ParseSSEEvents([]byte(stream))
+	require.NoError(t, err)
+
+	converter := NewAnthropicToOpenAIStream()
+
+	var output strings.Builder
+	for _, event := range events {
+		output.Write(converter.Convert(event))
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n\n")
+	require.Len(t, lines, 7, output.String())
+	assert.Equal(t, "data: [DONE]", lines[len(lines)-1])
+
+	var (
+		chunks    []map[string]any
+		content   strings.Builder
+		arguments strings.Builder
+	)
+
+	for _, line := range lines[:len(lines)-1] {
+		data, found := strings.CutPrefix(line, "data: ")
+		require.True(t, found, line)
+
+		var chunk map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+
+		assert.Equal(t, "chat.completion.chunk", chunk["object"])
+		assert.Equal(t, "msg_1", chunk["id"])
+		assert.Equal(t, "gpt-4o", chunk["model"])
+
+		delta := chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+		if text, ok := delta["content"].(string); ok {
+			content.WriteString(text)
+		}
+
+		if toolCalls, ok := delta["tool_calls"].([]any); ok {
+			toolCall := toolCalls[0].(map[string]any)
+			assert.Equal(t, float64(0), toolCall["index"])
+			arguments.WriteString(toolCall["function"].(map[string]any)["arguments"].(string))
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	assert.Equal(t, "assistant", chunks[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)["role"])
+	assert.Equal(t, "Hi", content.String())
+	assert.JSONEq(t, `{"city":"Paris"}`, arguments.String())
+
+	toolStart := chunks[2]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	assert.Equal(t, "toolu_1", toolStart["id"])
+	assert.Equal(t, "get_weather", toolStart["function"].(map[string]any)["name"])
+
+	final := chunks[len(chunks)-1]
+	assert.Equal(t, "tool_calls", final["choices"].([]any)[0].(map[string]any)["finish_reason"])
+	assert.Equal(t, float64(12), final["usage"].(map[string]any)["completion_tokens"])
+}
+
+func TestAnthropicToOpenAIStream_Error(t *testing.T) {
+	events, err := ParseSSEEvents([]byte(sseEvent("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)))
+	require.NoError(t, err)
+
+	output := string(NewAnthropicToOpenAIStream().Convert(events[0]))
+	assert.Equal(t, `data: {"error":{"message":"Overloaded","type":"overloaded_error"}}`+"\n\n", output)
+}
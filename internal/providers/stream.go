@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamEvent is one Anthropic event produced by converting an upstream stream
+type StreamEvent struct {
+	Type string
+	Data map[string]any
+}
+
+// keepAliveComments are the texts of SSE comments sent only to keep a connection open
+var keepAliveComments = map[string]bool{
+	"":           true,
+	"keep-alive": true,
+	"keepalive":  true,
+	"ping":       true,
+	"heartbeat":  true,
+}
+
+// IsKeepAliveComment reports whether an SSE comment line is a generic keep-alive, rather
+// than provider-specific noise such as OpenRouter's ": OPENROUTER PROCESSING"
+func IsKeepAliveComment(line string) bool {
+	text, ok := strings.CutPrefix(strings.TrimSpace(line), ":")
+
+	return ok && keepAliveComments[strings.ToLower(strings.TrimSpace(text))]
+}
+
+// SSELineKind is what a line of an upstream SSE stream means to SSEDecoder
+type SSELineKind int
+
+const (
+	// SSEEventEnd is the blank line ending an event
+	SSEEventEnd SSELineKind = iota
+	// SSEData is a data line, collected until the event ends
+	SSEData
+	// SSEComment is a line starting with ":"
+	SSEComment
+	// SSEDone is OpenAI's "data: [DONE]", the end of the stream
+	SSEDone
+	// SSEOtherField is any other line, such as an event: or id: field
+	SSEOtherField
+)
+
+// SSEDecoder collects the data lines of upstream SSE events. The proxy and ProcessSSEStream
+// both read upstream streams with it, so they split events the same way.
+type SSEDecoder struct {
+	dataLines []string
+}
+
+// Line classifies a line with surrounding whitespace trimmed. For SSEEventEnd it also returns
+// the event's data, with multiple data lines joined by newlines, and whether it had any.
+func (d *SSEDecoder) Line(line string) (SSELineKind, string, bool) {
+	switch {
+	case line == "":
+		data, ok := d.Flush()
+		return SSEEventEnd, data, ok
+	case strings.HasPrefix(line, ":"):
+		return SSEComment, "", false
+	case line == "data: [DONE]":
+		return SSEDone, "", false
+	}
+
+	if data, ok := strings.CutPrefix(line, "data:"); ok {
+		d.dataLines = append(d.dataLines, strings.TrimPrefix(data, " "))
+		return SSEData, "", false
+	}
+
+	return SSEOtherField, "", false
+}
+
+// Flush returns the data of an event the stream left unterminated, if there is one
+func (d *SSEDecoder) Flush() (string, bool) {
+	if len(d.dataLines) == 0 {
+		return "", false
+	}
+
+	data := strings.Join(d.dataLines, "\n")
+	d.dataLines = d.dataLines[:0]
+
+	return data, true
+}
+
+// ProcessSSEStream converts a complete upstream SSE stream the way the proxy does: each
+// event's data goes through TransformStream with a single StreamState, [DONE] or the end of
+// the reader flushes the held back message end, and comments are dropped. It returns the
+// resulting Anthropic events in order.
+func ProcessSSEStream(r io.Reader, provider Provider) ([]StreamEvent, error) {
+	state := &StreamState{}
+
+	var (
+		output  bytes.Buffer
+		decoder SSEDecoder
+		event   int
+	)
+
+	dispatch := func(data string) error {
+		event++
+
+		events, err := provider.TransformStream([]byte(data), state)
+		if err != nil {
+			return fmt.Errorf("event %d failed to convert: %w\n  data: %s", event, err, data)
+		}
+
+		output.Write(events)
+		output.WriteString("\n\n")
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+scan:
+	for scanner.Scan() {
+		switch kind, data, ok := decoder.Line(strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))); kind {
+		case SSEEventEnd:
+			if ok {
+				if err := dispatch(data); err != nil {
+					return nil, err
+				}
+			}
+		case SSEDone:
+			break scan
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if data, ok := decoder.Flush(); ok {
+		if err := dispatch(data); err != nil {
+			return nil, err
+		}
+	}
+
+	output.Write(FinishStream(state))
+
+	return ParseSSEEvents(output.Bytes())
+}
+
+// ParseSSEEvents splits converted stream output into its events. Passthrough providers
+// return bare JSON payloads, whose type is taken from the payload.
+func ParseSSEEvents(stream []byte) ([]StreamEvent, error) {
+	var events []StreamEvent
+
+	for _, block := range strings.Split(string(stream), "\n\n") {
+		var (
+			eventType string
+			dataLines []string
+		)
+
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			case strings.HasPrefix(line, "{"):
+				dataLines = append(dataLines, line)
+			}
+		}
+
+		if len(dataLines) == 0 {
+			continue
+		}
+
+		var data map[string]any
+		if err := json.Unmarshal([]byte(strings.Join(dataLines, "\n")), &data); err != nil {
+			return nil, fmt.Errorf("invalid event data %q: %w", strings.Join(dataLines, "\n"), err)
+		}
+
+		if eventType == "" {
+			eventType, _ = data["type"].(string)
+		}
+
+		events = append(events, StreamEvent{Type: eventType, Data: data})
+	}
+
+	return events, nil
+}
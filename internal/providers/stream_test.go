@@ -0,0 +1,172 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const openAIRecordedStream = `data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"content":"Let me check."},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_q1","type":"function","function":{"name":"Bash","arguments":""}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"command\":"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"ls\"}"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"id":"chatcmpl-9x","object":"chat.completion.chunk","model":"gpt-4o-2024-08-06","choices":[],"usage":{"prompt_tokens":52,"completion_tokens":18,"total_tokens":70}}
+
+data: [DONE]
+
+`
+
+const openRouterRecordedStream = `: OPENROUTER PROCESSING
+
+data: {"id":"gen-17","provider":"Anthropic","model":"anthropic/claude-sonnet-4","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"finish_reason":null}]}
+
+data: {"id":"gen-17","provider":"Anthropic","model":"anthropic/claude-sonnet-4","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":" there!"},"finish_reason":null}]}
+
+data: {"id":"gen-17","provider":"Anthropic","model":"anthropic/claude-sonnet-4","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":"stop"}]}
+
+data: {"id":"gen-17","provider":"Anthropic","model":"anthropic/claude-sonnet-4","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}],"usage":{"prompt_tokens":12,"completion_tokens":4,"total_tokens":16}}
+
+data: [DONE]
+`
+
+const geminiRecordedStream = `data: {"candidates":[{"content":{"parts":[{"text":"The answer"}],"role":"model"},"index":0}],"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":3,"totalTokenCount":43},"modelVersion":"gemini-2.5-flash","responseId":"resp-1"}
+
+data: {"candidates":[{"content":{"parts":[{"text":" is 42."}],"role":"model"},"index":0}],"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":6,"totalTokenCount":46},"modelVersion":"gemini-2.5-flash","responseId":"resp-1"}
+
+data: {"candidates":[{"content":{"parts":[{"text":""}],"role":"model"},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":9,"totalTokenCount":49},"modelVersion":"gemini-2.5-flash","responseId":"resp-1"}
+
+`
+
+// assertValidEventSequence fails the test when the events break Anthropic's ordering rules
+func assertValidEventSequence(t *testing.T, events []StreamEvent) {
+	t.Helper()
+
+	assert.NoError(t, ValidateAnthropicEvents(events))
+}
+
+// eventTypes lists the event types, with the block type of content_block_start events
+func eventTypes(events []StreamEvent) []string {
+	types := make([]string, 0, len(events))
+
+	for _, event := range events {
+		if block, ok := event.Data["content_block"].(map[string]any); ok {
+			types = append(types, fmt.Sprintf("%s:%s", event.Type, block["type"]))
+			continue
+		}
+
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func TestProcessSSEStream_RecordedStreams(t *testing.T) {
+	testCases := []struct {
+		name       string
+		provider   Provider
+		stream     string
+		types      []string
+		stopReason string
+		usage      map[string]any
+	}{
+		{
+			name:     "openai text and tool call",
+			provider: NewOpenAIProvider(),
+			stream:   openAIRecordedStream,
+			types: []string{
+				"message_start",
+				"content_block_start:text", "content_block_delta",
+				"content_block_start:tool_use", "content_block_delta", "content_block_delta",
+				"content_block_stop", "content_block_stop",
+				"message_delta", "message_stop",
+			},
+			stopReason: "tool_use",
+			usage:      map[string]any{"input_tokens": float64(52), "output_tokens": float64(18)},
+		},
+		{
+			name:     "openrouter text with usage after finish",
+			provider: NewOpenRouterProvider(),
+			stream:   openRouterRecordedStream,
+			types: []string{
+				"message_start",
+				"content_block_start:text", "content_block_delta", "content_block_delta", "content_block_stop",
+				"message_delta", "message_stop",
+			},
+			stopReason: "end_turn",
+			usage:      map[string]any{"input_tokens": float64(12), "output_tokens": float64(4)},
+		},
+		{
+			name:     "gemini text",
+			provider: NewGeminiProvider(),
+			stream:   geminiRecordedStream,
+			types: []string{
+				"message_start",
+				"content_block_start:text", "content_block_delta", "content_block_delta", "content_block_stop",
+				"message_delta", "message_stop",
+			},
+			stopReason: "end_turn",
+			usage:      map[string]any{"input_tokens": float64(40), "output_tokens": float64(9)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := ProcessSSEStream(strings.NewReader(tc.stream), tc.provider)
+			require.NoError(t, err)
+
+			assertValidEventSequence(t, events)
+			assert.Equal(t, tc.types, eventTypes(events))
+
+			messageDelta := events[len(events)-2].Data
+			delta, _ := messageDelta["delta"].(map[string]any)
+			assert.Equal(t, tc.stopReason, delta["stop_reason"])
+
+			usage, _ := messageDelta["usage"].(map[string]any)
+			for key, value := range tc.usage {
+				assert.Equal(t, value, usage[key], "usage %s", key)
+			}
+		})
+	}
+}
+
+func TestProcessSSEStream_AnthropicPassthrough(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-sonnet-4","usage":{"input_tokens":5,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_start\n" +
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+		"event: content_block_stop\n" +
+		`data: {"type":"content_block_stop","index":0}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+
+	events, err := ProcessSSEStream(strings.NewReader(stream), NewAnthropicProvider())
+	require.NoError(t, err)
+
+	assertValidEventSequence(t, events)
+	assert.Len(t, events, 6)
+}
+
+func TestIsKeepAliveComment(t *testing.T) {
+	for _, line := range []string{":", ": keep-alive", ":keepalive", ": PING", ":  heartbeat "} {
+		assert.True(t, IsKeepAliveComment(line), line)
+	}
+
+	for _, line := range []string{": OPENROUTER PROCESSING", ": processing request", "data: keep-alive", "keep-alive"} {
+		assert.False(t, IsKeepAliveComment(line), line)
+	}
+}
@@ -0,0 +1,16 @@
+package providers
+
+// TogetherProvider targets Together AI's OpenAI-compatible chat completions API.
+// Model IDs are organization-scoped (e.g. meta-llama/Llama-3.3-70B-Instruct-Turbo).
+type TogetherProvider struct {
+	*OpenAIProvider
+}
+
+func NewTogetherProvider() *TogetherProvider {
+	return &TogetherProvider{
+		OpenAIProvider: &OpenAIProvider{
+			name:     "together",
+			endpoint: "https://api.together.xyz/v1/chat/completions",
+		},
+	}
+}
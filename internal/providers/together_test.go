@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTogetherProvider_BasicMethods(t *testing.T) {
+	provider := NewTogetherProvider()
+
+	assert.Equal(t, "together", provider.Name())
+	assert.True(t, provider.SupportsStreaming())
+	assert.Equal(t, "https://api.together.xyz/v1/chat/completions", provider.GetEndpoint())
+
+	provider.SetAPIKey("test-key")
+	assert.Equal(t, "test-key", provider.apiKey)
+}
+
+func TestTogetherProvider_ModelIDWithSlashes(t *testing.T) {
+	providerName, model := ExtractModelFromConfig("together,meta-llama/Llama-3.3-70B-Instruct-Turbo")
+
+	assert.Equal(t, "together", providerName)
+	assert.Equal(t, "meta-llama/Llama-3.3-70B-Instruct-Turbo", model)
+}
+
+func TestTogetherProvider_TransformRequest(t *testing.T) {
+	provider := NewTogetherProvider()
+
+	anthropicRequest := map[string]any{
+		"model":      "meta-llama/Llama-3.3-70B-Instruct-Turbo",
+		"max_tokens": 100,
+		"messages": []any{
+			map[string]any{
+				"role":    "user",
+				"content": "Hello, world!",
+			},
+		},
+		"tools": []any{
+			map[string]any{
+				"name":        "get_weather",
+				"description": "Get current weather",
+				"input_schema": map[string]any{
+					"type": "object",
+				},
+			},
+		},
+	}
+
+	anthropicJSON, err := json.Marshal(anthropicRequest)
+	require.NoError(t, err)
+
+	result, err := provider.TransformRequest(anthropicJSON)
+	require.NoError(t, err)
+
+	var togetherReq map[string]any
+	err = json.Unmarshal(result, &togetherReq)
+	require.NoError(t, err)
+
+	assert.Equal(t, "meta-llama/Llama-3.3-70B-Instruct-Turbo", togetherReq["model"])
+
+	tools, ok := togetherReq["tools"].([]any)
+	require.True(t, ok, "tools should be an array")
+	require.Len(t, tools, 1)
+
+	tool := tools[0].(map[string]any)
+	assert.Equal(t, "function", tool["type"])
+	assert.Equal(t, "get_weather", tool["function"].(map[string]any)["name"])
+}
+
+func TestTogetherProvider_TransformStream(t *testing.T) {
+	provider := NewTogetherProvider()
+	state := &StreamState{}
+
+	chunk := map[string]any{
+		"id":    "together-123",
+		"model": "meta-llama/Llama-3.3-70B-Instruct-Turbo",
+		"choices": []any{
+			map[string]any{
+				"index": 0,
+				"delta": map[string]any{
+					"content": "Hello",
+				},
+			},
+		},
+	}
+
+	chunkJSON, err := json.Marshal(chunk)
+	require.NoError(t, err)
+
+	events, err := provider.TransformStream(chunkJSON, state)
+	require.NoError(t, err)
+
+	eventStr := string(events)
+	assert.Contains(t, eventStr, "event: message_start")
+	assert.Contains(t, eventStr, "meta-llama/Llama-3.3-70B-Instruct-Turbo")
+	assert.Contains(t, eventStr, "event: content_block_delta")
+	assert.Contains(t, eventStr, "Hello")
+}
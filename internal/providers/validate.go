@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ValidateAnthropicSSE parses an Anthropic event stream and checks it with
+// ValidateAnthropicEvents
+func ValidateAnthropicSSE(stream []byte) error {
+	events, err := ParseSSEEvents(stream)
+	if err != nil {
+		return err
+	}
+
+	return ValidateAnthropicEvents(events)
+}
+
+// ValidateAnthropicEvents checks the ordering rules Anthropic clients rely on: one
+// message_start first, content blocks started before their deltas and stopped once, and a
+// message_delta followed by message_stop at the end. Blocks are tracked by index, so a
+// block may start while an earlier one is still open. Pings may come anywhere, and an error
+// event ends the stream early. Every violation found is returned, joined.
+func ValidateAnthropicEvents(events []StreamEvent) error {
+	if len(events) == 0 {
+		return errors.New("stream has no events")
+	}
+
+	var violations []error
+
+	violation := func(i int, event StreamEvent, format string, args ...any) {
+		violations = append(violations, fmt.Errorf("event %d (%s): %s", i, event.Type, fmt.Sprintf(format, args...)))
+	}
+
+	var started, delta, stopped, failed bool
+
+	open := make(map[int]bool)
+	closed := make(map[int]bool)
+
+	for i, event := range events {
+		if payloadType, _ := event.Data["type"].(string); payloadType != event.Type {
+			violation(i, event, "payload type %q does not match the event name", payloadType)
+		}
+
+		if event.Type == "ping" {
+			continue
+		}
+
+		if stopped || failed {
+			violation(i, event, "sent after the stream ended")
+			continue
+		}
+
+		index := -1
+		if value, ok := event.Data["index"].(float64); ok {
+			index = int(value)
+		}
+
+		if !started && event.Type != "message_start" && event.Type != "error" {
+			violation(i, event, "sent before message_start")
+		}
+
+		if delta && event.Type != "message_stop" && event.Type != "error" {
+			violation(i, event, "sent after message_delta")
+		}
+
+		switch event.Type {
+		case "message_start":
+			if started {
+				violation(i, event, "message_start sent more than once")
+			}
+
+			started = true
+		case "content_block_start":
+			if open[index] || closed[index] {
+				violation(i, event, "block %d started twice", index)
+			}
+
+			open[index] = true
+		case "content_block_delta":
+			if !open[index] {
+				violation(i, event, "delta for block %d outside the block", index)
+			}
+		case "content_block_stop":
+			if !open[index] {
+				violation(i, event, "stop for block %d that is not open", index)
+			}
+
+			open[index] = false
+			closed[index] = true
+		case "message_delta":
+			if indexes := openBlocks(open); len(indexes) > 0 {
+				violation(i, event, "blocks %v still open", indexes)
+			}
+
+			delta = true
+		case "message_stop":
+			if !delta {
+				violation(i, event, "message_stop without a message_delta before it")
+			}
+
+			if indexes := openBlocks(open); len(indexes) > 0 {
+				violation(i, event, "blocks %v still open", indexes)
+			}
+
+			stopped = true
+		case "error":
+			failed = true
+		default:
+			violation(i, event, "unknown event type")
+		}
+	}
+
+	if !stopped && !failed {
+		violations = append(violations, errors.New("stream ended without message_stop"))
+	}
+
+	return errors.Join(violations...)
+}
+
+// openBlocks lists the indexes of the blocks still open, in order
+func openBlocks(open map[int]bool) []int {
+	var indexes []int
+
+	for index, isOpen := range open {
+		if isOpen {
+			indexes = append(indexes, index)
+		}
+	}
+
+	sort.Ints(indexes)
+
+	return indexes
+}
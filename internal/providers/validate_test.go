@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent formats one Anthropic event the way the proxy writes it
+func sseEvent(eventType, data string) string {
+	return "event: " + eventType + "\ndata: " + data + "\n\n"
+}
+
+var (
+	validMessageStart = sseEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"gpt-4o"}}`)
+	validBlockStart   = sseEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+	validBlockDelta   = sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`)
+	validBlockStop    = sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`)
+	validMessageDelta = sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}`)
+	validMessageStop  = sseEvent("message_stop", `{"type":"message_stop"}`)
+	validPing         = sseEvent("ping", `{"type":"ping"}`)
+)
+
+func TestValidateAnthropicSSE_AcceptsWellFormedStreams(t *testing.T) {
+	streams := map[string]string{
+		"text": validMessageStart + validBlockStart + validBlockDelta + validBlockStop + validMessageDelta + validMessageStop,
+		"pings and keep-alive comments": validPing + validMessageStart + ": keep-alive\n\n" + validBlockStart + validPing +
+			validBlockDelta + validBlockStop + validMessageDelta + validMessageStop,
+		"error after start": validMessageStart + validBlockStart +
+			sseEvent("error", `{"type":"error","error":{"type":"api_error","message":"idle timeout"}}`),
+	}
+
+	for name, stream := range streams {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, ValidateAnthropicSSE([]byte(stream)))
+		})
+	}
+}
+
+func TestValidateAnthropicSSE_FlagsMalformedStreams(t *testing.T) {
+	testCases := []struct {
+		name      string
+		stream    string
+		violation string
+	}{
+		{
+			name:      "content before message_start",
+			stream:    validBlockStart + validMessageStart + validBlockDelta + validBlockStop + validMessageDelta + validMessageStop,
+			violation: "event 0 (content_block_start): sent before message_start",
+		},
+		{
+			name:      "delta outside its block",
+			stream:    validMessageStart + validBlockDelta + validMessageDelta + validMessageStop,
+			violation: "delta for block 0 outside the block",
+		},
+		{
+			name:      "block never stopped",
+			stream:    validMessageStart + validBlockStart + validBlockDelta + validMessageDelta + validMessageStop,
+			violation: "blocks [0] still open",
+		},
+		{
+			name:      "block started twice",
+			stream:    validMessageStart + validBlockStart + validBlockStop + validBlockStart + validBlockStop + validMessageDelta + validMessageStop,
+			violation: "block 0 started twice",
+		},
+		{
+			name:      "message_stop without message_delta",
+			stream:    validMessageStart + validBlockStart + validBlockStop + validMessageStop,
+			violation: "message_stop without a message_delta before it",
+		},
+		{
+			name:      "content after message_delta",
+			stream:    validMessageStart + validMessageDelta + validBlockStart + validBlockStop + validMessageStop,
+			violation: "event 2 (content_block_start): sent after message_delta",
+		},
+		{
+			name:      "truncated stream",
+			stream:    validMessageStart + validBlockStart + validBlockDelta,
+			violation: "stream ended without message_stop",
+		},
+		{
+			name:      "event name differs from payload",
+			stream:    validMessageStart + "event: content_block_start\ndata: {\"type\":\"content_block_delta\",\"index\":0}\n\n",
+			violation: `payload type "content_block_delta" does not match the event name`,
+		},
+		{
+			name:      "events after message_stop",
+			stream:    validMessageStart + validMessageDelta + validMessageStop + validMessageDelta,
+			violation: "event 3 (message_delta): sent after the stream ended",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAnthropicSSE([]byte(tc.stream))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.violation)
+		})
+	}
+}
+
+func TestValidateAnthropicSSE_RejectsEmptyAndInvalidStreams(t *testing.T) {
+	assert.Error(t, ValidateAnthropicSSE(nil))
+	assert.Error(t, ValidateAnthropicSSE([]byte(strings.TrimSuffix(validMessageStart, "}}\n\n"))))
+}
@@ -10,7 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -22,28 +24,64 @@ import (
 	"github.com/mihaisavezi/claude-code-open/internal/providers"
 )
 
+// DefaultShutdownTimeout bounds how long non-streaming requests get to finish on shutdown
+const DefaultShutdownTimeout = 10 * time.Second
+
 type Server struct {
-	config   *config.Manager
-	registry *providers.Registry
-	logger   *slog.Logger
-	server   *http.Server
+	config          *config.Manager
+	registry        *providers.Registry
+	logger          *slog.Logger
+	server          *http.Server
+	proxy           *handlers.ProxyHandler
+	shutdownTimeout time.Duration
+	stopProbes      context.CancelFunc
+	validateStreams bool
 }
 
 func New(configManager *config.Manager, logger *slog.Logger) *Server {
-    registry := providers.NewRegistry()
-    registry.Initialize()
-    
-    // Apply domain mappings from config
-    cfg := configManager.Get()
-    if cfg.DomainMappings != nil {
-        registry.SetDomainMappings(cfg.DomainMappings)
-    }
-    
-    return &Server{
-        config:   configManager,
-        registry: registry,
-        logger:   logger,
-    }
+	registry := providers.NewRegistry()
+	registry.Initialize()
+
+	// Subscription tokens live next to the config so refreshed tokens persist
+	registry.Register(providers.NewAnthropicOAuthProvider(filepath.Join(configManager.BaseDir(), providers.AnthropicOAuthCredentialsFile)))
+
+	// Apply domain mappings from config
+	cfg := configManager.Get()
+	if cfg.DomainMappings != nil {
+		registry.SetDomainMappings(cfg.DomainMappings)
+	}
+
+	// The mock provider is opt-in: it answers without calling any upstream
+	if slices.ContainsFunc(cfg.Providers, func(p config.Provider) bool { return p.Name == "mock" }) {
+		registerMockProvider(registry, cfg)
+	}
+
+	return &Server{
+		config:          configManager,
+		registry:        registry,
+		logger:          logger,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+}
+
+// EnableMockProvider registers the mock provider even when no "mock" provider is configured
+func (s *Server) EnableMockProvider() {
+	registerMockProvider(s.registry, s.config.Get())
+}
+
+// EnableStreamValidation logs streams sent to clients that break Anthropic's event order
+func (s *Server) EnableStreamValidation() {
+	s.validateStreams = true
+}
+
+// registerMockProvider registers a mock provider answering with the configured canned reply
+func registerMockProvider(registry *providers.Registry, cfg *config.Config) {
+	toolCalls := make([]providers.MockToolCall, 0, len(cfg.Mock.ToolCalls))
+	for _, call := range cfg.Mock.ToolCalls {
+		toolCalls = append(toolCalls, providers.MockToolCall{Name: call.Name, Input: call.Input})
+	}
+
+	registry.Register(providers.NewMockProvider(cfg.Mock.Text, toolCalls))
 }
 
 func (s *Server) Start() error {
@@ -65,6 +103,23 @@ func (s *Server) Start() error {
 
 	s.logger.Info("Starting server", "address", addr)
 
+	// Probe provider reachability in the background
+	probeCtx, stopProbes := context.WithCancel(context.Background())
+	s.stopProbes = stopProbes
+
+	go s.proxy.Prober().Run(probeCtx)
+
+	// Re-read the configuration on SIGHUP and when the file changes; both stop with the probes on shutdown
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	go s.handleReloadSignals(probeCtx, reload)
+
+	if err := s.watchConfigFile(probeCtx); err != nil {
+		s.logger.Warn("Not watching the config file for changes", "error", err)
+	}
+
 	// Start server in goroutine
 	go func() {
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -84,11 +139,7 @@ func (s *Server) Start() error {
 
 	s.logger.Info("Server is shutting down...")
 
-	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := s.server.Shutdown(ctx); err != nil {
+	if err := s.shutdown(); err != nil {
 		return fmt.Errorf("server forced to shutdown: %w", err)
 	}
 
@@ -97,15 +148,92 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// handleReloadSignals reloads the configuration for every signal received until ctx is done
+func (s *Server) handleReloadSignals(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			s.logger.Info("Reloading configuration", "signal", sig.String())
+
+			if _, err := s.reloadConfig(); err != nil {
+				s.logger.Error("Configuration reload failed, keeping the current configuration", "error", err)
+			}
+		}
+	}
+}
+
+// reloadConfig re-reads the configuration file. A file that fails to load or validate
+// leaves the current configuration in place. Host and port changes take effect on restart.
+func (s *Server) reloadConfig() (*config.Config, error) {
+	previous := s.config.Get()
+
+	cfg, err := s.config.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	s.config.Use(cfg)
+	s.registry.SetDomainMappings(cfg.DomainMappings)
+
+	if previous != nil && (cfg.Host != previous.Host || cfg.Port != previous.Port) {
+		s.logger.Warn("Host and port changes require a restart",
+			"host", previous.Host, "port", previous.Port)
+	}
+
+	s.logger.Info("Configuration reloaded", "path", s.config.GetPath(), "providers", len(cfg.Providers))
+
+	return cfg, nil
+}
+
 func (s *Server) Stop() error {
 	if s.server == nil {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return s.shutdown()
+}
+
+// shutdown stops accepting new connections, then gives regular requests the shutdown
+// timeout and in-flight streaming responses the longer stream drain timeout to finish
+func (s *Server) shutdown() error {
+	if s.stopProbes != nil {
+		s.stopProbes()
+	}
+
+	drainSeconds := s.config.Get().StreamDrainTimeout
+	if drainSeconds <= 0 {
+		drainSeconds = config.DefaultStreamDrainTimeoutSeconds
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Duration(drainSeconds)*time.Second)
+	defer cancelDrain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 
-	return s.server.Shutdown(ctx)
+	err := s.server.Shutdown(ctx)
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) || s.proxy == nil {
+		return err
+	}
+
+	s.logger.Info("Waiting for streaming responses to finish", "timeout_seconds", drainSeconds)
+
+	if err := s.proxy.WaitForStreams(drainCtx); err != nil {
+		if closeErr := s.server.Close(); closeErr != nil {
+			s.logger.Warn("Failed to close server", "error", closeErr)
+		}
+
+		return fmt.Errorf("streaming responses still active after drain timeout: %w", err)
+	}
+
+	// Streams are done; close whatever non-streaming connections outlived the shutdown timeout
+	return s.server.Close()
 }
 
 func (s *Server) setupRoutes() *http.ServeMux {
@@ -113,14 +241,35 @@ func (s *Server) setupRoutes() *http.ServeMux {
 
 	// Create handlers
 	proxyHandler := handlers.NewProxyHandler(s.config, s.registry, s.logger)
+	s.proxy = proxyHandler
+
+	if s.validateStreams {
+		proxyHandler.EnableStreamValidation()
+	}
+
 	healthHandler := handlers.NewHealthHandler(s.logger)
+	statsHandler := handlers.NewStatsHandler(proxyHandler.Stats(), s.logger)
+	metricsHandler := handlers.NewMetricsHandler(proxyHandler.Stats(), s.logger)
+	readyHandler := handlers.NewReadyHandler(proxyHandler.Prober(), s.logger)
+	webSocketHandler := handlers.NewWebSocketHandler(proxyHandler, s.logger)
+	debugHandler := handlers.NewDebugHandler(proxyHandler.DebugCapture(), s.config, s.logger)
+	reloadHandler := handlers.NewReloadHandler(s.reloadConfig, s.config, s.logger)
+	modelsHandler := handlers.NewModelsHandler(s.config, s.logger)
 
 	// Setup middleware chains
 	middlewareSet := middleware.NewMiddlewareSet(s.config, s.logger)
 
 	// Apply middleware chains to routes
 	mux.Handle("/health", middlewareSet.HealthChain().Handler(healthHandler))
-	mux.Handle("/", middlewareSet.DefaultChain().Handler(proxyHandler))
+	mux.Handle("/health/ready", middlewareSet.HealthChain().Handler(readyHandler))
+	mux.Handle("/stats", middlewareSet.DefaultChain().Handler(statsHandler))
+	mux.Handle("/metrics", middlewareSet.DefaultChain().Handler(metricsHandler))
+	mux.Handle("/debug/last", middlewareSet.DefaultChain().Handler(debugHandler))
+	mux.Handle("/admin/reload", middlewareSet.DefaultChain().Handler(reloadHandler))
+	mux.Handle("/v1/models", middlewareSet.DefaultChain().Handler(modelsHandler))
+	mux.Handle("/v1/models/", middlewareSet.DefaultChain().Handler(modelsHandler))
+	mux.Handle("/v1/messages/ws", middlewareSet.WebSocketChain().Handler(webSocketHandler))
+	mux.Handle("/", middlewareSet.ProxyChain().Handler(proxyHandler))
 
 	return mux
 }
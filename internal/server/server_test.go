@@ -0,0 +1,450 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+	"github.com/mihaisavezi/claude-code-open/internal/handlers"
+	"github.com/mihaisavezi/claude-code-open/internal/providers"
+)
+
+func TestServer_ShutdownDrainsStreamingRequests(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Upstream streams a response slowly
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"chunk\":%d}\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "anthropic", APIBase: upstream.URL, APIKey: "test-key"},
+		},
+		DomainMappings:     map[string]string{"127.0.0.1": "anthropic"},
+		StreamPingInterval: -1,
+		StreamDrainTimeout: 10,
+	}))
+
+	srv := New(cfgMgr, logger)
+	srv.shutdownTimeout = 100 * time.Millisecond
+
+	proxy := httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	srv.server = proxy.Config
+
+	resp, err := http.Post(proxy.URL+"/v1/messages", "application/json",
+		strings.NewReader(`{"model":"anthropic,claude-sonnet-4","stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Shut down while the stream is still in flight
+	shutdownErr := make(chan error, 1)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		shutdownErr <- srv.Stop()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "stream should not be cut off by shutdown")
+
+	assert.Contains(t, string(body), `{"chunk":4}`)
+	assert.Contains(t, string(body), "event: message_stop", "stream should complete")
+	assert.NoError(t, <-shutdownErr)
+
+	// New connections are refused once shut down
+	_, err = http.Get(proxy.URL + "/health")
+	assert.Error(t, err)
+}
+
+func TestServer_StreamsEventsBeforeUpstreamFinishes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n")
+		w.(http.Flusher).Flush()
+
+		// The rest of the stream waits until the client has seen the first event
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "anthropic", APIBase: upstream.URL, APIKey: "test-key"},
+		},
+		DomainMappings:     map[string]string{"127.0.0.1": "anthropic"},
+		StreamPingInterval: -1,
+	}))
+
+	srv := New(cfgMgr, logger)
+
+	proxy := httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	// Runs before the proxy closes, which waits for the handler and so for the upstream
+	defer close(release)
+
+	// Without flushing, not even the headers would arrive before the upstream finishes
+	firstEvent := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Post(proxy.URL+"/v1/messages", "application/json",
+			strings.NewReader(`{"model":"anthropic,claude-sonnet-4","stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+		if err != nil {
+			firstEvent <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		firstEvent <- line
+	}()
+
+	select {
+	case line := <-firstEvent:
+		assert.Equal(t, "event: message_start\n", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("first event was held back until the upstream finished")
+	}
+}
+
+func TestServer_MockProviderStreamsEndToEnd(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{
+			{Name: "mock", APIBase: "mock://mock"},
+		},
+		Mock: config.MockConfig{
+			Text: "Reading the file now.",
+			ToolCalls: []config.MockToolCall{
+				{Name: "Read", Input: map[string]any{"file_path": "/tmp/notes.txt"}},
+			},
+		},
+		StreamPingInterval: -1,
+	}))
+
+	srv := New(cfgMgr, logger)
+
+	proxy := httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	resp, err := http.Post(proxy.URL+"/v1/messages", "application/json",
+		strings.NewReader(`{"model":"mock,claude-sonnet-4","stream":true,"max_tokens":100,"messages":[{"role":"user","content":"Read my notes"}]}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	stream := string(body)
+
+	var eventTypes []string
+
+	for _, line := range strings.Split(stream, "\n") {
+		if eventType, ok := strings.CutPrefix(line, "event: "); ok {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, eventTypes)
+
+	assert.Contains(t, stream, `"model":"claude-sonnet-4"`)
+	assert.Contains(t, stream, `"text":"file "`)
+	assert.Contains(t, stream, `"name":"Read"`)
+	assert.Contains(t, stream, `"partial_json":"{\"file_path\":\"/tmp/notes.txt\"}"`)
+	assert.Contains(t, stream, `"stop_reason":"tool_use"`)
+
+	// Usage flows into the stats like for any provider
+	snapshot := srv.proxy.Stats().Snapshot()
+	require.Len(t, snapshot.Models, 1)
+	assert.Equal(t, "mock", snapshot.Models[0].Provider)
+	assert.Equal(t, int64(5), snapshot.Models[0].OutputTokens)
+}
+
+func TestServer_MockProviderRequiresOptIn(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{StreamPingInterval: -1}))
+
+	request := `{"model":"mock,test","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`
+
+	srv := New(cfgMgr, logger)
+	proxy := httptest.NewServer(srv.setupRoutes())
+
+	resp, err := http.Post(proxy.URL+"/v1/messages", "application/json", strings.NewReader(request))
+	require.NoError(t, err)
+	resp.Body.Close()
+	proxy.Close()
+
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode, "mock is not registered without --mock or a mock provider")
+
+	// --mock
+	srv = New(cfgMgr, logger)
+	srv.EnableMockProvider()
+
+	proxy = httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	resp, err = http.Post(proxy.URL+"/v1/messages", "application/json", strings.NewReader(request))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), providers.DefaultMockText)
+	assert.Contains(t, string(body), `"stop_reason":"end_turn"`)
+}
+
+func TestServer_ReloadsConfigOnSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not available on Windows")
+	}
+
+	t.Setenv("CCO_API_KEY", "")
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "old-key"}},
+	}))
+
+	srv := New(cfgMgr, logger)
+	require.Equal(t, "old-key", cfgMgr.Get().Providers[0].APIKey)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.handleReloadSignals(ctx, signals)
+
+	// Rewrite the file behind the manager's back, as an editor or deploy tool would
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "new-key"}},
+		Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+	}))
+
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, self.Signal(syscall.SIGHUP))
+
+	assert.Eventually(t, func() bool {
+		return cfgMgr.Get().Providers[0].APIKey == "new-key"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A broken file is reported and the loaded configuration is kept
+	require.NoError(t, os.WriteFile(cfgMgr.GetPath(), []byte("providers: [unterminated"), 0o600))
+	_, err = srv.reloadConfig()
+	require.Error(t, err)
+	assert.Equal(t, "new-key", cfgMgr.Get().Providers[0].APIKey)
+
+	// So is a file that loads but does not validate, domain mappings included
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		Providers:      []config.Provider{{Name: "openai"}},
+		Router:         config.RouterConfig{Default: "openai,gpt-4o"},
+		DomainMappings: map[string]string{"llm.internal.example": "openai"},
+	}))
+
+	_, err = srv.reloadConfig()
+	require.ErrorContains(t, err, "API key is required")
+	assert.Equal(t, "new-key", cfgMgr.Get().Providers[0].APIKey)
+
+	_, err = srv.registry.GetByDomain("https://llm.internal.example/v1/chat/completions")
+	assert.Error(t, err, "domain mappings of a rejected file should not be applied")
+
+	// A valid file brings its domain mappings along
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		Providers:      []config.Provider{{Name: "openai", APIKey: "newer-key"}},
+		Router:         config.RouterConfig{Default: "openai,gpt-4o"},
+		DomainMappings: map[string]string{"llm.internal.example": "openai"},
+	}))
+
+	_, err = srv.reloadConfig()
+	require.NoError(t, err)
+
+	provider, err := srv.registry.GetByDomain("https://llm.internal.example/v1/chat/completions")
+	require.NoError(t, err)
+	assert.Equal(t, "openai", provider.Name())
+}
+
+func TestServer_ReloadKeylessLocalProvider(t *testing.T) {
+	t.Setenv("CCO_API_KEY", "")
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "old-key"}},
+		Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+	}))
+
+	srv := New(cfgMgr, logger)
+
+	// An LM Studio only configuration has no API key at all
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		Providers: []config.Provider{{Name: "lmstudio", Models: []string{"qwen3-coder"}}},
+		Router:    config.RouterConfig{Default: "lmstudio,qwen3-coder"},
+	}))
+
+	_, err := srv.reloadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfgMgr.Get().Providers, 1)
+	assert.Equal(t, "lmstudio", cfgMgr.Get().Providers[0].Name)
+}
+
+func TestServer_AdminReload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		APIKey:    "proxy-key",
+		Providers: []config.Provider{{Name: "openai", APIKey: "old-key"}},
+	}))
+
+	srv := New(cfgMgr, logger)
+	proxy := httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	reload := func(method, apiKey string) (int, handlers.ReloadSummary) {
+		req, err := http.NewRequest(method, proxy.URL+"/admin/reload", nil)
+		require.NoError(t, err)
+
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var summary handlers.ReloadSummary
+		if resp.Header.Get("Content-Type") == "application/json" {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+		}
+
+		return resp.StatusCode, summary
+	}
+
+	status, _ := reload(http.MethodPost, "")
+	assert.Equal(t, http.StatusUnauthorized, status, "reloading requires the proxy API key")
+
+	status, _ = reload(http.MethodGet, "proxy-key")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// Rewrite the file behind the manager's back, as a deploy tool would
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		APIKey: "proxy-key",
+		Providers: []config.Provider{
+			{Name: "openai", APIKey: "new-key"},
+			{Name: "work-proxy", APIBase: "https://llm.internal.example/v1/chat/completions", APIKey: "work-key", Models: []string{"llama-3"}},
+		},
+		Router: config.RouterConfig{Default: "work-proxy,llama-3"},
+	}))
+
+	status, summary := reload(http.MethodPost, "proxy-key")
+	require.Equal(t, http.StatusOK, status, summary.Error)
+	assert.True(t, summary.Reloaded)
+	require.Len(t, summary.Providers, 2)
+	assert.Equal(t, "openai", summary.Providers[0].Name)
+	assert.NotEmpty(t, summary.Providers[0].DefaultModels)
+	assert.Equal(t, []string{"llama-3"}, summary.Providers[1].Models)
+	assert.Equal(t, "work-proxy,llama-3", summary.Router.Default)
+	assert.Equal(t, "new-key", cfgMgr.Get().Providers[0].APIKey)
+
+	// A broken file is reported and the loaded configuration is kept
+	require.NoError(t, os.WriteFile(cfgMgr.GetPath(), []byte("providers: [unterminated"), 0o600))
+
+	status, summary = reload(http.MethodPost, "proxy-key")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.False(t, summary.Reloaded)
+	assert.Contains(t, summary.Error, "YAML")
+	assert.Equal(t, "new-key", cfgMgr.Get().Providers[0].APIKey)
+	assert.Len(t, cfgMgr.Get().Providers, 2)
+}
+
+func TestServer_AdminReloadRequiresCredentials(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "old-key"}},
+		Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+	}))
+
+	srv := New(cfgMgr, logger)
+	proxy := httptest.NewServer(srv.setupRoutes())
+	defer proxy.Close()
+
+	require.NoError(t, config.NewManager(filepath.Dir(cfgMgr.GetPath())).Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "new-key"}},
+		Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+	}))
+
+	resp, err := http.Post(proxy.URL+"/admin/reload", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "an unprotected proxy should not reload over HTTP")
+	assert.Equal(t, "old-key", cfgMgr.Get().Providers[0].APIKey)
+}
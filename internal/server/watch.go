@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay coalesces the burst of events a single save produces into one reload
+const configReloadDelay = 100 * time.Millisecond
+
+// watchConfigFile reloads the configuration when its file changes, until ctx is done.
+// The config directory is watched rather than the file: editors that save by writing a
+// temporary file and renaming it over the config replace the file's inode, and a watch
+// on the file itself stops firing after the first such save.
+func (s *Server) watchConfigFile(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create config watcher: %w", err)
+	}
+
+	dir := filepath.Dir(s.config.GetPath())
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch config directory %s: %w", dir, err)
+	}
+
+	// A config given by path has only one of the two files
+	names := make(map[string]bool)
+
+	for _, path := range []string{s.config.GetYAMLPath(), s.config.GetJSONPath()} {
+		if path != "" {
+			names[filepath.Base(path)] = true
+		}
+	}
+
+	go s.handleConfigEvents(ctx, watcher, names)
+
+	return nil
+}
+
+// handleConfigEvents reloads the configuration once events for the config files settle
+func (s *Server) handleConfigEvents(ctx context.Context, watcher *fsnotify.Watcher, names map[string]bool) {
+	defer watcher.Close()
+
+	timer := time.NewTimer(configReloadDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !names[filepath.Base(event.Name)] || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			timer.Reset(configReloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			s.logger.Warn("Config watcher error", "error", err)
+		case <-timer.C:
+			// Between the remove and the create of a save there is briefly no file
+			if !s.config.Exists() {
+				continue
+			}
+
+			if _, err := s.reloadConfig(); err != nil {
+				s.logger.Error("Configuration reload failed, keeping the current configuration", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mihaisavezi/claude-code-open/internal/config"
+)
+
+func TestServer_WatchConfigFileSurvivesAtomicSaves(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfgMgr := config.NewManager(t.TempDir())
+	require.NoError(t, cfgMgr.Save(&config.Config{
+		Providers: []config.Provider{{Name: "openai", APIKey: "key-0"}},
+		Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+	}))
+
+	srv := New(cfgMgr, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, srv.watchConfigFile(ctx))
+
+	// Save the way editors do: write a temporary file, then rename it over the config.
+	// Each rename replaces the file, so a second save only reloads when the directory is watched.
+	for _, key := range []string{"key-1", "key-2"} {
+		scratch := config.NewManager(t.TempDir())
+		require.NoError(t, scratch.Save(&config.Config{
+			Providers: []config.Provider{{Name: "openai", APIKey: key}},
+			Router:    config.RouterConfig{Default: "openai,gpt-4o"},
+		}))
+
+		temp := filepath.Join(filepath.Dir(cfgMgr.GetPath()), ".config.yaml.swp")
+		data, err := os.ReadFile(scratch.GetPath())
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(temp, data, 0o600))
+		require.NoError(t, os.Rename(temp, cfgMgr.GetPath()))
+
+		assert.Eventually(t, func() bool {
+			return cfgMgr.Get().Providers[0].APIKey == key
+		}, 2*time.Second, 10*time.Millisecond, "config should reload after saving %s", key)
+	}
+}